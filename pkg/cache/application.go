@@ -32,6 +32,7 @@ import (
 	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
 	"github.com/cloudera/yunikorn-k8shim/pkg/dispatcher"
 	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+	"github.com/cloudera/yunikorn-k8shim/pkg/metrics"
 	"github.com/cloudera/yunikorn-scheduler-interface/lib/go/si"
 )
 
@@ -43,6 +44,7 @@ type Application struct {
 	taskMap       map[string]*Task
 	tags          map[string]string
 	sm            *fsm.FSM
+	history       *events.StateHistory
 	lock          *sync.RWMutex
 	ch            CompletionHandler
 	schedulerAPI  api.SchedulerAPI
@@ -63,6 +65,7 @@ func NewApplication(appID, queueName, user string, tags map[string]string, sched
 		user:          user,
 		taskMap:       taskMap,
 		tags:          tags,
+		history:       events.NewStateHistory(events.ObjectApplication, appID),
 		lock:          &sync.RWMutex{},
 		ch:            CompletionHandler{running: false},
 		schedulerAPI:  scheduler,
@@ -105,12 +108,20 @@ func NewApplication(appID, queueName, user string, tags map[string]string, sched
 			string(events.RecoverApplication):  app.handleRecoverApplicationEvent,
 			string(events.RejectApplication):   app.handleRejectApplicationEvent,
 			string(events.CompleteApplication): app.handleCompleteApplicationEvent,
+			events.EnterState:                  app.onStateChange,
 		},
 	)
+	metrics.GetShimMetrics().IncApplicationsInState(states.New)
 
 	return app
 }
 
+// this is called every time the application enters a new state
+func (app *Application) onStateChange(event *fsm.Event) {
+	app.history.OnEnterState(event)
+	metrics.GetShimMetrics().MoveApplicationState(event.Src, event.Dst)
+}
+
 func (app *Application) handle(ev events.ApplicationEvent) error {
 	// Locking mechanism:
 	// 1) when handle event transitions, we first obtain the object's lock,
@@ -123,7 +134,7 @@ func (app *Application) handle(ev events.ApplicationEvent) error {
 	//    because the lock is already held here.
 	app.lock.Lock()
 	defer app.lock.Unlock()
-	log.Logger.Debug("application state transition",
+	log.Log(log.Cache).Debug("application state transition",
 		zap.String("appID", app.applicationID),
 		zap.String("preState", app.sm.Current()),
 		zap.String("pendingEvent", string(ev.GetEvent())))
@@ -132,7 +143,7 @@ func (app *Application) handle(ev events.ApplicationEvent) error {
 	if err != nil && err.Error() != "no transition" {
 		return err
 	}
-	log.Logger.Debug("application state transition",
+	log.Log(log.Cache).Debug("application state transition",
 		zap.String("appID", app.applicationID),
 		zap.String("postState", app.sm.Current()))
 	return nil
@@ -166,6 +177,18 @@ func (app *Application) GetQueue() string {
 	return app.queue
 }
 
+func (app *Application) GetPartition() string {
+	app.lock.RLock()
+	defer app.lock.RUnlock()
+	return app.partition
+}
+
+func (app *Application) GetUser() string {
+	app.lock.RLock()
+	defer app.lock.RUnlock()
+	return app.user
+}
+
 func (app *Application) AddTask(task *Task) {
 	app.lock.Lock()
 	defer app.lock.Unlock()
@@ -180,6 +203,11 @@ func (app *Application) GetApplicationState() string {
 	return app.sm.Current()
 }
 
+// returns the recorded state transitions of this application, from the oldest to the latest
+func (app *Application) GetStateHistory() []events.StateTransition {
+	return app.history.GetTransitions()
+}
+
 func (app *Application) GetPendingTasks() []*Task {
 	app.lock.RLock()
 	defer app.lock.RUnlock()
@@ -198,6 +226,29 @@ func (app *Application) GetAllocatedTasks() []*Task {
 	return app.getTasks(events.States().Task.Allocated)
 }
 
+// removes the application and its tasks from the state metrics,
+// this is called when the application is removed from the context.
+func (app *Application) discard() {
+	app.lock.RLock()
+	defer app.lock.RUnlock()
+	shimMetrics := metrics.GetShimMetrics()
+	for _, task := range app.taskMap {
+		shimMetrics.DecTasksInState(task.GetTaskState())
+	}
+	shimMetrics.DecApplicationsInState(app.sm.Current())
+}
+
+// returns all tasks of this application, regardless of their states
+func (app *Application) GetAllTasks() []*Task {
+	app.lock.RLock()
+	defer app.lock.RUnlock()
+	taskList := make([]*Task, 0, len(app.taskMap))
+	for _, task := range app.taskMap {
+		taskList = append(taskList, task)
+	}
+	return taskList
+}
+
 func (app *Application) getTasks(state string) []*Task {
 	taskList := make([]*Task, 0)
 	if len(app.taskMap) > 0 {
@@ -222,13 +273,13 @@ func (app *Application) Schedule() {
 	case states.New:
 		ev := NewSubmitApplicationEvent(app.GetApplicationID())
 		if err := app.handle(ev); err != nil {
-			log.Logger.Warn("failed to handle SUBMIT app event",
+			log.Log(log.Cache).Warn("failed to handle SUBMIT app event",
 				zap.Error(err))
 		}
 	case states.Accepted:
 		ev := NewRunApplicationEvent(app.GetApplicationID())
 		if err := app.handle(ev); err != nil {
-			log.Logger.Warn("failed to handle RUN app event",
+			log.Log(log.Cache).Warn("failed to handle RUN app event",
 				zap.Error(err))
 		}
 	case states.Running:
@@ -243,10 +294,10 @@ func (app *Application) Schedule() {
 						// something goes wrong when transit task to PENDING state,
 						// this should not happen because we already checked the state
 						// before calling the transition. Nowhere to go, just log the error.
-						log.Logger.Warn("init task failed", zap.Error(err))
+						log.Log(log.Cache).Warn("init task failed", zap.Error(err))
 					}
 				} else {
-					log.Logger.Debug("task is not ready for scheduling",
+					log.Log(log.Cache).Debug("task is not ready for scheduling",
 						zap.String("appID", task.applicationID),
 						zap.String("taskID", task.taskID),
 						zap.Error(err))
@@ -254,14 +305,14 @@ func (app *Application) Schedule() {
 			}
 		}
 	default:
-		log.Logger.Debug("skipping scheduling application",
+		log.Log(log.Cache).Debug("skipping scheduling application",
 			zap.String("appID", app.GetApplicationID()),
 			zap.String("appState", app.GetApplicationState()))
 	}
 }
 
 func (app *Application) handleSubmitApplicationEvent(event *fsm.Event) {
-	log.Logger.Info("handle app submission",
+	log.Log(log.Cache).Info("handle app submission",
 		zap.String("app", app.String()),
 		zap.String("clusterID", conf.GetSchedulerConf().ClusterID))
 	err := app.schedulerAPI.Update(
@@ -282,13 +333,13 @@ func (app *Application) handleSubmitApplicationEvent(event *fsm.Event) {
 
 	if err != nil {
 		// submission failed
-		log.Logger.Warn("failed to submit app", zap.Error(err))
+		log.Log(log.Cache).Warn("failed to submit app", zap.Error(err))
 		dispatcher.Dispatch(NewFailApplicationEvent(app.applicationID))
 	}
 }
 
 func (app *Application) handleRecoverApplicationEvent(event *fsm.Event) {
-	log.Logger.Info("handle app recovering",
+	log.Log(log.Cache).Info("handle app recovering",
 		zap.String("app", app.String()),
 		zap.String("clusterID", conf.GetSchedulerConf().ClusterID))
 	err := app.schedulerAPI.Update(
@@ -309,13 +360,13 @@ func (app *Application) handleRecoverApplicationEvent(event *fsm.Event) {
 
 	if err != nil {
 		// submission failed
-		log.Logger.Warn("failed to submit app", zap.Error(err))
+		log.Log(log.Cache).Warn("failed to submit app", zap.Error(err))
 		dispatcher.Dispatch(NewFailApplicationEvent(app.applicationID))
 	}
 }
 
 func (app *Application) handleRejectApplicationEvent(event *fsm.Event) {
-	log.Logger.Info("app is rejected by scheduler", zap.String("appID", app.applicationID))
+	log.Log(log.Cache).Info("app is rejected by scheduler", zap.String("appID", app.applicationID))
 	// for rejected apps, we directly move them to failed state
 	dispatcher.Dispatch(NewFailApplicationEvent(app.applicationID))
 }
@@ -345,7 +396,7 @@ func (app *Application) startCompletionHandler(client client.KubeClient, pod *v1
 
 func (app *Application) startSparkCompletionHandler(client client.KubeClient, pod *v1.Pod) {
 	// spark driver pod
-	log.Logger.Info("start app completion handler",
+	log.Log(log.Cache).Info("start app completion handler",
 		zap.String("pod", pod.Name),
 		zap.String("appID", app.applicationID))
 	if app.ch.running {
@@ -356,7 +407,7 @@ func (app *Application) startSparkCompletionHandler(client client.KubeClient, po
 		completeFn: func() {
 			podWatch, err := client.GetClientSet().CoreV1().Pods(pod.Namespace).Watch(metav1.ListOptions{Watch: true})
 			if err != nil {
-				log.Logger.Info("unable to create Watch for pod",
+				log.Log(log.Cache).Info("unable to create Watch for pod",
 					zap.String("pod", pod.Name),
 					zap.Error(err))
 				return
@@ -365,11 +416,11 @@ func (app *Application) startSparkCompletionHandler(client client.KubeClient, po
 			for targetPod := range podWatch.ResultChan() {
 				resp, ok := targetPod.Object.(*v1.Pod)
 				if !ok {
-					log.Logger.Debug("cast failed unexpected object",
+					log.Log(log.Cache).Debug("cast failed unexpected object",
 						zap.Any("PodObject", targetPod.Object))
 				}
 				if resp.Status.Phase == v1.PodSucceeded && resp.UID == pod.UID {
-					log.Logger.Info("spark driver completed, app completed",
+					log.Log(log.Cache).Info("spark driver completed, app completed",
 						zap.String("pod", resp.Name),
 						zap.String("appID", app.applicationID))
 					dispatcher.Dispatch(NewSimpleApplicationEvent(app.applicationID, events.CompleteApplication))
@@ -94,6 +94,28 @@ func TestRunApplication(t *testing.T) {
 	assertAppState(t, app, events.States().Application.Submitted, 3*time.Second)
 }
 
+func TestApplicationStateHistory(t *testing.T) {
+	app := NewApplication("app00001", "root.abc", "testuser", map[string]string{}, newMockSchedulerAPI())
+	assert.Equal(t, len(app.GetStateHistory()), 0)
+
+	err := app.handle(NewSubmitApplicationEvent(app.applicationID))
+	assert.NilError(t, err)
+	err = app.handle(NewSimpleApplicationEvent(app.applicationID, events.AcceptApplication))
+	assert.NilError(t, err)
+	// invalid transition is not recorded
+	err = app.handle(NewSubmitApplicationEvent(app.applicationID))
+	assert.Assert(t, err != nil)
+
+	history := app.GetStateHistory()
+	assert.Equal(t, len(history), 2)
+	assert.Equal(t, history[0].ObjectID, "app00001")
+	assert.Equal(t, history[0].From, events.States().Application.New)
+	assert.Equal(t, history[0].To, events.States().Application.Submitted)
+	assert.Equal(t, history[0].Event, string(events.SubmitApplication))
+	assert.Equal(t, history[1].From, events.States().Application.Submitted)
+	assert.Equal(t, history[1].To, events.States().Application.Accepted)
+}
+
 func TestGetApplicationIDFromPod(t *testing.T) {
 	// defined in label
 	pod := v1.Pod{
@@ -0,0 +1,254 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/events"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/utils"
+	"github.com/cloudera/yunikorn-k8shim/pkg/dispatcher"
+	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+	"github.com/cloudera/yunikorn-k8shim/pkg/metrics"
+)
+
+// the inconsistencies found between the scheduler cache, the tasks in the context and the informers,
+// the informers are taken as the source of truth.
+type CacheInconsistencies struct {
+	// assigned pods of the scheduler which are not cached on the nodes they are assigned to
+	MissingPods []*v1.Pod
+	// assumed pods which are deleted, or which the informer already reports as assigned,
+	// the cached state of the pods
+	StaleAssumedPods []*v1.Pod
+	// pods cached on the nodes which are deleted and not assumed, the cached state of the pods
+	RedundantPods []*v1.Pod
+	// tasks which are not finished while their pods are deleted
+	OrphanTasks []*Task
+	// nodes which are not in the cache
+	MissingNodes []*v1.Node
+	// nodes which changed since they were cached, the state reported by the informer
+	StaleNodes []*v1.Node
+	// nodes in the cache which are deleted, the cached state of the nodes
+	RedundantNodes []*v1.Node
+}
+
+func (c *CacheInconsistencies) IsConsistent() bool {
+	return len(c.MissingPods) == 0 && len(c.StaleAssumedPods) == 0 && len(c.RedundantPods) == 0 &&
+		len(c.OrphanTasks) == 0 && len(c.MissingNodes) == 0 && len(c.StaleNodes) == 0 &&
+		len(c.RedundantNodes) == 0
+}
+
+// compares the scheduler cache and the tasks in the context with the pods and the nodes listed
+// by the informers. The comparison is not atomic, an informer event handled while comparing
+// may show up as an inconsistency which is gone in the next comparison.
+func (ctx *Context) CompareCache() (*CacheInconsistencies, error) {
+	// the informers are never started in test mode, their content is set by the tests
+	if !ctx.testMode && !ctx.InformersSynced() {
+		return nil, fmt.Errorf("the cache is not compared before the informers are synced")
+	}
+	nodes, err := ctx.nodeInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	pods, err := ctx.podInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CacheInconsistencies{}
+	snapshot := ctx.schedulerCache.Snapshot()
+
+	// nodes
+	nodeNames := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		nodeNames[node.Name] = true
+		nodeInfo, ok := snapshot.NodeInfos[node.Name]
+		switch {
+		case !ok || nodeInfo.Node() == nil:
+			result.MissingNodes = append(result.MissingNodes, node)
+		case nodeInfo.Node().ResourceVersion != node.ResourceVersion:
+			result.StaleNodes = append(result.StaleNodes, node)
+		}
+	}
+	for name, nodeInfo := range snapshot.NodeInfos {
+		// the nodes only known from the pods assigned to them are not real nodes
+		if nodeInfo.Node() != nil && !nodeNames[name] {
+			result.RedundantNodes = append(result.RedundantNodes, nodeInfo.Node())
+		}
+	}
+
+	// pods
+	podsByUID := make(map[string]*v1.Pod, len(pods))
+	for _, pod := range pods {
+		podsByUID[string(pod.UID)] = pod
+	}
+	// the nodes the pods are cached on
+	cachedPods := make(map[string]string)
+	assumedPods := ctx.schedulerCache.GetAssumedPods()
+	for name, nodeInfo := range snapshot.NodeInfos {
+		for _, pod := range nodeInfo.Pods() {
+			key := string(pod.UID)
+			cachedPods[key] = name
+			// the assumed pods are checked separately
+			if _, assumed := assumedPods[key]; !assumed {
+				if _, ok := podsByUID[key]; !ok {
+					result.RedundantPods = append(result.RedundantPods, pod)
+				}
+			}
+		}
+	}
+	for _, pod := range pods {
+		if !utils.IsSchedulablePod(pod) || !utils.IsAssignedPod(pod) {
+			continue
+		}
+		// the assumed pods are checked separately
+		if _, assumed := assumedPods[string(pod.UID)]; !assumed && cachedPods[string(pod.UID)] != pod.Spec.NodeName {
+			result.MissingPods = append(result.MissingPods, pod)
+		}
+	}
+	for key := range assumedPods {
+		cachedPod, ok := ctx.schedulerCache.GetPod(key)
+		if !ok {
+			// the pod is forgotten in the meantime
+			continue
+		}
+		// the pod of an assumed pod is still pending while it is being bound
+		if pod, ok := podsByUID[key]; !ok || utils.IsAssignedPod(pod) {
+			result.StaleAssumedPods = append(result.StaleAssumedPods, cachedPod)
+		}
+	}
+
+	// tasks
+	for _, app := range ctx.SelectApplications(nil) {
+		for _, task := range app.GetAllTasks() {
+			if isTaskFinished(task) {
+				continue
+			}
+			if _, ok := podsByUID[string(task.GetTaskPod().UID)]; !ok {
+				result.OrphanTasks = append(result.OrphanTasks, task)
+			}
+		}
+	}
+	return result, nil
+}
+
+func isTaskFinished(task *Task) bool {
+	switch task.GetTaskState() {
+	case events.States().Task.Completed, events.States().Task.Failed,
+		events.States().Task.Rejected, events.States().Task.Killed:
+		return true
+	default:
+		return false
+	}
+}
+
+// repairs the inconsistencies found by CompareCache, the changes are made the same
+// way as the informer events missed by the cache would have made them.
+func (ctx *Context) HealCache(inconsistencies *CacheInconsistencies) {
+	// the nodes first, so that the pods are added to existing nodes
+	for _, node := range inconsistencies.MissingNodes {
+		log.Log(log.Cache).Info("healing cache: adding missing node", zap.String("nodeName", node.Name))
+		ctx.addNode(node)
+	}
+	for _, node := range inconsistencies.StaleNodes {
+		if cachedNode := ctx.schedulerCache.GetNode(node.Name); cachedNode != nil && cachedNode.Node() != nil {
+			log.Log(log.Cache).Info("healing cache: updating stale node", zap.String("nodeName", node.Name))
+			ctx.updateNode(cachedNode.Node(), node)
+		}
+	}
+	for _, node := range inconsistencies.RedundantNodes {
+		log.Log(log.Cache).Info("healing cache: deleting redundant node", zap.String("nodeName", node.Name))
+		ctx.deleteNode(node)
+	}
+	for _, pod := range inconsistencies.MissingPods {
+		log.Log(log.Cache).Info("healing cache: adding missing pod",
+			zap.String("podName", pod.Name),
+			zap.String("nodeName", pod.Spec.NodeName))
+		if err := ctx.schedulerCache.ReplacePod(pod); err != nil {
+			log.Log(log.Cache).Error("failed to add missing pod", zap.Error(err))
+		}
+	}
+	for _, cachedPod := range inconsistencies.StaleAssumedPods {
+		pod, err := ctx.podInformer.Lister().Pods(cachedPod.Namespace).Get(cachedPod.Name)
+		if err == nil && pod.UID == cachedPod.UID && utils.IsAssignedPod(pod) {
+			log.Log(log.Cache).Info("healing cache: confirming assumed pod",
+				zap.String("podName", pod.Name),
+				zap.String("nodeName", pod.Spec.NodeName))
+			err = ctx.schedulerCache.ReplacePod(pod)
+		} else {
+			log.Log(log.Cache).Info("healing cache: forgetting assumed pod of a deleted pod",
+				zap.String("podName", cachedPod.Name))
+			err = ctx.schedulerCache.ForgetPod(cachedPod)
+		}
+		if err != nil {
+			log.Log(log.Cache).Error("failed to heal assumed pod", zap.Error(err))
+		}
+	}
+	for _, pod := range inconsistencies.RedundantPods {
+		log.Log(log.Cache).Info("healing cache: removing pod of a deleted pod",
+			zap.String("podName", pod.Name),
+			zap.String("nodeName", pod.Spec.NodeName))
+		if err := ctx.schedulerCache.RemovePod(pod); err != nil {
+			log.Log(log.Cache).Error("failed to remove redundant pod", zap.Error(err))
+		}
+	}
+	for _, task := range inconsistencies.OrphanTasks {
+		log.Log(log.Cache).Info("healing cache: completing task of a deleted pod",
+			zap.String("appID", task.GetApplicationID()),
+			zap.String("taskID", task.GetTaskID()))
+		ctx.diagnostics.remove(task.GetTaskID())
+		dispatcher.Dispatch(NewSimpleTaskEvent(task.GetApplicationID(), task.GetTaskID(), events.CompleteTask))
+	}
+}
+
+// compares the cache with the informers, the inconsistencies are logged and
+// reported in the metrics, they are repaired if heal is set.
+func (ctx *Context) checkCache(heal bool) {
+	inconsistencies, err := ctx.CompareCache()
+	if err != nil {
+		log.Log(log.Cache).Debug("cache check skipped", zap.Error(err))
+		return
+	}
+	shimMetrics := metrics.GetShimMetrics()
+	shimMetrics.SetCacheInconsistencies(metrics.InconsistencyMissingPod, len(inconsistencies.MissingPods))
+	shimMetrics.SetCacheInconsistencies(metrics.InconsistencyStaleAssumedPod, len(inconsistencies.StaleAssumedPods))
+	shimMetrics.SetCacheInconsistencies(metrics.InconsistencyRedundantPod, len(inconsistencies.RedundantPods))
+	shimMetrics.SetCacheInconsistencies(metrics.InconsistencyOrphanTask, len(inconsistencies.OrphanTasks))
+	shimMetrics.SetCacheInconsistencies(metrics.InconsistencyMissingNode, len(inconsistencies.MissingNodes))
+	shimMetrics.SetCacheInconsistencies(metrics.InconsistencyStaleNode, len(inconsistencies.StaleNodes))
+	shimMetrics.SetCacheInconsistencies(metrics.InconsistencyRedundantNode, len(inconsistencies.RedundantNodes))
+	if inconsistencies.IsConsistent() {
+		log.Log(log.Cache).Debug("cache is consistent with the informers")
+		return
+	}
+	log.Log(log.Cache).Warn("cache is inconsistent with the informers",
+		zap.Int("missingPods", len(inconsistencies.MissingPods)),
+		zap.Int("staleAssumedPods", len(inconsistencies.StaleAssumedPods)),
+		zap.Int("redundantPods", len(inconsistencies.RedundantPods)),
+		zap.Int("orphanTasks", len(inconsistencies.OrphanTasks)),
+		zap.Int("missingNodes", len(inconsistencies.MissingNodes)),
+		zap.Int("staleNodes", len(inconsistencies.StaleNodes)),
+		zap.Int("redundantNodes", len(inconsistencies.RedundantNodes)),
+		zap.Bool("heal", heal))
+	if heal {
+		ctx.HealCache(inconsistencies)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	v1 "k8s.io/api/core/v1"
+	apis "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/common"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/events"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/test"
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+	"github.com/cloudera/yunikorn-k8shim/pkg/dispatcher"
+)
+
+func newComparerTestNode(name string, resourceVersion string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: apis.ObjectMeta{
+			Name:            name,
+			UID:             types.UID("uid_" + name),
+			ResourceVersion: resourceVersion,
+		},
+	}
+}
+
+func newTestPod(name string, nodeName string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: apis.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			UID:       types.UID("uid_" + name),
+		},
+		Spec: v1.PodSpec{
+			SchedulerName: fakeClusterSchedulerName,
+			NodeName:      nodeName,
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodPending,
+		},
+	}
+}
+
+func namesOfPods(pods []*v1.Pod) []string {
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	return names
+}
+
+func namesOfNodes(nodes []*v1.Node) []string {
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	return names
+}
+
+func TestCompareCache(t *testing.T) {
+	configs := &conf.SchedulerConf{
+		ClusterID:     fakeClusterID,
+		SchedulerName: fakeClusterSchedulerName,
+		TestMode:      true,
+	}
+	conf.Set(configs)
+	schedulerAPI := test.NewSchedulerAPIMock()
+	context := NewContextInternal(schedulerAPI, configs, test.NewKubeClientMock(), true)
+	dispatcher.RegisterEventHandler(dispatcher.EventTypeApp, context.ApplicationEventHandler())
+	dispatcher.RegisterEventHandler(dispatcher.EventTypeTask, context.TaskEventHandler())
+	dispatcher.RegisterEventHandler(dispatcher.EventTypeNode, context.SchedulerNodeEventHandler())
+	dispatcher.Start()
+	defer dispatcher.Stop()
+	defer func() {
+		assert.NilError(t, context.DrainAsyncOperations(time.Second))
+	}()
+	nodeIndexer := context.nodeInformer.Informer().GetIndexer()
+	podIndexer := context.podInformer.Informer().GetIndexer()
+
+	inconsistencies, err := context.CompareCache()
+	assert.NilError(t, err)
+	assert.Assert(t, inconsistencies.IsConsistent())
+
+	// node-1 is consistent, node-2 is missing, node-3 is deleted and node-4 is changed
+	for _, node := range []*v1.Node{newComparerTestNode("node-1", "1"),
+		newComparerTestNode("node-2", "1"), newComparerTestNode("node-4", "2")} {
+		assert.NilError(t, nodeIndexer.Add(node))
+	}
+	context.schedulerCache.AddNode(newComparerTestNode("node-1", "1"))
+	context.schedulerCache.AddNode(newComparerTestNode("node-3", "1"))
+	context.schedulerCache.AddNode(newComparerTestNode("node-4", "1"))
+
+	// pod-1 is consistent and pod-2 is missing
+	pod1 := newTestPod("pod-1", "node-1")
+	assert.NilError(t, podIndexer.Add(pod1))
+	assert.NilError(t, context.schedulerCache.AddPod(pod1))
+	assert.NilError(t, podIndexer.Add(newTestPod("pod-2", "node-1")))
+	// pod-3 is being bound, pod-4 is deleted and pod-5 is bound already
+	for _, name := range []string{"pod-3", "pod-4", "pod-5"} {
+		assert.NilError(t, context.schedulerCache.AssumePod(newTestPod(name, "node-1"), true))
+	}
+	assert.NilError(t, podIndexer.Add(newTestPod("pod-3", "")))
+	assert.NilError(t, podIndexer.Add(newTestPod("pod-5", "node-1")))
+	// the delete event of pod-8 is missed
+	assert.NilError(t, context.schedulerCache.AddPod(newTestPod("pod-8", "node-1")))
+
+	// the pod of task-2 is deleted, task-3 is completed already
+	app := NewApplication("app01", "root.a", "bob", map[string]string{}, schedulerAPI)
+	context.AddApplication(app)
+	task1 := createTaskInternal("uid_pod-1", app, common.NewResourceBuilder().Build(), pod1, context)
+	task2 := createTaskInternal("uid_pod-6", app, common.NewResourceBuilder().Build(),
+		newTestPod("pod-6", "node-1"), context)
+	task3 := createTaskInternal("uid_pod-7", app, common.NewResourceBuilder().Build(),
+		newTestPod("pod-7", "node-1"), context)
+	task3.sm.SetState(events.States().Task.Completed)
+	app.AddTask(task1)
+	app.AddTask(task2)
+	app.AddTask(task3)
+
+	inconsistencies, err = context.CompareCache()
+	assert.NilError(t, err)
+	assert.Assert(t, !inconsistencies.IsConsistent())
+	assert.DeepEqual(t, namesOfNodes(inconsistencies.MissingNodes), []string{"node-2"})
+	assert.DeepEqual(t, namesOfNodes(inconsistencies.StaleNodes), []string{"node-4"})
+	assert.DeepEqual(t, namesOfNodes(inconsistencies.RedundantNodes), []string{"node-3"})
+	assert.DeepEqual(t, namesOfPods(inconsistencies.MissingPods), []string{"pod-2"})
+	assert.DeepEqual(t, namesOfPods(inconsistencies.RedundantPods), []string{"pod-8"})
+	staleAssumedPods := namesOfPods(inconsistencies.StaleAssumedPods)
+	assert.Equal(t, len(staleAssumedPods), 2)
+	assert.Assert(t, (staleAssumedPods[0] == "pod-4" && staleAssumedPods[1] == "pod-5") ||
+		(staleAssumedPods[0] == "pod-5" && staleAssumedPods[1] == "pod-4"))
+	assert.Equal(t, len(inconsistencies.OrphanTasks), 1)
+	assert.Equal(t, inconsistencies.OrphanTasks[0].GetTaskID(), "uid_pod-6")
+
+	context.HealCache(inconsistencies)
+	assertTaskState(t, task2, events.States().Task.Completed, 3*time.Second)
+	inconsistencies, err = context.CompareCache()
+	assert.NilError(t, err)
+	assert.Assert(t, inconsistencies.IsConsistent())
+
+	// the pods are on their nodes and only the pod being bound is still assumed
+	assumedPods := context.schedulerCache.GetAssumedPods()
+	assert.Equal(t, len(assumedPods), 1)
+	_, assumed := assumedPods["uid_pod-3"]
+	assert.Assert(t, assumed)
+	_, ok := context.schedulerCache.GetPod("uid_pod-4")
+	assert.Assert(t, !ok)
+	assert.Equal(t, len(context.schedulerCache.GetNode("node-1").Pods()), 4)
+	assert.Equal(t, context.schedulerCache.GetNode("node-4").Node().ResourceVersion, "2")
+	assert.Assert(t, context.schedulerCache.GetNode("node-3") == nil)
+}
@@ -17,16 +17,22 @@ limitations under the License.
 package cache
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/informers"
 	coreInfomerV1 "k8s.io/client-go/informers/core/v1"
 	storageInformerV1 "k8s.io/client-go/informers/storage/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 	podutil "k8s.io/kubernetes/pkg/api/v1/pod"
+	schedulernode "k8s.io/kubernetes/pkg/scheduler/nodeinfo"
 	"k8s.io/kubernetes/pkg/scheduler/volumebinder"
 
 	"github.com/cloudera/yunikorn-core/pkg/api"
@@ -38,9 +44,18 @@ import (
 	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
 	"github.com/cloudera/yunikorn-k8shim/pkg/dispatcher"
 	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+	"github.com/cloudera/yunikorn-k8shim/pkg/metrics"
+	"github.com/cloudera/yunikorn-k8shim/pkg/plugin/extenders"
 	plugin "github.com/cloudera/yunikorn-k8shim/pkg/plugin/predicates"
+	"github.com/cloudera/yunikorn-k8shim/pkg/plugin/priorities"
 )
 
+// interval of checking the shim config file for changes
+const configFileCheckInterval = 10 * time.Second
+
+// number of workers evaluating the nodes of a pod in parallel
+const filterWorkers = 16
+
 // context maintains scheduling state, like apps and apps' tasks.
 type Context struct {
 	applications map[string]*Application
@@ -63,6 +78,26 @@ type Context struct {
 
 	// plugged predictor handles predicates related checks
 	predictor *plugin.Predictor
+	// plugged prioritizer ranks the nodes for a pod
+	prioritizer *priorities.Prioritizer
+	// scheduler extenders called by the predictor, the prioritizer and when binding pods
+	extenders *extenders.Extenders
+
+	// queue configuration read from the configMap
+	queueConfig *queueConfig
+
+	// predicate results of the pending pods
+	diagnostics *podDiagnostics
+
+	// binding is disabled once the scheduler is no longer the leader,
+	// accessed atomically, 1 means disabled
+	bindingDisabled int32
+
+	// number of in-flight async operations, e.g binding pods, accessed atomically
+	asyncOps int32
+	// closed when the context starts draining, delayed operations are cancelled then
+	drainChan chan struct{}
+	drainOnce sync.Once
 
 	// test mode disables some functionality for UT
 	testMode bool
@@ -83,13 +118,16 @@ func NewContextInternal(scheduler api.SchedulerAPI, configs *conf.SchedulerConf,
 	// volumebinder needs the informers
 	// the cache needs informers and volumebinder
 	// nodecontroller needs the cache
-	// predictor need the cache, volumebinder and informers
+	// predictor and prioritizer need the cache, volumebinder and informers
 	ctx := &Context{
 		applications: make(map[string]*Application),
 		conf:         configs,
 		kubeClient:   client,
 		schedulerAPI: scheduler,
 		testMode:     testMode,
+		drainChan:    make(chan struct{}),
+		queueConfig:  newQueueConfig(configs.PolicyGroup),
+		diagnostics:  newPodDiagnostics(),
 		lock:         &sync.RWMutex{},
 	}
 
@@ -100,11 +138,15 @@ func NewContextInternal(scheduler api.SchedulerAPI, configs *conf.SchedulerConf,
 	// volume informers are also used to get the Listers for the predicates
 	ctx.nodeInformer = informerFactory.Core().V1().Nodes()
 	ctx.podInformer = informerFactory.Core().V1().Pods()
-	ctx.configMapInformer = informerFactory.Core().V1().ConfigMaps()
 	ctx.storageInformer = informerFactory.Storage().V1().StorageClasses()
 	ctx.pvInformer = informerFactory.Core().V1().PersistentVolumes()
 	ctx.pvcInformer = informerFactory.Core().V1().PersistentVolumeClaims()
 
+	// the scheduler configMap is only watched in the namespace of the scheduler
+	configMapInformerFactory := informers.NewSharedInformerFactoryWithOptions(
+		ctx.kubeClient.GetClientSet(), 0, informers.WithNamespace(configs.Namespace))
+	ctx.configMapInformer = configMapInformerFactory.Core().V1().ConfigMaps()
+
 	// for test mode, we skip volume binding operations for now
 	if !testMode {
 		// create a volume binder (needs the informers)
@@ -114,6 +156,8 @@ func NewContextInternal(scheduler api.SchedulerAPI, configs *conf.SchedulerConf,
 			ctx.pvInformer,
 			ctx.storageInformer,
 			ctx.conf.VolumeBindTimeout)
+		// the core loads the queue configuration through the context
+		ctx.queueConfig.install()
 	}
 
 	// create the cache
@@ -121,11 +165,14 @@ func NewContextInternal(scheduler api.SchedulerAPI, configs *conf.SchedulerConf,
 		ctx.pvInformer.Lister(),
 		ctx.pvcInformer.Lister(),
 		ctx.storageInformer.Lister(),
-		ctx.volumeBinder)
+		ctx.volumeBinder,
+		ctx.conf.AssumedPodTTL)
 
 	// init the controllers and plugins (need the cache)
 	ctx.nodes = newSchedulerNodes(scheduler, ctx.schedulerCache)
-	ctx.predictor = plugin.NewPredictor(schedulercache.GetPluginArgs(), testMode)
+	ctx.extenders = extenders.NewExtenders(testMode)
+	ctx.predictor = ctx.newPredictor()
+	ctx.prioritizer = ctx.newPrioritizer()
 
 	return ctx
 }
@@ -170,17 +217,36 @@ func (ctx *Context) AddSchedulingEventHandlers() {
 			DeleteFunc: ctx.deleteConfigMaps,
 		},
 	})
+
+	// count the raw informer events, before any filtering
+	ctx.nodeInformer.Informer().AddEventHandler(informerEventsCounter("node"))
+	ctx.podInformer.Informer().AddEventHandler(informerEventsCounter("pod"))
+	ctx.configMapInformer.Informer().AddEventHandler(informerEventsCounter("configmap"))
+}
+
+func informerEventsCounter(resource string) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			metrics.GetShimMetrics().IncInformerEvent(resource, metrics.InformerEventAdd)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			metrics.GetShimMetrics().IncInformerEvent(resource, metrics.InformerEventUpdate)
+		},
+		DeleteFunc: func(obj interface{}) {
+			metrics.GetShimMetrics().IncInformerEvent(resource, metrics.InformerEventDelete)
+		},
+	}
 }
 
 func (ctx *Context) addNode(obj interface{}) {
 	node, err := convertToNode(obj)
 	if err != nil {
-		log.Logger.Error("node conversion failed", zap.Error(err))
+		log.Log(log.Cache).Error("node conversion failed", zap.Error(err))
 		return
 	}
 
 	// add node to secondary scheduler cache
-	log.Logger.Info("adding node to cache", zap.String("NodeName", node.Name))
+	log.Log(log.Cache).Info("adding node to cache", zap.String("NodeName", node.Name))
 	ctx.schedulerCache.AddNode(node)
 
 	// add node to internal cache
@@ -195,23 +261,23 @@ func (ctx *Context) updateNode(oldObj, newObj interface{}) {
 	// we only trigger update when resource changes
 	oldNode, err := convertToNode(oldObj)
 	if err != nil {
-		log.Logger.Error("old node conversion failed",
+		log.Log(log.Cache).Error("old node conversion failed",
 			zap.Error(err))
 		return
 	}
 
 	newNode, err := convertToNode(newObj)
 	if err != nil {
-		log.Logger.Error("new node conversion failed",
+		log.Log(log.Cache).Error("new node conversion failed",
 			zap.Error(err))
 		return
 	}
 
 	// update secondary cache
-	log.Logger.Debug("updating node in cache",
+	log.Log(log.Cache).Debug("updating node in cache",
 		zap.String("OldNodeName", oldNode.Name))
 	if err := ctx.schedulerCache.UpdateNode(oldNode, newNode); err != nil {
-		log.Logger.Error("unable to update node in scheduler cache",
+		log.Log(log.Cache).Error("unable to update node in scheduler cache",
 			zap.Error(err))
 		return
 	}
@@ -223,14 +289,14 @@ func (ctx *Context) updateNode(oldObj, newObj interface{}) {
 func (ctx *Context) deleteNode(obj interface{}) {
 	node, err := convertToNode(obj)
 	if err != nil {
-		log.Logger.Error("node conversion failed", zap.Error(err))
+		log.Log(log.Cache).Error("node conversion failed", zap.Error(err))
 		return
 	}
 
 	// delete node from secondary cache
-	log.Logger.Debug("delete node from cache", zap.String("nodeName", node.Name))
+	log.Log(log.Cache).Debug("delete node from cache", zap.String("nodeName", node.Name))
 	if err := ctx.schedulerCache.RemoveNode(node); err != nil {
-		log.Logger.Error("unable to delete node from scheduler cache",
+		log.Log(log.Cache).Error("unable to delete node from scheduler cache",
 			zap.Error(err))
 		return
 	}
@@ -250,18 +316,18 @@ func (ctx *Context) deleteNode(obj interface{}) {
 func (ctx *Context) addPod(obj interface{}) {
 	pod, err := utils.Convert2Pod(obj)
 	if err != nil {
-		log.Logger.Error("failed to add pod", zap.Error(err))
+		log.Log(log.Cache).Error("failed to add pod", zap.Error(err))
 		return
 	}
 
 	if pod.Status.Phase == v1.PodPending {
-		log.Logger.Debug("add pod",
+		log.Log(log.Cache).Debug("add pod",
 			zap.String("namespace", pod.Namespace),
 			zap.String("podName", pod.Name),
 			zap.String("podUID", string(pod.UID)),
 			zap.String("state", string(pod.Status.Phase)))
 		if err := ctx.validatePod(pod); err != nil {
-			log.Logger.Error("application is invalid", zap.Error(err))
+			log.Log(log.Cache).Error("application is invalid", zap.Error(err))
 			return
 		}
 
@@ -272,7 +338,7 @@ func (ctx *Context) addPod(obj interface{}) {
 	}
 
 	if utils.IsAssignedPod(pod) && utils.IsSchedulablePod(pod) {
-		log.Logger.Debug("add pod",
+		log.Log(log.Cache).Debug("add pod",
 			zap.String("namespace", pod.Namespace),
 			zap.String("podName", pod.Name),
 			zap.String("podUID", string(pod.UID)),
@@ -286,7 +352,7 @@ func (ctx *Context) addPod(obj interface{}) {
 
 	// add pod to cache
 	if err := ctx.schedulerCache.AddPod(pod); err != nil {
-		log.Logger.Error("add pod to scheduler cache failed",
+		log.Log(log.Cache).Error("add pod to scheduler cache failed",
 			zap.String("podName", pod.Name),
 			zap.Error(err))
 	}
@@ -295,13 +361,13 @@ func (ctx *Context) addPod(obj interface{}) {
 func (ctx *Context) addPodToCache(obj interface{}) {
 	pod, err := utils.Convert2Pod(obj)
 	if err != nil {
-		log.Logger.Error("failed to add pod to cache", zap.Error(err))
+		log.Log(log.Cache).Error("failed to add pod to cache", zap.Error(err))
 		return
 	}
 
-	log.Logger.Info("adding pod to cache", zap.String("podName", pod.Name))
+	log.Log(log.Cache).Info("adding pod to cache", zap.String("podName", pod.Name))
 	if err := ctx.schedulerCache.AddPod(pod); err != nil {
-		log.Logger.Error("add pod to scheduler cache failed",
+		log.Log(log.Cache).Error("add pod to scheduler cache failed",
 			zap.String("podName", pod.Name),
 			zap.Error(err))
 	}
@@ -316,17 +382,17 @@ func (ctx *Context) removePodFromCache(obj interface{}) {
 		var ok bool
 		pod, ok = t.Obj.(*v1.Pod)
 		if !ok {
-			log.Logger.Error("Cannot convert to *v1.Pod", zap.Any("pod", obj))
+			log.Log(log.Cache).Error("Cannot convert to *v1.Pod", zap.Any("pod", obj))
 			return
 		}
 	default:
-		log.Logger.Error("Cannot convert to *v1.Pod", zap.Any("pod", obj))
+		log.Log(log.Cache).Error("Cannot convert to *v1.Pod", zap.Any("pod", obj))
 		return
 	}
 
-	log.Logger.Info("removing pod from cache", zap.String("podName", pod.Name))
+	log.Log(log.Cache).Info("removing pod from cache", zap.String("podName", pod.Name))
 	if err := ctx.schedulerCache.RemovePod(pod); err != nil {
-		log.Logger.Error("failed to remove pod from scheduler cache",
+		log.Log(log.Cache).Error("failed to remove pod from scheduler cache",
 			zap.String("podName", pod.Name),
 			zap.Error(err))
 	}
@@ -363,19 +429,19 @@ func (ctx *Context) validatePod(pod *v1.Pod) error {
 // this function is called when a pod of a application gets updated,
 // currently there is no operation needed for this call.
 func (ctx *Context) updatePod(obj, newObj interface{}) {
-	log.Logger.Debug("handling UpdatePod")
+	log.Log(log.Cache).Debug("handling UpdatePod")
 	old, err := utils.Convert2Pod(obj)
 	if err != nil {
-		log.Logger.Error("failed to update pod", zap.Error(err))
+		log.Log(log.Cache).Error("failed to update pod", zap.Error(err))
 		return
 	}
 	pod, err := utils.Convert2Pod(newObj)
 	if err != nil {
-		log.Logger.Error("failed to update pod", zap.Error(err))
+		log.Log(log.Cache).Error("failed to update pod", zap.Error(err))
 		return
 	}
 
-	log.Logger.Debug("updatePod",
+	log.Log(log.Cache).Debug("updatePod",
 		zap.String("podName", old.Name),
 		zap.String("oldState", string(old.Status.Phase)),
 		zap.String("newState", string(pod.Status.Phase)))
@@ -384,16 +450,16 @@ func (ctx *Context) updatePod(obj, newObj interface{}) {
 func (ctx *Context) updatePodInCache(oldObj, newObj interface{}) {
 	oldPod, err := utils.Convert2Pod(oldObj)
 	if err != nil {
-		log.Logger.Error("failed to update pod in cache", zap.Error(err))
+		log.Log(log.Cache).Error("failed to update pod in cache", zap.Error(err))
 		return
 	}
 	newPod, err := utils.Convert2Pod(newObj)
 	if err != nil {
-		log.Logger.Error("failed to update pod in cache", zap.Error(err))
+		log.Log(log.Cache).Error("failed to update pod in cache", zap.Error(err))
 		return
 	}
 	if err := ctx.schedulerCache.UpdatePod(oldPod, newPod); err != nil {
-		log.Logger.Debug("failed to update pod in cache",
+		log.Log(log.Cache).Debug("failed to update pod in cache",
 			zap.String("podName", oldPod.Name),
 			zap.Error(err))
 	}
@@ -413,20 +479,21 @@ func (ctx *Context) deletePod(obj interface{}) {
 	case cache.DeletedFinalStateUnknown:
 		var ok bool
 		if pod, ok = obj.Obj.(*v1.Pod); !ok {
-			log.Logger.Error("cannot convert to pod")
+			log.Log(log.Cache).Error("cannot convert to pod")
 			return
 		}
 	default:
-		log.Logger.Error("cannot convert to pod")
+		log.Log(log.Cache).Error("cannot convert to pod")
 		return
 	}
 
+	ctx.diagnostics.remove(string(pod.UID))
 	if application := ctx.getOrCreateApplication(pod); application != nil {
-		log.Logger.Debug("release allocation")
+		log.Log(log.Cache).Debug("release allocation")
 		dispatcher.Dispatch(NewSimpleTaskEvent(
 			application.GetApplicationID(), string(pod.UID), events.CompleteTask))
 
-		log.Logger.Info("delete pod",
+		log.Log(log.Cache).Info("delete pod",
 			zap.String("namespace", pod.Namespace),
 			zap.String("podName", pod.Name),
 			zap.String("podUID", string(pod.UID)))
@@ -465,6 +532,11 @@ func (ctx *Context) filterConfigMaps(obj interface{}) bool {
 	switch obj := obj.(type) {
 	case *v1.ConfigMap:
 		return obj.Name == common.DefaultConfigMapName
+	case cache.DeletedFinalStateUnknown:
+		if configMap, ok := obj.Obj.(*v1.ConfigMap); ok {
+			return configMap.Name == common.DefaultConfigMapName
+		}
+		return false
 	default:
 		return false
 	}
@@ -472,69 +544,337 @@ func (ctx *Context) filterConfigMaps(obj interface{}) bool {
 
 // when detects the configMap for the scheduler is added, trigger hot-refresh
 func (ctx *Context) addConfigMaps(obj interface{}) {
-	log.Logger.Debug("configMap added")
-	ctx.triggerReloadConfig()
+	log.Log(log.Cache).Debug("configMap added")
+	ctx.reloadShimConfig(obj)
+	ctx.reloadQueueConfig(obj)
 }
 
 // when detects the configMap for the scheduler is updated, trigger hot-refresh
 func (ctx *Context) updateConfigMaps(obj, newObj interface{}) {
-	log.Logger.Debug("trigger scheduler to reload configuration")
-	// When update event is received, it is not guaranteed the data mounted to the pod
-	// is also updated. This is because the actual update in pod's volume is ensured
-	// by kubelet, kubelet is checking whether the mounted ConfigMap is fresh on every
-	// periodic sync. As a result, the total delay from the moment when the ConfigMap
-	// is updated to the moment when new keys are projected to the pod can be as long
-	// as kubelet sync period + ttl of ConfigMaps cache in kubelet.
-	// We trigger configuration reload, on yunikorn-core side, it keeps checking config
-	// file state once this is called. And the actual reload happens when it detects
-	// actual changes on the content.
-	ctx.triggerReloadConfig()
-}
-
-// when detects the configMap for the scheduler is deleted, no operation needed here
-// we assume there will be a consequent add operation after delete, so we treat it like a update.
+	log.Log(log.Cache).Debug("trigger scheduler to reload configuration")
+	// Both sections are read from the object directly, the scheduler doesn't wait
+	// for kubelet to project the new keys to the volume mounted in the pod.
+	ctx.reloadShimConfig(newObj)
+	ctx.reloadQueueConfig(newObj)
+}
+
+// when detects the configMap for the scheduler is deleted, the options set in the
+// shim section are reverted and the core falls back to the queue configuration file.
 func (ctx *Context) deleteConfigMaps(obj interface{}) {
-	log.Logger.Debug("configMap deleted")
+	log.Log(log.Cache).Info("configMap deleted, falling back to the configuration files")
+	logReloadResult(conf.UpdateConfigMapSection(nil))
+	if ctx.queueConfig.clear() {
+		// the error is logged, the core keeps the current configuration
+		//nolint:errcheck
+		_ = ctx.triggerReloadConfig()
+	}
+}
+
+// pushes the queue configuration in the configMap to the scheduler core,
+// the validation result is reported as an event of the configMap. An invalid
+// configuration is rejected and the core keeps the current one.
+func (ctx *Context) reloadQueueConfig(obj interface{}) {
+	configMap, ok := obj.(*v1.ConfigMap)
+	if !ok {
+		return
+	}
+	key := ctx.queueConfig.configMapKey()
+	data, ok := configMap.Data[key]
+	if !ok {
+		// no queue section in the configMap, the configuration file is used
+		if ctx.queueConfig.clear() {
+			log.Log(log.Cache).Info("queue configuration removed from the configMap, falling back to the configuration file",
+				zap.String("key", key))
+			//nolint:errcheck
+			_ = ctx.triggerReloadConfig()
+		}
+		return
+	}
+	changed, err := ctx.queueConfig.update([]byte(data))
+	if err != nil {
+		log.Log(log.Cache).Error("invalid queue configuration, the current configuration is kept",
+			zap.String("key", key),
+			zap.Error(err))
+		events.GetRecorder().Eventf(configMap, v1.EventTypeWarning, "InvalidQueueConfig",
+			"queue configuration %s is rejected: %v", key, err)
+		return
+	}
+	if changed {
+		// the core reloads the configuration asynchronously, the shim only knows it is valid
+		if err = ctx.triggerReloadConfig(); err != nil {
+			events.GetRecorder().Eventf(configMap, v1.EventTypeWarning, "QueueConfigReloadFailed",
+				"queue configuration %s is validated but the scheduler failed to reload it: %v", key, err)
+			return
+		}
+		events.GetRecorder().Eventf(configMap, v1.EventTypeNormal, "QueueConfigValidated",
+			"queue configuration %s is validated, the scheduler is reloading it", key)
+	}
+}
+
+// reloads the shim configuration from the shim section of the configMap,
+// the section is optional, removing it reverts the options set in it.
+func (ctx *Context) reloadShimConfig(obj interface{}) {
+	configMap, ok := obj.(*v1.ConfigMap)
+	if !ok {
+		return
+	}
+	result := conf.UpdateConfigMapSection([]byte(configMap.Data[common.ShimConfigMapKey]))
+	logReloadResult(result)
+	if result.Error != "" {
+		events.GetRecorder().Eventf(configMap, v1.EventTypeWarning, "InvalidShimConfig",
+			"shim configuration %s is rejected: %s", common.ShimConfigMapKey, result.Error)
+	}
+}
+
+// logs the outcome of a shim configuration reload
+func logReloadResult(result *conf.ReloadResult) {
+	switch {
+	case result.Error != "":
+		log.Log(log.Cache).Error("invalid shim configuration, the current configuration is kept",
+			zap.String("source", result.Source),
+			zap.String("error", result.Error))
+	case result.HasChanges():
+		log.Log(log.Cache).Info("shim configuration reloaded",
+			zap.String("source", result.Source),
+			zap.Strings("applied", result.Applied),
+			zap.Strings("requireRestart", result.RequireRestart))
+	}
+}
+
+// called when the shim configuration is changed at runtime, the predictor
+// and the prioritizer are rebuilt when the predicates or priorities are changed.
+func (ctx *Context) OnConfigReload(previous, updated *conf.SchedulerConf) {
+	if previous.Predicates != updated.Predicates {
+		predictor := ctx.newPredictor()
+		ctx.lock.Lock()
+		ctx.predictor = predictor
+		ctx.lock.Unlock()
+		log.Log(log.Cache).Info("predicates are changed",
+			zap.String("predicates", updated.Predicates))
+	}
+	if previous.Priorities != updated.Priorities {
+		prioritizer := ctx.newPrioritizer()
+		ctx.lock.Lock()
+		ctx.prioritizer = prioritizer
+		ctx.lock.Unlock()
+		log.Log(log.Cache).Info("priorities are changed",
+			zap.String("priorities", updated.Priorities))
+	}
+}
+
+// the extenders are not reloaded, the same extenders are used by the new predictor and prioritizer
+func (ctx *Context) newPredictor() *plugin.Predictor {
+	predictor := plugin.NewPredictor(schedulercache.GetPluginArgs(), ctx.testMode)
+	predictor.SetExtenders(ctx.extenders)
+	return predictor
+}
+
+func (ctx *Context) newPrioritizer() *priorities.Prioritizer {
+	prioritizer := priorities.NewPrioritizer(schedulercache.GetPluginArgs(), ctx.testMode)
+	prioritizer.SetExtenders(ctx.extenders)
+	return prioritizer
 }
 
-func (ctx *Context) triggerReloadConfig() {
-	log.Logger.Info("trigger scheduler configuration reloading")
-	if err := ctx.schedulerAPI.ReloadConfiguration(ctx.conf.ClusterID); err != nil {
-		log.Logger.Error("reload configuration failed", zap.Error(err))
+func (ctx *Context) triggerReloadConfig() error {
+	log.Log(log.Cache).Info("trigger scheduler configuration reloading")
+	err := ctx.schedulerAPI.ReloadConfiguration(ctx.conf.ClusterID)
+	if err != nil {
+		log.Log(log.Cache).Error("reload configuration failed", zap.Error(err))
 	}
+	return err
 }
 
 func (ctx *Context) updatePodCondition(pod *v1.Pod, condition *v1.PodCondition) error {
-	log.Logger.Info("Updating pod condition",
+	log.Log(log.Cache).Info("Updating pod condition",
 		zap.String("namespace", pod.Namespace),
 		zap.String("name", pod.Name),
 		zap.Any("podCondition", condition))
 	if podutil.UpdatePodCondition(&pod.Status, condition) {
-		_, err := ctx.kubeClient.GetClientSet().CoreV1().Pods(pod.Namespace).UpdateStatus(pod)
+		_, err := ctx.kubeClient.UpdateStatus(pod)
 		return err
 	}
 	return nil
 }
 
-// evaluate given predicates based on current context
+// evaluate given predicates based on current context, the predicate metadata and the results
+// are cached by the predictor until the scheduler cache is changed.
 func (ctx *Context) IsPodFitNode(name string, node string) error {
+	ctx.lock.RLock()
+	predictor := ctx.predictor
+	ctx.lock.RUnlock()
 	// simply skip if predicates are not enabled
-	if !ctx.predictor.Enabled() {
+	if !predictor.Enabled() {
 		return nil
 	}
 
-	ctx.lock.RLock()
-	defer ctx.lock.RUnlock()
 	if pod, ok := ctx.schedulerCache.GetPod(name); ok {
 		// if pod exists in cache, try to run predicates
-		if targetNode := ctx.schedulerCache.GetNode(node); targetNode != nil {
-			meta := ctx.predictor.GetPredicateMeta(pod, ctx.schedulerCache.GetNodesInfoMap())
-			return ctx.predictor.Predicates(pod, meta, targetNode)
+		// the predicates read the nodes from a snapshot, which is not changed by the informers
+		snapshot := ctx.schedulerCache.Snapshot()
+		if targetNode, ok := snapshot.NodeInfos[node]; ok {
+			nodeNameToInfo := snapshot.NodeInfos
+			err := predictor.PredicatesWithCache(pod, targetNode, nodeNameToInfo, snapshot.Generation)
+			if err == nil {
+				// the extenders are only called for the nodes which pass the predicates
+				var failures map[string]error
+				if failures, err = predictor.FilterByExtenders(pod,
+					[]*schedulernode.NodeInfo{targetNode}, nodeNameToInfo); err != nil {
+					return err
+				}
+				err = failures[node]
+			}
+			ctx.diagnostics.record(name, node, err)
+			return err
 		}
 	}
 	return fmt.Errorf("predicates were not running because pod or node was not found in cache")
 }
 
+// the result of filtering the candidate nodes of a pod
+type FilterResult struct {
+	// the nodes the pod fits on, in the order they were given
+	FitNodes []string
+	// the nodes the pod doesn't fit on, with the failure reasons
+	FailedNodes map[string]string
+}
+
+// evaluates the predicates of the pod against all the given nodes in parallel,
+// the nodes are read from a snapshot of the scheduler cache so that all the nodes
+// are checked against the same cache content. The nodes passing the predicates
+// are filtered by the scheduler extenders in one call of each extender.
+func (ctx *Context) FilterNodes(name string, nodes []string) (*FilterResult, error) {
+	ctx.lock.RLock()
+	predictor := ctx.predictor
+	ctx.lock.RUnlock()
+
+	pod, ok := ctx.schedulerCache.GetPod(name)
+	if !ok {
+		return nil, fmt.Errorf("nodes were not filtered because pod %s was not found in cache", name)
+	}
+	snapshot := ctx.schedulerCache.Snapshot()
+	failures := make([]error, len(nodes))
+	checkNode := func(i int) {
+		nodeInfo, ok := snapshot.NodeInfos[nodes[i]]
+		if !ok || nodeInfo.Node() == nil {
+			failures[i] = fmt.Errorf("node %s was not found in cache", nodes[i])
+			return
+		}
+		if predictor.Enabled() {
+			failures[i] = predictor.PredicatesWithCache(pod, nodeInfo, snapshot.NodeInfos, snapshot.Generation)
+		}
+	}
+	workqueue.ParallelizeUntil(context.TODO(), filterWorkers, len(nodes), checkNode)
+
+	if predictor.Enabled() {
+		candidates := make([]*schedulernode.NodeInfo, 0, len(nodes))
+		for i, node := range nodes {
+			if failures[i] == nil {
+				candidates = append(candidates, snapshot.NodeInfos[node])
+			}
+		}
+		extenderFailures, err := predictor.FilterByExtenders(pod, candidates, snapshot.NodeInfos)
+		if err != nil {
+			return nil, err
+		}
+		for i, node := range nodes {
+			if failure, ok := extenderFailures[node]; ok {
+				failures[i] = failure
+			}
+			if nodeInfo, ok := snapshot.NodeInfos[node]; ok && nodeInfo.Node() != nil {
+				ctx.diagnostics.record(name, node, failures[i])
+			}
+		}
+	}
+
+	result := &FilterResult{
+		FitNodes:    make([]string, 0, len(nodes)),
+		FailedNodes: make(map[string]string),
+	}
+	for i, node := range nodes {
+		if failures[i] != nil {
+			result.FailedNodes[node] = failures[i].Error()
+		} else {
+			result.FitNodes = append(result.FitNodes, node)
+		}
+	}
+	log.Log(log.Cache).Debug("nodes filtered",
+		zap.String("pod", pod.Name),
+		zap.Int("nodes", len(nodes)),
+		zap.Int("fitNodes", len(result.FitNodes)))
+	return result, nil
+}
+
+// ranks the given nodes for the pod with the configured priorities, the nodes are returned
+// sorted by their scores in descending order. The nodes keep the given order when the
+// priorities are not enabled, nodes not found in the cache are ranked last with zero score.
+func (ctx *Context) ScoreNodes(name string, nodes []string) ([]priorities.NodeScore, error) {
+	// the extenders may take long, the context is not locked while the nodes are scored
+	ctx.lock.RLock()
+	prioritizer := ctx.prioritizer
+	ctx.lock.RUnlock()
+	pod, ok := ctx.schedulerCache.GetPod(name)
+	if !ok {
+		return nil, fmt.Errorf("nodes were not scored because pod %s was not found in cache", name)
+	}
+	snapshot := ctx.schedulerCache.Snapshot()
+	nodeInfos := make([]*schedulernode.NodeInfo, 0, len(nodes))
+	unknown := make([]priorities.NodeScore, 0)
+	for _, node := range nodes {
+		if nodeInfo, ok := snapshot.NodeInfos[node]; ok && nodeInfo.Node() != nil {
+			nodeInfos = append(nodeInfos, nodeInfo)
+		} else {
+			unknown = append(unknown, priorities.NodeScore{NodeID: node})
+		}
+	}
+	var scores []priorities.NodeScore
+	if prioritizer.Enabled() {
+		var err error
+		scores, err = prioritizer.ScoreNodes(pod, nodeInfos, snapshot.NodeInfos)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		scores = make([]priorities.NodeScore, len(nodeInfos))
+		for i, nodeInfo := range nodeInfos {
+			scores[i].NodeID = nodeInfo.Node().Name
+		}
+	}
+	return append(scores, unknown...), nil
+}
+
+// returns the scheduling diagnosis of a pending pod, the predicate results of
+// the nodes checked for the pod aggregated by the failure reasons.
+func (ctx *Context) GetPodDiagnosis(podKey string) (*PodDiagnosis, bool) {
+	nodeExists := func(node string) bool {
+		nodeInfo := ctx.schedulerCache.GetNode(node)
+		return nodeInfo != nil && nodeInfo.Node() != nil
+	}
+	return ctx.diagnostics.get(podKey, nodeExists, ctx.schedulerCache.GetNodeCount())
+}
+
+// explains why a task is pending, the state of the application and its queue
+// are combined with the node failures of the pod if the nodes were checked.
+func (ctx *Context) GetPendingMessage(task *Task) string {
+	message := fmt.Sprintf("application \"%s\"", task.applicationID)
+	if app, err := ctx.GetApplication(task.applicationID); err == nil {
+		message = fmt.Sprintf("application \"%s\" in queue \"%s\" is %s",
+			task.applicationID, app.GetQueue(), app.GetApplicationState())
+	}
+	if diagnosis, ok := ctx.GetPodDiagnosis(task.taskID); ok {
+		return fmt.Sprintf("%s: %s", message, diagnosis.Summary())
+	}
+	return fmt.Sprintf("%s: waiting for resources from the queue", message)
+}
+
+// binds the pod to the node, the binder extender binds the pod if it is interested in the pod,
+// otherwise the pod is bound through the API server.
+func (ctx *Context) bindPod(pod *v1.Pod, nodeName string) error {
+	if bound, err := ctx.extenders.Bind(pod, nodeName); bound {
+		return err
+	}
+	return ctx.kubeClient.Bind(pod, nodeName)
+}
+
 // call volume binder to bind pod volumes if necessary,
 // internally, volume binder maintains a cache (podBindingCache) for pod volumes,
 // and before calling this, they should have been updated by FindPodVolumes and AssumePodVolumes.
@@ -546,11 +886,17 @@ func (ctx *Context) bindPodVolumes(pod *v1.Pod) error {
 	// then here we just need to retrieve that value from cache, to skip bindings if volumes are already bound.
 	if assumedPod, exist := ctx.schedulerCache.GetPod(podKey); exist {
 		if ctx.schedulerCache.ArePodVolumesAllBound(podKey) {
-			log.Logger.Info("Binding Pod Volumes skipped: all volumes already bound",
+			log.Log(log.Cache).Info("Binding Pod Volumes skipped: all volumes already bound",
 				zap.String("podName", pod.Name))
 		} else {
-			log.Logger.Info("Binding Pod Volumes", zap.String("podName", pod.Name))
-			return ctx.volumeBinder.Binder.BindPodVolumes(assumedPod)
+			log.Log(log.Cache).Info("Binding Pod Volumes", zap.String("podName", pod.Name))
+			// the binder waits for the volumes to be bound up to the volume bind timeout
+			err := ctx.volumeBinder.Binder.BindPodVolumes(assumedPod)
+			if err == wait.ErrWaitTimeout {
+				return fmt.Errorf("timed out after %s waiting for the volumes of the pod to be bound",
+					ctx.conf.VolumeBindTimeout)
+			}
+			return err
 		}
 	}
 	return nil
@@ -584,12 +930,42 @@ func (ctx *Context) AssumePod(name string, node string) error {
 			}
 			// assign the node name for pod
 			assumedPod.Spec.NodeName = node
-			return ctx.schedulerCache.AssumePod(assumedPod, allBound)
+			if err := ctx.schedulerCache.AssumePod(assumedPod, allBound); err != nil {
+				// the volume bindings assumed for the pod are not used
+				if ctx.volumeBinder != nil {
+					ctx.volumeBinder.DeletePodBindings(pod)
+				}
+				return err
+			}
+			// the pod is no longer pending
+			ctx.diagnostics.remove(name)
 		}
 	}
 	return nil
 }
 
+// reverts what AssumePod reserved for a pod which failed to be bound, the assumed pod
+// is removed from its node and it stays pending in the cache, the volume bindings cached
+// for the pod are dropped. The volume binder reverts the assumed PVs and PVCs itself when
+// it fails to update them, the volumes already bound through the API server stay bound,
+// like they do in the default scheduler.
+func (ctx *Context) UnreservePod(name string) error {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	pod, ok := ctx.schedulerCache.GetPod(name)
+	if !ok {
+		return fmt.Errorf("pod %s was not unreserved because it was not found in scheduler cache", name)
+	}
+	log.Log(log.Cache).Info("unreserve pod",
+		zap.String("podName", pod.Name),
+		zap.String("nodeName", pod.Spec.NodeName))
+	if ctx.volumeBinder != nil {
+		ctx.volumeBinder.DeletePodBindings(pod)
+	}
+	return ctx.schedulerCache.UnassumePod(pod)
+}
+
 // forget pod must be called when a pod is assumed to be running on a node,
 // but then for some reason it is failed to bind or released.
 func (ctx *Context) ForgetPod(name string) error {
@@ -597,10 +973,10 @@ func (ctx *Context) ForgetPod(name string) error {
 	defer ctx.lock.Unlock()
 
 	if pod, ok := ctx.schedulerCache.GetPod(name); ok {
-		log.Logger.Debug("forget pod", zap.String("pod", pod.Name))
+		log.Log(log.Cache).Debug("forget pod", zap.String("pod", pod.Name))
 		return ctx.schedulerCache.ForgetPod(pod)
 	}
-	log.Logger.Debug("unable to forget pod",
+	log.Log(log.Cache).Debug("unable to forget pod",
 		zap.String("reason", fmt.Sprintf("pod %s not found in scheduler cache", name)))
 	return nil
 }
@@ -613,7 +989,7 @@ func (ctx *Context) getOrCreateApplication(pod *v1.Pod) *Application {
 
 	appID, err := utils.GetApplicationIDFromPod(pod)
 	if err != nil {
-		log.Logger.Error("unable to get application by given pod", zap.Error(err))
+		log.Log(log.Cache).Error("unable to get application by given pod", zap.Error(err))
 		return nil
 	}
 
@@ -643,6 +1019,11 @@ func (ctx *Context) AddApplication(app *Application) {
 	ctx.applications[app.GetApplicationID()] = app
 }
 
+// for testing only
+func (ctx *Context) AddNode(node *v1.Node) {
+	ctx.addNode(node)
+}
+
 func (ctx *Context) GetApplication(appID string) (*Application, error) {
 	ctx.lock.RLock()
 	defer ctx.lock.RUnlock()
@@ -652,13 +1033,11 @@ func (ctx *Context) GetApplication(appID string) (*Application, error) {
 	return nil, fmt.Errorf("application %s is not found in context", appID)
 }
 
-func (ctx *Context) getTask(appID string, taskID string) (*Task, error) {
+func (ctx *Context) GetTask(appID string, taskID string) (*Task, error) {
 	ctx.lock.RLock()
 	defer ctx.lock.RUnlock()
 	if app, ok := ctx.applications[appID]; ok {
-		if task, err := app.GetTask(taskID); err == nil {
-			return task, nil
-		}
+		return app.GetTask(taskID)
 	}
 	return nil, fmt.Errorf("application %s is not found in context", appID)
 }
@@ -678,18 +1057,33 @@ func (ctx *Context) SelectApplications(filter func(app *Application) bool) []*Ap
 	return apps
 }
 
+func (ctx *Context) SelectNodes(filter func(node *SchedulerNode) bool) []*SchedulerNode {
+	nodes := make([]*SchedulerNode, 0)
+	for _, node := range ctx.nodes.listNodes() {
+		if filter != nil && !filter(node) {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func (ctx *Context) GetSchedulerCache() *schedulercache.SchedulerCache {
+	return ctx.schedulerCache
+}
+
 func (ctx *Context) ApplicationEventHandler() func(obj interface{}) {
 	return func(obj interface{}) {
 		if event, ok := obj.(events.ApplicationEvent); ok {
 			app, err := ctx.GetApplication(event.GetApplicationID())
 			if err != nil {
-				log.Logger.Error("failed to handle application event", zap.Error(err))
+				log.Log(log.Cache).Error("failed to handle application event", zap.Error(err))
 				return
 			}
 
 			if app.canHandle(event) {
 				if err = app.handle(event); err != nil {
-					log.Logger.Error("failed to handle application event",
+					log.Log(log.Cache).Error("failed to handle application event",
 						zap.String("event", string(event.GetEvent())),
 						zap.Error(err))
 				}
@@ -701,15 +1095,15 @@ func (ctx *Context) ApplicationEventHandler() func(obj interface{}) {
 func (ctx *Context) TaskEventHandler() func(obj interface{}) {
 	return func(obj interface{}) {
 		if event, ok := obj.(events.TaskEvent); ok {
-			task, err := ctx.getTask(event.GetApplicationID(), event.GetTaskID())
+			task, err := ctx.GetTask(event.GetApplicationID(), event.GetTaskID())
 			if err != nil {
-				log.Logger.Error("failed to handle application event", zap.Error(err))
+				log.Log(log.Cache).Error("failed to handle application event", zap.Error(err))
 				return
 			}
 
 			if task.canHandle(event) {
 				if err = task.handle(event); err != nil {
-					log.Logger.Error("failed to handle task event",
+					log.Log(log.Cache).Error("failed to handle task event",
 						zap.String("applicationID", task.applicationID),
 						zap.String("taskID", task.taskID),
 						zap.String("event", string(event.GetEvent())),
@@ -728,6 +1122,65 @@ func (ctx *Context) SchedulerNodeEventHandler() func(obj interface{}) {
 	return nil
 }
 
+func (ctx *Context) GetKubeClient() client.KubeClient {
+	return ctx.kubeClient
+}
+
+// stops binding pods and volumes, this is irreversible,
+// it is called when the scheduler loses the leadership.
+func (ctx *Context) DisableBinding() {
+	atomic.StoreInt32(&ctx.bindingDisabled, 1)
+}
+
+func (ctx *Context) isBindingDisabled() bool {
+	return atomic.LoadInt32(&ctx.bindingDisabled) == 1
+}
+
+// runs the function in a go routine which is tracked as an in-flight operation,
+// the scheduler waits for the in-flight operations before it shuts down.
+func (ctx *Context) runAsync(fn func()) {
+	atomic.AddInt32(&ctx.asyncOps, 1)
+	go func() {
+		defer atomic.AddInt32(&ctx.asyncOps, -1)
+		fn()
+	}()
+}
+
+// cancels the delayed operations and waits for the in-flight operations to finish,
+// returns an error if there are still operations running when the timeout is reached.
+func (ctx *Context) DrainAsyncOperations(timeout time.Duration) error {
+	ctx.drainOnce.Do(func() {
+		close(ctx.drainChan)
+	})
+	log.Log(log.Cache).Info("waiting for in-flight operations",
+		zap.Int32("remaining", atomic.LoadInt32(&ctx.asyncOps)))
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := atomic.LoadInt32(&ctx.asyncOps)
+		if remaining == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for %d in-flight operations", remaining)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// returns true if all informers have synced their caches,
+// informers are not running in test mode, so they are treated as synced.
+func (ctx *Context) InformersSynced() bool {
+	if ctx.testMode {
+		return true
+	}
+	return ctx.nodeInformer.Informer().HasSynced() &&
+		ctx.podInformer.Informer().HasSynced() &&
+		ctx.pvInformer.Informer().HasSynced() &&
+		ctx.pvcInformer.Informer().HasSynced() &&
+		ctx.storageInformer.Informer().HasSynced() &&
+		ctx.configMapInformer.Informer().HasSynced()
+}
+
 func (ctx *Context) Run(stopCh <-chan struct{}) {
 	if ctx != nil && !ctx.testMode {
 		go ctx.nodeInformer.Informer().Run(stopCh)
@@ -736,5 +1189,12 @@ func (ctx *Context) Run(stopCh <-chan struct{}) {
 		go ctx.pvcInformer.Informer().Run(stopCh)
 		go ctx.storageInformer.Informer().Run(stopCh)
 		go ctx.configMapInformer.Informer().Run(stopCh)
+		go conf.WatchConfigFile(configFileCheckInterval, stopCh, logReloadResult)
+		ctx.schedulerCache.Run(stopCh)
+		if ctx.conf.CacheCheckInterval > 0 {
+			go wait.Until(func() {
+				ctx.checkCache(ctx.conf.CacheSelfHeal)
+			}, ctx.conf.CacheCheckInterval, stopCh)
+		}
 	}
 }
@@ -39,13 +39,13 @@ func (ctx *Context) WaitForRecovery(maxTimeout time.Duration) error {
 	if !ctx.testMode {
 		// step 1: recover apps
 		if err := ctx.waitForAppRecovery(ctx.podInformer.Lister(), maxTimeout); err != nil {
-			log.Logger.Error("app recovery failed", zap.Error(err))
+			log.Log(log.Cache).Error("app recovery failed", zap.Error(err))
 			return err
 		}
 
 		// step 2: recover nodes
 		if err := ctx.waitForNodeRecovery(ctx.nodeInformer.Lister(), maxTimeout); err != nil {
-			log.Logger.Error("nodes recovery failed", zap.Error(err))
+			log.Log(log.Cache).Error("nodes recovery failed", zap.Error(err))
 			return err
 		}
 	}
@@ -53,6 +53,51 @@ func (ctx *Context) WaitForRecovery(maxTimeout time.Duration) error {
 	return nil
 }
 
+// Forgets all applications and nodes, this is called when the scheduler-core has lost
+// the registration of this RM, e.g the core was restarted. The core has no knowledge of them
+// anymore, they are rebuilt from the informers in the next recovery. The pods assumed for the
+// lost allocations are pending again in the scheduler cache.
+func (ctx *Context) ResetForRecovery() {
+	ctx.lock.Lock()
+	for _, app := range ctx.applications {
+		app.discard()
+	}
+	ctx.applications = make(map[string]*Application)
+	for _, pod := range ctx.schedulerCache.UnassumeAllPods() {
+		if ctx.volumeBinder != nil {
+			ctx.volumeBinder.DeletePodBindings(pod)
+		}
+	}
+	ctx.lock.Unlock()
+	ctx.nodes.reset()
+	log.Log(log.Cache).Info("context is reset for recovery")
+}
+
+// Submits pending pods again after the context is reset and recovered, informers do not
+// notify about them again as they are already in the informer cache.
+func (ctx *Context) ResubmitPendingPods() error {
+	allPods, err := ctx.podInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, pod := range allPods {
+		if !utils.IsSchedulablePod(pod) || utils.IsAssignedPod(pod) || pod.Status.Phase != corev1.PodPending {
+			continue
+		}
+		if err = ctx.validatePod(pod); err != nil {
+			log.Log(log.Cache).Warn("skip resubmitting invalid pod",
+				zap.String("podName", pod.Name),
+				zap.Error(err))
+			continue
+		}
+		if app := ctx.getOrCreateApplication(pod); app != nil {
+			task := ctx.getOrAddTask(app, pod)
+			app.AddTask(task)
+		}
+	}
+	return nil
+}
+
 // Wait until all previous scheduled applications are recovered, or fail as timeout.
 // During this process, shim submits all applications again to the scheduler-core and verifies app
 // state to ensure they are accepted, this must be done before recovering app allocations.
@@ -73,7 +118,7 @@ func (ctx *Context) waitForAppRecovery(lister v1.PodLister, maxTimeout time.Dura
 			app := ctx.getOrCreateApplication(pod)
 			ctx.AddApplication(app)
 			if app.GetApplicationState() == events.States().Application.New {
-				log.Logger.Info("start to recover the app",
+				log.Log(log.Cache).Info("start to recover the app",
 					zap.String("appID", app.applicationID))
 				dispatcher.Dispatch(NewSimpleApplicationEvent(app.applicationID, events.RecoverApplication))
 				toRecoverApps[app.applicationID] = app
@@ -85,7 +130,7 @@ func (ctx *Context) waitForAppRecovery(lister v1.PodLister, maxTimeout time.Dura
 		// check app states periodically, ensure all apps exit from recovering state
 		if err = utils.WaitForCondition(func() bool {
 			for _, app := range toRecoverApps {
-				log.Logger.Info("appInfo",
+				log.Log(log.Cache).Info("appInfo",
 					zap.String("appID", app.applicationID),
 					zap.String("state", app.GetApplicationState()))
 				if app.GetApplicationState() == events.States().Application.Accepted {
@@ -94,7 +139,7 @@ func (ctx *Context) waitForAppRecovery(lister v1.PodLister, maxTimeout time.Dura
 			}
 
 			if len(toRecoverApps) == 0 {
-				log.Logger.Info("app recovery is successful")
+				log.Log(log.Cache).Info("app recovery is successful")
 				return true
 			}
 
@@ -136,12 +181,12 @@ func (ctx *Context) waitForNodeRecovery(nodeLister v1.NodeLister, maxTimeout tim
 			}
 			for _, pod := range podList.Items {
 				if utils.IsSchedulablePod(&pod) && utils.IsAssignedPod(&pod) {
-					log.Logger.Debug("existing pods",
+					log.Log(log.Cache).Debug("existing pods",
 						zap.String("podName", pod.Name),
 						zap.String("podUID", string(pod.UID)),
 						zap.String("podNodeName", pod.Spec.NodeName))
 					if err = ctx.nodes.addExistingAllocation(&pod); err != nil {
-						log.Logger.Warn("add existing allocation failed", zap.Error(err))
+						log.Log(log.Cache).Warn("add existing allocation failed", zap.Error(err))
 					}
 				}
 			}
@@ -151,12 +196,12 @@ func (ctx *Context) waitForNodeRecovery(nodeLister v1.NodeLister, maxTimeout tim
 	if err = utils.WaitForCondition(func() bool {
 		nodesRecovered := 0
 		for _, node := range ctx.nodes.nodesMap {
-			log.Logger.Info("node state",
+			log.Log(log.Cache).Info("node state",
 				zap.String("nodeName", node.name),
 				zap.String("nodeState", node.getNodeState()))
 			switch node.getNodeState() {
 			case events.States().Node.New:
-				log.Logger.Info("node recovering",
+				log.Log(log.Cache).Info("node recovering",
 					zap.String("nodeID", node.name))
 				dispatcher.Dispatch(CachedSchedulerNodeEvent{
 					NodeID: node.name,
@@ -170,11 +215,11 @@ func (ctx *Context) waitForNodeRecovery(nodeLister v1.NodeLister, maxTimeout tim
 		}
 
 		if nodesRecovered == len(allNodes) {
-			log.Logger.Info("nodes recovery is successful",
+			log.Log(log.Cache).Info("nodes recovery is successful",
 				zap.Int("recoveredNodes", nodesRecovered))
 			return true
 		}
-		log.Logger.Info("still waiting for recovering nodes",
+		log.Log(log.Cache).Info("still waiting for recovering nodes",
 			zap.Int("totalNodes", len(allNodes)),
 			zap.Int("recoveredNodes", nodesRecovered))
 		return false
@@ -20,6 +20,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"gotest.tools/assert"
 	v1 "k8s.io/api/core/v1"
 	apis "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -263,7 +264,7 @@ func TestAppRecovery(t *testing.T) {
 			for _, app := range apps {
 				appStates[app.GetApplicationID()] = app.GetApplicationState()
 			}
-			t.Fatalf("failed to wait for app1 with Recovering state in 3 seconds, actual app states: %v", appStates)
+			t.Errorf("failed to wait for app1 with Recovering state in 3 seconds, actual app states: %v", appStates)
 		}
 	}()
 
@@ -284,3 +285,82 @@ func TestAppRecovery(t *testing.T) {
 	_, err := context.GetApplication("app2")
 	assert.Error(t, err, "application app2 is not found in context")
 }
+
+func TestResetAndResubmitPendingPods(t *testing.T) {
+	context := initContextForTest()
+
+	// the informer cache has a pending pod, a running pod, and a pod of other scheduler
+	pendingPod := newTestPod("pod00001", "")
+	runningPod := newTestPod("pod00002", "host0001")
+	runningPod.Status.Phase = v1.PodRunning
+	otherPod := newTestPod("pod00003", "")
+	otherPod.Spec.SchedulerName = "default-scheduler"
+	for _, pod := range []*v1.Pod{pendingPod, runningPod, otherPod} {
+		pod.Labels = map[string]string{"applicationId": "app0001"}
+		assert.NilError(t, context.podInformer.Informer().GetIndexer().Add(pod))
+	}
+
+	context.addPod(pendingPod)
+	context.nodes.addAndReportNode(&v1.Node{
+		ObjectMeta: apis.ObjectMeta{
+			Name: "host0001",
+			UID:  "uid_0001",
+		},
+	}, false)
+	_, err := context.GetApplication("app0001")
+	assert.NilError(t, err)
+	assert.Equal(t, len(context.SelectNodes(nil)), 1)
+	// the core allocated the pending pod before it lost the registration
+	context.schedulerCache.AddNode(&v1.Node{
+		ObjectMeta: apis.ObjectMeta{
+			Name: "host0001",
+			UID:  "uid_0001",
+		},
+	})
+	assert.NilError(t, context.AssumePod("uid_pod00001", "host0001"))
+	assert.Equal(t, len(context.schedulerCache.GetAssumedPods()), 1)
+
+	// reset forgets all apps and nodes, and removes them from the state metrics
+	newApps := stateGaugeValue(t, "yunikorn_k8shim_applications", events.States().Application.New)
+	newTasks := stateGaugeValue(t, "yunikorn_k8shim_tasks", events.States().Task.New)
+	context.ResetForRecovery()
+	assert.Equal(t, len(context.SelectApplications(nil)), 0)
+	assert.Equal(t, len(context.SelectNodes(nil)), 0)
+	assert.Equal(t, stateGaugeValue(t, "yunikorn_k8shim_applications", events.States().Application.New), newApps-1)
+	assert.Equal(t, stateGaugeValue(t, "yunikorn_k8shim_tasks", events.States().Task.New), newTasks-1)
+	// the assumed pod is pending again
+	assert.Equal(t, len(context.schedulerCache.GetAssumedPods()), 0)
+	cached, ok := context.schedulerCache.GetPod("uid_pod00001")
+	assert.Assert(t, ok)
+	assert.Equal(t, cached.Spec.NodeName, "")
+	assert.Equal(t, len(context.schedulerCache.GetNode("host0001").Pods()), 0)
+
+	// only the pending pod of this scheduler is submitted again, as a new app
+	assert.NilError(t, context.ResubmitPendingPods())
+	app, err := context.GetApplication("app0001")
+	assert.NilError(t, err)
+	assert.Equal(t, app.GetApplicationState(), events.States().Application.New)
+	tasks := app.GetAllTasks()
+	assert.Equal(t, len(tasks), 1)
+	assert.Equal(t, tasks[0].GetTaskID(), "uid_pod00001")
+	assert.Equal(t, tasks[0].GetTaskState(), events.States().Task.New)
+}
+
+// returns the value of a gauge by state in the registered metrics
+func stateGaugeValue(t *testing.T, name string, state string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NilError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "state" && label.GetValue() == state {
+					return metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
@@ -17,17 +17,38 @@ limitations under the License.
 package cache
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"gotest.tools/assert"
 	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	apis "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
+	"k8s.io/kubernetes/pkg/scheduler/volumebinder"
 
 	"github.com/cloudera/yunikorn-k8shim/pkg/common/events"
 	"github.com/cloudera/yunikorn-k8shim/pkg/common/test"
 	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
 	"github.com/cloudera/yunikorn-k8shim/pkg/dispatcher"
+	"github.com/cloudera/yunikorn-k8shim/pkg/plugin/extenders"
+	plugin "github.com/cloudera/yunikorn-k8shim/pkg/plugin/predicates"
 )
 
 const fakeClusterID = "test-cluster"
@@ -62,8 +83,8 @@ func TestAddApplications(t *testing.T) {
 
 	task01 := CreateTaskForTest("task00001", app01, nil, nil)
 	task02 := CreateTaskForTest("task00002", app01, nil, nil)
-	app01.AddTask(&task01)
-	app01.AddTask(&task02)
+	app01.AddTask(task01)
+	app01.AddTask(task02)
 	assert.Equal(t, len(context.applications["app00001"].GetNewTasks()), 2)
 }
 
@@ -255,3 +276,366 @@ func assertTaskState(t *testing.T, task *Task, expectedState string, timeout tim
 		}
 	}
 }
+
+func TestScoreNodes(t *testing.T) {
+	previous := conf.GetSchedulerConf()
+	defer conf.Set(previous)
+	context := initContextForTest()
+	newNode := func(name string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: apis.ObjectMeta{Name: name, UID: types.UID("uid_" + name)},
+			Status: v1.NodeStatus{
+				Allocatable: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse("4"),
+					v1.ResourceMemory: resource.MustParse("8Gi"),
+				},
+			},
+		}
+	}
+	context.schedulerCache.AddNode(newNode("busy"))
+	context.schedulerCache.AddNode(newNode("idle"))
+	pod := &v1.Pod{
+		ObjectMeta: apis.ObjectMeta{Name: "pod", UID: "UID-POD-00001"},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+				},
+			}},
+		},
+	}
+	assert.NilError(t, context.schedulerCache.AddPod(pod))
+	existing := pod.DeepCopy()
+	existing.Name = "existing"
+	existing.UID = "UID-POD-00002"
+	existing.Spec.NodeName = "busy"
+	existing.Spec.Containers[0].Resources.Requests[v1.ResourceCPU] = resource.MustParse("3")
+	assert.NilError(t, context.schedulerCache.AddPod(existing))
+
+	// pod not in the cache
+	_, err := context.ScoreNodes("UID-POD-NOT-EXIST", []string{"busy", "idle"})
+	assert.Assert(t, err != nil)
+
+	// priorities are disabled in test mode, the order is kept and unknown nodes go last
+	scores, err := context.ScoreNodes("UID-POD-00001", []string{"unknown", "busy", "idle"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(scores), 3)
+	assert.Equal(t, scores[0].NodeID, "busy")
+	assert.Equal(t, scores[1].NodeID, "idle")
+	assert.Equal(t, scores[2].NodeID, "unknown")
+
+	// the idle node is preferred by the configured priorities
+	// the priorities are only built outside of the test mode
+	context.testMode = false
+	current := conf.GetSchedulerConf()
+	updated := current.Clone()
+	updated.Priorities = "LeastRequestedPriority"
+	conf.Set(updated)
+	context.OnConfigReload(current, updated)
+	scores, err = context.ScoreNodes("UID-POD-00001", []string{"unknown", "busy", "idle"})
+	assert.NilError(t, err)
+	assert.Equal(t, scores[0].NodeID, "idle")
+	assert.Equal(t, scores[1].NodeID, "busy")
+	assert.Equal(t, scores[2].NodeID, "unknown")
+	assert.Assert(t, scores[0].Score > scores[1].Score)
+	assert.Equal(t, scores[2].Score, 0)
+}
+
+func TestFilterNodes(t *testing.T) {
+	previous := conf.GetSchedulerConf()
+	defer conf.Set(previous)
+	context := initContextForTest()
+	for _, name := range []string{"small", "large-1", "large-2"} {
+		cpu := "4"
+		if name == "small" {
+			cpu = "500m"
+		}
+		context.schedulerCache.AddNode(&v1.Node{
+			ObjectMeta: apis.ObjectMeta{Name: name, UID: types.UID("uid_" + name)},
+			Status: v1.NodeStatus{
+				Allocatable: v1.ResourceList{
+					v1.ResourceCPU:  resource.MustParse(cpu),
+					v1.ResourcePods: resource.MustParse("10"),
+				},
+			},
+		})
+	}
+	pod := &v1.Pod{
+		ObjectMeta: apis.ObjectMeta{Name: "pod", UID: "UID-POD-00001"},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+				},
+			}},
+		},
+	}
+	assert.NilError(t, context.schedulerCache.AddPod(pod))
+	candidates := []string{"large-2", "unknown", "small", "large-1"}
+
+	_, err := context.FilterNodes("UID-POD-NOT-EXIST", candidates)
+	assert.Assert(t, err != nil)
+
+	// predicates are disabled in test mode, only unknown nodes fail
+	result, err := context.FilterNodes("UID-POD-00001", candidates)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result.FitNodes, []string{"large-2", "small", "large-1"})
+	assert.Equal(t, len(result.FailedNodes), 1)
+	assert.Assert(t, result.FailedNodes["unknown"] != "")
+
+	// the predicates are only built outside of the test mode
+	context.testMode = false
+	current := conf.GetSchedulerConf()
+	updated := current.Clone()
+	updated.Predicates = "PodFitsResources"
+	conf.Set(updated)
+	context.OnConfigReload(current, updated)
+	result, err = context.FilterNodes("UID-POD-00001", candidates)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result.FitNodes, []string{"large-2", "large-1"})
+	assert.Equal(t, len(result.FailedNodes), 2)
+	assert.Assert(t, strings.Contains(result.FailedNodes["small"], "PodFitsResources"), result.FailedNodes["small"])
+}
+
+func TestExtenders(t *testing.T) {
+	// the extender fails node-2, prefers node-3 and binds all the pods
+	var bindings []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result interface{}
+		switch filepath.Base(r.URL.Path) {
+		case "filter":
+			var args schedulerapi.ExtenderArgs
+			assert.NilError(t, json.NewDecoder(r.Body).Decode(&args))
+			filterResult := schedulerapi.ExtenderFilterResult{
+				Nodes:       &v1.NodeList{},
+				FailedNodes: schedulerapi.FailedNodesMap{},
+			}
+			for _, node := range args.Nodes.Items {
+				if node.Name == "node-2" {
+					filterResult.FailedNodes[node.Name] = "license not available"
+				} else {
+					filterResult.Nodes.Items = append(filterResult.Nodes.Items, node)
+				}
+			}
+			result = filterResult
+		case "prioritize":
+			var args schedulerapi.ExtenderArgs
+			assert.NilError(t, json.NewDecoder(r.Body).Decode(&args))
+			priorities := schedulerapi.HostPriorityList{}
+			for _, node := range args.Nodes.Items {
+				if node.Name == "node-3" {
+					priorities = append(priorities, schedulerapi.HostPriority{Host: node.Name, Score: 10})
+				}
+			}
+			result = priorities
+		case "bind":
+			var args schedulerapi.ExtenderBindingArgs
+			assert.NilError(t, json.NewDecoder(r.Body).Decode(&args))
+			bindings = append(bindings, args.PodName+"/"+args.Node)
+			result = schedulerapi.ExtenderBindingResult{}
+		}
+		assert.NilError(t, json.NewEncoder(w).Encode(result))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "extenders")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "policy.json")
+	policy := fmt.Sprintf(`{"kind": "Policy", "apiVersion": "v1", "extenders": [{"urlPrefix": "%s",
+"filterVerb": "filter", "prioritizeVerb": "prioritize", "weight": 1, "bindVerb": "bind"}]}`, server.URL)
+	assert.NilError(t, ioutil.WriteFile(configFile, []byte(policy), 0644))
+
+	context := initContextForTest()
+	context.extenders, err = extenders.LoadExtenders(configFile)
+	assert.NilError(t, err)
+	context.predictor = context.newPredictor()
+	context.prioritizer = context.newPrioritizer()
+	for _, name := range []string{"node-1", "node-2", "node-3"} {
+		context.schedulerCache.AddNode(&v1.Node{
+			ObjectMeta: apis.ObjectMeta{Name: name, UID: types.UID("uid_" + name)},
+		})
+	}
+	pod := &v1.Pod{
+		ObjectMeta: apis.ObjectMeta{Name: "pod", UID: "UID-POD-00001"},
+	}
+	assert.NilError(t, context.schedulerCache.AddPod(pod))
+
+	// the predicates are disabled in test mode, only the extender filters the nodes
+	result, err := context.FilterNodes("UID-POD-00001", []string{"node-1", "node-2", "node-3"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result.FitNodes, []string{"node-1", "node-3"})
+	assert.Assert(t, strings.Contains(result.FailedNodes["node-2"], "license not available"),
+		result.FailedNodes["node-2"])
+	assert.NilError(t, context.IsPodFitNode("UID-POD-00001", "node-1"))
+	err = context.IsPodFitNode("UID-POD-00001", "node-2")
+	assert.Assert(t, err != nil)
+	predicateErr, ok := err.(*plugin.PredicateError)
+	assert.Assert(t, ok)
+	assert.Equal(t, predicateErr.Predicate, plugin.ExtenderPredicate)
+
+	diagnosis, ok := context.GetPodDiagnosis("UID-POD-00001")
+	assert.Assert(t, ok)
+	assert.Equal(t, diagnosis.Summary(), "2/3 nodes are available: 1 license not available.")
+
+	// the extender scores are added to the scores of the priorities
+	scores, err := context.ScoreNodes("UID-POD-00001", []string{"node-1", "node-3"})
+	assert.NilError(t, err)
+	assert.Equal(t, scores[0].NodeID, "node-3")
+	assert.Equal(t, scores[0].Score, 10)
+
+	// the extender binds the pod, the api server is not called
+	context.kubeClient.(*test.KubeClientMock).MockBindFn(func(pod *v1.Pod, hostID string) error {
+		return fmt.Errorf("pod should be bound by the extender")
+	})
+	assert.NilError(t, context.bindPod(pod, "node-3"))
+	assert.DeepEqual(t, bindings, []string{"pod/node-3"})
+}
+
+func TestUnreservePod(t *testing.T) {
+	context := initContextForTest()
+	context.schedulerCache.AddNode(&v1.Node{
+		ObjectMeta: apis.ObjectMeta{Name: "node-1", UID: "uid_node-1"},
+	})
+	pod := &v1.Pod{
+		ObjectMeta: apis.ObjectMeta{Name: "pod", UID: "UID-POD-00001"},
+	}
+	assert.NilError(t, context.schedulerCache.AddPod(pod))
+
+	// unknown pod
+	assert.Assert(t, context.UnreservePod("UID-POD-NOT-EXIST") != nil)
+	// pending pod, not assumed
+	assert.Assert(t, context.UnreservePod("UID-POD-00001") != nil)
+
+	assert.NilError(t, context.AssumePod("UID-POD-00001", "node-1"))
+	assert.Equal(t, len(context.schedulerCache.GetNode("node-1").Pods()), 1)
+	assert.NilError(t, context.UnreservePod("UID-POD-00001"))
+	assert.Equal(t, len(context.schedulerCache.GetNode("node-1").Pods()), 0)
+	assert.Equal(t, len(context.schedulerCache.GetAssumedPods()), 0)
+	cached, ok := context.schedulerCache.GetPod("UID-POD-00001")
+	assert.Assert(t, ok)
+	assert.Equal(t, cached.Spec.NodeName, "")
+
+	// the pod can be assumed again
+	assert.NilError(t, context.AssumePod("UID-POD-00001", "node-1"))
+	assert.Equal(t, len(context.schedulerCache.GetNode("node-1").Pods()), 1)
+}
+
+func TestUnreservePodWaitForFirstConsumer(t *testing.T) {
+	waitForFirstConsumer := storagev1.VolumeBindingWaitForFirstConsumer
+	storageClass := &storagev1.StorageClass{
+		ObjectMeta:        apis.ObjectMeta{Name: "local"},
+		Provisioner:       "kubernetes.io/no-provisioner",
+		VolumeBindingMode: &waitForFirstConsumer,
+	}
+	node := &v1.Node{
+		ObjectMeta: apis.ObjectMeta{Name: "node-1", UID: "uid_node-1",
+			Labels: map[string]string{v1.LabelHostname: "node-1"}},
+	}
+	storageClassName := "local"
+	pv := &v1.PersistentVolume{
+		ObjectMeta: apis.ObjectMeta{Name: "pv-1", ResourceVersion: "1"},
+		Spec: v1.PersistentVolumeSpec{
+			Capacity:                      v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")},
+			AccessModes:                   []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			StorageClassName:              storageClassName,
+			PersistentVolumeReclaimPolicy: v1.PersistentVolumeReclaimRetain,
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				Local: &v1.LocalVolumeSource{Path: "/mnt/disks/pv-1"},
+			},
+			NodeAffinity: &v1.VolumeNodeAffinity{
+				Required: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{{
+						MatchExpressions: []v1.NodeSelectorRequirement{{
+							Key:      v1.LabelHostname,
+							Operator: v1.NodeSelectorOpIn,
+							Values:   []string{"node-1"},
+						}},
+					}},
+				},
+			},
+		},
+		Status: v1.PersistentVolumeStatus{Phase: v1.VolumeAvailable},
+	}
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: apis.ObjectMeta{Name: "pvc-1", Namespace: "default", UID: "UID-PVC-00001", ResourceVersion: "1",
+			SelfLink: "/api/v1/namespaces/default/persistentvolumeclaims/pvc-1"},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes:      []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			StorageClassName: &storageClassName,
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")},
+			},
+		},
+		Status: v1.PersistentVolumeClaimStatus{Phase: v1.ClaimPending},
+	}
+	pod := &v1.Pod{
+		ObjectMeta: apis.ObjectMeta{Name: "pod", Namespace: "default", UID: "UID-POD-00001"},
+		Spec: v1.PodSpec{
+			Volumes: []v1.Volume{{
+				Name: "data",
+				VolumeSource: v1.VolumeSource{
+					PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "pvc-1"},
+				},
+			}},
+		},
+	}
+
+	// a real volume binder on a fake API server, no PV controller completes the bindings
+	client := fake.NewSimpleClientset(storageClass, node, pv, pvc)
+	// the fake API server doesn't bump the resource versions, the binder ignores updates without it
+	client.PrependReactor("update", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if accessor, err := meta.Accessor(action.(k8stesting.UpdateAction).GetObject()); err == nil {
+			version, _ := strconv.Atoi(accessor.GetResourceVersion())
+			accessor.SetResourceVersion(strconv.Itoa(version + 1))
+		}
+		return false, nil, nil
+	})
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	volumeBinder := volumebinder.NewVolumeBinder(client,
+		informerFactory.Core().V1().Nodes(),
+		informerFactory.Core().V1().PersistentVolumeClaims(),
+		informerFactory.Core().V1().PersistentVolumes(),
+		informerFactory.Storage().V1().StorageClasses(),
+		time.Second)
+	// the binder only reads the nodes when it checks the bindings, register the informer before it starts
+	informerFactory.Core().V1().Nodes().Informer()
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	informerFactory.Start(stopChan)
+	informerFactory.WaitForCacheSync(stopChan)
+
+	context := initContextForTest()
+	context.conf.VolumeBindTimeout = time.Second
+	context.volumeBinder = volumeBinder
+	context.schedulerCache.AddNode(node)
+	assert.NilError(t, context.schedulerCache.AddPod(pod))
+
+	// the claim is not bound until the pod is scheduled
+	unboundSatisfied, boundSatisfied, err := volumeBinder.Binder.FindPodVolumes(pod, node)
+	assert.NilError(t, err)
+	assert.Assert(t, unboundSatisfied && boundSatisfied)
+	assert.NilError(t, context.AssumePod("UID-POD-00001", "node-1"))
+	assert.Equal(t, context.schedulerCache.GetAssumedPods()["UID-POD-00001"], false)
+	assert.Equal(t, len(volumeBinder.Binder.GetBindingsCache().GetBindings(pod, "node-1")), 1)
+
+	// the PV is updated, but the claim is never bound
+	err = context.bindPodVolumes(pod)
+	assert.ErrorContains(t, err, "timed out after 1s waiting for the volumes of the pod to be bound")
+	updated, err := client.CoreV1().PersistentVolumes().Get("pv-1", apis.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, updated.Spec.ClaimRef.Name, "pvc-1")
+
+	// the pod and its volume bindings are no longer reserved
+	assert.NilError(t, context.UnreservePod("UID-POD-00001"))
+	assert.Equal(t, len(context.schedulerCache.GetAssumedPods()), 0)
+	assert.Equal(t, len(context.schedulerCache.GetNode("node-1").Pods()), 0)
+	assert.Assert(t, volumeBinder.Binder.GetBindingsCache().GetBindings(pod, "node-1") == nil)
+
+	// the pod is scheduled again, the volumes are found again for the node
+	unboundSatisfied, boundSatisfied, err = volumeBinder.Binder.FindPodVolumes(pod, node)
+	assert.NilError(t, err)
+	assert.Assert(t, unboundSatisfied && boundSatisfied)
+	assert.NilError(t, context.AssumePod("UID-POD-00001", "node-1"))
+	assert.Equal(t, len(context.schedulerCache.GetNode("node-1").Pods()), 1)
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	plugin "github.com/cloudera/yunikorn-k8shim/pkg/plugin/predicates"
+)
+
+// podDiagnostics keeps the predicate results of the nodes checked for each pod,
+// the results are aggregated to explain why a pod is pending.
+type podDiagnostics struct {
+	pods map[string]*podResults
+	lock sync.RWMutex
+}
+
+type podResults struct {
+	// node name to the failure reasons, no reasons means the pod fits the node
+	nodes   map[string][]string
+	updated time.Time
+	// the message of the last reported event, the same message is not reported again
+	reported string
+}
+
+// the aggregated scheduling diagnosis of a pod
+type PodDiagnosis struct {
+	// number of nodes in the cluster and the number of them the pod fits on
+	TotalNodes     int
+	AvailableNodes int
+	// number of nodes failed for each reason, sorted by the count
+	Reasons []ReasonCount
+	// the failure reasons of each checked node, empty if the pod fits the node
+	Nodes   map[string][]string
+	Updated time.Time
+}
+
+type ReasonCount struct {
+	Reason string
+	Count  int
+}
+
+func newPodDiagnostics() *podDiagnostics {
+	return &podDiagnostics{
+		pods: make(map[string]*podResults),
+	}
+}
+
+// records the result of the predicates of a pod on a node
+func (d *podDiagnostics) record(podKey string, node string, err error) {
+	var reasons []string
+	if err != nil {
+		if predicateErr, ok := err.(*plugin.PredicateError); ok {
+			reasons = predicateErr.Reasons
+		} else {
+			reasons = []string{err.Error()}
+		}
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	results, ok := d.pods[podKey]
+	if !ok {
+		results = &podResults{nodes: make(map[string][]string)}
+		d.pods[podKey] = results
+	}
+	results.nodes[node] = reasons
+	results.updated = time.Now()
+}
+
+// removes the results of a pod, e.g when it is assigned to a node or deleted
+func (d *podDiagnostics) remove(podKey string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.pods, podKey)
+}
+
+// returns the diagnosis of a pod, only the nodes that still exist are considered
+func (d *podDiagnostics) get(podKey string, nodeExists func(string) bool, totalNodes int) (*PodDiagnosis, bool) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	results, ok := d.pods[podKey]
+	if !ok || len(results.nodes) == 0 {
+		return nil, false
+	}
+	diagnosis := &PodDiagnosis{
+		TotalNodes: totalNodes,
+		Nodes:      make(map[string][]string),
+		Updated:    results.updated,
+	}
+	counts := make(map[string]int)
+	for node, reasons := range results.nodes {
+		if !nodeExists(node) {
+			continue
+		}
+		diagnosis.Nodes[node] = reasons
+		if len(reasons) == 0 {
+			diagnosis.AvailableNodes++
+		}
+		for _, reason := range reasons {
+			counts[reason]++
+		}
+	}
+	for reason, count := range counts {
+		diagnosis.Reasons = append(diagnosis.Reasons, ReasonCount{Reason: reason, Count: count})
+	}
+	sort.Slice(diagnosis.Reasons, func(i, j int) bool {
+		if diagnosis.Reasons[i].Count != diagnosis.Reasons[j].Count {
+			return diagnosis.Reasons[i].Count > diagnosis.Reasons[j].Count
+		}
+		return diagnosis.Reasons[i].Reason < diagnosis.Reasons[j].Reason
+	})
+	return diagnosis, true
+}
+
+// returns true if the message differs from the last message reported for the pod,
+// the message is remembered as reported then.
+func (d *podDiagnostics) shouldReport(podKey string, message string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	results, ok := d.pods[podKey]
+	if !ok {
+		results = &podResults{nodes: make(map[string][]string)}
+		d.pods[podKey] = results
+	}
+	if results.reported == message {
+		return false
+	}
+	results.reported = message
+	return true
+}
+
+// summarizes the node failures in the style of the default scheduler, e.g
+// "0/120 nodes are available: 80 Insufficient cpu, 40 node(s) had taints that the pod didn't tolerate."
+func (d *PodDiagnosis) Summary() string {
+	reasons := make([]string, len(d.Reasons))
+	for i, reason := range d.Reasons {
+		reasons[i] = fmt.Sprintf("%d %s", reason.Count, reason.Reason)
+	}
+	if len(reasons) == 0 {
+		return fmt.Sprintf("%d/%d nodes are available.", d.AvailableNodes, d.TotalNodes)
+	}
+	return fmt.Sprintf("%d/%d nodes are available: %s.", d.AvailableNodes, d.TotalNodes, strings.Join(reasons, ", "))
+}
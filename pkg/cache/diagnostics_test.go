@@ -0,0 +1,135 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"testing"
+
+	"gotest.tools/assert"
+	v1 "k8s.io/api/core/v1"
+	apis "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/common"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/test"
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+	plugin "github.com/cloudera/yunikorn-k8shim/pkg/plugin/predicates"
+)
+
+func TestPodDiagnosis(t *testing.T) {
+	diagnostics := newPodDiagnostics()
+	allNodes := func(string) bool { return true }
+
+	// nothing recorded yet
+	_, ok := diagnostics.get("pod-1", allNodes, 5)
+	assert.Assert(t, !ok)
+
+	cpu := &plugin.PredicateError{Predicate: "PodFitsResources", Reasons: []string{"Insufficient cpu"}}
+	cpuAndMemory := &plugin.PredicateError{Predicate: "PodFitsResources",
+		Reasons: []string{"Insufficient cpu", "Insufficient memory"}}
+	diagnostics.record("pod-1", "node-1", cpu)
+	diagnostics.record("pod-1", "node-2", cpu)
+	diagnostics.record("pod-1", "node-3", cpuAndMemory)
+	diagnostics.record("pod-1", "node-4", fmt.Errorf("node not found"))
+	diagnostics.record("pod-1", "node-5", nil)
+
+	diagnosis, ok := diagnostics.get("pod-1", allNodes, 5)
+	assert.Assert(t, ok)
+	assert.Equal(t, diagnosis.TotalNodes, 5)
+	assert.Equal(t, diagnosis.AvailableNodes, 1)
+	assert.DeepEqual(t, diagnosis.Reasons, []ReasonCount{
+		{Reason: "Insufficient cpu", Count: 3},
+		{Reason: "Insufficient memory", Count: 1},
+		{Reason: "node not found", Count: 1},
+	})
+	assert.Equal(t, len(diagnosis.Nodes), 5)
+	assert.Equal(t, len(diagnosis.Nodes["node-5"]), 0)
+	assert.Equal(t, diagnosis.Summary(),
+		"1/5 nodes are available: 3 Insufficient cpu, 1 Insufficient memory, 1 node not found.")
+
+	// a later result of the same node replaces the previous one
+	diagnostics.record("pod-1", "node-1", nil)
+	diagnosis, ok = diagnostics.get("pod-1", allNodes, 5)
+	assert.Assert(t, ok)
+	assert.Equal(t, diagnosis.AvailableNodes, 2)
+	assert.Equal(t, diagnosis.Reasons[0], ReasonCount{Reason: "Insufficient cpu", Count: 2})
+
+	// removed nodes are not counted
+	diagnosis, ok = diagnostics.get("pod-1", func(node string) bool { return node != "node-2" }, 4)
+	assert.Assert(t, ok)
+	assert.Equal(t, len(diagnosis.Nodes), 4)
+	assert.Equal(t, diagnosis.Summary(),
+		"2/4 nodes are available: 1 Insufficient cpu, 1 Insufficient memory, 1 node not found.")
+
+	diagnostics.remove("pod-1")
+	_, ok = diagnostics.get("pod-1", allNodes, 5)
+	assert.Assert(t, !ok)
+}
+
+func TestShouldReport(t *testing.T) {
+	diagnostics := newPodDiagnostics()
+	assert.Assert(t, diagnostics.shouldReport("pod-1", "message-1"))
+	assert.Assert(t, !diagnostics.shouldReport("pod-1", "message-1"))
+	assert.Assert(t, diagnostics.shouldReport("pod-2", "message-1"))
+	assert.Assert(t, diagnostics.shouldReport("pod-1", "message-2"))
+	assert.Assert(t, diagnostics.shouldReport("pod-1", "message-1"))
+
+	// reporting alone does not produce a diagnosis
+	_, ok := diagnostics.get("pod-1", func(string) bool { return true }, 1)
+	assert.Assert(t, !ok)
+
+	// once the pod is removed, the message is reported again
+	diagnostics.remove("pod-1")
+	assert.Assert(t, diagnostics.shouldReport("pod-1", "message-1"))
+}
+
+func TestGetPendingMessage(t *testing.T) {
+	conf.Set(&conf.SchedulerConf{TestMode: true})
+	context := initContextForTest()
+
+	app := NewApplication("app01", "root.a", "bob", map[string]string{}, test.NewSchedulerAPIMock())
+	context.AddApplication(app)
+	task := CreateTaskForTest("task01", app, common.NewResourceBuilder().Build(), context)
+	app.AddTask(task)
+
+	assert.Equal(t, context.GetPendingMessage(task),
+		"application \"app01\" in queue \"root.a\" is New: waiting for resources from the queue")
+
+	for _, name := range []string{"node-1", "node-2"} {
+		context.schedulerCache.AddNode(&v1.Node{
+			ObjectMeta: apis.ObjectMeta{Name: name, UID: types.UID("uid_" + name)},
+		})
+	}
+	context.diagnostics.record("task01", "node-1",
+		&plugin.PredicateError{Predicate: "PodFitsResources", Reasons: []string{"Insufficient cpu"}})
+	context.diagnostics.record("task01", "node-2", nil)
+
+	diagnosis, ok := context.GetPodDiagnosis("task01")
+	assert.Assert(t, ok)
+	assert.Equal(t, diagnosis.TotalNodes, 2)
+	assert.Equal(t, diagnosis.AvailableNodes, 1)
+	assert.Equal(t, context.GetPendingMessage(task),
+		"application \"app01\" in queue \"root.a\" is New: 1/2 nodes are available: 1 Insufficient cpu.")
+
+	// results of removed nodes are ignored
+	context.schedulerCache.RemoveNode(&v1.Node{
+		ObjectMeta: apis.ObjectMeta{Name: "node-2", UID: "uid_node-2"},
+	})
+	assert.Equal(t, context.GetPendingMessage(task),
+		"application \"app01\" in queue \"root.a\" is New: 0/1 nodes are available: 1 Insufficient cpu.")
+}
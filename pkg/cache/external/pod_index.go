@@ -0,0 +1,143 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package external
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// the pods on the nodes of the cache indexed by namespace and by label,
+// selector queries only check the pods which can match the selector.
+// The index is not locked, it is changed under the cache lock.
+type podIndex struct {
+	// pod key to pod
+	pods map[string]*v1.Pod
+	// namespace to the pods in the namespace
+	namespaces map[string]map[string]*v1.Pod
+	// label key to label value to the pods with the label
+	labels map[string]map[string]map[string]*v1.Pod
+}
+
+func newPodIndex() *podIndex {
+	return &podIndex{
+		pods:       make(map[string]*v1.Pod),
+		namespaces: make(map[string]map[string]*v1.Pod),
+		labels:     make(map[string]map[string]map[string]*v1.Pod),
+	}
+}
+
+// adds the pod to the index, a pod indexed with the same key is replaced
+func (i *podIndex) add(key string, pod *v1.Pod) {
+	i.remove(key)
+	i.pods[key] = pod
+	if _, ok := i.namespaces[pod.Namespace]; !ok {
+		i.namespaces[pod.Namespace] = make(map[string]*v1.Pod)
+	}
+	i.namespaces[pod.Namespace][key] = pod
+	for name, value := range pod.Labels {
+		values, ok := i.labels[name]
+		if !ok {
+			values = make(map[string]map[string]*v1.Pod)
+			i.labels[name] = values
+		}
+		if _, ok = values[value]; !ok {
+			values[value] = make(map[string]*v1.Pod)
+		}
+		values[value][key] = pod
+	}
+}
+
+func (i *podIndex) remove(key string) {
+	pod, ok := i.pods[key]
+	if !ok {
+		return
+	}
+	delete(i.pods, key)
+	delete(i.namespaces[pod.Namespace], key)
+	if len(i.namespaces[pod.Namespace]) == 0 {
+		delete(i.namespaces, pod.Namespace)
+	}
+	for name, value := range pod.Labels {
+		values := i.labels[name]
+		delete(values[value], key)
+		if len(values[value]) == 0 {
+			delete(values, value)
+		}
+		if len(values) == 0 {
+			delete(i.labels, name)
+		}
+	}
+}
+
+// returns the pods in the namespace matching the selector, all namespaces are
+// searched if the namespace is empty. Only the smallest set of pods found in the
+// indexes for the namespace or for one of the requirements of the selector is checked.
+func (i *podIndex) list(namespace string, selector labels.Selector) []*v1.Pod {
+	requirements, selectable := selector.Requirements()
+	if !selectable {
+		return nil
+	}
+	candidates := []map[string]*v1.Pod{i.pods}
+	size := len(i.pods)
+	if namespace != "" {
+		candidates = []map[string]*v1.Pod{i.namespaces[namespace]}
+		size = len(i.namespaces[namespace])
+	}
+	for _, requirement := range requirements {
+		if matching, matchingSize, ok := i.lookup(requirement); ok && matchingSize < size {
+			candidates = matching
+			size = matchingSize
+		}
+	}
+
+	pods := make([]*v1.Pod, 0, size)
+	for _, set := range candidates {
+		for _, pod := range set {
+			if (namespace == "" || pod.Namespace == namespace) && selector.Matches(labels.Set(pod.Labels)) {
+				pods = append(pods, pod)
+			}
+		}
+	}
+	return pods
+}
+
+// returns the sets of pods which can match the requirement and their total size, the sets are
+// disjoint. Only the requirements which need a label to be set are looked up in the index.
+func (i *podIndex) lookup(requirement labels.Requirement) ([]map[string]*v1.Pod, int, bool) {
+	values := i.labels[requirement.Key()]
+	var sets []map[string]*v1.Pod
+	size := 0
+	switch requirement.Operator() {
+	case selection.Equals, selection.DoubleEquals, selection.In:
+		for value := range requirement.Values() {
+			if set, ok := values[value]; ok {
+				sets = append(sets, set)
+				size += len(set)
+			}
+		}
+	case selection.Exists, selection.GreaterThan, selection.LessThan:
+		for _, set := range values {
+			sets = append(sets, set)
+			size += len(set)
+		}
+	default:
+		return nil, 0, false
+	}
+	return sets, size, true
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package external
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"gotest.tools/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	schedulernode "k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+)
+
+func podUIDs(pods []*v1.Pod) []string {
+	uids := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		uids = append(uids, string(pod.UID))
+	}
+	sort.Strings(uids)
+	return uids
+}
+
+// lists the pods the way the cache did before the pods were indexed, by checking every pod on every node
+func scanPods(nodeInfos map[string]*schedulernode.NodeInfo, namespace string, selector labels.Selector) []*v1.Pod {
+	pods := make([]*v1.Pod, 0)
+	for _, nodeInfo := range nodeInfos {
+		for _, pod := range nodeInfo.Pods() {
+			if (namespace == "" || pod.Namespace == namespace) && selector.Matches(labels.Set(pod.Labels)) {
+				pods = append(pods, pod)
+			}
+		}
+	}
+	return pods
+}
+
+func TestPodIndexList(t *testing.T) {
+	index := newPodIndex()
+	index.add("1", newTestPod("1", "ns-1", "node-1", map[string]string{"app": "web", "tier": "front"}))
+	index.add("2", newTestPod("2", "ns-1", "node-1", map[string]string{"app": "db"}))
+	index.add("3", newTestPod("3", "ns-2", "node-2", map[string]string{"app": "web", "tier": "back"}))
+	index.add("4", newTestPod("4", "ns-2", "node-2", nil))
+
+	testCases := []struct {
+		namespace string
+		selector  string
+		expected  []string
+	}{
+		{"", "", []string{"1", "2", "3", "4"}},
+		{"ns-1", "", []string{"1", "2"}},
+		{"ns-3", "", []string{}},
+		{"", "app=web", []string{"1", "3"}},
+		{"ns-2", "app=web", []string{"3"}},
+		{"", "app in (web,db)", []string{"1", "2", "3"}},
+		{"", "app=web,tier=back", []string{"3"}},
+		{"", "tier", []string{"1", "3"}},
+		{"", "!tier", []string{"2", "4"}},
+		{"", "app!=web", []string{"2", "4"}},
+		{"", "app notin (web)", []string{"2", "4"}},
+		{"", "app=cache", []string{}},
+		{"", "missing=label", []string{}},
+	}
+	for _, tc := range testCases {
+		selector, err := labels.Parse(tc.selector)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, podUIDs(index.list(tc.namespace, selector)), tc.expected)
+	}
+	assert.Equal(t, len(index.list("", labels.Nothing())), 0)
+
+	// a pod added again replaces the indexed pod
+	index.add("1", newTestPod("1", "ns-1", "node-1", map[string]string{"app": "db"}))
+	assert.DeepEqual(t, podUIDs(index.list("", labels.SelectorFromSet(labels.Set{"app": "web"}))), []string{"3"})
+	assert.DeepEqual(t, podUIDs(index.list("", labels.SelectorFromSet(labels.Set{"app": "db"}))), []string{"1", "2"})
+	_, ok := index.labels["tier"]["front"]
+	assert.Assert(t, !ok)
+
+	// the removed pods leave no empty index entries behind
+	for _, key := range []string{"1", "2", "3", "4", "5"} {
+		index.remove(key)
+	}
+	assert.Equal(t, len(index.pods), 0)
+	assert.Equal(t, len(index.namespaces), 0)
+	assert.Equal(t, len(index.labels), 0)
+}
+
+func TestFilteredListIndexed(t *testing.T) {
+	cache := NewSchedulerCache(nil, nil, nil, nil, 0)
+	cache.AddNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+	cache.AddNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}})
+	web := labels.SelectorFromSet(labels.Set{"app": "web"})
+
+	// pending pods are not listed
+	assert.NilError(t, cache.AddPod(newTestPod("1", "ns-1", "", map[string]string{"app": "web"})))
+	assert.Equal(t, len(cache.ListInNamespace("ns-1", web)), 0)
+
+	// the assumed pod is listed until it is forgotten
+	assumed := newTestPod("1", "ns-1", "node-1", map[string]string{"app": "web"})
+	assert.NilError(t, cache.AssumePod(assumed, true))
+	assert.DeepEqual(t, podUIDs(cache.ListInNamespace("ns-1", web)), []string{"1"})
+	assert.NilError(t, cache.ForgetPod(assumed))
+	assert.Equal(t, len(cache.ListInNamespace("ns-1", web)), 0)
+
+	// the index follows the label changes of the updated pods
+	pod := newTestPod("2", "ns-1", "node-2", map[string]string{"app": "web"})
+	assert.NilError(t, cache.AddPod(pod))
+	pods, err := cache.List(web)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, podUIDs(pods), []string{"2"})
+	updated := newTestPod("2", "ns-1", "node-2", map[string]string{"app": "db"})
+	assert.NilError(t, cache.UpdatePod(pod, updated))
+	pods, err = cache.List(web)
+	assert.NilError(t, err)
+	assert.Equal(t, len(pods), 0)
+
+	// the filter is applied to the matching pods
+	assert.NilError(t, cache.AddPod(newTestPod("3", "ns-2", "node-1", map[string]string{"app": "db"})))
+	pods, err = cache.FilteredList(func(pod *v1.Pod) bool {
+		return pod.Spec.NodeName == "node-1"
+	}, labels.SelectorFromSet(labels.Set{"app": "db"}))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, podUIDs(pods), []string{"3"})
+
+	// the pods of a removed node are not listed
+	assert.NilError(t, cache.RemovePod(updated))
+	assert.NilError(t, cache.RemoveNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}))
+	pods, err = cache.List(labels.Everything())
+	assert.NilError(t, err)
+	assert.Equal(t, len(pods), 0)
+}
+
+// builds a cache with the given number of pods spread over 1000 nodes and 100 namespaces,
+// each pod has an app label shared by 10 pods and a tier label shared by a third of the pods.
+func newBenchmarkCache(b *testing.B, podCount int) *SchedulerCache {
+	cache := NewSchedulerCache(nil, nil, nil, nil, 0)
+	for i := 0; i < 1000; i++ {
+		cache.AddNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node-%d", i)}})
+	}
+	for i := 0; i < podCount; i++ {
+		pod := newTestPod(fmt.Sprintf("pod-%d", i), fmt.Sprintf("ns-%d", i%100),
+			fmt.Sprintf("node-%d", i%1000), map[string]string{
+				"app":  fmt.Sprintf("app-%d", i/10),
+				"tier": fmt.Sprintf("tier-%d", i%3),
+			})
+		if err := cache.AddPod(pod); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return cache
+}
+
+func BenchmarkListBySelector(b *testing.B) {
+	selector := labels.SelectorFromSet(labels.Set{"app": "app-42", "tier": "tier-1"})
+	for _, podCount := range []int{10000, 100000} {
+		cache := newBenchmarkCache(b, podCount)
+		nodeInfos := cache.GetNodesInfoMap()
+		b.Run(fmt.Sprintf("scan/pods=%d", podCount), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				scanPods(nodeInfos, "", selector)
+			}
+		})
+		b.Run(fmt.Sprintf("indexed/pods=%d", podCount), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if _, err := cache.List(selector); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkListInNamespace(b *testing.B) {
+	selector := labels.SelectorFromSet(labels.Set{"tier": "tier-1"})
+	for _, podCount := range []int{10000, 100000} {
+		cache := newBenchmarkCache(b, podCount)
+		nodeInfos := cache.GetNodesInfoMap()
+		b.Run(fmt.Sprintf("scan/pods=%d", podCount), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				scanPods(nodeInfos, "ns-7", selector)
+			}
+		})
+		b.Run(fmt.Sprintf("indexed/pods=%d", podCount), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				cache.ListInNamespace("ns-7", selector)
+			}
+		})
+	}
+}
+
+// the write path: a pod assumed on and forgotten from a node which already has many pods,
+// both the pod index and the snapshot of the node are updated on each change.
+func BenchmarkAssumePod(b *testing.B) {
+	for _, podCount := range []int{100, 1000, 10000} {
+		cache := NewSchedulerCache(nil, nil, nil, nil, 0)
+		cache.AddNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+		for i := 0; i < podCount; i++ {
+			pod := newTestPod(fmt.Sprintf("pod-%d", i), fmt.Sprintf("ns-%d", i%100),
+				"node-1", map[string]string{"app": fmt.Sprintf("app-%d", i/10)})
+			if err := cache.AddPod(pod); err != nil {
+				b.Fatal(err)
+			}
+		}
+		pod := newTestPod("assumed", "ns-1", "node-1", map[string]string{"app": "app-1"})
+		b.Run(fmt.Sprintf("pods=%d", podCount), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if err := cache.AssumePod(pod, true); err != nil {
+					b.Fatal(err)
+				}
+				if err := cache.ForgetPod(pod); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -19,11 +19,15 @@ package external
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 	v1 "k8s.io/api/core/v1"
 	storageV1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	corelistersV1 "k8s.io/client-go/listers/core/v1"
 	storagelisterV1 "k8s.io/client-go/listers/storage/v1"
 	"k8s.io/kubernetes/pkg/scheduler/algorithm"
@@ -33,8 +37,12 @@ import (
 	"k8s.io/kubernetes/pkg/scheduler/volumebinder"
 
 	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+	"github.com/cloudera/yunikorn-k8shim/pkg/metrics"
 )
 
+// interval of checking the assumed pods for expiration
+const cleanAssumedPeriod = time.Second
+
 // scheduler cache maintains some critical information about nodes and pods used for scheduling
 // nodes are cached in the form of de-scheduler nodeInfo, instead of re-creating all nodes info from scratch,
 // we replicate nodes info from de-scheduler, in order to re-use predicates functions.
@@ -42,10 +50,25 @@ type SchedulerCache struct {
 	// node name to NodeInfo map
 	nodesMap map[string]*schedulernode.NodeInfo
 	podsMap  map[string]*v1.Pod
+	// the pods on the nodes, indexed to list the pods matching a selector
+	podIndex *podIndex
+	// the images present on the nodes, the image locality priority prefers the nodes with the images of a pod
+	imageStates map[string]*imageState
 	// this is a map of assumed pods,
 	// the value indicates if a pod volumes are all bound
 	assumedPods map[string]bool
-	lock        sync.RWMutex
+	// the deadlines of the assumed pods which finished binding, an assumed pod
+	// is expired when the informer does not confirm it before its deadline
+	assumedPodDeadlines map[string]time.Time
+	// how long an assumed pod is kept after its binding finished, 0 means forever
+	assumedPodTTL time.Duration
+	// increased on every change of the nodes or pods, results derived
+	// from the cache content stay valid while the generation is unchanged
+	generation uint64
+	lock       sync.RWMutex
+	// the latest snapshot of the nodes, it is rebuilt by the writers under the cache lock
+	// and it is published atomically, so that the readers do not need any lock
+	snapshot atomic.Value
 
 	pvLister      corelistersV1.PersistentVolumeLister
 	pvcLister     corelistersV1.PersistentVolumeClaimLister
@@ -56,27 +79,81 @@ type SchedulerCache struct {
 func NewSchedulerCache(pvl corelistersV1.PersistentVolumeLister,
 	pvcl corelistersV1.PersistentVolumeClaimLister,
 	stl storagelisterV1.StorageClassLister,
-	binder *volumebinder.VolumeBinder) *SchedulerCache {
+	binder *volumebinder.VolumeBinder,
+	assumedPodTTL time.Duration) *SchedulerCache {
 	cache := &SchedulerCache{
-		nodesMap:      make(map[string]*schedulernode.NodeInfo),
-		podsMap:       make(map[string]*v1.Pod),
-		assumedPods:   make(map[string]bool),
-		pvLister:      pvl,
-		pvcLister:     pvcl,
-		storageLister: stl,
-		volumeBinder:  binder,
+		nodesMap:            make(map[string]*schedulernode.NodeInfo),
+		podsMap:             make(map[string]*v1.Pod),
+		podIndex:            newPodIndex(),
+		imageStates:         make(map[string]*imageState),
+		assumedPods:         make(map[string]bool),
+		assumedPodDeadlines: make(map[string]time.Time),
+		assumedPodTTL:       assumedPodTTL,
+		pvLister:            pvl,
+		pvcLister:           pvcl,
+		storageLister:       stl,
+		volumeBinder:        binder,
 	}
+	cache.snapshot.Store(&NodesSnapshot{
+		NodeInfos: make(map[string]*schedulernode.NodeInfo),
+	})
 	cache.assignArgs(GetPluginArgs())
 	return cache
 }
 
+// returns the nodes of the latest snapshot, the map and the NodeInfos in it must not be modified.
 func (cache *SchedulerCache) GetNodesInfoMap() map[string]*schedulernode.NodeInfo {
-	return cache.nodesMap
+	return cache.Snapshot().NodeInfos
+}
+
+// returns the generation of the cache content, it is increased on every change
+func (cache *SchedulerCache) GetGeneration() uint64 {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+	return cache.generation
+}
+
+// a consistent and immutable copy of the nodes in the cache, taken at the given generation,
+// it is shared by all readers so neither the map nor the NodeInfos in it must be modified.
+type NodesSnapshot struct {
+	Generation uint64
+	NodeInfos  map[string]*schedulernode.NodeInfo
+}
+
+// returns a copy of the cached nodes, the copy is not changed by later cache updates
+// so it can be read without holding the cache lock. The latest snapshot is returned
+// without locking, it is rebuilt by the writers when they change the cache.
+func (cache *SchedulerCache) Snapshot() *NodesSnapshot {
+	return cache.snapshot.Load().(*NodesSnapshot)
+}
+
+// rebuilds the snapshot if the cache generation changed since the last one, only the nodes
+// changed since then are copied, the others are shared with the previous snapshot.
+// Assumes that the cache lock is acquired for writing.
+func (cache *SchedulerCache) publishSnapshot() {
+	previous := cache.Snapshot()
+	if previous.Generation == cache.generation {
+		return
+	}
+	snapshot := &NodesSnapshot{
+		Generation: cache.generation,
+		NodeInfos:  make(map[string]*schedulernode.NodeInfo, len(cache.nodesMap)),
+	}
+	for name, nodeInfo := range cache.nodesMap {
+		// a NodeInfo gets a new generation on every change, the generations
+		// are unique across all NodeInfos so a re-created node is also copied
+		if copied, ok := previous.NodeInfos[name]; ok && copied.GetGeneration() == nodeInfo.GetGeneration() {
+			snapshot.NodeInfos[name] = copied
+			continue
+		}
+		snapshot.NodeInfos[name] = nodeInfo.Clone()
+	}
+	cache.snapshot.Store(snapshot)
 }
 
 func (cache *SchedulerCache) assignArgs(args *factory.PluginFactoryArgs) {
 	// nodes cache implemented PodLister and NodeInfo interface
-	log.Logger.Debug("Initialising PluginFactoryArgs using SchedulerCache")
+	log.Log(log.Cache).Debug("Initialising PluginFactoryArgs using SchedulerCache")
 	args.PodLister = cache
 	args.NodeInfo = cache
 	args.VolumeBinder = cache.volumeBinder
@@ -85,19 +162,31 @@ func (cache *SchedulerCache) assignArgs(args *factory.PluginFactoryArgs) {
 	args.StorageClassInfo = &predicates.CachedStorageClassInfo{StorageClassLister: cache.storageLister}
 }
 
+// returns the node from the latest snapshot, the NodeInfo must not be modified.
 func (cache *SchedulerCache) GetNode(name string) *schedulernode.NodeInfo {
-	cache.lock.RLock()
-	defer cache.lock.RUnlock()
-
-	if n, ok := cache.nodesMap[name]; ok {
+	if n, ok := cache.Snapshot().NodeInfos[name]; ok {
 		return n
 	}
 	return nil
 }
 
+// returns the number of nodes in the cache, nodes only known from the pods assigned to them are not counted
+func (cache *SchedulerCache) GetNodeCount() int {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+	count := 0
+	for _, nodeInfo := range cache.nodesMap {
+		if nodeInfo.Node() != nil {
+			count++
+		}
+	}
+	return count
+}
+
 func (cache *SchedulerCache) AddNode(node *v1.Node) {
 	cache.lock.Lock()
 	defer cache.lock.Unlock()
+	defer cache.publishSnapshot()
 
 	_, ok := cache.nodesMap[node.Name]
 	if !ok {
@@ -105,21 +194,27 @@ func (cache *SchedulerCache) AddNode(node *v1.Node) {
 		// API call always returns nil, never an error
 		//nolint:errcheck
 		_ = n.SetNode(node)
+		cache.addNodeImageStates(node, n)
 		cache.nodesMap[node.Name] = n
+		cache.generation++
 	}
 }
 
 func (cache *SchedulerCache) UpdateNode(oldNode, newNode *v1.Node) error {
 	cache.lock.Lock()
 	defer cache.lock.Unlock()
+	defer cache.publishSnapshot()
 
 	n, ok := cache.nodesMap[oldNode.Name]
 	if ok {
 		// API calls always returns nil, never an error
 		//nolint:errcheck
 		_ = n.RemoveNode(oldNode)
+		cache.removeNodeImageStates(oldNode)
 		//nolint:errcheck
 		_ = n.SetNode(newNode)
+		cache.addNodeImageStates(newNode, n)
+		cache.generation++
 	}
 	return nil
 }
@@ -127,20 +222,74 @@ func (cache *SchedulerCache) UpdateNode(oldNode, newNode *v1.Node) error {
 func (cache *SchedulerCache) RemoveNode(node *v1.Node) error {
 	cache.lock.Lock()
 	defer cache.lock.Unlock()
+	defer cache.publishSnapshot()
 
 	return cache.removeNode(node)
 }
 
 func (cache *SchedulerCache) removeNode(node *v1.Node) error {
-	_, ok := cache.nodesMap[node.Name]
+	n, ok := cache.nodesMap[node.Name]
 	if !ok {
 		return fmt.Errorf("node %v is not found", node.Name)
 	}
 
+	// the pods are not listed once their node is removed
+	for _, pod := range n.Pods() {
+		cache.podIndex.remove(string(pod.UID))
+	}
+	cache.removeNodeImageStates(n.Node())
 	delete(cache.nodesMap, node.Name)
+	cache.generation++
 	return nil
 }
 
+// the size of an image and the nodes it is present on
+type imageState struct {
+	size  int64
+	nodes sets.String
+}
+
+// From: k8s.io/kubernetes/pkg/scheduler/internal/cache/cache.go
+// adds the images of the node to the image states and sets the summaries of
+// the images on the node info. Assumes that lock is already acquired.
+func (cache *SchedulerCache) addNodeImageStates(node *v1.Node, nodeInfo *schedulernode.NodeInfo) {
+	newSum := make(map[string]*schedulernode.ImageStateSummary)
+	for _, image := range node.Status.Images {
+		for _, name := range image.Names {
+			state, ok := cache.imageStates[name]
+			if !ok {
+				state = &imageState{size: image.SizeBytes, nodes: sets.NewString(node.Name)}
+				cache.imageStates[name] = state
+			} else {
+				state.nodes.Insert(node.Name)
+			}
+			if _, ok := newSum[name]; !ok {
+				newSum[name] = &schedulernode.ImageStateSummary{Size: state.size, NumNodes: len(state.nodes)}
+			}
+		}
+	}
+	nodeInfo.SetImageStates(newSum)
+}
+
+// From: k8s.io/kubernetes/pkg/scheduler/internal/cache/cache.go
+// removes the node from the states of its images, the images which are no longer
+// present on any node are removed. Assumes that lock is already acquired.
+func (cache *SchedulerCache) removeNodeImageStates(node *v1.Node) {
+	if node == nil {
+		return
+	}
+	for _, image := range node.Status.Images {
+		for _, name := range image.Names {
+			if state, ok := cache.imageStates[name]; ok {
+				state.nodes.Delete(node.Name)
+				if len(state.nodes) == 0 {
+					delete(cache.imageStates, name)
+				}
+			}
+		}
+	}
+}
+
 // return if pod is assumed in cache, avoid nil
 func (cache *SchedulerCache) isAssumedPod(podKey string) bool {
 	_, ok := cache.assumedPods[podKey]
@@ -153,6 +302,18 @@ func (cache *SchedulerCache) ArePodVolumesAllBound(podKey string) bool {
 	return cache.assumedPods[podKey]
 }
 
+// returns a copy of the assumed pods, keyed by the pod key,
+// the value indicates if the pod volumes are all bound
+func (cache *SchedulerCache) GetAssumedPods() map[string]bool {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+	assumedPods := make(map[string]bool, len(cache.assumedPods))
+	for key, allBound := range cache.assumedPods {
+		assumedPods[key] = allBound
+	}
+	return assumedPods
+}
+
 // cache pod in the scheduler internal map, so it can be fast retrieved by UID,
 // if pod is assigned to a node, update the cached nodes map too so that scheduler
 // knows which pod is running before pod is bound to that node.
@@ -164,32 +325,35 @@ func (cache *SchedulerCache) AddPod(pod *v1.Pod) error {
 
 	cache.lock.Lock()
 	defer cache.lock.Unlock()
+	defer cache.publishSnapshot()
 
 	currState, ok := cache.podsMap[key]
 	switch {
 	case ok && cache.isAssumedPod(key):
 		if currState.Spec.NodeName != pod.Spec.NodeName {
 			// The pod was added to a different node than it was assumed to.
-			log.Logger.Warn("inconsistent pod location",
+			log.Log(log.Cache).Warn("inconsistent pod location",
 				zap.String("assumedLocation", pod.Spec.NodeName),
 				zap.String("actualLocation", currState.Spec.NodeName))
 
 			// Clean this up.
 			err = cache.removePod(currState)
 			if err != nil {
-				log.Logger.Debug("node not in cache",
+				log.Log(log.Cache).Debug("node not in cache",
 					zap.Error(err))
 			}
 			cache.addPod(pod)
 		}
-		delete(cache.assumedPods, key)
+		cache.deleteAssumedPod(key)
 		cache.podsMap[key] = pod
+		cache.generation++
 	case !ok:
 		// Pod was expired. We should add it back.
 		cache.addPod(pod)
 		cache.podsMap[key] = pod
+		cache.generation++
 	default:
-		log.Logger.Debug("pod was already in added state", zap.String("pod", key))
+		log.Log(log.Cache).Debug("pod was already in added state", zap.String("pod", key))
 	}
 	return nil
 }
@@ -202,6 +366,7 @@ func (cache *SchedulerCache) UpdatePod(oldPod, newPod *v1.Pod) error {
 
 	cache.lock.Lock()
 	defer cache.lock.Unlock()
+	defer cache.publishSnapshot()
 
 	currState, ok := cache.podsMap[key]
 	switch {
@@ -209,13 +374,14 @@ func (cache *SchedulerCache) UpdatePod(oldPod, newPod *v1.Pod) error {
 	// before Update event, in which case the state would change from Assumed to Added.
 	case ok && !cache.isAssumedPod(key):
 		if currState.Spec.NodeName != newPod.Spec.NodeName {
-			log.Logger.Error("pod updated on a different node than previously added to", zap.String("pod", key))
-			log.Logger.Error("scheduler cache is corrupted and can badly affect scheduling decisions")
+			log.Log(log.Cache).Error("pod updated on a different node than previously added to", zap.String("pod", key))
+			log.Log(log.Cache).Error("scheduler cache is corrupted and can badly affect scheduling decisions")
 		}
 		if err = cache.updatePod(oldPod, newPod); err != nil {
 			return err
 		}
 		cache.podsMap[key] = newPod
+		cache.generation++
 	default:
 		return fmt.Errorf("pod %v is not added to scheduler cache, so cannot be updated", key)
 	}
@@ -231,6 +397,7 @@ func (cache *SchedulerCache) addPod(pod *v1.Pod) {
 			cache.nodesMap[pod.Spec.NodeName] = n
 		}
 		n.AddPod(pod)
+		cache.podIndex.add(string(pod.UID), pod)
 	}
 }
 
@@ -245,6 +412,7 @@ func (cache *SchedulerCache) updatePod(oldPod, newPod *v1.Pod) error {
 func (cache *SchedulerCache) RemovePod(pod *v1.Pod) error {
 	cache.lock.Lock()
 	defer cache.lock.Unlock()
+	defer cache.publishSnapshot()
 	return cache.removePod(pod)
 }
 
@@ -256,6 +424,8 @@ func (cache *SchedulerCache) removePod(pod *v1.Pod) error {
 	if err := n.RemovePod(pod); err != nil {
 		return err
 	}
+	cache.podIndex.remove(string(pod.UID))
+	cache.generation++
 	return nil
 }
 
@@ -276,6 +446,7 @@ func (cache *SchedulerCache) AssumePod(pod *v1.Pod, allBound bool) error {
 
 	cache.lock.Lock()
 	defer cache.lock.Unlock()
+	defer cache.publishSnapshot()
 	//if _, ok := cache.podsMap[key]; ok {
 	//	return fmt.Errorf("pod %v is in the cache, so can't be assumed", key)
 	//}
@@ -283,6 +454,9 @@ func (cache *SchedulerCache) AssumePod(pod *v1.Pod, allBound bool) error {
 	cache.addPod(pod)
 	cache.podsMap[key] = pod
 	cache.assumedPods[key] = allBound
+	// the pod is assumed again, it does not expire until it finishes binding again
+	delete(cache.assumedPodDeadlines, key)
+	cache.generation++
 
 	return nil
 }
@@ -295,6 +469,7 @@ func (cache *SchedulerCache) ForgetPod(pod *v1.Pod) error {
 
 	cache.lock.Lock()
 	defer cache.lock.Unlock()
+	defer cache.publishSnapshot()
 
 	currState, ok := cache.podsMap[key]
 	if ok && currState.Spec.NodeName != pod.Spec.NodeName {
@@ -309,7 +484,7 @@ func (cache *SchedulerCache) ForgetPod(pod *v1.Pod) error {
 		if err != nil {
 			return err
 		}
-		delete(cache.assumedPods, key)
+		cache.deleteAssumedPod(key)
 		delete(cache.podsMap, key)
 	default:
 		return fmt.Errorf("pod %v wasn't assumed so cannot be forgotten", key)
@@ -317,6 +492,160 @@ func (cache *SchedulerCache) ForgetPod(pod *v1.Pod) error {
 	return nil
 }
 
+// replaces the cached state of a pod with the given one, which is the state reported by the informer,
+// the pod is moved to the node it is assigned to and it is no longer assumed. This repairs the cache
+// when an informer event was missed, the normal updates go through AddPod and UpdatePod.
+func (cache *SchedulerCache) ReplacePod(pod *v1.Pod) error {
+	key, err := schedulernode.GetPodKey(pod)
+	if err != nil {
+		return err
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	defer cache.publishSnapshot()
+
+	if currState, ok := cache.podsMap[key]; ok {
+		// the cached pod might not be on its node, that is what is repaired
+		if err = cache.removePod(currState); err != nil {
+			log.Log(log.Cache).Debug("cached pod was not on its node",
+				zap.String("pod", key),
+				zap.Error(err))
+		}
+	}
+	cache.deleteAssumedPod(key)
+	cache.addPod(pod)
+	cache.podsMap[key] = pod
+	cache.generation++
+	return nil
+}
+
+// starts the expiration of an assumed pod once its binding is finished, the pod is expired
+// if it is not confirmed by the informer within the assumed pod TTL.
+func (cache *SchedulerCache) FinishBinding(pod *v1.Pod) error {
+	return cache.finishBinding(pod, time.Now())
+}
+
+func (cache *SchedulerCache) finishBinding(pod *v1.Pod, now time.Time) error {
+	key, err := schedulernode.GetPodKey(pod)
+	if err != nil {
+		return err
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if !cache.isAssumedPod(key) {
+		// the informer confirmed the pod already
+		log.Log(log.Cache).Debug("pod is not assumed, skip finishing binding", zap.String("pod", key))
+		return nil
+	}
+	if cache.assumedPodTTL > 0 {
+		cache.assumedPodDeadlines[key] = now.Add(cache.assumedPodTTL)
+	}
+	return nil
+}
+
+// expires the assumed pods which deadline passed before the given time,
+// the pods are removed from their nodes and from the cache. An expired pod
+// is added back when the informer reports it.
+func (cache *SchedulerCache) cleanupExpiredAssumedPods(now time.Time) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	defer cache.publishSnapshot()
+
+	for key, deadline := range cache.assumedPodDeadlines {
+		if now.Before(deadline) {
+			continue
+		}
+		log.Log(log.Cache).Warn("assumed pod expired, it was not confirmed after binding",
+			zap.String("pod", key),
+			zap.Stringer("ttl", cache.assumedPodTTL))
+		if pod, ok := cache.podsMap[key]; ok {
+			if err := cache.removePod(pod); err != nil {
+				log.Log(log.Cache).Debug("failed to remove expired pod from node",
+					zap.String("pod", key),
+					zap.Error(err))
+			}
+		}
+		cache.deleteAssumedPod(key)
+		delete(cache.podsMap, key)
+		cache.generation++
+		metrics.GetShimMetrics().IncExpiredAssumedPods()
+	}
+}
+
+// periodically expires the assumed pods until the stop channel is closed
+func (cache *SchedulerCache) Run(stopCh <-chan struct{}) {
+	go wait.Until(func() {
+		cache.cleanupExpiredAssumedPods(time.Now())
+	}, cleanAssumedPeriod, stopCh)
+}
+
+// Assumes that lock is already acquired.
+func (cache *SchedulerCache) deleteAssumedPod(key string) {
+	delete(cache.assumedPods, key)
+	delete(cache.assumedPodDeadlines, key)
+}
+
+// reverts an assumed pod to pending, the pod is removed from the node it was assumed on
+// and it is kept in the cache without a node, so that it can be scheduled again.
+func (cache *SchedulerCache) UnassumePod(pod *v1.Pod) error {
+	key, err := schedulernode.GetPodKey(pod)
+	if err != nil {
+		return err
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	defer cache.publishSnapshot()
+
+	currState, ok := cache.podsMap[key]
+	if !ok || !cache.isAssumedPod(key) {
+		return fmt.Errorf("pod %v wasn't assumed so cannot be unassumed", key)
+	}
+	if err = cache.removePod(currState); err != nil {
+		return err
+	}
+	pendingPod := currState.DeepCopy()
+	pendingPod.Spec.NodeName = ""
+	cache.deleteAssumedPod(key)
+	cache.podsMap[key] = pendingPod
+	cache.generation++
+	return nil
+}
+
+// reverts all assumed pods to pending, this is used when the allocations of the assumed
+// pods are lost, the pods are scheduled again. Returns the pods which were reverted.
+func (cache *SchedulerCache) UnassumeAllPods() []*v1.Pod {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	defer cache.publishSnapshot()
+
+	pendingPods := make([]*v1.Pod, 0, len(cache.assumedPods))
+	for key := range cache.assumedPods {
+		currState, ok := cache.podsMap[key]
+		if !ok {
+			cache.deleteAssumedPod(key)
+			continue
+		}
+		if err := cache.removePod(currState); err != nil {
+			log.Log(log.Cache).Debug("assumed pod was not on its node",
+				zap.String("pod", key),
+				zap.Error(err))
+		}
+		pendingPod := currState.DeepCopy()
+		pendingPod.Spec.NodeName = ""
+		cache.deleteAssumedPod(key)
+		cache.podsMap[key] = pendingPod
+		pendingPods = append(pendingPods, pendingPod)
+	}
+	if len(pendingPods) > 0 {
+		cache.generation++
+	}
+	return pendingPods
+}
+
 // Implement scheduler/algorithm/types.go#PodLister interface
 func (cache *SchedulerCache) List(selector labels.Selector) ([]*v1.Pod, error) {
 	alwaysTrue := func(p *v1.Pod) bool { return true }
@@ -324,33 +653,34 @@ func (cache *SchedulerCache) List(selector labels.Selector) ([]*v1.Pod, error) {
 }
 
 // Implement scheduler/algorithm/types.go#PodLister interface
+// the pods matching the selector are looked up in the pod index,
+// the cache is not locked while they are filtered.
 func (cache *SchedulerCache) FilteredList(podFilter algorithm.PodFilter, selector labels.Selector) ([]*v1.Pod, error) {
 	cache.lock.RLock()
-	defer cache.lock.RUnlock()
-	// podFilter is expected to return true for most or all of the pods. We
-	// can avoid expensive array growth without wasting too much memory by
-	// pre-allocating capacity.
-	maxSize := 0
-	for _, nodeInfo := range cache.nodesMap {
-		maxSize += len(nodeInfo.Pods())
-	}
-	pods := make([]*v1.Pod, 0, maxSize)
-	for _, nodeInfo := range cache.nodesMap {
-		for _, pod := range nodeInfo.Pods() {
-			if podFilter(pod) && selector.Matches(labels.Set(pod.Labels)) {
-				pods = append(pods, pod)
-			}
+	candidates := cache.podIndex.list("", selector)
+	cache.lock.RUnlock()
+	// podFilter is expected to return true for most or all of the pods,
+	// the pods are filtered in place.
+	pods := candidates[:0]
+	for _, pod := range candidates {
+		if podFilter(pod) {
+			pods = append(pods, pod)
 		}
 	}
 	return pods, nil
 }
 
-// Implement scheduler/algorithm/predicates/predicates.go#NodeInfo interface
-func (cache *SchedulerCache) GetNodeInfo(nodeName string) (*v1.Node, error) {
+// returns the pods on the nodes in the namespace matching the selector,
+// like the namespaced selectors of the inter-pod affinity terms.
+func (cache *SchedulerCache) ListInNamespace(namespace string, selector labels.Selector) []*v1.Pod {
 	cache.lock.RLock()
 	defer cache.lock.RUnlock()
+	return cache.podIndex.list(namespace, selector)
+}
 
-	if nodeInfo, ok := cache.nodesMap[nodeName]; ok {
+// Implement scheduler/algorithm/predicates/predicates.go#NodeInfo interface
+func (cache *SchedulerCache) GetNodeInfo(nodeName string) (*v1.Node, error) {
+	if nodeInfo, ok := cache.Snapshot().NodeInfos[nodeName]; ok {
 		return nodeInfo.Node(), nil
 	}
 	return nil, fmt.Errorf("node %s is not found", nodeName)
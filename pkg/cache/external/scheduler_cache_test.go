@@ -0,0 +1,273 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package external
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newTestPod(uid string, namespace string, nodeName string, podLabels map[string]string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod-" + uid,
+			Namespace: namespace,
+			UID:       types.UID(uid),
+			Labels:    podLabels,
+		},
+		Spec: v1.PodSpec{
+			NodeName: nodeName,
+			Containers: []v1.Container{{
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{
+						v1.ResourceCPU: resource.MustParse("100m"),
+					},
+				},
+			}},
+		},
+	}
+}
+
+func newTestCache(ttl time.Duration) *SchedulerCache {
+	cache := NewSchedulerCache(nil, nil, nil, nil, ttl)
+	cache.AddNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+	return cache
+}
+
+func TestExpireAssumedPod(t *testing.T) {
+	cache := newTestCache(30 * time.Second)
+	pod := newTestPod("pod-uid-1", "default", "", nil)
+	assert.NilError(t, cache.AddPod(pod))
+
+	assumedPod := pod.DeepCopy()
+	assumedPod.Spec.NodeName = "node-1"
+	assert.NilError(t, cache.AssumePod(assumedPod, true))
+	assert.Equal(t, len(cache.GetNode("node-1").Pods()), 1)
+
+	// the pod does not expire before its binding is finished
+	now := time.Now()
+	cache.cleanupExpiredAssumedPods(now.Add(time.Hour))
+	assert.Equal(t, len(cache.GetAssumedPods()), 1)
+
+	assert.NilError(t, cache.finishBinding(assumedPod, now))
+	cache.cleanupExpiredAssumedPods(now.Add(10 * time.Second))
+	assert.Equal(t, len(cache.GetAssumedPods()), 1)
+	assert.Equal(t, len(cache.GetNode("node-1").Pods()), 1)
+
+	generation := cache.GetGeneration()
+	cache.cleanupExpiredAssumedPods(now.Add(31 * time.Second))
+	assert.Equal(t, len(cache.GetAssumedPods()), 0)
+	assert.Equal(t, len(cache.GetNode("node-1").Pods()), 0)
+	_, ok := cache.GetPod("pod-uid-1")
+	assert.Assert(t, !ok)
+	assert.Assert(t, cache.GetGeneration() > generation)
+
+	// the informer adds the expired pod back
+	assert.NilError(t, cache.AddPod(assumedPod))
+	assert.Equal(t, len(cache.GetNode("node-1").Pods()), 1)
+}
+
+func TestConfirmedPodNotExpired(t *testing.T) {
+	cache := newTestCache(30 * time.Second)
+	pod := newTestPod("pod-uid-1", "default", "node-1", nil)
+	assert.NilError(t, cache.AssumePod(pod, true))
+
+	now := time.Now()
+	assert.NilError(t, cache.finishBinding(pod, now))
+	// the informer confirms the pod
+	assert.NilError(t, cache.AddPod(pod))
+	assert.Equal(t, len(cache.GetAssumedPods()), 0)
+
+	cache.cleanupExpiredAssumedPods(now.Add(time.Hour))
+	_, ok := cache.GetPod("pod-uid-1")
+	assert.Assert(t, ok)
+	assert.Equal(t, len(cache.GetNode("node-1").Pods()), 1)
+
+	// finishing the binding of a confirmed pod does not expire it
+	assert.NilError(t, cache.finishBinding(pod, now))
+	cache.cleanupExpiredAssumedPods(now.Add(time.Hour))
+	_, ok = cache.GetPod("pod-uid-1")
+	assert.Assert(t, ok)
+}
+
+func TestAssumedPodExpiryDisabled(t *testing.T) {
+	cache := newTestCache(0)
+	pod := newTestPod("pod-uid-1", "default", "node-1", nil)
+	assert.NilError(t, cache.AssumePod(pod, true))
+
+	now := time.Now()
+	assert.NilError(t, cache.finishBinding(pod, now))
+	cache.cleanupExpiredAssumedPods(now.Add(time.Hour))
+	assert.Equal(t, len(cache.GetAssumedPods()), 1)
+	assert.Equal(t, len(cache.GetNode("node-1").Pods()), 1)
+}
+
+func TestUnassumedPodNotExpired(t *testing.T) {
+	cache := newTestCache(30 * time.Second)
+	pod := newTestPod("pod-uid-1", "default", "node-1", nil)
+	assert.NilError(t, cache.AssumePod(pod, true))
+
+	now := time.Now()
+	assert.NilError(t, cache.finishBinding(pod, now))
+	assert.NilError(t, cache.UnassumePod(pod))
+	cache.cleanupExpiredAssumedPods(now.Add(time.Hour))
+	pendingPod, ok := cache.GetPod("pod-uid-1")
+	assert.Assert(t, ok)
+	assert.Equal(t, pendingPod.Spec.NodeName, "")
+
+	// the pod assumed again waits for its binding to finish
+	assert.NilError(t, cache.AssumePod(pod, true))
+	cache.cleanupExpiredAssumedPods(now.Add(time.Hour))
+	assert.Equal(t, len(cache.GetAssumedPods()), 1)
+}
+
+func TestSnapshotIncremental(t *testing.T) {
+	cache := newTestCache(0)
+	cache.AddNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}})
+
+	snapshot := cache.Snapshot()
+	assert.Equal(t, len(snapshot.NodeInfos), 2)
+	assert.Equal(t, snapshot.Generation, cache.GetGeneration())
+	// the snapshot is not rebuilt while the cache is unchanged
+	assert.Assert(t, cache.Snapshot() == snapshot)
+
+	// only the changed node is copied
+	assert.NilError(t, cache.AddPod(newTestPod("pod-uid-1", "default", "node-1", nil)))
+	updated := cache.Snapshot()
+	assert.Assert(t, updated != snapshot)
+	assert.Assert(t, updated.Generation > snapshot.Generation)
+	assert.Assert(t, updated.NodeInfos["node-1"] != snapshot.NodeInfos["node-1"])
+	assert.Assert(t, updated.NodeInfos["node-2"] == snapshot.NodeInfos["node-2"])
+	assert.Equal(t, len(updated.NodeInfos["node-1"].Pods()), 1)
+	// the previous snapshot is not changed
+	assert.Equal(t, len(snapshot.NodeInfos["node-1"].Pods()), 0)
+
+	// a removed node is not in the next snapshot
+	assert.NilError(t, cache.RemoveNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}}))
+	removed := cache.Snapshot()
+	_, ok := removed.NodeInfos["node-2"]
+	assert.Assert(t, !ok)
+	assert.Assert(t, removed.NodeInfos["node-1"] == updated.NodeInfos["node-1"])
+
+	// a re-created node is copied again
+	cache.AddNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}})
+	recreated := cache.Snapshot()
+	assert.Assert(t, recreated.NodeInfos["node-2"] != snapshot.NodeInfos["node-2"])
+	assert.Assert(t, recreated.NodeInfos["node-2"].Node() != nil)
+
+	// the snapshot is published by the writers, it is read without locking the cache
+	cache.lock.Lock()
+	assert.Assert(t, cache.Snapshot() == recreated)
+	cache.lock.Unlock()
+}
+
+func newTestNodeWithImages(name string, images ...string) *v1.Node {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	for _, image := range images {
+		node.Status.Images = append(node.Status.Images, v1.ContainerImage{
+			Names:     []string{image},
+			SizeBytes: 500 * 1024 * 1024,
+		})
+	}
+	return node
+}
+
+func TestNodeImageStates(t *testing.T) {
+	cache := newTestCache(0)
+	cache.AddNode(newTestNodeWithImages("node-2", "app:1", "sidecar:1"))
+	cache.AddNode(newTestNodeWithImages("node-3", "app:1"))
+	assert.Equal(t, len(cache.imageStates), 2)
+	assert.Equal(t, cache.imageStates["app:1"].nodes.Len(), 2)
+
+	imageStates := cache.Snapshot().NodeInfos["node-3"].ImageStates()
+	assert.Equal(t, len(imageStates), 1)
+	assert.Equal(t, imageStates["app:1"].NumNodes, 2)
+	assert.Equal(t, imageStates["app:1"].Size, int64(500*1024*1024))
+	assert.Equal(t, len(cache.Snapshot().NodeInfos["node-1"].ImageStates()), 0)
+
+	// the images removed from a node are no longer present on it
+	assert.NilError(t, cache.UpdateNode(newTestNodeWithImages("node-2", "app:1", "sidecar:1"),
+		newTestNodeWithImages("node-2", "app:1")))
+	_, ok := cache.imageStates["sidecar:1"]
+	assert.Assert(t, !ok)
+	imageStates = cache.Snapshot().NodeInfos["node-2"].ImageStates()
+	assert.Equal(t, len(imageStates), 1)
+
+	assert.NilError(t, cache.RemoveNode(newTestNodeWithImages("node-3")))
+	assert.Equal(t, cache.imageStates["app:1"].nodes.Len(), 1)
+	assert.NilError(t, cache.RemoveNode(newTestNodeWithImages("node-2")))
+	assert.Equal(t, len(cache.imageStates), 0)
+}
+
+// the informer updates run concurrently with the readers of the snapshots,
+// run with -race to verify the snapshots are not changed by the updates.
+func TestSnapshotConcurrentUpdates(t *testing.T) {
+	cache := newTestCache(0)
+	const nodes = 5
+	const pods = 1000
+	for i := 0; i < nodes; i++ {
+		cache.AddNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node-%d", i)}})
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for _, nodeInfo := range cache.GetNodesInfoMap() {
+					requested := nodeInfo.RequestedResource()
+					assert.Equal(t, requested.MilliCPU, int64(len(nodeInfo.Pods()))*100)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < pods; i++ {
+		pod := newTestPod(fmt.Sprintf("pod-uid-%d", i), "default", fmt.Sprintf("node-%d", i%nodes), nil)
+		assert.NilError(t, cache.AssumePod(pod, true))
+		if i%2 == 0 {
+			assert.NilError(t, cache.AddPod(pod))
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: pod.Spec.NodeName}}
+			assert.NilError(t, cache.UpdateNode(node, node))
+		} else {
+			assert.NilError(t, cache.ForgetPod(pod))
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	podCount := 0
+	for _, nodeInfo := range cache.Snapshot().NodeInfos {
+		podCount += len(nodeInfo.Pods())
+	}
+	assert.Equal(t, podCount, pods/2)
+}
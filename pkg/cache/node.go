@@ -40,6 +40,7 @@ type SchedulerNode struct {
 	existingAllocations []*si.Allocation
 	schedulerAPI        api.SchedulerAPI
 	fsm                 *fsm.FSM
+	history             *events.StateHistory
 	lock                *sync.RWMutex
 }
 
@@ -51,6 +52,7 @@ func newSchedulerNode(nodeName string, nodeUID string,
 		capacity:     nodeResource,
 		schedulerAPI: schedulerAPI,
 		schedulable:  schedulable,
+		history:      events.NewStateHistory(events.ObjectNode, nodeName),
 		lock:         &sync.RWMutex{},
 	}
 	schedulerNode.initFSM()
@@ -92,22 +94,64 @@ func (n *SchedulerNode) initFSM() {
 			string(events.DrainNode):   n.handleDrainNode,
 			string(events.RestoreNode): n.handleRestoreNode,
 			string(states.Accepted):    n.postNodeAccepted,
+			events.EnterState:          n.history.OnEnterState,
 		})
 }
 
 func (n *SchedulerNode) addExistingAllocation(allocation *si.Allocation) {
 	n.lock.Lock()
 	defer n.lock.Unlock()
-	log.Logger.Info("add existing allocation",
+	log.Log(log.Cache).Info("add existing allocation",
 		zap.Any("allocation", allocation))
 	n.existingAllocations = append(n.existingAllocations, allocation)
 }
 
+func (n *SchedulerNode) GetNodeName() string {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.name
+}
+
+func (n *SchedulerNode) GetNodeUID() string {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.uid
+}
+
+func (n *SchedulerNode) GetCapacity() *si.Resource {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.capacity
+}
+
+func (n *SchedulerNode) IsSchedulable() bool {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.schedulable
+}
+
+func (n *SchedulerNode) GetExistingAllocations() []*si.Allocation {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	allocations := make([]*si.Allocation, len(n.existingAllocations))
+	copy(allocations, n.existingAllocations)
+	return allocations
+}
+
 func (n *SchedulerNode) getNodeState() string {
 	// fsm has its own internal lock, we don't need to hold node's lock here
 	return n.fsm.Current()
 }
 
+func (n *SchedulerNode) GetNodeState() string {
+	return n.getNodeState()
+}
+
+// returns the recorded state transitions of this node, from the oldest to the latest
+func (n *SchedulerNode) GetStateHistory() []events.StateTransition {
+	return n.history.GetTransitions()
+}
+
 func (n *SchedulerNode) postNodeAccepted(event *fsm.Event) {
 	// when node is accepted, it means the node is already registered to the scheduler,
 	// this doesn't mean this node is ready for scheduling, there is a step away.
@@ -127,7 +171,7 @@ func (n *SchedulerNode) postNodeAccepted(event *fsm.Event) {
 }
 
 func (n *SchedulerNode) handleNodeRecovery(event *fsm.Event) {
-	log.Logger.Info("node recovering",
+	log.Log(log.Cache).Info("node recovering",
 		zap.String("nodeID", n.name),
 		zap.Bool("schedulable", n.schedulable))
 
@@ -150,13 +194,13 @@ func (n *SchedulerNode) handleNodeRecovery(event *fsm.Event) {
 
 	// send request to scheduler-core
 	if err := n.schedulerAPI.Update(request); err != nil {
-		log.Logger.Error("failed to send request",
+		log.Log(log.Cache).Error("failed to send request",
 			zap.Any("request", request))
 	}
 }
 
 func (n *SchedulerNode) handleDrainNode(event *fsm.Event) {
-	log.Logger.Info("node enters draining mode",
+	log.Log(log.Cache).Info("node enters draining mode",
 		zap.String("nodeID", n.name))
 
 	request := &si.UpdateRequest{
@@ -177,13 +221,13 @@ func (n *SchedulerNode) handleDrainNode(event *fsm.Event) {
 
 	// send request to scheduler-core
 	if err := n.schedulerAPI.Update(request); err != nil {
-		log.Logger.Error("failed to send request",
+		log.Log(log.Cache).Error("failed to send request",
 			zap.Any("request", request))
 	}
 }
 
 func (n *SchedulerNode) handleRestoreNode(event *fsm.Event) {
-	log.Logger.Info("restore node from draining mode",
+	log.Log(log.Cache).Info("restore node from draining mode",
 		zap.String("nodeID", n.name))
 
 	request := &si.UpdateRequest{
@@ -204,7 +248,7 @@ func (n *SchedulerNode) handleRestoreNode(event *fsm.Event) {
 
 	// send request to scheduler-core
 	if err := n.schedulerAPI.Update(request); err != nil {
-		log.Logger.Error("failed to send request",
+		log.Log(log.Cache).Error("failed to send request",
 			zap.Any("request", request))
 	}
 }
@@ -212,7 +256,7 @@ func (n *SchedulerNode) handleRestoreNode(event *fsm.Event) {
 func (n *SchedulerNode) handle(ev events.SchedulerNodeEvent) error {
 	n.lock.Lock()
 	defer n.lock.Unlock()
-	log.Logger.Debug("scheduler node state transition",
+	log.Log(log.Cache).Debug("scheduler node state transition",
 		zap.String("nodeID", ev.GetNodeID()),
 		zap.String("preState", n.fsm.Current()),
 		zap.String("pendingEvent", string(ev.GetEvent())))
@@ -221,7 +265,7 @@ func (n *SchedulerNode) handle(ev events.SchedulerNodeEvent) error {
 	if err != nil && err.Error() != "no transition" {
 		return err
 	}
-	log.Logger.Debug("scheduler node state transition",
+	log.Log(log.Cache).Debug("scheduler node state transition",
 		zap.String("nodeID", ev.GetNodeID()),
 		zap.String("postState", n.fsm.Current()))
 	return nil
@@ -59,6 +59,23 @@ func (nc *schedulerNodes) getNode(name string) *SchedulerNode {
 	return nil
 }
 
+func (nc *schedulerNodes) listNodes() []*SchedulerNode {
+	nc.lock.RLock()
+	defer nc.lock.RUnlock()
+	nodes := make([]*SchedulerNode, 0, len(nc.nodesMap))
+	for _, node := range nc.nodesMap {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// forgets all nodes, they are added again in the next recovery
+func (nc *schedulerNodes) reset() {
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+	nc.nodesMap = make(map[string]*SchedulerNode)
+}
+
 func convertToNode(obj interface{}) (*v1.Node, error) {
 	if node, ok := obj.(*v1.Node); ok {
 		return node, nil
@@ -106,7 +123,7 @@ func (nc *schedulerNodes) addAndReportNode(node *v1.Node, reportNode bool) {
 
 	// add node to nodes map
 	if _, ok := nc.nodesMap[node.Name]; !ok {
-		log.Logger.Info("adding node to context",
+		log.Log(log.Cache).Info("adding node to context",
 			zap.String("nodeName", node.Name),
 			zap.String("UID", string(node.UID)),
 			zap.Bool("schedulable", !node.Spec.Unschedulable))
@@ -131,7 +148,7 @@ func (nc *schedulerNodes) addAndReportNode(node *v1.Node, reportNode bool) {
 }
 
 func (nc *schedulerNodes) drainNode(node *v1.Node) {
-	log.Logger.Info("draining node", zap.String("name", node.Name))
+	log.Log(log.Cache).Info("draining node", zap.String("name", node.Name))
 	if node, ok := nc.nodesMap[node.Name]; ok {
 		if node.getNodeState() == events.States().Node.Healthy {
 			dispatcher.Dispatch(CachedSchedulerNodeEvent{
@@ -143,7 +160,7 @@ func (nc *schedulerNodes) drainNode(node *v1.Node) {
 }
 
 func (nc *schedulerNodes) restoreNode(node *v1.Node) {
-	log.Logger.Info("restoring node", zap.String("name", node.Name))
+	log.Log(log.Cache).Info("restoring node", zap.String("name", node.Name))
 	if node, ok := nc.nodesMap[node.Name]; ok {
 		if node.getNodeState() == events.States().Node.Draining {
 			dispatcher.Dispatch(CachedSchedulerNodeEvent{
@@ -167,15 +184,15 @@ func (nc *schedulerNodes) updateNode(oldNode, newNode *v1.Node) {
 
 	// node resource changes
 	if equals(oldNode, newNode) {
-		log.Logger.Info("Node status not changed, skip this UpdateNode event")
+		log.Log(log.Cache).Info("Node status not changed, skip this UpdateNode event")
 		return
 	}
 
 	node := common.CreateFrom(newNode)
 	request := common.CreateUpdateRequestForUpdatedNode(node)
-	log.Logger.Info("report updated nodes to scheduler", zap.Any("request", request))
+	log.Log(log.Cache).Info("report updated nodes to scheduler", zap.Any("request", request))
 	if err := nc.proxy.Update(&request); err != nil {
-		log.Logger.Info("hitting error while handling UpdateNode", zap.Error(err))
+		log.Log(log.Cache).Info("hitting error while handling UpdateNode", zap.Error(err))
 	}
 }
 
@@ -185,9 +202,9 @@ func (nc *schedulerNodes) deleteNode(node *v1.Node) {
 
 	n := common.CreateFrom(node)
 	request := common.CreateUpdateRequestForDeleteNode(n)
-	log.Logger.Info("report updated nodes to scheduler", zap.Any("request", request.String()))
+	log.Log(log.Cache).Info("report updated nodes to scheduler", zap.Any("request", request.String()))
 	if err := nc.proxy.Update(&request); err != nil {
-		log.Logger.Info("hitting error while handling UpdateNode", zap.Error(err))
+		log.Log(log.Cache).Info("hitting error while handling UpdateNode", zap.Error(err))
 	}
 }
 
@@ -197,7 +214,7 @@ func (nc *schedulerNodes) schedulerNodeEventHandler() func(obj interface{}) {
 			if node := nc.getNode(event.GetNodeID()); node != nil {
 				if node.canHandle(event) {
 					if err := node.handle(event); err != nil {
-						log.Logger.Error("failed to handle scheduler node event",
+						log.Log(log.Cache).Error("failed to handle scheduler node event",
 							zap.String("event", string(event.GetEvent())),
 							zap.Error(err))
 					}
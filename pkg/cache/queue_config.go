@@ -0,0 +1,92 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/cloudera/yunikorn-core/pkg/common/configs"
+)
+
+// queueConfig keeps the queue configuration read from the configMap,
+// it serves the configuration to the scheduler core in place of the file
+// mounted in the pod, the file is only used when the configMap has no queue section.
+type queueConfig struct {
+	policyGroup string
+	data        []byte
+	// loader used when no configuration is set from the configMap
+	fileLoader configs.LoadSchedulerConfigFunc
+	lock       sync.RWMutex
+}
+
+func newQueueConfig(policyGroup string) *queueConfig {
+	return &queueConfig{
+		policyGroup: policyGroup,
+		fileLoader:  configs.SchedulerConfigLoader,
+	}
+}
+
+// key of the queue configuration in the configMap, e.g queues.yaml,
+// it is named after the policy group like the file the core loads.
+func (qc *queueConfig) configMapKey() string {
+	return fmt.Sprintf("%s.yaml", qc.policyGroup)
+}
+
+// makes the scheduler core load the queue configuration from here
+func (qc *queueConfig) install() {
+	configs.SchedulerConfigLoader = qc.load
+}
+
+// implements configs.LoadSchedulerConfigFunc
+func (qc *queueConfig) load(policyGroup string) (*configs.SchedulerConfig, error) {
+	qc.lock.RLock()
+	data := qc.data
+	qc.lock.RUnlock()
+	if data == nil || policyGroup != qc.policyGroup {
+		return qc.fileLoader(policyGroup)
+	}
+	return configs.LoadSchedulerConfigFromByteArray(data)
+}
+
+// validates and keeps the given queue configuration, an invalid configuration is
+// rejected and the previous one is kept. Returns true if the configuration is changed.
+func (qc *queueConfig) update(data []byte) (bool, error) {
+	if _, err := configs.LoadSchedulerConfigFromByteArray(data); err != nil {
+		return false, err
+	}
+	qc.lock.Lock()
+	defer qc.lock.Unlock()
+	if qc.data != nil && bytes.Equal(qc.data, data) {
+		return false, nil
+	}
+	qc.data = data
+	return true, nil
+}
+
+// removes the queue configuration, the core falls back to the configuration file.
+// Returns true if there was a configuration set.
+func (qc *queueConfig) clear() bool {
+	qc.lock.Lock()
+	defer qc.lock.Unlock()
+	if qc.data == nil {
+		return false
+	}
+	qc.data = nil
+	return true
+}
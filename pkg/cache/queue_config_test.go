@@ -0,0 +1,157 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+	v1 "k8s.io/api/core/v1"
+	apis "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/cloudera/yunikorn-core/pkg/common/configs"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/events"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/test"
+)
+
+const validQueueConfig = `
+partitions:
+  - name: default
+    queues:
+      - name: root
+        submitacl: "*"
+`
+
+const invalidQueueConfig = `
+partitions:
+  - name: default
+    queues:
+      - name: root
+        submitacl: "*"
+        queues:
+          - name: a
+          - name: a
+`
+
+func newConfigMapForTest(data map[string]string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: apis.ObjectMeta{
+			Name:      common.DefaultConfigMapName,
+			Namespace: "default",
+		},
+		Data: data,
+	}
+}
+
+// drains the events recorded so far by the fake recorder
+func recordedEvents() []string {
+	recorder, ok := events.GetRecorder().(*record.FakeRecorder)
+	if !ok {
+		return nil
+	}
+	var recorded []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			recorded = append(recorded, event)
+		default:
+			return recorded
+		}
+	}
+}
+
+func TestQueueConfigLoad(t *testing.T) {
+	qc := newQueueConfig("queues")
+	fileLoads := 0
+	qc.fileLoader = func(policyGroup string) (*configs.SchedulerConfig, error) {
+		fileLoads++
+		return nil, fmt.Errorf("no file for %s", policyGroup)
+	}
+	assert.Equal(t, qc.configMapKey(), "queues.yaml")
+
+	// nothing set from the configMap, the file is loaded
+	_, err := qc.load("queues")
+	assert.ErrorContains(t, err, "no file for queues")
+	assert.Equal(t, fileLoads, 1)
+
+	changed, err := qc.update([]byte(invalidQueueConfig))
+	assert.Assert(t, err != nil)
+	assert.Assert(t, !changed)
+
+	changed, err = qc.update([]byte(validQueueConfig))
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+	changed, err = qc.update([]byte(validQueueConfig))
+	assert.NilError(t, err)
+	assert.Assert(t, !changed)
+
+	loaded, err := qc.load("queues")
+	assert.NilError(t, err)
+	assert.Equal(t, len(loaded.Partitions), 1)
+	assert.Equal(t, loaded.Partitions[0].Name, "default")
+	assert.Equal(t, fileLoads, 1)
+
+	// other policy groups are not served from the configMap
+	_, err = qc.load("others")
+	assert.Assert(t, err != nil)
+	assert.Equal(t, fileLoads, 2)
+
+	assert.Assert(t, qc.clear())
+	assert.Assert(t, !qc.clear())
+	_, err = qc.load("queues")
+	assert.Assert(t, err != nil)
+	assert.Equal(t, fileLoads, 3)
+}
+
+func TestReloadQueueConfigFromConfigMap(t *testing.T) {
+	context := initContextForTest()
+	api := test.NewSchedulerAPIMock()
+	context.schedulerAPI = api
+	context.queueConfig = newQueueConfig("queues")
+	recordedEvents()
+
+	// no queue section, nothing is pushed
+	context.addConfigMaps(newConfigMapForTest(map[string]string{}))
+	assert.Equal(t, api.GetReloadCount(), int32(0))
+
+	// a valid configuration is pushed to the core
+	context.updateConfigMaps(nil, newConfigMapForTest(map[string]string{"queues.yaml": validQueueConfig}))
+	assert.Equal(t, api.GetReloadCount(), int32(1))
+	recorded := recordedEvents()
+	assert.Equal(t, len(recorded), 1)
+	assert.Equal(t, recorded[0], "Normal QueueConfigValidated queue configuration queues.yaml is validated, the scheduler is reloading it")
+
+	// an invalid configuration is rejected with a warning
+	context.updateConfigMaps(nil, newConfigMapForTest(map[string]string{"queues.yaml": invalidQueueConfig}))
+	assert.Equal(t, api.GetReloadCount(), int32(1))
+	recorded = recordedEvents()
+	assert.Equal(t, len(recorded), 1)
+	assert.Assert(t, strings.HasPrefix(recorded[0], "Warning InvalidQueueConfig"), recorded[0])
+	loaded, err := context.queueConfig.load("queues")
+	assert.NilError(t, err)
+	assert.Equal(t, len(loaded.Partitions), 1)
+
+	// deleting the configMap falls back to the file
+	context.deleteConfigMaps(newConfigMapForTest(map[string]string{"queues.yaml": validQueueConfig}))
+	assert.Equal(t, api.GetReloadCount(), int32(2))
+	context.deleteConfigMaps(newConfigMapForTest(nil))
+	assert.Equal(t, api.GetReloadCount(), int32(2))
+}
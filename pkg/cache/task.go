@@ -28,12 +28,22 @@ import (
 	"github.com/cloudera/yunikorn-k8shim/pkg/common/events"
 	"github.com/cloudera/yunikorn-k8shim/pkg/dispatcher"
 	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+	"github.com/cloudera/yunikorn-k8shim/pkg/metrics"
 	"github.com/cloudera/yunikorn-scheduler-interface/lib/go/si"
 
 	"github.com/looplab/fsm"
 	v1 "k8s.io/api/core/v1"
 )
 
+// a task which failed to be bound is scheduled again after a backoff, the backoff
+// doubles on each retry up to the max backoff. The task fails once it has been
+// retried maxBindRetries times.
+var (
+	maxBindRetries          = 3
+	bindRetryInitialBackoff = time.Second
+	bindRetryMaxBackoff     = 10 * time.Second
+)
+
 type Task struct {
 	taskID         string
 	applicationID  string
@@ -43,17 +53,21 @@ type Task struct {
 	pod            *v1.Pod
 	context        *Context
 	nodeName       string
+	createTime     time.Time
+	submitTime     time.Time
+	bindRetries    int
 	sm             *fsm.FSM
+	history        *events.StateHistory
 	lock           *sync.RWMutex
 }
 
-func newTask(tid string, app *Application, ctx *Context, pod *v1.Pod) Task {
+func newTask(tid string, app *Application, ctx *Context, pod *v1.Pod) *Task {
 	taskResource := common.GetPodResource(pod)
 	return createTaskInternal(tid, app, taskResource, pod, ctx)
 }
 
 // test only
-func CreateTaskForTest(tid string, app *Application, resource *si.Resource, ctx *Context) Task {
+func CreateTaskForTest(tid string, app *Application, resource *si.Resource, ctx *Context) *Task {
 	// for testing purpose, the pod name is same as the taskID
 	taskPod := &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
@@ -64,14 +78,16 @@ func CreateTaskForTest(tid string, app *Application, resource *si.Resource, ctx
 }
 
 func createTaskInternal(tid string, app *Application, resource *si.Resource,
-	pod *v1.Pod, ctx *Context) Task {
-	task := Task{
+	pod *v1.Pod, ctx *Context) *Task {
+	task := &Task{
 		taskID:        tid,
 		applicationID: app.GetApplicationID(),
 		application:   app,
 		pod:           pod,
 		resource:      resource,
 		context:       ctx,
+		createTime:    time.Now(),
+		history:       events.NewStateHistory(events.ObjectTask, tid),
 		lock:          &sync.RWMutex{},
 	}
 
@@ -106,6 +122,9 @@ func createTaskInternal(tid string, app *Application, resource *si.Resource,
 			{Name: string(events.TaskFail),
 				Src: []string{states.Rejected, states.Allocated},
 				Dst: states.Failed},
+			{Name: string(events.RetryTask),
+				Src: []string{states.Allocated},
+				Dst: states.Pending},
 		},
 		fsm.Callbacks{
 			string(events.SubmitTask): task.handleSubmitTaskEvent,
@@ -115,8 +134,13 @@ func createTaskInternal(tid string, app *Application, resource *si.Resource,
 			states.Rejected:           task.postTaskRejected,
 			states.Completed:          task.postTaskCompleted,
 			states.Failed:             task.postTaskFailed,
+			events.EnterState:         task.onStateChange,
+
+			// the allocation is released before the task goes back to pending
+			"before_" + string(events.RetryTask): task.handleRetryEvent,
 		},
 	)
+	metrics.GetShimMetrics().IncTasksInState(states.New)
 
 	return task
 }
@@ -125,7 +149,7 @@ func createTaskInternal(tid string, app *Application, resource *si.Resource,
 func (task *Task) handle(te events.TaskEvent) error {
 	task.lock.Lock()
 	defer task.lock.Unlock()
-	log.Logger.Debug("task state transition",
+	log.Log(log.Cache).Debug("task state transition",
 		zap.String("taskID", task.taskID),
 		zap.String("preState", task.sm.Current()),
 		zap.String("pendingEvent", string(te.GetEvent())))
@@ -134,7 +158,7 @@ func (task *Task) handle(te events.TaskEvent) error {
 	if err != nil && err.Error() != "no transition" {
 		return err
 	}
-	log.Logger.Debug("task state transition",
+	log.Log(log.Cache).Debug("task state transition",
 		zap.String("taskID", task.taskID),
 		zap.String("postState", task.sm.Current()))
 	return nil
@@ -147,8 +171,33 @@ func (task *Task) canHandle(te events.TaskEvent) bool {
 }
 
 func createTaskFromPod(app *Application, ctx *Context, pod *v1.Pod) *Task {
-	task := newTask(string(pod.UID), app, ctx, pod)
-	return &task
+	return newTask(string(pod.UID), app, ctx, pod)
+}
+
+func (task *Task) GetTaskID() string {
+	task.lock.RLock()
+	defer task.lock.RUnlock()
+	return task.taskID
+}
+
+func (task *Task) GetApplicationID() string {
+	task.lock.RLock()
+	defer task.lock.RUnlock()
+	return task.applicationID
+}
+
+// returns the name of the node the task is allocated to,
+// this is empty until the task gets an allocation from the scheduler core
+func (task *Task) GetNodeName() string {
+	task.lock.RLock()
+	defer task.lock.RUnlock()
+	return task.nodeName
+}
+
+func (task *Task) GetAllocationUUID() string {
+	task.lock.RLock()
+	defer task.lock.RUnlock()
+	return task.allocationUUID
 }
 
 func (task *Task) GetTaskPod() *v1.Pod {
@@ -162,13 +211,27 @@ func (task *Task) GetTaskState() string {
 	return task.sm.Current()
 }
 
+// returns the recorded state transitions of this task, from the oldest to the latest
+func (task *Task) GetStateHistory() []events.StateTransition {
+	return task.history.GetTransitions()
+}
+
 func (task *Task) setAllocated(nodeName string) {
 	task.lock.Lock()
 	defer task.lock.Unlock()
 	task.nodeName = nodeName
+	// the state is restored directly without a fsm event, record it here
+	task.history.Record(task.sm.Current(), events.States().Task.Allocated, "SetAllocated", nodeName)
+	metrics.GetShimMetrics().MoveTaskState(task.sm.Current(), events.States().Task.Allocated)
 	task.sm.SetState(events.States().Task.Allocated)
 }
 
+// this is called every time the task enters a new state
+func (task *Task) onStateChange(event *fsm.Event) {
+	task.history.OnEnterState(event)
+	metrics.GetShimMetrics().MoveTaskState(event.Src, event.Dst)
+}
+
 func (task *Task) handleFailEvent(event *fsm.Event) {
 	eventArgs := make([]string, 1)
 	if err := events.GetEventArgsAsStrings(eventArgs, event.Args); err != nil {
@@ -176,22 +239,43 @@ func (task *Task) handleFailEvent(event *fsm.Event) {
 		return
 	}
 
-	log.Logger.Error("task failed",
+	log.Log(log.Cache).Error("task failed",
+		zap.String("appID", task.applicationID),
+		zap.String("taskID", task.taskID),
+		zap.String("reason", eventArgs[0]))
+}
+
+// the task failed to be bound to the allocated node, the allocation is released
+// and the task goes back to pending, which asks the scheduler core again.
+func (task *Task) handleRetryEvent(event *fsm.Event) {
+	eventArgs := make([]string, 1)
+	if err := events.GetEventArgsAsStrings(eventArgs, event.Args); err != nil {
+		log.Log(log.Cache).Error("error", zap.Error(err))
+		return
+	}
+
+	log.Log(log.Cache).Warn("task failed to be bound, scheduling it again",
 		zap.String("appID", task.applicationID),
 		zap.String("taskID", task.taskID),
+		zap.String("nodeName", task.nodeName),
 		zap.String("reason", eventArgs[0]))
+	task.sendReleaseRequest(task.newReleaseRequest())
+	task.allocationUUID = ""
+	task.nodeName = ""
 }
 
 func (task *Task) handleSubmitTaskEvent(event *fsm.Event) {
-	log.Logger.Debug("scheduling pod",
+	log.Log(log.Cache).Debug("scheduling pod",
 		zap.String("podName", task.pod.Name))
 	// convert the request
 	rr := common.CreateUpdateRequestForTask(task.applicationID, task.taskID, task.resource)
-	log.Logger.Debug("send update request", zap.String("request", rr.String()))
+	log.Log(log.Cache).Debug("send update request", zap.String("request", rr.String()))
 	if err := task.context.schedulerAPI.Update(&rr); err != nil {
-		log.Logger.Debug("failed to send scheduling request to scheduler", zap.Error(err))
+		log.Log(log.Cache).Debug("failed to send scheduling request to scheduler", zap.Error(err))
 		return
 	}
+	metrics.GetShimMetrics().ObservePodAddToSubmitLatency(task.createTime)
+	task.submitTime = time.Now()
 
 	events.GetRecorder().Eventf(task.pod,
 		v1.EventTypeNormal, "TaskSubmitted",
@@ -207,30 +291,40 @@ func (task *Task) handleSubmitTaskEvent(event *fsm.Event) {
 	// user/app runs out of the limit etc. Ideally, we should add more interactions between
 	// core and shim to negotiate on when to set the state to unscheduable and trigger the
 	// auto-scaling appropriately.
-	go func(t *Task) {
-		time.Sleep(5*time.Second)
-		if t.GetTaskState() == events.States().Task.Scheduling {
-			log.Logger.Debug("updating pod state ",
-				zap.String("appID", t.applicationID),
-				zap.String("taskID", t.taskID),
+	task.context.runAsync(func() {
+		// the delayed update runs right away when the scheduler shuts down,
+		// a pod which is still not allocated is not left without its condition
+		select {
+		case <-time.After(5 * time.Second):
+		case <-task.context.drainChan:
+		}
+		if task.GetTaskState() == events.States().Task.Scheduling {
+			log.Log(log.Cache).Debug("updating pod state ",
+				zap.String("appID", task.applicationID),
+				zap.String("taskID", task.taskID),
 				zap.String("podName", fmt.Sprintf("%s/%s", task.pod.Namespace, task.pod.Name)),
 				zap.String("state", "Unscheduable"))
 			// if task state is still pending after 5s,
 			// move task to un-schedule-able state.
-			t.lock.Lock()
-			defer t.lock.Unlock()
-			if err := t.context.updatePodCondition(t.pod,
+			message := task.context.GetPendingMessage(task)
+			task.lock.Lock()
+			defer task.lock.Unlock()
+			if err := task.context.updatePodCondition(task.pod,
 				&v1.PodCondition{
 					Type:    v1.PodScheduled,
 					Status:  v1.ConditionFalse,
 					Reason:  v1.PodReasonUnschedulable,
-					Message: "retrying scheduling",
+					Message: message,
 				}); err != nil {
-				log.Logger.Error("update pod condition failed",
+				log.Log(log.Cache).Error("update pod condition failed",
 					zap.Error(err))
 			}
+			// one event per pod instead of one per failed node, repeated messages are dropped
+			if task.context.diagnostics.shouldReport(task.taskID, message) {
+				events.GetRecorder().Eventf(task.pod, v1.EventTypeWarning, "FailedScheduling", message)
+			}
 		}
-	}(task)
+	})
 }
 
 // this is called after task reaches PENDING state,
@@ -242,13 +336,16 @@ func (task *Task) postTaskPending(event *fsm.Event) {
 // this is called after task reaches ALLOCATED state,
 // we run this in a go routine to bind pod to the allocated node,
 // if successful, we move task to next state BOUND,
-// otherwise we fail the task
+// otherwise we revert the reservation and schedule the task again
 func (task *Task) postTaskAllocated(event *fsm.Event) {
 	// delay binding task
 	// this calls K8s api to bind a pod to the assigned node, this may need some time,
 	// so we do a delay binding to avoid blocking main process. we tracks the result
 	// of the binding and properly handle failures.
-	go func(event *fsm.Event) {
+	// the binding is tracked as an in-flight operation, so that the scheduler
+	// waits for it to finish before it shuts down.
+	allocateTime := time.Now()
+	task.context.runAsync(func() {
 		// we need to obtain task's lock first,
 		// this ensures no other threads modifying task state at the time being
 		task.lock.Lock()
@@ -258,7 +355,7 @@ func (task *Task) postTaskAllocated(event *fsm.Event) {
 		eventArgs := make([]string, 2)
 		if err := events.GetEventArgsAsStrings(eventArgs, event.Args); err != nil {
 			errorMessage = err.Error()
-			log.Logger.Error("error", zap.Error(err))
+			log.Log(log.Cache).Error("error", zap.Error(err))
 			dispatcher.Dispatch(NewFailTaskEvent(task.applicationID, task.taskID, errorMessage))
 			return
 		}
@@ -268,42 +365,128 @@ func (task *Task) postTaskAllocated(event *fsm.Event) {
 
 		// task allocation UID is assigned once we get allocation decision from scheduler core
 		task.allocationUUID = allocUUID
+		task.nodeName = nodeID
+		// the submit time is unknown for the tasks restored during recovery
+		if !task.submitTime.IsZero() {
+			metrics.GetShimMetrics().ObservePodSubmitToAllocateLatency(task.submitTime)
+		}
+
+		if task.skipBinding() {
+			return
+		}
 
 		// before binding pod to node, first bind volumes to pod
-		log.Logger.Debug("bind pod volumes",
+		log.Log(log.Cache).Debug("bind pod volumes",
 			zap.String("podName", task.pod.Name),
 			zap.String("podUID", string(task.pod.UID)))
 		if task.context.volumeBinder != nil {
 			if err := task.context.bindPodVolumes(task.pod); err != nil {
 				errorMessage = fmt.Sprintf("bind pod volumes failed, name: %s, uid: %s, %#v",
 					task.pod.Name, task.pod.UID, err)
-				dispatcher.Dispatch(NewFailTaskEvent(task.applicationID, task.taskID, errorMessage))
+				metrics.GetShimMetrics().IncVolumeBindFailure()
 				events.GetRecorder().Eventf(task.pod,
 					v1.EventTypeWarning, "PodVolumesBindFailure", errorMessage)
+				task.unreserve(errorMessage)
 				return
 			}
 		}
 
-		log.Logger.Debug("bind pod",
+		log.Log(log.Cache).Debug("bind pod",
 			zap.String("podName", task.pod.Name),
 			zap.String("podUID", string(task.pod.UID)))
 
-		if err := task.context.kubeClient.Bind(task.pod, nodeID); err != nil {
+		// the leadership may be lost while the volumes are bound
+		if task.skipBinding() {
+			return
+		}
+
+		if err := task.context.bindPod(task.pod, nodeID); err != nil {
 			errorMessage = fmt.Sprintf("bind pod failed, name: %s, uid: %s, %#v",
 				task.pod.Name, task.pod.UID, err)
-			log.Logger.Error(errorMessage)
-			dispatcher.Dispatch(NewFailTaskEvent(task.applicationID, task.taskID, errorMessage))
+			metrics.GetShimMetrics().IncPodBindFailure()
+			log.Log(log.Cache).Error(errorMessage)
 			events.GetRecorder().Eventf(task.pod,
 				v1.EventTypeWarning, "PodBindFailure", errorMessage)
+			task.unreserve(errorMessage)
 			return
 		}
 
-		log.Logger.Info("successfully bound pod", zap.String("podName", task.pod.Name))
+		log.Log(log.Cache).Info("successfully bound pod", zap.String("podName", task.pod.Name))
+		// the assumed pod expires if the informer does not confirm it in time
+		if err := task.context.schedulerCache.FinishBinding(task.pod); err != nil {
+			log.Log(log.Cache).Warn("failed to finish binding of the assumed pod",
+				zap.String("podName", task.pod.Name),
+				zap.Error(err))
+		}
+		metrics.GetShimMetrics().ObservePodAllocateToBindLatency(allocateTime)
 		dispatcher.Dispatch(NewBindTaskEvent(task.applicationID, task.taskID))
 		events.GetRecorder().Eventf(task.pod,
 			v1.EventTypeNormal, "PodBindSuccessful",
 			"pod \"%s\" successfully bound to node \"%s\"", task.pod.Name, nodeID)
-	}(event)
+	})
+}
+
+// a scheduler that is no longer the leader must not bind anything,
+// the reservation of the pod is reverted and the pod stays pending,
+// it is scheduled again by the new leader.
+// the caller must hold the task lock.
+func (task *Task) skipBinding() bool {
+	if !task.context.isBindingDisabled() {
+		return false
+	}
+	log.Log(log.Cache).Warn("binding is disabled, skip binding pod",
+		zap.String("podName", task.pod.Name),
+		zap.String("podUID", string(task.pod.UID)))
+	if err := task.context.UnreservePod(task.taskID); err != nil {
+		log.Log(log.Cache).Warn("failed to unreserve pod",
+			zap.String("podName", task.pod.Name),
+			zap.Error(err))
+	}
+	return true
+}
+
+// reverts the reservation of a task failed to be bound and schedules the task again after a backoff,
+// the task fails if the reservation cannot be reverted or if the task has been retried too many times.
+// the caller must hold the task lock.
+func (task *Task) unreserve(message string) {
+	if err := task.context.UnreservePod(task.taskID); err != nil {
+		log.Log(log.Cache).Error("failed to unreserve pod",
+			zap.String("podName", task.pod.Name),
+			zap.Error(err))
+		dispatcher.Dispatch(NewFailTaskEvent(task.applicationID, task.taskID, message))
+		return
+	}
+	if task.bindRetries >= maxBindRetries {
+		dispatcher.Dispatch(NewFailTaskEvent(task.applicationID, task.taskID,
+			fmt.Sprintf("task failed to be bound after %d retries: %s", task.bindRetries, message)))
+		return
+	}
+	backoff := bindRetryBackoff(task.bindRetries)
+	task.bindRetries++
+	log.Log(log.Cache).Info("retry binding the task after backoff",
+		zap.String("taskID", task.taskID),
+		zap.Int("retry", task.bindRetries),
+		zap.Stringer("backoff", backoff))
+	task.context.runAsync(func() {
+		// the task is retried right away when the scheduler shuts down, this releases its allocation
+		select {
+		case <-time.After(backoff):
+		case <-task.context.drainChan:
+		}
+		dispatcher.Dispatch(NewRetryTaskEvent(task.applicationID, task.taskID, message))
+	})
+}
+
+// returns the backoff before the given retry, it doubles on each retry up to the max backoff
+func bindRetryBackoff(retries int) time.Duration {
+	backoff := bindRetryInitialBackoff
+	for i := 0; i < retries && backoff < bindRetryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > bindRetryMaxBackoff {
+		backoff = bindRetryMaxBackoff
+	}
+	return backoff
 }
 
 func (task *Task) postTaskRejected(event *fsm.Event) {
@@ -338,20 +521,26 @@ func (task *Task) postTaskCompleted(event *fsm.Event) {
 }
 
 func (task *Task) releaseAllocation() {
+	releaseRequest := task.newReleaseRequest()
 	// when task is completed, we notify the scheduler to release allocations
-	go func() {
-		// scheduler api might be nil in some tests
-		if task.context.schedulerAPI != nil {
-			releaseRequest := common.CreateReleaseAllocationRequestForTask(
-				task.applicationID, task.allocationUUID, task.application.partition)
-
-			log.Logger.Debug("send release request",
-				zap.String("releaseRequest", releaseRequest.String()))
-			if err := task.context.schedulerAPI.Update(&releaseRequest); err != nil {
-				log.Logger.Debug("failed to send scheduling request to scheduler", zap.Error(err))
-			}
+	go task.sendReleaseRequest(releaseRequest)
+}
+
+// the request is created before the allocation info of a retried task is reset
+func (task *Task) newReleaseRequest() si.UpdateRequest {
+	return common.CreateReleaseAllocationRequestForTask(
+		task.applicationID, task.allocationUUID, task.application.partition)
+}
+
+func (task *Task) sendReleaseRequest(releaseRequest si.UpdateRequest) {
+	// scheduler api might be nil in some tests
+	if task.context.schedulerAPI != nil {
+		log.Log(log.Cache).Debug("send release request",
+			zap.String("releaseRequest", releaseRequest.String()))
+		if err := task.context.schedulerAPI.Update(&releaseRequest); err != nil {
+			log.Log(log.Cache).Debug("failed to send scheduling request to scheduler", zap.Error(err))
 		}
-	}()
+	}
 }
 
 // some sanity checks before sending task for scheduling,
@@ -368,7 +557,7 @@ func (task *Task) sanityCheckBeforeScheduling() error {
 			continue
 		}
 		pvcName := volume.PersistentVolumeClaim.ClaimName
-		log.Logger.Debug("checking PVC", zap.String("name", pvcName))
+		log.Log(log.Cache).Debug("checking PVC", zap.String("name", pvcName))
 		pvc, err := task.context.pvcInformer.Lister().PersistentVolumeClaims(namespace).Get(pvcName)
 		if err != nil {
 			return err
@@ -230,3 +230,40 @@ func (re RejectTaskEvent) GetTaskID() string {
 func (re RejectTaskEvent) GetApplicationID() string {
 	return re.applicationID
 }
+
+// ------------------------
+// Retry Event
+// ------------------------
+type RetryTaskEvent struct {
+	applicationID string
+	taskID        string
+	event         events.TaskEventType
+	message       string
+}
+
+func NewRetryTaskEvent(appID string, taskID string, retryMessage string) RetryTaskEvent {
+	return RetryTaskEvent{
+		applicationID: appID,
+		taskID:        taskID,
+		event:         events.RetryTask,
+		message:       retryMessage,
+	}
+}
+
+func (re RetryTaskEvent) GetEvent() events.TaskEventType {
+	return re.event
+}
+
+func (re RetryTaskEvent) GetArgs() []interface{} {
+	args := make([]interface{}, 1)
+	args[0] = re.message
+	return args
+}
+
+func (re RetryTaskEvent) GetTaskID() string {
+	return re.taskID
+}
+
+func (re RetryTaskEvent) GetApplicationID() string {
+	return re.applicationID
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	v1 "k8s.io/api/core/v1"
+	apis "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/common"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/events"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/test"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/utils"
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+	"github.com/cloudera/yunikorn-k8shim/pkg/dispatcher"
+	"github.com/cloudera/yunikorn-scheduler-interface/lib/go/si"
+)
+
+func TestRetryTaskOnBindFailure(t *testing.T) {
+	configs := &conf.SchedulerConf{ClusterID: fakeClusterID, TestMode: true}
+	conf.Set(configs)
+	var requests []*si.UpdateRequest
+	var lock sync.Mutex
+	schedulerAPI := test.NewSchedulerAPIMock().UpdateFunction(func(request *si.UpdateRequest) error {
+		lock.Lock()
+		defer lock.Unlock()
+		requests = append(requests, request)
+		return nil
+	})
+	kubeClient := test.NewKubeClientMock()
+	kubeClient.MockBindFn(func(pod *v1.Pod, hostID string) error {
+		return fmt.Errorf("bind failure")
+	})
+	context := NewContextInternal(schedulerAPI, configs, kubeClient, true)
+	dispatcher.RegisterEventHandler(dispatcher.EventTypeApp, context.ApplicationEventHandler())
+	dispatcher.RegisterEventHandler(dispatcher.EventTypeTask, context.TaskEventHandler())
+	dispatcher.Start()
+	defer dispatcher.Stop()
+	defer func() {
+		assert.NilError(t, context.DrainAsyncOperations(time.Second))
+	}()
+	defer setBindRetryBackoff(10*time.Millisecond, 100*time.Millisecond)()
+
+	context.schedulerCache.AddNode(&v1.Node{
+		ObjectMeta: apis.ObjectMeta{Name: "node-1", UID: "uid_node-1"},
+	})
+	pod := &v1.Pod{
+		ObjectMeta: apis.ObjectMeta{Name: "pod-1", Namespace: "default", UID: "UID-POD-00001"},
+	}
+	assert.NilError(t, context.schedulerCache.AddPod(pod))
+	app := NewApplication("app01", "root.a", "bob", map[string]string{}, schedulerAPI)
+	context.AddApplication(app)
+	task := createTaskInternal("UID-POD-00001", app, common.NewResourceBuilder().Build(), pod, context)
+	app.AddTask(task)
+	task.sm.SetState(events.States().Task.Scheduling)
+
+	// the core assumes the pod before it allocates the task
+	assert.NilError(t, context.AssumePod("UID-POD-00001", "node-1"))
+	_, assumed := context.schedulerCache.GetAssumedPods()["UID-POD-00001"]
+	assert.Assert(t, assumed)
+	assert.NilError(t, task.handle(NewAllocateTaskEvent("app01", "UID-POD-00001", "alloc-1", "node-1")))
+
+	// the binding fails, the task is scheduled again
+	assert.NilError(t, utils.WaitForCondition(func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(requests) == 2
+	}, 10*time.Millisecond, 3*time.Second))
+	assertTaskState(t, task, events.States().Task.Scheduling, 3*time.Second)
+	assert.Equal(t, task.GetAllocationUUID(), "")
+	assert.Equal(t, task.GetNodeName(), "")
+
+	// the allocation is released before the task is asked again
+	lock.Lock()
+	assert.Assert(t, requests[0].Releases != nil)
+	assert.Equal(t, requests[0].Releases.AllocationsToRelease[0].UUID, "alloc-1")
+	assert.Equal(t, len(requests[1].Asks), 1)
+	assert.Equal(t, requests[1].Asks[0].AllocationKey, "UID-POD-00001")
+	lock.Unlock()
+
+	// the pod is pending again in the cache
+	_, assumed = context.schedulerCache.GetAssumedPods()["UID-POD-00001"]
+	assert.Assert(t, !assumed)
+	cached, ok := context.schedulerCache.GetPod("UID-POD-00001")
+	assert.Assert(t, ok)
+	assert.Equal(t, cached.Spec.NodeName, "")
+	assert.Equal(t, len(context.schedulerCache.GetNode("node-1").Pods()), 0)
+}
+
+func TestUnschedulableConditionOnDrain(t *testing.T) {
+	configs := &conf.SchedulerConf{ClusterID: fakeClusterID, TestMode: true}
+	conf.Set(configs)
+	schedulerAPI := test.NewSchedulerAPIMock()
+	var conditions []v1.PodCondition
+	var lock sync.Mutex
+	kubeClient := test.NewKubeClientMock()
+	kubeClient.MockUpdateStatusFn(func(pod *v1.Pod) (*v1.Pod, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		conditions = append(conditions, pod.Status.Conditions...)
+		return pod, nil
+	})
+	context := NewContextInternal(schedulerAPI, configs, kubeClient, true)
+
+	pod := &v1.Pod{
+		ObjectMeta: apis.ObjectMeta{Name: "pod-1", Namespace: "default", UID: "UID-POD-00001"},
+	}
+	app := NewApplication("app01", "root.a", "bob", map[string]string{}, schedulerAPI)
+	context.AddApplication(app)
+	task := createTaskInternal("UID-POD-00001", app, common.NewResourceBuilder().Build(), pod, context)
+	app.AddTask(task)
+	task.sm.SetState(events.States().Task.Pending)
+	assert.NilError(t, task.handle(NewSubmitTaskEvent("app01", "UID-POD-00001")))
+
+	// the delayed update is not cancelled, it runs before the drain finishes
+	start := time.Now()
+	assert.NilError(t, context.DrainAsyncOperations(time.Second))
+	assert.Assert(t, time.Since(start) < time.Second)
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, len(conditions), 1)
+	assert.Equal(t, conditions[0].Type, v1.PodScheduled)
+	assert.Equal(t, conditions[0].Status, v1.ConditionFalse)
+	assert.Equal(t, conditions[0].Reason, v1.PodReasonUnschedulable)
+}
+
+func TestFailTaskAfterBindRetries(t *testing.T) {
+	configs := &conf.SchedulerConf{ClusterID: fakeClusterID, TestMode: true}
+	conf.Set(configs)
+	var releases int32
+	schedulerAPI := test.NewSchedulerAPIMock().UpdateFunction(func(request *si.UpdateRequest) error {
+		if request.Releases != nil {
+			atomic.AddInt32(&releases, 1)
+		}
+		return nil
+	})
+	kubeClient := test.NewKubeClientMock()
+	kubeClient.MockBindFn(func(pod *v1.Pod, hostID string) error {
+		return fmt.Errorf("bind failure")
+	})
+	context := NewContextInternal(schedulerAPI, configs, kubeClient, true)
+	dispatcher.RegisterEventHandler(dispatcher.EventTypeApp, context.ApplicationEventHandler())
+	dispatcher.RegisterEventHandler(dispatcher.EventTypeTask, context.TaskEventHandler())
+	dispatcher.Start()
+	defer dispatcher.Stop()
+	defer func() {
+		assert.NilError(t, context.DrainAsyncOperations(time.Second))
+	}()
+	defer setBindRetryBackoff(10*time.Millisecond, 100*time.Millisecond)()
+
+	context.schedulerCache.AddNode(&v1.Node{
+		ObjectMeta: apis.ObjectMeta{Name: "node-1", UID: "uid_node-1"},
+	})
+	pod := &v1.Pod{
+		ObjectMeta: apis.ObjectMeta{Name: "pod-1", Namespace: "default", UID: "UID-POD-00001"},
+	}
+	assert.NilError(t, context.schedulerCache.AddPod(pod))
+	app := NewApplication("app01", "root.a", "bob", map[string]string{}, schedulerAPI)
+	context.AddApplication(app)
+	task := createTaskInternal("UID-POD-00001", app, common.NewResourceBuilder().Build(), pod, context)
+	app.AddTask(task)
+	task.sm.SetState(events.States().Task.Scheduling)
+
+	// every allocation fails to be bound, the task is retried until the limit is reached
+	for i := 0; i <= maxBindRetries; i++ {
+		assertTaskState(t, task, events.States().Task.Scheduling, 3*time.Second)
+		allocUUID := fmt.Sprintf("alloc-%d", i)
+		assert.NilError(t, context.AssumePod("UID-POD-00001", "node-1"))
+		assert.NilError(t, task.handle(NewAllocateTaskEvent("app01", "UID-POD-00001", allocUUID, "node-1")))
+	}
+	assertTaskState(t, task, events.States().Task.Failed, 3*time.Second)
+	// the allocations of the retries and the one of the failed task are released
+	assert.NilError(t, utils.WaitForCondition(func() bool {
+		return atomic.LoadInt32(&releases) == int32(maxBindRetries+1)
+	}, 10*time.Millisecond, 3*time.Second))
+	_, assumed := context.schedulerCache.GetAssumedPods()["UID-POD-00001"]
+	assert.Assert(t, !assumed)
+}
+
+func TestBindRetryBackoff(t *testing.T) {
+	defer setBindRetryBackoff(time.Second, 5*time.Second)()
+	assert.Equal(t, bindRetryBackoff(0), time.Second)
+	assert.Equal(t, bindRetryBackoff(1), 2*time.Second)
+	assert.Equal(t, bindRetryBackoff(2), 4*time.Second)
+	assert.Equal(t, bindRetryBackoff(3), 5*time.Second)
+	assert.Equal(t, bindRetryBackoff(100), 5*time.Second)
+}
+
+// sets the bind retry backoff for a test, returns a function which restores the previous backoff
+func setBindRetryBackoff(initial, max time.Duration) func() {
+	previousInitial, previousMax := bindRetryInitialBackoff, bindRetryMaxBackoff
+	bindRetryInitialBackoff, bindRetryMaxBackoff = initial, max
+	return func() {
+		bindRetryInitialBackoff, bindRetryMaxBackoff = previousInitial, previousMax
+	}
+}
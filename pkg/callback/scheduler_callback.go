@@ -25,6 +25,7 @@ import (
 	"github.com/cloudera/yunikorn-k8shim/pkg/common/events"
 	"github.com/cloudera/yunikorn-k8shim/pkg/dispatcher"
 	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+	"github.com/cloudera/yunikorn-k8shim/pkg/plugin/priorities"
 	"github.com/cloudera/yunikorn-scheduler-interface/lib/go/si"
 )
 
@@ -39,12 +40,12 @@ func NewAsyncRMCallback(ctx *cache.Context) *AsyncRMCallback {
 }
 
 func (callback *AsyncRMCallback) RecvUpdateResponse(response *si.UpdateResponse) error {
-	log.Logger.Info("callback received",
+	log.Log(log.Callback).Info("callback received",
 		zap.String("updateResponse", response.String()))
 
 	// handle new accepted nodes
 	for _, node := range response.AcceptedNodes {
-		log.Logger.Info("callback: response to accepted node",
+		log.Log(log.Callback).Info("callback: response to accepted node",
 			zap.String("nodeID", node.NodeID))
 
 		dispatcher.Dispatch(cache.CachedSchedulerNodeEvent{
@@ -54,7 +55,7 @@ func (callback *AsyncRMCallback) RecvUpdateResponse(response *si.UpdateResponse)
 	}
 
 	for _, node := range response.RejectedNodes {
-		log.Logger.Info("callback: response to rejected node",
+		log.Log(log.Callback).Info("callback: response to rejected node",
 			zap.String("nodeID", node.NodeID))
 
 		dispatcher.Dispatch(cache.CachedSchedulerNodeEvent{
@@ -66,7 +67,7 @@ func (callback *AsyncRMCallback) RecvUpdateResponse(response *si.UpdateResponse)
 	// handle new accepted apps
 	for _, app := range response.AcceptedApplications {
 		// update context
-		log.Logger.Info("callback: response to accepted application",
+		log.Log(log.Callback).Info("callback: response to accepted application",
 			zap.String("appID", app.ApplicationID))
 
 		if app, err := callback.context.GetApplication(app.ApplicationID); err == nil {
@@ -77,7 +78,7 @@ func (callback *AsyncRMCallback) RecvUpdateResponse(response *si.UpdateResponse)
 
 	for _, app := range response.RejectedApplications {
 		// update context
-		log.Logger.Info("callback: response to rejected application",
+		log.Log(log.Callback).Info("callback: response to rejected application",
 			zap.String("appID", app.ApplicationID))
 
 		if app, err := callback.context.GetApplication(app.ApplicationID); err == nil {
@@ -89,7 +90,7 @@ func (callback *AsyncRMCallback) RecvUpdateResponse(response *si.UpdateResponse)
 	// handle new allocations
 	for _, alloc := range response.NewAllocations {
 		// got allocation for pod, bind pod to the scheduled node
-		log.Logger.Info("callback: response to new allocation",
+		log.Log(log.Callback).Info("callback: response to new allocation",
 			zap.String("allocationKey", alloc.AllocationKey),
 			zap.String("UUID", alloc.UUID),
 			zap.String("applicationID", alloc.ApplicationID),
@@ -103,7 +104,7 @@ func (callback *AsyncRMCallback) RecvUpdateResponse(response *si.UpdateResponse)
 
 	for _, reject := range response.RejectedAllocations {
 		// request rejected by the scheduler, put it back and try scheduling again
-		log.Logger.Info("callback: response to rejected allocation",
+		log.Log(log.Callback).Info("callback: response to rejected allocation",
 			zap.String("allocationKey", reject.AllocationKey))
 
 		if app, err := callback.context.GetApplication(reject.ApplicationID); err == nil {
@@ -114,7 +115,7 @@ func (callback *AsyncRMCallback) RecvUpdateResponse(response *si.UpdateResponse)
 	}
 
 	for _, release := range response.ReleasedAllocations {
-		log.Logger.Info("callback: response to released allocations",
+		log.Log(log.Callback).Info("callback: response to released allocations",
 			zap.String("UUID", release.UUID))
 	}
 
@@ -126,6 +127,22 @@ func (callback *AsyncRMCallback) Predicates(args *si.PredicatesArgs) error {
 	return callback.context.IsPodFitNode(args.AllocationKey, args.NodeID)
 }
 
+// this callback evaluates the predicates of an allocation against all its candidate nodes at once,
+// it returns the nodes the allocation fits on and the failure reasons of the other nodes.
+// Note, this is a shim-side API only: the scheduler-interface has no batch predicates plugin yet,
+// the scheduler-core calls Predicates for each node.
+func (callback *AsyncRMCallback) FilterNodes(allocationKey string, nodeIDs []string) (*cache.FilterResult, error) {
+	return callback.context.FilterNodes(allocationKey, nodeIDs)
+}
+
+// this callback ranks the candidate nodes of an allocation with the configured priorities,
+// the nodes are returned sorted by their scores, the preferred node first.
+// Note, this is a shim-side API only: the scheduler-interface has no scoring plugin yet,
+// so the scheduler-core does not call it.
+func (callback *AsyncRMCallback) ScoreNodes(allocationKey string, nodeIDs []string) ([]priorities.NodeScore, error) {
+	return callback.context.ScoreNodes(allocationKey, nodeIDs)
+}
+
 // this callback implements scheduler plugin interface ReconcilePlugin.
 func (callback *AsyncRMCallback) ReSyncSchedulerCache(args *si.ReSyncSchedulerCacheArgs) error {
 	for _, assumedAlloc := range args.AssumedAllocations {
@@ -28,6 +28,9 @@ type KubeClient interface {
 	// Delete a pod from a host
 	Delete(pod *v1.Pod) error
 
+	// update the status of a pod
+	UpdateStatus(pod *v1.Pod) (*v1.Pod, error)
+
 	// minimal expose this, only informers factory needs it
 	GetClientSet() *kubernetes.Clientset
 }
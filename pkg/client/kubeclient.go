@@ -105,3 +105,15 @@ func (nc SchedulerKubeClient) Delete(pod *v1.Pod) error {
 	}
 	return nil
 }
+
+func (nc SchedulerKubeClient) UpdateStatus(pod *v1.Pod) (*v1.Pod, error) {
+	updated, err := nc.clientSet.CoreV1().Pods(pod.Namespace).UpdateStatus(pod)
+	if err != nil {
+		log.Logger.Error("failed to update pod status",
+			zap.String("namespace", pod.Namespace),
+			zap.String("podName", pod.Name),
+			zap.Error(err))
+		return nil, err
+	}
+	return updated, nil
+}
@@ -38,3 +38,4 @@ const SparkLabelRoleDriver = "driver"
 
 // Configuration
 const DefaultConfigMapName = "yunikorn-configs"
+const ShimConfigMapKey = "k8shim.yaml"
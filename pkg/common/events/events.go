@@ -67,6 +67,7 @@ const (
 	TaskBound     TaskEventType = "TaskBound"
 	CompleteTask  TaskEventType = "CompleteTask"
 	TaskFail      TaskEventType = "TaskFail"
+	RetryTask     TaskEventType = "RetryTask"
 	KillTask      TaskEventType = "KillTask"
 	TaskKilled    TaskEventType = "TaskKilled"
 )
@@ -100,6 +101,8 @@ const (
 	RecoverScheduler         SchedulerEventType = "RecoverScheduler"
 	RecoverSchedulerSucceed  SchedulerEventType = "RecoverSchedulerSucceed"
 	RecoverSchedulerFailed   SchedulerEventType = "RecoverSchedulerFailed"
+	DrainScheduler           SchedulerEventType = "DrainScheduler"
+	StopScheduler            SchedulerEventType = "StopScheduler"
 )
 
 type SchedulerEvent interface {
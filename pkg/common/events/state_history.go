@@ -0,0 +1,178 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/looplab/fsm"
+	"go.uber.org/zap"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+)
+
+// the generic fsm callback which is called every time a state machine enters a new state,
+// register this to the fsm.Callbacks to get all transitions recorded in the state history.
+const EnterState = "enter_state"
+
+// object types whose state transitions are recorded
+const (
+	ObjectApplication = "application"
+	ObjectTask        = "task"
+	ObjectNode        = "node"
+	ObjectScheduler   = "scheduler"
+)
+
+// a single state transition of an object
+type StateTransition struct {
+	ObjectType string    `json:"objectType"`
+	ObjectID   string    `json:"objectID"`
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	Event      string    `json:"event"`
+	Timestamp  time.Time `json:"timestamp"`
+	Args       []string  `json:"args,omitempty"`
+}
+
+// state history keeps the most recent state transitions of an object in a bounded ring buffer,
+// the oldest transitions are dropped once the history is full. The buffer grows with the
+// recorded transitions up to the size, most objects only have a few transitions.
+type StateHistory struct {
+	objectType  string
+	objectID    string
+	transitions []StateTransition
+	size        int
+	// the position of the oldest transition once the buffer is full
+	next int
+	lock sync.RWMutex
+}
+
+func NewStateHistory(objectType, objectID string) *StateHistory {
+	size := conf.DefaultStateHistorySize
+	if configs := conf.GetSchedulerConf(); configs != nil && configs.StateHistorySize > 0 {
+		size = configs.StateHistorySize
+	}
+	return newStateHistoryInternal(objectType, objectID, size)
+}
+
+func newStateHistoryInternal(objectType, objectID string, size int) *StateHistory {
+	return &StateHistory{
+		objectType: objectType,
+		objectID:   objectID,
+		size:       size,
+	}
+}
+
+// records the transition described by the fsm event,
+// this is designed to be used as the EnterState callback of a state machine.
+func (h *StateHistory) OnEnterState(event *fsm.Event) {
+	h.Record(event.Src, event.Dst, event.Event, event.Args...)
+}
+
+// records a state transition, this is exposed for the transitions that are not
+// triggered by a fsm event, e.g the state is restored during recovery.
+func (h *StateHistory) Record(from, to, event string, args ...interface{}) {
+	transition := StateTransition{
+		ObjectType: h.objectType,
+		ObjectID:   h.objectID,
+		From:       from,
+		To:         to,
+		Event:      event,
+		Timestamp:  time.Now(),
+	}
+	for _, arg := range args {
+		transition.Args = append(transition.Args, fmt.Sprint(arg))
+	}
+
+	h.lock.Lock()
+	if len(h.transitions) < h.size {
+		h.transitions = append(h.transitions, transition)
+	} else {
+		h.transitions[h.next] = transition
+		h.next = (h.next + 1) % h.size
+	}
+	h.lock.Unlock()
+
+	writeTransition(transition)
+}
+
+// returns a copy of the recorded state transitions, ordered from the oldest to the latest
+func (h *StateHistory) GetTransitions() []StateTransition {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	result := make([]StateTransition, 0, len(h.transitions))
+	result = append(result, h.transitions[h.next:]...)
+	result = append(result, h.transitions[:h.next]...)
+	return result
+}
+
+var transitionFile *os.File
+var transitionWriter *json.Encoder
+var transitionWriterLock sync.Mutex
+var transitionWriterOnce sync.Once
+
+// appends the transition to the state history file as a JSON line,
+// this is a no-op if the state history file is not configured.
+func writeTransition(transition StateTransition) {
+	transitionWriterOnce.Do(func() {
+		configs := conf.GetSchedulerConf()
+		if configs == nil || configs.StateHistoryFile == "" {
+			return
+		}
+		file, err := os.OpenFile(configs.StateHistoryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Logger.Warn("failed to open state history file, transitions are kept in memory only",
+				zap.String("file", configs.StateHistoryFile),
+				zap.Error(err))
+			return
+		}
+		transitionWriterLock.Lock()
+		transitionFile = file
+		transitionWriter = json.NewEncoder(file)
+		transitionWriterLock.Unlock()
+	})
+
+	transitionWriterLock.Lock()
+	defer transitionWriterLock.Unlock()
+	if transitionWriter == nil {
+		return
+	}
+	//nolint:errcheck
+	_ = transitionWriter.Encode(transition)
+}
+
+// closes the state history file, this is called when the scheduler stops.
+// The transitions recorded after this are kept in memory only.
+func CloseStateHistoryFile() {
+	transitionWriterLock.Lock()
+	defer transitionWriterLock.Unlock()
+	if transitionFile == nil {
+		return
+	}
+	if err := transitionFile.Close(); err != nil {
+		log.Logger.Warn("failed to close state history file",
+			zap.String("file", transitionFile.Name()),
+			zap.Error(err))
+	}
+	transitionFile = nil
+	transitionWriter = nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/looplab/fsm"
+	"gotest.tools/assert"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+)
+
+func TestStateHistoryRecord(t *testing.T) {
+	history := newStateHistoryInternal(ObjectTask, "task0001", 5)
+	assert.Equal(t, len(history.GetTransitions()), 0)
+	// nothing is allocated before the transitions are recorded
+	assert.Assert(t, history.transitions == nil)
+
+	history.Record("New", "Pending", string(InitTask))
+	history.Record("Pending", "Scheduling", string(SubmitTask))
+	history.Record("Scheduling", "TaskAllocated", string(TaskAllocated), "uuid-0001", "node-0001")
+
+	transitions := history.GetTransitions()
+	assert.Equal(t, len(transitions), 3)
+	assert.Equal(t, len(history.transitions), 3)
+	assert.Equal(t, transitions[0].ObjectType, ObjectTask)
+	assert.Equal(t, transitions[0].ObjectID, "task0001")
+	assert.Equal(t, transitions[0].From, "New")
+	assert.Equal(t, transitions[0].To, "Pending")
+	assert.Equal(t, transitions[0].Event, string(InitTask))
+	assert.Equal(t, transitions[2].To, "TaskAllocated")
+	assert.DeepEqual(t, transitions[2].Args, []string{"uuid-0001", "node-0001"})
+	assert.Assert(t, !transitions[2].Timestamp.Before(transitions[0].Timestamp))
+}
+
+func TestStateHistoryIsBounded(t *testing.T) {
+	history := newStateHistoryInternal(ObjectApplication, "app0001", 3)
+	for i := 0; i < 7; i++ {
+		history.Record(fmt.Sprintf("state-%d", i), fmt.Sprintf("state-%d", i+1), "event")
+	}
+
+	// only the latest 3 transitions are kept, from the oldest to the latest
+	transitions := history.GetTransitions()
+	assert.Equal(t, len(transitions), 3)
+	assert.Equal(t, len(history.transitions), 3)
+	assert.Equal(t, transitions[0].From, "state-4")
+	assert.Equal(t, transitions[1].From, "state-5")
+	assert.Equal(t, transitions[2].From, "state-6")
+	assert.Equal(t, transitions[2].To, "state-7")
+}
+
+func TestStateHistoryAsFsmCallback(t *testing.T) {
+	history := newStateHistoryInternal(ObjectNode, "node0001", 10)
+	sm := fsm.NewFSM("New",
+		fsm.Events{
+			{Name: "recover", Src: []string{"New"}, Dst: "Recovering"},
+			{Name: "accept", Src: []string{"Recovering"}, Dst: "Accepted"},
+		},
+		fsm.Callbacks{
+			EnterState: history.OnEnterState,
+		})
+
+	assert.NilError(t, sm.Event("recover"))
+	assert.NilError(t, sm.Event("accept", "arg"))
+	// invalid event is not recorded
+	assert.Assert(t, sm.Event("recover") != nil)
+
+	transitions := history.GetTransitions()
+	assert.Equal(t, len(transitions), 2)
+	assert.Equal(t, transitions[0].Event, "recover")
+	assert.Equal(t, transitions[1].From, "Recovering")
+	assert.Equal(t, transitions[1].To, "Accepted")
+	assert.DeepEqual(t, transitions[1].Args, []string{"arg"})
+}
+
+func TestStateHistoryFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state-history")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the file is opened on the first recorded transition
+	original := conf.GetSchedulerConf()
+	configs := original.Clone()
+	configs.StateHistoryFile = filepath.Join(dir, "transitions.json")
+	conf.Set(configs)
+	transitionWriterOnce = sync.Once{}
+	defer func() {
+		CloseStateHistoryFile()
+		transitionWriterOnce = sync.Once{}
+		conf.Set(original)
+	}()
+
+	history := newStateHistoryInternal(ObjectNode, "node0001", 5)
+	history.Record("New", "Recovering", string(RecoverNode))
+	assert.Assert(t, transitionFile != nil)
+
+	CloseStateHistoryFile()
+	assert.Assert(t, transitionFile == nil)
+	assert.Assert(t, transitionWriter == nil)
+	// closing again is a no-op, the transitions are kept in memory once the file is closed
+	CloseStateHistoryFile()
+	history.Record("Recovering", "Healthy", string(NodeAccepted))
+	assert.Equal(t, len(history.GetTransitions()), 2)
+
+	file, err := os.Open(configs.StateHistoryFile)
+	assert.NilError(t, err)
+	defer file.Close()
+	var lines []StateTransition
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var transition StateTransition
+		assert.NilError(t, json.Unmarshal(scanner.Bytes(), &transition))
+		lines = append(lines, transition)
+	}
+	assert.Equal(t, len(lines), 1)
+	assert.Equal(t, lines[0].ObjectID, "node0001")
+	assert.Equal(t, lines[0].To, "Recovering")
+}
@@ -21,10 +21,11 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
-// fake client allows us to inject customized bind/delete pod functions
+// fake client allows us to inject customized bind/delete/update status pod functions
 type KubeClientMock struct {
-	bindFn   func(pod *v1.Pod, hostID string) error
-	deleteFn func(pod *v1.Pod) error
+	bindFn         func(pod *v1.Pod, hostID string) error
+	deleteFn       func(pod *v1.Pod) error
+	updateStatusFn func(pod *v1.Pod) (*v1.Pod, error)
 }
 
 func NewKubeClientMock() *KubeClientMock {
@@ -35,6 +36,9 @@ func NewKubeClientMock() *KubeClientMock {
 		deleteFn: func(pod *v1.Pod) error {
 			return nil
 		},
+		updateStatusFn: func(pod *v1.Pod) (*v1.Pod, error) {
+			return pod, nil
+		},
 	}
 }
 
@@ -46,6 +50,10 @@ func (c *KubeClientMock) MockDeleteFn(dfn func(pod *v1.Pod) error) {
 	c.deleteFn = dfn
 }
 
+func (c *KubeClientMock) MockUpdateStatusFn(ufn func(pod *v1.Pod) (*v1.Pod, error)) {
+	c.updateStatusFn = ufn
+}
+
 func (c *KubeClientMock) Bind(pod *v1.Pod, hostID string) error {
 	return c.bindFn(pod, hostID)
 }
@@ -54,6 +62,10 @@ func (c *KubeClientMock) Delete(pod *v1.Pod) error {
 	return c.deleteFn(pod)
 }
 
+func (c *KubeClientMock) UpdateStatus(pod *v1.Pod) (*v1.Pod, error) {
+	return c.updateStatusFn(pod)
+}
+
 func (c *KubeClientMock) GetClientSet() *kubernetes.Clientset {
 	return nil
 }
@@ -27,6 +27,7 @@ import (
 type SchedulerAPIMock struct {
 	registerCount int32
 	updateCount   int32
+	reloadCount   int32
 	registerFn    func(request *si.RegisterResourceManagerRequest,
 		callback api.ResourceManagerCallback) (*si.RegisterResourceManagerResponse, error)
 	updateFn func(request *si.UpdateRequest) error
@@ -79,6 +80,7 @@ func (api *SchedulerAPIMock) Update(request *si.UpdateRequest) error {
 func (api *SchedulerAPIMock) ReloadConfiguration(rmID string) error {
 	api.lock.Lock()
 	defer api.lock.Unlock()
+	atomic.AddInt32(&api.reloadCount, 1)
 	return nil
 }
 
@@ -89,3 +91,7 @@ func (api *SchedulerAPIMock) GetRegisterCount() int32 {
 func (api *SchedulerAPIMock) GetUpdateCount() int32 {
 	return atomic.LoadInt32(&api.updateCount)
 }
+
+func (api *SchedulerAPIMock) GetReloadCount() int32 {
+	return atomic.LoadInt32(&api.reloadCount)
+}
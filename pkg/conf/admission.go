@@ -0,0 +1,86 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conf
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// parses a comma-separated list, the items are trimmed and the empty items are dropped
+func ParseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parses the comma-separated list of the default queues of the namespaces, each given as namespace=queue,
+// e.g "dev=root.dev,prod=root.prod.services". An empty value returns no queues.
+func ParseNamespaceQueues(value string) (map[string]string, error) {
+	queues := make(map[string]string)
+	for _, item := range ParseList(value) {
+		idx := strings.Index(item, "=")
+		if idx <= 0 || idx == len(item)-1 {
+			return nil, fmt.Errorf("configured namespace queue '%s' is invalid, it must be given as namespace=queue", item)
+		}
+		namespace := strings.TrimSpace(item[:idx])
+		if _, ok := queues[namespace]; ok {
+			return nil, fmt.Errorf("configured namespace queue '%s' is invalid, namespace %s has more than one queue",
+				item, namespace)
+		}
+		queues[namespace] = strings.TrimSpace(item[idx+1:])
+	}
+	return queues, nil
+}
+
+// validates the options of the admission controller
+func (conf *SchedulerConf) validateAdmission() error {
+	if conf.AdmissionPort <= 0 || conf.AdmissionPort > 65535 {
+		return fmt.Errorf("admission controller port must be in range [1, 65535], got %d", conf.AdmissionPort)
+	}
+	if conf.AdmissionDefaultQueue == "" {
+		return fmt.Errorf("admission controller default queue must not be empty")
+	}
+	if _, err := ParseNamespaceQueues(conf.AdmissionNamespaceQueues); err != nil {
+		return err
+	}
+	if _, err := labels.Parse(conf.AdmissionNamespaceSelector); err != nil {
+		return fmt.Errorf("admission controller namespace selector is invalid: %v", err)
+	}
+	if _, err := labels.Parse(conf.AdmissionPodSelector); err != nil {
+		return fmt.Errorf("admission controller pod selector is invalid: %v", err)
+	}
+	if conf.AdmissionCertRenewBefore <= 0 {
+		return fmt.Errorf("admission controller certificate renewal must be positive, got %s",
+			conf.AdmissionCertRenewBefore)
+	}
+	if conf.AdmissionCertValidity <= conf.AdmissionCertRenewBefore {
+		return fmt.Errorf("admission controller certificate validity must be longer than the renewal %s, got %s",
+			conf.AdmissionCertRenewBefore, conf.AdmissionCertValidity)
+	}
+	if conf.AdmissionCAValidity < conf.AdmissionCertValidity {
+		return fmt.Errorf("admission controller CA validity must not be shorter than the certificate validity %s, got %s",
+			conf.AdmissionCertValidity, conf.AdmissionCAValidity)
+	}
+	return nil
+}
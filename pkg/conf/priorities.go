@@ -0,0 +1,74 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/priorities"
+)
+
+// priority functions that can be configured with the -priorities option,
+// the prioritizer registers the functions of exactly these priorities
+var SupportedPriorities = []string{
+	priorities.LeastRequestedPriority,
+	priorities.MostRequestedPriority,
+	priorities.BalancedResourceAllocation,
+	priorities.NodePreferAvoidPodsPriority,
+	priorities.NodeAffinityPriority,
+	priorities.TaintTolerationPriority,
+	priorities.ImageLocalityPriority,
+}
+
+// a priority function configured with the -priorities option,
+// zero weight means the default weight of the function is used.
+type PriorityWeight struct {
+	Name   string
+	Weight int
+}
+
+// parses the comma-separated list of priorities, each priority is given as name or name:weight,
+// e.g "LeastRequestedPriority:2,ImageLocalityPriority". An empty value returns no priorities.
+func ParsePriorities(value string) ([]PriorityWeight, error) {
+	if value == "" {
+		return nil, nil
+	}
+	supported := make(map[string]bool)
+	for _, name := range SupportedPriorities {
+		supported[name] = true
+	}
+	var parsed []PriorityWeight
+	for _, item := range strings.Split(value, ",") {
+		priority := PriorityWeight{Name: item}
+		if idx := strings.Index(item, ":"); idx >= 0 {
+			priority.Name = item[:idx]
+			weight, err := strconv.Atoi(item[idx+1:])
+			if err != nil || weight <= 0 {
+				return nil, fmt.Errorf("configured priority '%s' has an invalid weight, it must be a positive integer", item)
+			}
+			priority.Weight = weight
+		}
+		if !supported[priority.Name] {
+			return nil, fmt.Errorf("configured priority '%s' is invalid, valid priorities are: %v",
+				priority.Name, SupportedPriorities)
+		}
+		parsed = append(parsed, priority)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conf
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// options that take effect at runtime when they are changed in the config file or
+// in the ConfigMap, changes of other options are only applied after a restart.
+var reloadableOptions = map[string]bool{
+	"logLevel":   true,
+	"predicates": true,
+	"priorities": true,
+	"interval":   true,
+}
+
+// the configuration is merged from the sources in this order: the defaults,
+// the config file, the ConfigMap section and the command line.
+type configSources struct {
+	configFile  string
+	fileData    []byte
+	file        map[string]string
+	configMap   map[string]string
+	commandLine map[string]string
+	lastReload  *ReloadResult
+	handlers    []ReloadHandler
+	lock        sync.Mutex
+}
+
+var sources = &configSources{}
+
+// called after changes are applied at runtime, with the previous and the updated configuration
+type ReloadHandler func(previous, updated *SchedulerConf)
+
+// the outcome of a configuration reload
+type ReloadResult struct {
+	Time           time.Time `json:"time"`
+	Source         string    `json:"source"`
+	Applied        []string  `json:"applied,omitempty"`
+	RequireRestart []string  `json:"requireRestart,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// returns true if the reload has any effect or failed
+func (r *ReloadResult) HasChanges() bool {
+	return len(r.Applied) > 0 || len(r.RequireRestart) > 0 || r.Error != ""
+}
+
+const (
+	SourceConfigFile = "configFile"
+	SourceConfigMap  = "configMap"
+)
+
+func initSources(configFile string, fileOptions map[string]string, commandLine map[string]string) {
+	sources.lock.Lock()
+	defer sources.lock.Unlock()
+	sources.configFile = configFile
+	sources.file = fileOptions
+	sources.configMap = nil
+	sources.commandLine = commandLine
+	sources.fileData = nil
+	sources.lastReload = nil
+}
+
+// registers a handler which is called when the configuration is changed at runtime
+func AddReloadHandler(handler ReloadHandler) {
+	sources.lock.Lock()
+	defer sources.lock.Unlock()
+	sources.handlers = append(sources.handlers, handler)
+}
+
+// returns the result of the latest reload, nil if the configuration was never reloaded
+func GetLastReloadResult() *ReloadResult {
+	sources.lock.Lock()
+	defer sources.lock.Unlock()
+	return sources.lastReload
+}
+
+// reloads the configuration with the new content of the config file
+func UpdateConfigFile(data []byte) *ReloadResult {
+	return update(SourceConfigFile, data)
+}
+
+// reloads the configuration with the new content of the shim section in the ConfigMap,
+// empty data removes the section.
+func UpdateConfigMapSection(data []byte) *ReloadResult {
+	return update(SourceConfigMap, data)
+}
+
+func update(source string, data []byte) *ReloadResult {
+	sources.lock.Lock()
+	defer sources.lock.Unlock()
+
+	options, err := parseOptions(data)
+	if err != nil {
+		return sources.record(&ReloadResult{
+			Time:   time.Now(),
+			Source: source,
+			Error:  err.Error(),
+		})
+	}
+	file, configMap := sources.file, sources.configMap
+	if source == SourceConfigFile {
+		file = options
+	} else {
+		configMap = options
+	}
+
+	current := GetSchedulerConf()
+	result := &ReloadResult{
+		Time:   time.Now(),
+		Source: source,
+	}
+	loaded, err := buildConf(current.ConfigFile, file, configMap, sources.commandLine)
+	if err != nil {
+		// the current configuration is kept
+		result.Error = err.Error()
+		return sources.record(result)
+	}
+	sources.file, sources.configMap = file, configMap
+
+	// only the reloadable options are applied to the current configuration
+	currentValues := optionValues(current)
+	loadedValues := optionValues(loaded)
+	updated := current.Clone()
+	fs := bindExisting(updated)
+	for _, name := range sortedKeys(loadedValues) {
+		if currentValues[name] == loadedValues[name] {
+			continue
+		}
+		if !reloadableOptions[name] {
+			result.RequireRestart = append(result.RequireRestart, name)
+			continue
+		}
+		if err = fs.Set(name, loadedValues[name]); err != nil {
+			result.Error = err.Error()
+			return sources.record(result)
+		}
+		result.Applied = append(result.Applied, name)
+	}
+
+	if len(result.Applied) > 0 {
+		Set(updated)
+		for _, handler := range sources.handlers {
+			handler(current, updated)
+		}
+	}
+	return sources.record(result)
+}
+
+func (s *configSources) record(result *ReloadResult) *ReloadResult {
+	if result.HasChanges() {
+		s.lastReload = result
+	}
+	return result
+}
+
+// checks the config file periodically and reloads the configuration when the content
+// of the file changes, the file may be a mounted ConfigMap which is updated by the kubelet.
+// The callback is called with the result of each reload.
+func WatchConfigFile(interval time.Duration, stopCh <-chan struct{}, callback func(result *ReloadResult)) {
+	sources.lock.Lock()
+	configFile := sources.configFile
+	sources.lock.Unlock()
+	if configFile == "" {
+		return
+	}
+
+	lastData, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		lastData = nil
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			data, err := ioutil.ReadFile(configFile)
+			if err != nil {
+				// the file may be replaced at the moment, try again in the next round
+				continue
+			}
+			if bytes.Equal(data, lastData) {
+				continue
+			}
+			lastData = data
+			callback(UpdateConfigFile(data))
+		}
+	}
+}
+
+func readConfigFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+	return data, nil
+}
+
+// parses the options in YAML format, the keys are the names of the command line options
+func parseOptions(data []byte) (map[string]string, error) {
+	raw := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	options := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch value.(type) {
+		case string, int, bool, float64:
+			options[name] = fmt.Sprint(value)
+		default:
+			return nil, fmt.Errorf("option %s must have a scalar value, got %v", name, value)
+		}
+	}
+	return options, nil
+}
+
+// builds a configuration from the defaults with the options applied in order
+func buildConf(configFile string, layers ...map[string]string) (*SchedulerConf, error) {
+	conf := &SchedulerConf{}
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	conf.bindFlags(fs)
+	for _, layer := range layers {
+		for _, name := range sortedKeys(layer) {
+			if err := fs.Set(name, layer[name]); err != nil {
+				return nil, fmt.Errorf("invalid option %s: %v", name, err)
+			}
+		}
+	}
+	conf.ConfigFile = configFile
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// binds the options of the configuration to a new flag set, keeping the current values
+func bindExisting(conf *SchedulerConf) *flag.FlagSet {
+	values := *conf
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	// binding resets the options to the defaults
+	conf.bindFlags(fs)
+	*conf = values
+	return fs
+}
+
+// returns the option values of the configuration, by the option names
+func optionValues(conf *SchedulerConf) map[string]string {
+	values := make(map[string]string)
+	bindExisting(conf.Clone()).VisitAll(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+	return values
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
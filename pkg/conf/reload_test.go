@@ -0,0 +1,182 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conf
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "k8shim-config-*.yaml")
+	assert.NilError(t, err)
+	_, err = file.WriteString(content)
+	assert.NilError(t, err)
+	assert.NilError(t, file.Close())
+	return file.Name()
+}
+
+func initForTest(t *testing.T, args ...string) error {
+	return initFromFlagSet(flag.NewFlagSet("test", flag.ContinueOnError), args)
+}
+
+func TestInitFromConfigFile(t *testing.T) {
+	defer Set(GetSchedulerConf())
+	path := writeConfigFile(t, `
+interval: 3s
+logLevel: 1
+name: scheduler-from-file
+leaderElection: true
+`)
+	defer os.Remove(path)
+
+	// the command line overrides the config file
+	assert.NilError(t, initForTest(t, "-config", path, "-name", "scheduler-from-cli"))
+	conf := GetSchedulerConf()
+	assert.Equal(t, conf.ConfigFile, path)
+	assert.Equal(t, conf.Interval, 3*time.Second)
+	assert.Equal(t, conf.LoggingLevel, 1)
+	assert.Equal(t, conf.LeaderElection, true)
+	assert.Equal(t, conf.SchedulerName, "scheduler-from-cli")
+	assert.Equal(t, conf.ClusterID, DefaultClusterID)
+}
+
+func TestInitInvalidConfig(t *testing.T) {
+	defer Set(GetSchedulerConf())
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{"unknown option", "unknown: value"},
+		{"invalid duration", "interval: 3 seconds"},
+		{"invalid interval", "interval: 0s"},
+		{"invalid volume bind timeout", "volumeBindTimeout: 0s"},
+		{"invalid assumed pod TTL", "assumedPodTTL: -1s"},
+		{"invalid cache check interval", "cacheCheckInterval: -1s"},
+		{"invalid log level", "logLevel: 10"},
+		{"invalid predicates", "predicates: GeneralPredicates,NotExist"},
+		{"invalid priorities", "priorities: LeastRequestedPriority,NotExist"},
+		{"invalid priority weight", "priorities: LeastRequestedPriority:0"},
+		{"non-scalar value", "name: [a, b]"},
+		{"config file in config file", "config: /tmp/other.yaml"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeConfigFile(t, tc.content)
+			defer os.Remove(path)
+			assert.Assert(t, initForTest(t, "-config", path) != nil)
+		})
+	}
+
+	assert.Assert(t, initForTest(t, "-config", "/not/exist.yaml") != nil)
+	assert.Assert(t, initForTest(t, "-logEncoding", "xml") != nil)
+}
+
+func TestReloadConfigFile(t *testing.T) {
+	defer Set(GetSchedulerConf())
+	path := writeConfigFile(t, "interval: 3s")
+	defer os.Remove(path)
+	assert.NilError(t, initForTest(t, "-config", path, "-name", "scheduler-from-cli"))
+
+	var previous, updated *SchedulerConf
+	AddReloadHandler(func(p, u *SchedulerConf) {
+		previous, updated = p, u
+	})
+
+	// reloadable options are applied, others need a restart, options set on the command line are kept
+	result := UpdateConfigFile([]byte(`
+interval: 5s
+predicates: GeneralPredicates
+clusterId: new-cluster
+name: scheduler-from-file
+`))
+	assert.Equal(t, result.Error, "")
+	assert.Equal(t, result.Source, SourceConfigFile)
+	assert.DeepEqual(t, result.Applied, []string{"interval", "predicates"})
+	assert.DeepEqual(t, result.RequireRestart, []string{"clusterId"})
+	conf := GetSchedulerConf()
+	assert.Equal(t, conf.Interval, 5*time.Second)
+	assert.Equal(t, conf.Predicates, "GeneralPredicates")
+	assert.Equal(t, conf.ClusterID, DefaultClusterID)
+	assert.Equal(t, conf.SchedulerName, "scheduler-from-cli")
+	assert.Equal(t, previous.Interval, 3*time.Second)
+	assert.Equal(t, updated, conf)
+	assert.Equal(t, GetLastReloadResult(), result)
+
+	// an invalid config is rejected, the current configuration is kept
+	result = UpdateConfigFile([]byte("logLevel: 10"))
+	assert.Assert(t, result.Error != "")
+	assert.Equal(t, GetSchedulerConf(), conf)
+	assert.Equal(t, GetLastReloadResult(), result)
+
+	// the pending changes are still reported until a restart
+	result = UpdateConfigFile([]byte("interval: 5s\npredicates: GeneralPredicates\nclusterId: new-cluster"))
+	assert.Equal(t, len(result.Applied), 0)
+	assert.DeepEqual(t, result.RequireRestart, []string{"clusterId"})
+}
+
+func TestReloadConfigMapSection(t *testing.T) {
+	defer Set(GetSchedulerConf())
+	path := writeConfigFile(t, "logLevel: 1")
+	defer os.Remove(path)
+	assert.NilError(t, initForTest(t, "-config", path))
+
+	// the ConfigMap section overrides the config file
+	result := UpdateConfigMapSection([]byte("logLevel: -1"))
+	assert.Equal(t, result.Source, SourceConfigMap)
+	assert.DeepEqual(t, result.Applied, []string{"logLevel"})
+	assert.Equal(t, GetSchedulerConf().LoggingLevel, -1)
+
+	// the config file doesn't override the ConfigMap section
+	result = UpdateConfigFile([]byte("logLevel: 2"))
+	assert.Equal(t, result.HasChanges(), false)
+	assert.Equal(t, GetSchedulerConf().LoggingLevel, -1)
+
+	// removing the section reverts to the config file
+	result = UpdateConfigMapSection(nil)
+	assert.DeepEqual(t, result.Applied, []string{"logLevel"})
+	assert.Equal(t, GetSchedulerConf().LoggingLevel, 2)
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	defer Set(GetSchedulerConf())
+	path := writeConfigFile(t, "interval: 3s")
+	defer os.Remove(path)
+	assert.NilError(t, initForTest(t, "-config", path))
+
+	results := make(chan *ReloadResult, 1)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go WatchConfigFile(10*time.Millisecond, stopCh, func(result *ReloadResult) {
+		results <- result
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	assert.NilError(t, ioutil.WriteFile(path, []byte("interval: 4s"), 0644))
+	select {
+	case result := <-results:
+		assert.DeepEqual(t, result.Applied, []string{"interval"})
+		assert.Equal(t, GetSchedulerConf().Interval, 4*time.Second)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the config file reload")
+	}
+}
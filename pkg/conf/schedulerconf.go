@@ -19,6 +19,10 @@ package conf
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap/zapcore"
@@ -26,49 +30,120 @@ import (
 	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
 )
 
-// default configuration values, these can be override by CLI options
+// default configuration values, these can be override by the config file or CLI options
 const (
 	DefaultClusterID            = "my-kube-cluster"
 	DefaultClusterVersion       = "0.1"
 	DefaultSchedulerName        = "yunikorn"
 	DefaultPolicyGroup          = "queues"
+	DefaultNamespace            = "default"
 	DefaultLoggingLevel         = 0
 	DefaultLogEncoding          = "console"
 	DefaultVolumeBindTimeout    = 10 * time.Second
+	DefaultAssumedPodTTL        = 30 * time.Second
 	DefaultSchedulingInterval   = time.Second
 	DefaultEventChannelCapacity = 1024 * 1024
 	DefaultDispatchTimeout      = 300 * time.Second
 	DefaultKubeQPS              = 1000
 	DefaultKubeBurst            = 1000
+	DefaultStateHistorySize     = 100
+	DefaultWebServicePort       = 9089
+	DefaultLeaderElectionNS     = "default"
+	DefaultLeaseDuration        = 15 * time.Second
+	DefaultLeaseRenewDeadline   = 10 * time.Second
+	DefaultLeaseRetryPeriod     = 2 * time.Second
+	DefaultShutdownTimeout      = 20 * time.Second
+	DefaultRegisterRetryInitial = time.Second
+	DefaultRegisterRetryMax     = time.Minute
+	DefaultRegisterMaxRetries   = 0
+
+	DefaultAdmissionPort                = 8443
+	DefaultAdmissionCertFile            = "/run/secrets/tls/cert.pem"
+	DefaultAdmissionKeyFile             = "/run/secrets/tls/key.pem"
+	DefaultAdmissionQueue               = "root.default"
+	DefaultAdmissionExcludedNamespaces  = "kube-system"
+	DefaultAdmissionExcludedPodPrefixes = "yunikorn-scheduler"
+	DefaultAdmissionServiceName         = "yunikorn-admission-controller-service"
+	DefaultAdmissionSecretName          = "yunikorn-admission-controller-certs"
+	DefaultAdmissionCAValidity          = 10 * 365 * 24 * time.Hour
+	DefaultAdmissionCertValidity        = 365 * 24 * time.Hour
+	DefaultAdmissionCertRenewBefore     = 30 * 24 * time.Hour
 )
 
-var configuration *SchedulerConf
+var (
+	configuration *SchedulerConf
+	lock          sync.RWMutex
+	// the namespace of the pod, mounted with the service account
+	namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
 
 type SchedulerConf struct {
 	ClusterID            string        `json:"clusterId"`
 	ClusterVersion       string        `json:"clusterVersion"`
 	SchedulerName        string        `json:"schedulerName"`
 	PolicyGroup          string        `json:"policyGroup"`
+	Namespace            string        `json:"namespace"`
 	Interval             time.Duration `json:"schedulingIntervalSecond"`
 	KubeConfig           string        `json:"absoluteKubeConfigFilePath"`
 	LoggingLevel         int           `json:"loggingLevel"`
 	LogEncoding          string        `json:"logEncoding"`
 	LogFile              string        `json:"logFilePath"`
 	VolumeBindTimeout    time.Duration `json:"volumeBindTimeout"`
+	AssumedPodTTL        time.Duration `json:"assumedPodTTL"`
+	CacheCheckInterval   time.Duration `json:"cacheCheckInterval"`
+	CacheSelfHeal        bool          `json:"cacheSelfHeal"`
 	TestMode             bool          `json:"testMode"`
 	EventChannelCapacity int           `json:"eventChannelCapacity"`
 	DispatchTimeout      time.Duration `json:"dispatchTimeout"`
 	KubeQPS              int           `json:"kubeQPS"`
 	KubeBurst            int           `json:"kubeBurst"`
 	Predicates           string        `json:"predicates"`
+	Priorities           string        `json:"priorities"`
+	ExtenderConfigFile   string        `json:"extenderConfigFilePath"`
+	StateHistorySize     int           `json:"stateHistorySize"`
+	StateHistoryFile     string        `json:"stateHistoryFilePath"`
+	WebServicePort       int           `json:"webServicePort"`
+	LeaderElection       bool          `json:"leaderElection"`
+	LeaderElectionNS     string        `json:"leaderElectionNamespace"`
+	LeaseDuration        time.Duration `json:"leaseDuration"`
+	LeaseRenewDeadline   time.Duration `json:"leaseRenewDeadline"`
+	LeaseRetryPeriod     time.Duration `json:"leaseRetryPeriod"`
+	ShutdownTimeout      time.Duration `json:"shutdownTimeout"`
+	RegisterRetryInitial time.Duration `json:"registerRetryInitialInterval"`
+	RegisterRetryMax     time.Duration `json:"registerRetryMaxInterval"`
+	RegisterMaxRetries   int           `json:"registerMaxRetries"`
+	ConfigFile           string        `json:"configFilePath"`
+
+	// options of the admission controller
+	AdmissionPort                int    `json:"admissionPort"`
+	AdmissionCertFile            string `json:"admissionCertFilePath"`
+	AdmissionKeyFile             string `json:"admissionKeyFilePath"`
+	AdmissionDefaultQueue        string `json:"admissionDefaultQueue"`
+	AdmissionNamespaceQueues     string `json:"admissionNamespaceQueues"`
+	AdmissionExcludedNamespaces  string `json:"admissionExcludedNamespaces"`
+	AdmissionExcludedPodPrefixes string `json:"admissionExcludedPodPrefixes"`
+	AdmissionNamespaceSelector   string `json:"admissionNamespaceSelector"`
+	AdmissionPodSelector         string `json:"admissionPodSelector"`
+	// options of the certificates generated by the admission controller
+	AdmissionGenerateCerts    bool          `json:"admissionGenerateCerts"`
+	AdmissionServiceName      string        `json:"admissionServiceName"`
+	AdmissionServiceNamespace string        `json:"admissionServiceNamespace"`
+	AdmissionSecretName       string        `json:"admissionSecretName"`
+	AdmissionCAValidity       time.Duration `json:"admissionCAValidity"`
+	AdmissionCertValidity     time.Duration `json:"admissionCertValidity"`
+	AdmissionCertRenewBefore  time.Duration `json:"admissionCertRenewBefore"`
 }
 
 func GetSchedulerConf() *SchedulerConf {
+	lock.RLock()
+	defer lock.RUnlock()
 	return configuration
 }
 
 // unit tests may need to override configuration
 func Set(conf *SchedulerConf) {
+	lock.Lock()
+	defer lock.Unlock()
 	configuration = conf
 }
 
@@ -80,69 +155,248 @@ func (conf *SchedulerConf) GetKubeConfigPath() string {
 	return conf.KubeConfig
 }
 
-func init() {
+// returns a copy of the configuration, a loaded configuration is never modified,
+// the changes are made on a copy which replaces the current one.
+func (conf *SchedulerConf) Clone() *SchedulerConf {
+	clone := *conf
+	return &clone
+}
+
+// binds all options of the scheduler to the flag set, the option values are set to
+// the defaults, and they are overridden when the flag set parses the arguments.
+// The flag names are also the keys of the options in the config file.
+func (conf *SchedulerConf) bindFlags(fs *flag.FlagSet) {
 	// scheduler options
-	kubeConfig := flag.String("kubeConfig", "",
+	fs.StringVar(&conf.KubeConfig, "kubeConfig", "",
 		"absolute path to the kubeconfig file")
-	schedulingInterval := flag.Duration("interval", DefaultSchedulingInterval,
+	fs.DurationVar(&conf.Interval, "interval", DefaultSchedulingInterval,
 		"scheduling interval in seconds")
-	clusterID := flag.String("clusterId", DefaultClusterID,
+	fs.StringVar(&conf.ClusterID, "clusterId", DefaultClusterID,
 		"cluster id")
-	clusterVersion := flag.String("clusterVersion", DefaultClusterVersion,
+	fs.StringVar(&conf.ClusterVersion, "clusterVersion", DefaultClusterVersion,
 		"cluster version")
-	schedulerName := flag.String("name", DefaultSchedulerName,
+	fs.StringVar(&conf.SchedulerName, "name", DefaultSchedulerName,
 		"name of the scheduler")
-	policyGroup := flag.String("policyGroup", DefaultPolicyGroup,
+	fs.StringVar(&conf.PolicyGroup, "policyGroup", DefaultPolicyGroup,
 		"policy group")
-	volumeBindTimeout := flag.Duration("volumeBindTimeout", DefaultVolumeBindTimeout,
+	fs.StringVar(&conf.Namespace, "namespace", defaultNamespace(),
+		"namespace the scheduler is deployed in, the scheduler configMap is only watched in this namespace")
+	fs.DurationVar(&conf.VolumeBindTimeout, "volumeBindTimeout", DefaultVolumeBindTimeout,
 		"timeout in seconds when binding a volume")
-	eventChannelCapacity := flag.Int("eventChannelCapacity", DefaultEventChannelCapacity,
+	fs.DurationVar(&conf.AssumedPodTTL, "assumedPodTTL", DefaultAssumedPodTTL,
+		"time an assumed pod waits to be confirmed by the informer after it is bound, before it is expired, 0 never expires")
+	fs.DurationVar(&conf.CacheCheckInterval, "cacheCheckInterval", 0,
+		"interval of comparing the scheduler cache and the tasks with the informers, 0 disables the periodic check")
+	fs.BoolVar(&conf.CacheSelfHeal, "cacheSelfHeal", false,
+		"repair the inconsistencies found by the periodic cache check, otherwise they are only reported")
+	fs.IntVar(&conf.EventChannelCapacity, "eventChannelCapacity", DefaultEventChannelCapacity,
 		"event channel capacity of dispatcher")
-	dispatchTimeout := flag.Duration("dispatchTimeout", DefaultDispatchTimeout,
+	fs.DurationVar(&conf.DispatchTimeout, "dispatchTimeout", DefaultDispatchTimeout,
 		"timeout in seconds when dispatching an event")
-	kubeQPS := flag.Int("kubeQPS", DefaultKubeQPS,
+	fs.IntVar(&conf.KubeQPS, "kubeQPS", DefaultKubeQPS,
 		"the maximum QPS to kubernetes master from this client")
-	kubeBurst := flag.Int("kubeBurst", DefaultKubeBurst,
+	fs.IntVar(&conf.KubeBurst, "kubeBurst", DefaultKubeBurst,
 		"the maximum burst for throttle to kubernetes master from this client")
-	predicateList := flag.String("predicates", "",
+	fs.DurationVar(&conf.ShutdownTimeout, "shutdownTimeout", DefaultShutdownTimeout,
+		"maximum time to wait for the in-flight pod binds when the scheduler shuts down")
+	fs.DurationVar(&conf.RegisterRetryInitial, "registerRetryInitialInterval", DefaultRegisterRetryInitial,
+		"initial interval between retries of registering to the scheduler core, it is doubled after each failure")
+	fs.DurationVar(&conf.RegisterRetryMax, "registerRetryMaxInterval", DefaultRegisterRetryMax,
+		"maximum interval between retries of registering to the scheduler core")
+	fs.IntVar(&conf.RegisterMaxRetries, "registerMaxRetries", DefaultRegisterMaxRetries,
+		"maximum number of retries of registering to the scheduler core before the scheduler stops, 0 retries forever")
+	fs.StringVar(&conf.Predicates, "predicates", "",
 		fmt.Sprintf("comma-separated list of predicates, valid predicates are: %s, "+
 			"the program will exit if any invalid predicates exist.", predicates.Ordering()))
+	fs.StringVar(&conf.Priorities, "priorities", "",
+		fmt.Sprintf("comma-separated list of priorities used to rank the nodes, each given as name or name:weight, "+
+			"valid priorities are: %s, the default priorities are used if it is not set.", SupportedPriorities))
+	fs.StringVar(&conf.ExtenderConfigFile, "extenderConfig", "",
+		"absolute path to a scheduler policy file in JSON, the HTTP scheduler extenders in its extenders section "+
+			"are called to filter and prioritize the nodes and to bind the pods")
+	fs.IntVar(&conf.StateHistorySize, "stateHistorySize", DefaultStateHistorySize,
+		"maximum number of state transitions kept in memory for each app, task and node")
+	fs.StringVar(&conf.StateHistoryFile, "stateHistoryFile", "",
+		"absolute file path, if set, all state transitions are appended to this file as JSON lines")
+	fs.IntVar(&conf.WebServicePort, "webServicePort", DefaultWebServicePort,
+		"port of the shim web service, which serves the shim state and the log level control in REST endpoints, "+
+			"the endpoints changing the state are only served to local clients")
+
+	// leader election options
+	fs.BoolVar(&conf.LeaderElection, "leaderElection", false,
+		"enable the lease based leader election, only the leader schedules pods while others stay in standby")
+	fs.StringVar(&conf.LeaderElectionNS, "leaderElectionNamespace", DefaultLeaderElectionNS,
+		"namespace of the lease object used for the leader election")
+	fs.DurationVar(&conf.LeaseDuration, "leaseDuration", DefaultLeaseDuration,
+		"duration that standby candidates wait before they try to acquire a lease not renewed by the leader")
+	fs.DurationVar(&conf.LeaseRenewDeadline, "leaseRenewDeadline", DefaultLeaseRenewDeadline,
+		"duration that the leader retries renewing the lease before it gives up the leadership")
+	fs.DurationVar(&conf.LeaseRetryPeriod, "leaseRetryPeriod", DefaultLeaseRetryPeriod,
+		"duration that the candidates wait between tries of acquiring or renewing the lease")
+
+	// admission controller options
+	fs.IntVar(&conf.AdmissionPort, "admissionPort", DefaultAdmissionPort,
+		"port of the admission controller web-hook")
+	fs.StringVar(&conf.AdmissionCertFile, "admissionCertFile", DefaultAdmissionCertFile,
+		"absolute path to the TLS certificate of the admission controller web-hook")
+	fs.StringVar(&conf.AdmissionKeyFile, "admissionKeyFile", DefaultAdmissionKeyFile,
+		"absolute path to the TLS private key of the admission controller web-hook")
+	fs.StringVar(&conf.AdmissionDefaultQueue, "admissionDefaultQueue", DefaultAdmissionQueue,
+		"queue set by the admission controller on the pods without a queue")
+	fs.StringVar(&conf.AdmissionNamespaceQueues, "admissionNamespaceQueues", "",
+		"comma-separated list of the default queues of namespaces, each given as namespace=queue, "+
+			"the pods without a queue in these namespaces are placed in the namespace queue instead of the default queue")
+	fs.StringVar(&conf.AdmissionExcludedNamespaces, "admissionExcludedNamespaces", DefaultAdmissionExcludedNamespaces,
+		"comma-separated list of namespaces, the admission controller doesn't change the pods in these namespaces")
+	fs.StringVar(&conf.AdmissionExcludedPodPrefixes, "admissionExcludedPodPrefixes", DefaultAdmissionExcludedPodPrefixes,
+		"comma-separated list of pod name prefixes, the admission controller doesn't change the pods with these prefixes")
+	fs.StringVar(&conf.AdmissionNamespaceSelector, "admissionNamespaceSelector", "",
+		"label selector of namespaces, the admission controller only changes the pods in the matching namespaces, "+
+			"e.g \"yunikorn=enabled\" to opt in or \"!yunikorn-disabled\" to opt out, empty matches all namespaces")
+	fs.StringVar(&conf.AdmissionPodSelector, "admissionPodSelector", "",
+		"label selector of pods, the admission controller only changes the matching pods, empty matches all pods")
+	fs.BoolVar(&conf.AdmissionGenerateCerts, "admissionGenerateCerts", false,
+		"generate the CA and the TLS certificate of the admission controller, store them in a secret and rotate them "+
+			"before they expire, the web-hook configurations are registered with the CA bundle. "+
+			"The certificate and key files are not used when it is set")
+	fs.StringVar(&conf.AdmissionServiceName, "admissionServiceName", DefaultAdmissionServiceName,
+		"name of the service of the admission controller, the generated certificate is valid for this service")
+	fs.StringVar(&conf.AdmissionServiceNamespace, "admissionServiceNamespace", defaultNamespace(),
+		"namespace of the service and of the certificates secret of the admission controller")
+	fs.StringVar(&conf.AdmissionSecretName, "admissionSecretName", DefaultAdmissionSecretName,
+		"name of the secret storing the generated certificates of the admission controller")
+	fs.DurationVar(&conf.AdmissionCAValidity, "admissionCAValidity", DefaultAdmissionCAValidity,
+		"validity of the generated CA of the admission controller")
+	fs.DurationVar(&conf.AdmissionCertValidity, "admissionCertValidity", DefaultAdmissionCertValidity,
+		"validity of the generated TLS certificate of the admission controller")
+	fs.DurationVar(&conf.AdmissionCertRenewBefore, "admissionCertRenewBefore", DefaultAdmissionCertRenewBefore,
+		"the generated CA and TLS certificate are renewed when they expire within this duration")
 
 	// logging options
-	logLevel := flag.Int("logLevel", DefaultLoggingLevel,
+	fs.IntVar(&conf.LoggingLevel, "logLevel", DefaultLoggingLevel,
 		"logging level, available range [-1, 5], from DEBUG to FATAL.")
-	encode := flag.String("logEncoding", DefaultLogEncoding,
+	fs.StringVar(&conf.LogEncoding, "logEncoding", DefaultLogEncoding,
 		"log encoding, json or console.")
-	logFile := flag.String("logFile", "",
+	fs.StringVar(&conf.LogFile, "logFile", "",
 		"absolute log file path")
+}
+
+// validates the option values, the predicates and the logging options
+// are checked here because they can be changed at runtime.
+func (conf *SchedulerConf) validate() error {
+	if conf.Interval <= 0 {
+		return fmt.Errorf("scheduling interval must be positive, got %s", conf.Interval)
+	}
+	if conf.VolumeBindTimeout <= 0 {
+		return fmt.Errorf("volume bind timeout must be positive, got %s", conf.VolumeBindTimeout)
+	}
+	if conf.CacheCheckInterval < 0 {
+		return fmt.Errorf("cache check interval must not be negative, got %s", conf.CacheCheckInterval)
+	}
+	if conf.AssumedPodTTL < 0 {
+		return fmt.Errorf("assumed pod TTL must not be negative, got %s", conf.AssumedPodTTL)
+	}
+	if conf.LoggingLevel < int(zapcore.DebugLevel) || conf.LoggingLevel > int(zapcore.FatalLevel) {
+		return fmt.Errorf("logging level must be in range [%d, %d], got %d",
+			zapcore.DebugLevel, zapcore.FatalLevel, conf.LoggingLevel)
+	}
+	if conf.LogEncoding != "json" && conf.LogEncoding != "console" {
+		return fmt.Errorf("log encoding must be json or console, got %s", conf.LogEncoding)
+	}
+	if conf.Predicates != "" {
+		validPredicates := make(map[string]bool)
+		for _, validPredicate := range predicates.Ordering() {
+			validPredicates[validPredicate] = true
+		}
+		for _, predicate := range strings.Split(conf.Predicates, ",") {
+			if !validPredicates[predicate] {
+				return fmt.Errorf("configured predicate '%s' is invalid, valid predicates are: %v",
+					predicate, predicates.Ordering())
+			}
+		}
+	}
+	if _, err := ParsePriorities(conf.Priorities); err != nil {
+		return err
+	}
+	return conf.validateAdmission()
+}
 
-	flag.Parse()
+// the scheduler runs in the namespace of its own pod by default,
+// DefaultNamespace is used when running outside of the cluster.
+func defaultNamespace() string {
+	if data, err := ioutil.ReadFile(namespaceFile); err == nil {
+		if ns := strings.TrimSpace(string(data)); ns != "" {
+			return ns
+		}
+	}
+	return DefaultNamespace
+}
+
+func newDefaultConf() *SchedulerConf {
+	conf := &SchedulerConf{}
+	conf.bindFlags(flag.NewFlagSet("defaults", flag.ContinueOnError))
+	return conf
+}
+
+// Parses the command line and loads the config file given by the -config option, this must be
+// called once at the start of the scheduler. The options in the config file override the defaults,
+// and the options set on the command line override the config file. Loading the package only
+// sets the defaults, it doesn't parse the command line.
+func InitFromCommandLine() error {
+	if err := initFromFlagSet(flag.CommandLine, os.Args[1:]); err != nil {
+		return err
+	}
 
 	// if log level is debug, enable klog and set its log level verbosity to 4 (represents debug level),
 	// For details refer to the Logging Conventions of klog at
 	// https://github.com/kubernetes/community/blob/master/contributors/devel/sig-instrumentation/logging.md
-	if zapcore.Level(*logLevel).Enabled(zapcore.DebugLevel) {
+	if zapcore.Level(GetSchedulerConf().LoggingLevel).Enabled(zapcore.DebugLevel) {
 		klog.InitFlags(nil)
 		// cannot really handle the error here ignore it
 		//nolint:errcheck
 		_ = flag.Set("v", "4")
 	}
+	return nil
+}
 
-	configuration = &SchedulerConf{
-		ClusterID:            *clusterID,
-		ClusterVersion:       *clusterVersion,
-		PolicyGroup:          *policyGroup,
-		SchedulerName:        *schedulerName,
-		Interval:             *schedulingInterval,
-		KubeConfig:           *kubeConfig,
-		LoggingLevel:         *logLevel,
-		LogEncoding:          *encode,
-		LogFile:              *logFile,
-		VolumeBindTimeout:    *volumeBindTimeout,
-		EventChannelCapacity: *eventChannelCapacity,
-		DispatchTimeout:      *dispatchTimeout,
-		KubeQPS:              *kubeQPS,
-		KubeBurst:            *kubeBurst,
-		Predicates:           *predicateList,
+func initFromFlagSet(fs *flag.FlagSet, args []string) error {
+	conf := &SchedulerConf{}
+	conf.bindFlags(fs)
+	fs.StringVar(&conf.ConfigFile, "config", "",
+		"absolute path to the config file, the options of the scheduler can be set in the file "+
+			"in YAML format, the option names are the keys, changes are reloaded at runtime")
+	if err := fs.Parse(args); err != nil {
+		return err
 	}
+
+	// remember the options set on the command line, they override the config file
+	commandLine := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			commandLine[f.Name] = f.Value.String()
+		}
+	})
+
+	var fileOptions map[string]string
+	if conf.ConfigFile != "" {
+		data, err := readConfigFile(conf.ConfigFile)
+		if err != nil {
+			return err
+		}
+		if fileOptions, err = parseOptions(data); err != nil {
+			return fmt.Errorf("invalid config file %s: %v", conf.ConfigFile, err)
+		}
+	}
+
+	loaded, err := buildConf(conf.ConfigFile, fileOptions, nil, commandLine)
+	if err != nil {
+		return err
+	}
+	initSources(conf.ConfigFile, fileOptions, commandLine)
+	Set(loaded)
+	return nil
+}
+
+func init() {
+	configuration = newDefaultConf()
 }
@@ -16,7 +16,10 @@ limitations under the License.
 package conf
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 
 	"gotest.tools/assert"
 )
@@ -34,4 +37,108 @@ func TestDefaultValues(t *testing.T) {
 	assert.Equal(t, conf.KubeQPS, DefaultKubeQPS)
 	assert.Equal(t, conf.KubeBurst, DefaultKubeBurst)
 	assert.Equal(t, conf.Predicates, "")
+	assert.Equal(t, conf.Priorities, "")
+	assert.Equal(t, conf.StateHistorySize, DefaultStateHistorySize)
+	assert.Equal(t, conf.WebServicePort, DefaultWebServicePort)
+	assert.Equal(t, conf.LeaderElection, false)
+	assert.Equal(t, conf.LeaderElectionNS, DefaultLeaderElectionNS)
+	assert.Equal(t, conf.LeaseDuration, DefaultLeaseDuration)
+	assert.Equal(t, conf.LeaseRenewDeadline, DefaultLeaseRenewDeadline)
+	assert.Equal(t, conf.LeaseRetryPeriod, DefaultLeaseRetryPeriod)
+	assert.Equal(t, conf.ShutdownTimeout, DefaultShutdownTimeout)
+	assert.Equal(t, conf.RegisterRetryInitial, DefaultRegisterRetryInitial)
+	assert.Equal(t, conf.RegisterRetryMax, DefaultRegisterRetryMax)
+	assert.Equal(t, conf.RegisterMaxRetries, DefaultRegisterMaxRetries)
+	assert.Equal(t, conf.Namespace, DefaultNamespace)
+	assert.Equal(t, conf.AdmissionPort, DefaultAdmissionPort)
+	assert.Equal(t, conf.AdmissionCertFile, DefaultAdmissionCertFile)
+	assert.Equal(t, conf.AdmissionKeyFile, DefaultAdmissionKeyFile)
+	assert.Equal(t, conf.AdmissionDefaultQueue, DefaultAdmissionQueue)
+	assert.Equal(t, conf.AdmissionNamespaceQueues, "")
+	assert.Equal(t, conf.AdmissionExcludedNamespaces, DefaultAdmissionExcludedNamespaces)
+	assert.Equal(t, conf.AdmissionExcludedPodPrefixes, DefaultAdmissionExcludedPodPrefixes)
+	assert.Equal(t, conf.AdmissionNamespaceSelector, "")
+	assert.Equal(t, conf.AdmissionPodSelector, "")
+	assert.Equal(t, conf.AdmissionGenerateCerts, false)
+	assert.Equal(t, conf.AdmissionServiceName, DefaultAdmissionServiceName)
+	assert.Equal(t, conf.AdmissionServiceNamespace, DefaultNamespace)
+	assert.Equal(t, conf.AdmissionSecretName, DefaultAdmissionSecretName)
+	assert.Equal(t, conf.AdmissionCAValidity, DefaultAdmissionCAValidity)
+	assert.Equal(t, conf.AdmissionCertValidity, DefaultAdmissionCertValidity)
+	assert.Equal(t, conf.AdmissionCertRenewBefore, DefaultAdmissionCertRenewBefore)
+}
+
+func TestDefaultNamespace(t *testing.T) {
+	file, err := ioutil.TempFile("", "namespace")
+	assert.NilError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("yunikorn\n")
+	assert.NilError(t, err)
+	assert.NilError(t, file.Close())
+
+	previous := namespaceFile
+	defer func() { namespaceFile = previous }()
+	namespaceFile = file.Name()
+	assert.Equal(t, defaultNamespace(), "yunikorn")
+	assert.Equal(t, newDefaultConf().Namespace, "yunikorn")
+
+	namespaceFile = file.Name() + ".missing"
+	assert.Equal(t, defaultNamespace(), DefaultNamespace)
+}
+
+func TestParsePriorities(t *testing.T) {
+	parsed, err := ParsePriorities("")
+	assert.NilError(t, err)
+	assert.Equal(t, len(parsed), 0)
+
+	parsed, err = ParsePriorities("LeastRequestedPriority:2,ImageLocalityPriority")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, parsed, []PriorityWeight{
+		{Name: "LeastRequestedPriority", Weight: 2},
+		{Name: "ImageLocalityPriority", Weight: 0},
+	})
+
+	for _, invalid := range []string{"NotExist", "LeastRequestedPriority:", "LeastRequestedPriority:-1",
+		"LeastRequestedPriority:a", "LeastRequestedPriority,"} {
+		_, err = ParsePriorities(invalid)
+		assert.Assert(t, err != nil, invalid)
+	}
+}
+
+func TestParseNamespaceQueues(t *testing.T) {
+	parsed, err := ParseNamespaceQueues("")
+	assert.NilError(t, err)
+	assert.Equal(t, len(parsed), 0)
+
+	parsed, err = ParseNamespaceQueues("dev=root.dev, prod = root.prod.services,")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, parsed, map[string]string{
+		"dev":  "root.dev",
+		"prod": "root.prod.services",
+	})
+
+	for _, invalid := range []string{"dev", "dev=", "=root.dev", "dev=root.a,dev=root.b"} {
+		_, err = ParseNamespaceQueues(invalid)
+		assert.Assert(t, err != nil, invalid)
+	}
+}
+
+func TestValidateAdmission(t *testing.T) {
+	conf := newDefaultConf()
+	assert.NilError(t, conf.validate())
+
+	for _, invalid := range []func(conf *SchedulerConf){
+		func(conf *SchedulerConf) { conf.AdmissionPort = 0 },
+		func(conf *SchedulerConf) { conf.AdmissionDefaultQueue = "" },
+		func(conf *SchedulerConf) { conf.AdmissionNamespaceQueues = "dev" },
+		func(conf *SchedulerConf) { conf.AdmissionNamespaceSelector = "a in (b" },
+		func(conf *SchedulerConf) { conf.AdmissionPodSelector = "!!a" },
+		func(conf *SchedulerConf) { conf.AdmissionCertRenewBefore = 0 },
+		func(conf *SchedulerConf) { conf.AdmissionCertValidity = conf.AdmissionCertRenewBefore },
+		func(conf *SchedulerConf) { conf.AdmissionCAValidity = conf.AdmissionCertValidity - time.Hour },
+	} {
+		clone := conf.Clone()
+		invalid(clone)
+		assert.Assert(t, clone.validate() != nil)
+	}
 }
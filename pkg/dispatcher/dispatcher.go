@@ -27,6 +27,7 @@ import (
 	"github.com/cloudera/yunikorn-k8shim/pkg/common/events"
 	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
 	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+	"github.com/cloudera/yunikorn-k8shim/pkg/metrics"
 )
 
 var dispatcher *Dispatcher
@@ -76,7 +77,7 @@ func init() {
 	if AsyncDispatchLimit < 10000 {
 		AsyncDispatchLimit = 10000
 	}
-	log.Logger.Info("Init dispatcher",
+	log.Log(log.Dispatcher).Info("Init dispatcher",
 		zap.Int("EventChannelCapacity", eventChannelCapacity),
 		zap.Int32("AsyncDispatchLimit", AsyncDispatchLimit),
 		zap.Float64("DispatchTimeoutInSeconds", DispatchTimeout.Seconds()))
@@ -103,11 +104,16 @@ func Dispatch(event events.SchedulingEvent) {
 	// currently if dispatch fails, we simply log the error
 	// we may revisit this later, e.g add retry here
 	if err := dispatcher.dispatch(event); err != nil {
-		log.Logger.Warn("failed to dispatch SchedulingEvent",
+		log.Log(log.Dispatcher).Warn("failed to dispatch SchedulingEvent",
 			zap.Error(err))
 	}
 }
 
+// returns true if the dispatcher is started and its event loop is running
+func IsRunning() bool {
+	return dispatcher.isRunning()
+}
+
 func (p *Dispatcher) isRunning() bool {
 	return p.running.Load().(bool)
 }
@@ -122,6 +128,7 @@ func (p *Dispatcher) dispatch(event events.SchedulingEvent) error {
 	}
 	select {
 	case p.eventChan <- event:
+		metrics.GetShimMetrics().SetDispatcherQueueDepth(len(p.eventChan))
 		return nil
 	default:
 		p.asyncDispatch(event)
@@ -133,13 +140,18 @@ func (p *Dispatcher) dispatch(event events.SchedulingEvent) error {
 // it's only called when event channel is full.
 func (p *Dispatcher) asyncDispatch(event events.SchedulingEvent) {
 	count := atomic.AddInt32(&asyncDispatchCount, 1)
-	log.Logger.Warn("event channel is full, transition to async-dispatch mode",
+	metrics.GetShimMetrics().SetAsyncDispatches(int(count))
+	log.Log(log.Dispatcher).Warn("event channel is full, transition to async-dispatch mode",
 		zap.Int32("asyncDispatchCount", count))
 	if count > AsyncDispatchLimit {
+		// the event is not dispatched, it is not counted
+		metrics.GetShimMetrics().SetAsyncDispatches(int(atomic.AddInt32(&asyncDispatchCount, -1)))
 		panic(fmt.Errorf("dispatcher exceeds async-dispatch limit"))
 	}
 	go func(beginTime time.Time) {
-		defer atomic.AddInt32(&asyncDispatchCount, -1)
+		defer func() {
+			metrics.GetShimMetrics().SetAsyncDispatches(int(atomic.AddInt32(&asyncDispatchCount, -1)))
+		}()
 		for p.isRunning() {
 			select {
 			case p.eventChan <- event:
@@ -147,11 +159,11 @@ func (p *Dispatcher) asyncDispatch(event events.SchedulingEvent) {
 			case <-time.After(AsyncDispatchCheckInterval):
 				elapseTime := time.Since(beginTime)
 				if elapseTime >= DispatchTimeout {
-					log.Logger.Error("dispatch timeout",
+					log.Log(log.Dispatcher).Error("dispatch timeout",
 						zap.Float64("elapseSeconds", elapseTime.Seconds()))
 					return
 				}
-				log.Logger.Warn("event channel is full, keep waiting...",
+				log.Log(log.Dispatcher).Warn("event channel is full, keep waiting...",
 					zap.Float64("elapseSeconds", elapseTime.Seconds()))
 			}
 		}
@@ -160,19 +172,20 @@ func (p *Dispatcher) asyncDispatch(event events.SchedulingEvent) {
 
 func (p *Dispatcher) drain() {
 	for len(p.eventChan) > 0 {
-		log.Logger.Info("wait dispatcher to drain",
+		log.Log(log.Dispatcher).Info("wait dispatcher to drain",
 			zap.Int("remaining events", len(p.eventChan)))
 		time.Sleep(1 * time.Second)
 	}
-	log.Logger.Info("dispatcher is draining out")
+	log.Log(log.Dispatcher).Info("dispatcher is draining out")
 }
 
 func Start() {
-	log.Logger.Info("starting the dispatcher")
+	log.Log(log.Dispatcher).Info("starting the dispatcher")
 	go func() {
 		for {
 			select {
 			case event := <-dispatcher.eventChan:
+				metrics.GetShimMetrics().SetDispatcherQueueDepth(len(dispatcher.eventChan))
 				switch v := event.(type) {
 				case events.ApplicationEvent:
 					getEventHandler(EventTypeApp)(v)
@@ -183,11 +196,11 @@ func Start() {
 				case events.SchedulerNodeEvent:
 					getEventHandler(EventTypeNode)(v)
 				default:
-					log.Logger.Fatal("unsupported event",
+					log.Log(log.Dispatcher).Fatal("unsupported event",
 						zap.Any("event", v))
 				}
 			case <-dispatcher.stopChan:
-				log.Logger.Info("shutting down event channel")
+				log.Log(log.Dispatcher).Info("shutting down event channel")
 				dispatcher.setRunning(false)
 				return
 			}
@@ -196,22 +209,26 @@ func Start() {
 	dispatcher.setRunning(true)
 }
 
-// stop the dispatcher and wait at most 5 seconds gracefully
+// stop the dispatcher and wait at most 5 seconds gracefully,
+// the event loop is stopped once the event it is handling is done
 func Stop() {
-	log.Logger.Info("stopping the dispatcher")
+	log.Log(log.Dispatcher).Info("stopping the dispatcher")
+	if !dispatcher.isRunning() {
+		log.Log(log.Dispatcher).Info("dispatcher is already stopped")
+		return
+	}
+	maxTimeout := 5 * time.Second
 	select {
 	case dispatcher.stopChan <- struct{}{}:
-		maxTimeout := 5
-		for dispatcher.isRunning() && maxTimeout > 0 {
-			log.Logger.Info("waiting for dispatcher to be stopped",
-				zap.Int("remainingSeconds", maxTimeout))
-			time.Sleep(1 * time.Second)
-			maxTimeout--
+		deadline := time.Now().Add(maxTimeout)
+		for dispatcher.isRunning() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
 		}
 		if !dispatcher.isRunning() {
-			log.Logger.Info("dispatcher stopped")
+			log.Log(log.Dispatcher).Info("dispatcher stopped")
 		}
-	default:
-		log.Logger.Info("dispatcher is already stopped")
+	case <-time.After(maxTimeout):
+		log.Log(log.Dispatcher).Warn("dispatcher is not stopped, the event handler is still busy",
+			zap.Stringer("timeout", maxTimeout))
 	}
 }
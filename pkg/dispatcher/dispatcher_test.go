@@ -27,6 +27,7 @@ import (
 	"gotest.tools/assert"
 
 	"github.com/cloudera/yunikorn-k8shim/pkg/common/events"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/utils"
 )
 
 // app event for testing
@@ -200,18 +201,20 @@ func TestDispatchTimeout(t *testing.T) {
 		DispatchTimeout = backupDispatchTimeout
 	}()
 
-	// pretend to be an time-consuming event-handler
-	handledChan := make(chan bool)
-	RegisterEventHandler(EventTypeApp, func(obj interface{}) {
-		if _, ok := obj.(events.ApplicationEvent); ok {
-			time.Sleep(2 * time.Second)
-			handledChan <- true
-		}
-	})
+	// pretend to be an time-consuming event-handler, it blocks until the test ends
+	handling, release := registerBlockingHandler()
 	// start the dispatcher
 	Start()
-	// dispatch 3 events, the third event will be dispatched asynchronously
-	for i := 0; i < 3; i++ {
+	defer stopAndWaitForAsyncDispatches(t, release)
+
+	// the first event is handled, the second one fills the event channel
+	// and the third one is dispatched asynchronously
+	Dispatch(TestAppEvent{
+		appID:     "test",
+		eventType: events.RunApplication,
+	})
+	<-handling
+	for i := 0; i < 2; i++ {
 		Dispatch(TestAppEvent{
 			appID:     "test",
 			eventType: events.RunApplication,
@@ -223,46 +226,42 @@ func TestDispatchTimeout(t *testing.T) {
 	buf := make([]byte, 1<<16)
 	runtime.Stack(buf, true)
 	assert.Assert(t, strings.Contains(string(buf), "asyncDispatch"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&asyncDispatchCount))
 
-	// sleep 400ms to verify that async-dispatch goroutine is disappeared
-	time.Sleep(400 * time.Millisecond)
-	buf = make([]byte, 1<<16)
-	runtime.Stack(buf, true)
-	assert.Assert(t, !strings.Contains(string(buf), "asyncDispatch"))
-
-	// stop the dispatcher
-	Stop()
+	// verify that async-dispatch goroutine is disappeared after the timeout
+	assert.NilError(t, utils.WaitForCondition(func() bool {
+		return atomic.LoadInt32(&asyncDispatchCount) == 0
+	}, 10*time.Millisecond, time.Second))
 }
 
 // Test exceeding the async-dispatch limit, should panic immediately.
 func TestExceedAsyncDispatchLimit(t *testing.T) {
 	// reset event channel with small capacity for testing
+	backupCapacity := cap(dispatcher.eventChan)
+	backupAsyncDispatchCheckInterval := AsyncDispatchCheckInterval
 	dispatcher.eventChan = make(chan events.SchedulingEvent, 1)
+	AsyncDispatchCheckInterval = 100 * time.Millisecond
 	AsyncDispatchLimit = 1
-	// pretend to be an time-consuming event-handler
-	handledChan := make(chan bool)
-	RegisterEventHandler(EventTypeApp, func(obj interface{}) {
-		if _, ok := obj.(events.ApplicationEvent); ok {
-			time.Sleep(2 * time.Second)
-			handledChan <- true
-		}
-	})
+	// pretend to be an time-consuming event-handler, it blocks until the test ends
+	_, release := registerBlockingHandler()
 	// Handle errors in defer func with recover.
 	defer func() {
-		// stop the dispatcher
-		Stop()
-		// recovery variables
-		AsyncDispatchLimit = 10000
 		// check error
 		if err := recover(); err != nil {
 			assert.Assert(t, strings.Contains(err.(error).Error(), "dispatcher exceeds async-dispatch limit"))
 		} else {
 			t.Error("Panic should be caught here")
 		}
+		// stop the dispatcher
+		stopAndWaitForAsyncDispatches(t, release)
+		// recovery variables
+		AsyncDispatchLimit = 10000
+		dispatcher.eventChan = make(chan events.SchedulingEvent, backupCapacity)
+		AsyncDispatchCheckInterval = backupAsyncDispatchCheckInterval
 	}()
 	// start the dispatcher
 	Start()
-	// dispatch 4 events, the third and forth events will be dispatched asynchronously
+	// dispatch 4 events, at least the third and forth events are dispatched asynchronously
 	for i := 0; i < 4; i++ {
 		Dispatch(TestAppEvent{
 			appID:     "test",
@@ -270,3 +269,31 @@ func TestExceedAsyncDispatchLimit(t *testing.T) {
 		})
 	}
 }
+
+// registers an app event handler which blocks until the release channel is closed,
+// the handling channel is notified when the handler is called the first time.
+func registerBlockingHandler() (handling chan struct{}, release chan struct{}) {
+	handling = make(chan struct{}, 1)
+	release = make(chan struct{})
+	RegisterEventHandler(EventTypeApp, func(obj interface{}) {
+		if _, ok := obj.(events.ApplicationEvent); ok {
+			select {
+			case handling <- struct{}{}:
+			default:
+			}
+			<-release
+		}
+	})
+	return handling, release
+}
+
+// unblocks the handler, stops the dispatcher and waits until the async dispatches are gone,
+// so that no state is left behind for the next test.
+func stopAndWaitForAsyncDispatches(t *testing.T, release chan struct{}) {
+	close(release)
+	Stop()
+	assert.Equal(t, dispatcher.isRunning(), false)
+	assert.NilError(t, utils.WaitForCondition(func() bool {
+		return atomic.LoadInt32(&asyncDispatchCount) == 0
+	}, 10*time.Millisecond, 5*time.Second))
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package election
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+)
+
+// callbacks of the leader election, both are called in a separate go routine
+type Callbacks struct {
+	// called when this candidate becomes the leader
+	OnStartedLeading func()
+	// called when the leader loses its lease unexpectedly,
+	// it is not called when the elector is stopped on purpose.
+	OnStoppedLeading func()
+}
+
+// elector runs a lease based leader election among the scheduler replicas,
+// only the leader is allowed to register to the scheduler core and bind pods,
+// the others stay in standby until they acquire the lease.
+type Elector struct {
+	leaderElector *leaderelection.LeaderElector
+	identity      string
+	callbacks     Callbacks
+	leading       int32
+	stopping      int32
+	cancel        context.CancelFunc
+	done          chan struct{}
+	lock          sync.Mutex
+}
+
+func NewElector(client kubernetes.Interface, configs *conf.SchedulerConf, callbacks Callbacks) (*Elector, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	// the hostname might not be unique, e.g when running with host network
+	identity := fmt.Sprintf("%s_%s", hostname, uuid.NewUUID())
+	return newElectorInternal(client, configs, identity, callbacks)
+}
+
+func newElectorInternal(client kubernetes.Interface, configs *conf.SchedulerConf,
+	identity string, callbacks Callbacks) (*Elector, error) {
+	e := &Elector{
+		identity:  identity,
+		callbacks: callbacks,
+	}
+
+	// the lease is named after the scheduler, so that different schedulers do not interfere
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock,
+		configs.LeaderElectionNS,
+		configs.SchedulerName,
+		client.CoreV1(),
+		client.CoordinationV1(),
+		resourcelock.ResourceLockConfig{
+			Identity: identity,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	e.leaderElector, err = leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   configs.LeaseDuration,
+		RenewDeadline:   configs.LeaseRenewDeadline,
+		RetryPeriod:     configs.LeaseRetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            configs.SchedulerName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: e.onStartedLeading,
+			OnStoppedLeading: e.onStoppedLeading,
+			OnNewLeader: func(identity string) {
+				log.Logger.Info("observed a new leader",
+					zap.String("leader", identity))
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// starts the leader election loop in the background,
+// the election ends once the leadership is lost or the elector is stopped.
+func (e *Elector) Run() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.done != nil {
+		return
+	}
+	var ctx context.Context
+	ctx, e.cancel = context.WithCancel(context.Background())
+	e.done = make(chan struct{})
+	log.Logger.Info("starting the leader election",
+		zap.String("identity", e.identity))
+	go func() {
+		defer close(e.done)
+		e.leaderElector.Run(ctx)
+	}()
+}
+
+// stops the leader election, the lease is released if this candidate is the leader,
+// this waits until the election loop exits.
+func (e *Elector) Stop() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.done == nil {
+		return
+	}
+	atomic.StoreInt32(&e.stopping, 1)
+	e.cancel()
+	<-e.done
+	log.Logger.Info("leader election stopped",
+		zap.String("identity", e.identity))
+}
+
+func (e *Elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leading) == 1
+}
+
+func (e *Elector) GetIdentity() string {
+	return e.identity
+}
+
+func (e *Elector) onStartedLeading(ctx context.Context) {
+	log.Logger.Info("acquired the leadership",
+		zap.String("identity", e.identity))
+	atomic.StoreInt32(&e.leading, 1)
+	if e.callbacks.OnStartedLeading != nil {
+		e.callbacks.OnStartedLeading()
+	}
+}
+
+// the leader election library calls this whenever the election loop exits,
+// even if this candidate has never been the leader.
+func (e *Elector) onStoppedLeading() {
+	if !atomic.CompareAndSwapInt32(&e.leading, 1, 0) {
+		return
+	}
+	if atomic.LoadInt32(&e.stopping) == 1 {
+		log.Logger.Info("released the leadership",
+			zap.String("identity", e.identity))
+		return
+	}
+	log.Logger.Error("lost the leadership",
+		zap.String("identity", e.identity))
+	if e.callbacks.OnStoppedLeading != nil {
+		e.callbacks.OnStoppedLeading()
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package election
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/utils"
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+)
+
+func newTestConf() *conf.SchedulerConf {
+	return &conf.SchedulerConf{
+		SchedulerName:      "yunikorn-test",
+		LeaderElectionNS:   "default",
+		LeaseDuration:      1 * time.Second,
+		LeaseRenewDeadline: 500 * time.Millisecond,
+		LeaseRetryPeriod:   100 * time.Millisecond,
+	}
+}
+
+func TestLeaderTakeover(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	var started01, started02, lost01 int32
+	e01, err := newElectorInternal(client, newTestConf(), "candidate-01", Callbacks{
+		OnStartedLeading: func() { atomic.AddInt32(&started01, 1) },
+		OnStoppedLeading: func() { atomic.AddInt32(&lost01, 1) },
+	})
+	assert.NilError(t, err)
+	e02, err := newElectorInternal(client, newTestConf(), "candidate-02", Callbacks{
+		OnStartedLeading: func() { atomic.AddInt32(&started02, 1) },
+	})
+	assert.NilError(t, err)
+
+	e01.Run()
+	assert.NilError(t, utils.WaitForCondition(e01.IsLeader, 50*time.Millisecond, 5*time.Second),
+		"candidate-01 to become the leader")
+	assert.Equal(t, atomic.LoadInt32(&started01), int32(1))
+
+	// the second candidate stays in standby while the lease is renewed
+	e02.Run()
+	defer e02.Stop()
+	time.Sleep(1500 * time.Millisecond)
+	assert.Assert(t, e01.IsLeader())
+	assert.Assert(t, !e02.IsLeader())
+	assert.Equal(t, atomic.LoadInt32(&started02), int32(0))
+
+	// the lease is released when the leader stops, so the standby takes over
+	e01.Stop()
+	assert.Assert(t, !e01.IsLeader())
+	assert.NilError(t, utils.WaitForCondition(e02.IsLeader, 50*time.Millisecond, 5*time.Second),
+		"candidate-02 to become the leader")
+	assert.Equal(t, atomic.LoadInt32(&started02), int32(1))
+	// stopped on purpose, this is not a lost lease
+	assert.Equal(t, atomic.LoadInt32(&lost01), int32(0))
+}
+
+func TestLeaderLosesLease(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	var lost int32
+	e, err := newElectorInternal(client, newTestConf(), "candidate-01", Callbacks{
+		OnStoppedLeading: func() { atomic.AddInt32(&lost, 1) },
+	})
+	assert.NilError(t, err)
+	e.Run()
+	defer e.Stop()
+	assert.NilError(t, utils.WaitForCondition(e.IsLeader, 50*time.Millisecond, 5*time.Second),
+		"candidate-01 to become the leader")
+
+	// another candidate takes the lease, e.g the leader was partitioned from the api-server
+	leases := client.CoordinationV1().Leases("default")
+	lease, err := leases.Get("yunikorn-test", metav1.GetOptions{})
+	assert.NilError(t, err)
+	holder := "candidate-02"
+	now := metav1.NewMicroTime(time.Now().Add(time.Hour))
+	lease.Spec.HolderIdentity = &holder
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(lease)
+	assert.NilError(t, err)
+
+	assert.NilError(t, utils.WaitForCondition(func() bool {
+		return atomic.LoadInt32(&lost) == 1
+	}, 50*time.Millisecond, 5*time.Second), "candidate-01 to lose the lease")
+	assert.Assert(t, !e.IsLeader())
+}
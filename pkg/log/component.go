@@ -0,0 +1,172 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// components which have their own named loggers, the level of each
+// component can be set independently from the root logger
+const (
+	Dispatcher = "dispatcher"
+	Cache      = "cache"
+	Predicates = "predicates"
+	Priorities = "priorities"
+	Extenders  = "extenders"
+	Callback   = "callback"
+	Webhook    = "webhook"
+)
+
+type componentLevel struct {
+	level zap.AtomicLevel
+	// an overridden level doesn't follow the level of the root logger
+	overridden bool
+}
+
+var (
+	componentLevels = map[string]*componentLevel{
+		Dispatcher: {level: zap.NewAtomicLevel()},
+		Cache:      {level: zap.NewAtomicLevel()},
+		Predicates: {level: zap.NewAtomicLevel()},
+		Priorities: {level: zap.NewAtomicLevel()},
+		Extenders:  {level: zap.NewAtomicLevel()},
+		Callback:   {level: zap.NewAtomicLevel()},
+		Webhook:    {level: zap.NewAtomicLevel()},
+	}
+	componentLoggers = make(map[string]*zap.Logger)
+	levelLock        sync.RWMutex
+)
+
+// level info of a component logger
+type ComponentLevel struct {
+	Name       string
+	Level      zapcore.Level
+	Overridden bool
+}
+
+// returns the logger of the component, the root logger is returned for unknown components
+func Log(component string) *zap.Logger {
+	levelLock.RLock()
+	defer levelLock.RUnlock()
+	if logger, ok := componentLoggers[component]; ok {
+		return logger
+	}
+	return Logger
+}
+
+// returns the level of the root logger
+func GetLevel() zapcore.Level {
+	return level.Level()
+}
+
+// sets the level of the root logger, and the levels of the components which are not overridden
+func SetLevel(l zapcore.Level) {
+	levelLock.Lock()
+	defer levelLock.Unlock()
+	level.SetLevel(l)
+	for _, component := range componentLevels {
+		if !component.overridden {
+			component.level.SetLevel(l)
+		}
+	}
+}
+
+// overrides the level of the component, it doesn't follow the root logger afterwards
+func SetComponentLevel(name string, l zapcore.Level) error {
+	levelLock.Lock()
+	defer levelLock.Unlock()
+	component, ok := componentLevels[name]
+	if !ok {
+		return fmt.Errorf("unknown logging component %s", name)
+	}
+	component.level.SetLevel(l)
+	component.overridden = true
+	return nil
+}
+
+// resets the level of the component, it follows the root logger again
+func ResetComponentLevel(name string) error {
+	levelLock.Lock()
+	defer levelLock.Unlock()
+	component, ok := componentLevels[name]
+	if !ok {
+		return fmt.Errorf("unknown logging component %s", name)
+	}
+	component.level.SetLevel(level.Level())
+	component.overridden = false
+	return nil
+}
+
+// returns the levels of all components, sorted by name
+func GetComponentLevels() []ComponentLevel {
+	levelLock.RLock()
+	defer levelLock.RUnlock()
+	levels := make([]ComponentLevel, 0, len(componentLevels))
+	for name, component := range componentLevels {
+		levels = append(levels, ComponentLevel{
+			Name:       name,
+			Level:      component.level.Level(),
+			Overridden: component.overridden,
+		})
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].Name < levels[j].Name
+	})
+	return levels
+}
+
+func buildComponentLoggers(base *zap.Logger) {
+	levelLock.Lock()
+	defer levelLock.Unlock()
+	for name, component := range componentLevels {
+		componentLoggers[name] = withLevel(base.Named(name), component.level)
+	}
+}
+
+// wraps the core of the logger to only write the entries enabled by the level
+func withLevel(logger *zap.Logger, level zap.AtomicLevel) *zap.Logger {
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &levelCore{Core: core, level: level}
+	}))
+}
+
+// levelCore checks the entries against its own level instead of the level of the wrapped core
+type levelCore struct {
+	zapcore.Core
+	level zap.AtomicLevel
+}
+
+func (c *levelCore) Enabled(l zapcore.Level) bool {
+	return c.level.Enabled(l)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"gotest.tools/assert"
+)
+
+func TestComponentLevels(t *testing.T) {
+	defer SetLevel(GetLevel())
+	SetLevel(zapcore.InfoLevel)
+	for _, component := range GetComponentLevels() {
+		assert.Equal(t, component.Level, zapcore.InfoLevel)
+		assert.Equal(t, component.Overridden, false)
+	}
+
+	// an overridden component doesn't follow the root level
+	assert.NilError(t, SetComponentLevel(Dispatcher, zapcore.DebugLevel))
+	defer func() {
+		assert.NilError(t, ResetComponentLevel(Dispatcher))
+	}()
+	SetLevel(zapcore.WarnLevel)
+	for _, component := range GetComponentLevels() {
+		if component.Name == Dispatcher {
+			assert.Equal(t, component.Level, zapcore.DebugLevel)
+			assert.Equal(t, component.Overridden, true)
+		} else {
+			assert.Equal(t, component.Level, zapcore.WarnLevel)
+		}
+	}
+	assert.Assert(t, Log(Dispatcher).Core().Enabled(zapcore.DebugLevel))
+	assert.Assert(t, !Log(Cache).Core().Enabled(zapcore.InfoLevel))
+	assert.Assert(t, !Logger.Core().Enabled(zapcore.InfoLevel))
+
+	// the component follows the root level again after reset
+	assert.NilError(t, ResetComponentLevel(Dispatcher))
+	assert.Assert(t, !Log(Dispatcher).Core().Enabled(zapcore.InfoLevel))
+
+	// unknown components
+	assert.Assert(t, SetComponentLevel("unknown", zapcore.DebugLevel) != nil)
+	assert.Assert(t, ResetComponentLevel("unknown") != nil)
+	assert.Equal(t, Log("unknown"), Logger)
+}
+
+func TestLevelCore(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	logger := withLevel(zap.New(core), level).With(zap.String("key", "value"))
+
+	logger.Debug("filtered")
+	logger.Info("written")
+	assert.Equal(t, logs.Len(), 1)
+	assert.Equal(t, logs.All()[0].Message, "written")
+	assert.Equal(t, logs.All()[0].ContextMap()["key"], "value")
+
+	// the level changes at runtime
+	level.SetLevel(zapcore.DebugLevel)
+	logger.Debug("debug")
+	assert.Equal(t, logs.Len(), 2)
+}
@@ -29,9 +29,42 @@ import (
 
 var Logger *zap.Logger
 
+// the level of the root logger, it can be changed at runtime
+var level = zap.NewAtomicLevel()
+
 func init() {
-	configs := conf.GetSchedulerConf()
+	// the logger works with the default configuration until the configuration is loaded
+	buildLogger(conf.GetSchedulerConf())
+
+	// the log level is updated when it is changed in the reloaded configuration
+	conf.AddReloadHandler(func(previous, updated *conf.SchedulerConf) {
+		if previous.LoggingLevel != updated.LoggingLevel {
+			SetLevel(zapcore.Level(updated.LoggingLevel))
+			Logger.Info("logging level is changed",
+				zap.Int("from", previous.LoggingLevel),
+				zap.Int("to", updated.LoggingLevel))
+		}
+	})
+}
+
+// rebuilds the logger once the configuration is loaded, and dumps the configuration
+func InitLogger(configs *conf.SchedulerConf) {
+	buildLogger(configs)
 
+	// dump configuration
+	c, err := json.MarshalIndent(&configs, "", " ")
+	if err != nil {
+		Logger.Info("scheduler configuration, json conversion failed", zap.Any("configs", configs))
+	} else {
+		Logger.Info("scheduler configuration, pretty print", zap.String("configs", string(c)))
+	}
+
+	// make sure logs are flushed
+	//nolint:errcheck
+	defer Logger.Sync()
+}
+
+func buildLogger(configs *conf.SchedulerConf) {
 	var outputPaths []string
 	if strings.Compare(configs.LogFile, "") == 0 {
 		outputPaths = []string{"stdout"}
@@ -39,8 +72,11 @@ func init() {
 		outputPaths = []string{"stdout", configs.LogFile}
 	}
 
+	SetLevel(zapcore.Level(configs.LoggingLevel))
 	zapConfigs := zap.Config{
-		Level:             zap.NewAtomicLevelAt(zapcore.Level(configs.LoggingLevel)),
+		// the base logger enables all levels, the levels of the
+		// root logger and the component loggers are checked on top of it
+		Level:             zap.NewAtomicLevelAt(zapcore.DebugLevel),
 		Development:       false,
 		DisableCaller:     false,
 		DisableStacktrace: false,
@@ -63,7 +99,8 @@ func init() {
 	}
 
 	if logger, err := zapConfigs.Build(); err == nil {
-		Logger = logger
+		Logger = withLevel(logger, level)
+		buildComponentLoggers(logger)
 		// zap.ReplaceGlobals(Logger)
 	} else {
 		panic(fmt.Sprintf("failed to init logger, reason: %s", err.Error()))
@@ -73,16 +110,4 @@ func init() {
 	// when k8s-shim runs with core, core side can directly reuse this logger,
 	// this way we are making consistent logging configs in shim and core.
 	zap.ReplaceGlobals(Logger)
-
-	// dump configuration
-	c, err := json.MarshalIndent(&configs, "", " ")
-	if err != nil {
-		Logger.Info("scheduler configuration, json conversion failed", zap.Any("configs", configs))
-	} else {
-		Logger.Info("scheduler configuration, pretty print", zap.String("configs", string(c)))
-	}
-
-	// make sure logs are flushed
-	//nolint:errcheck
-	defer Logger.Sync()
 }
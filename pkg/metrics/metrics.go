@@ -0,0 +1,307 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+)
+
+const (
+	// all metrics should be declared under this namespace
+	Namespace = "yunikorn"
+	// ShimSubsystem - subsystem name used by the k8s shim
+	ShimSubsystem = "k8shim"
+)
+
+// label values of the bind failures
+const (
+	BindFailurePod    = "pod"
+	BindFailureVolume = "volume"
+)
+
+// label values of the predicate evaluation results
+const (
+	PredicateFit   = "fit"
+	PredicateUnfit = "unfit"
+	PredicateError = "error"
+)
+
+// label values of the informer events
+const (
+	InformerEventAdd    = "add"
+	InformerEventUpdate = "update"
+	InformerEventDelete = "delete"
+)
+
+// label values of the cache inconsistencies
+const (
+	InconsistencyMissingPod      = "missing_pod"
+	InconsistencyStaleAssumedPod = "stale_assumed_pod"
+	InconsistencyRedundantPod    = "redundant_pod"
+	InconsistencyOrphanTask      = "orphan_task"
+	InconsistencyMissingNode     = "missing_node"
+	InconsistencyStaleNode       = "stale_node"
+	InconsistencyRedundantNode   = "redundant_node"
+)
+
+var once sync.Once
+var shimMetrics *ShimMetrics
+
+// All shim metrics variables to be declared in this struct
+type ShimMetrics struct {
+	podAddToSubmitLatency      prometheus.Histogram
+	podSubmitToAllocateLatency prometheus.Histogram
+	podAllocateToBindLatency   prometheus.Histogram
+	bindFailures               *prometheus.CounterVec
+	predicateEvaluations       *prometheus.CounterVec
+	dispatcherQueueDepth       prometheus.Gauge
+	asyncDispatches            prometheus.Gauge
+	applications               *prometheus.GaugeVec
+	tasks                      *prometheus.GaugeVec
+	informerEvents             *prometheus.CounterVec
+	expiredAssumedPods         prometheus.Counter
+	cacheInconsistencies       *prometheus.GaugeVec
+}
+
+func GetShimMetrics() *ShimMetrics {
+	once.Do(func() {
+		shimMetrics = initShimMetrics()
+	})
+	return shimMetrics
+}
+
+// Initialize shim metrics
+func initShimMetrics() *ShimMetrics {
+	s := &ShimMetrics{}
+
+	// pod scheduling latencies, from a few milliseconds up to about one hour
+	latencyBuckets := prometheus.ExponentialBuckets(0.001, 4, 12)
+	s.podAddToSubmitLatency = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: ShimSubsystem,
+			Name:      "pod_add_to_submit_latency_seconds",
+			Help:      "latency in seconds from a pod is added to the shim till it is submitted to the scheduler core",
+			Buckets:   latencyBuckets,
+		})
+	s.podSubmitToAllocateLatency = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: ShimSubsystem,
+			Name:      "pod_submit_to_allocate_latency_seconds",
+			Help:      "latency in seconds from a pod is submitted to the scheduler core till it gets an allocation",
+			Buckets:   latencyBuckets,
+		})
+	s.podAllocateToBindLatency = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: ShimSubsystem,
+			Name:      "pod_allocate_to_bind_latency_seconds",
+			Help:      "latency in seconds from a pod gets an allocation till it is bound to the node",
+			Buckets:   latencyBuckets,
+		})
+
+	// failures
+	s.bindFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: ShimSubsystem,
+			Name:      "bind_failures_total",
+			Help:      "Number of failures when binding pods or pod volumes, by the type.",
+		}, []string{"type"})
+
+	// predicates
+	s.predicateEvaluations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: ShimSubsystem,
+			Name:      "predicate_evaluations_total",
+			Help:      "Number of predicate evaluations, by the predicate and the result.",
+		}, []string{"predicate", "result"})
+
+	// dispatcher
+	s.dispatcherQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: ShimSubsystem,
+			Name:      "dispatcher_queue_depth",
+			Help:      "number of events waiting in the dispatcher event channel",
+		})
+	s.asyncDispatches = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: ShimSubsystem,
+			Name:      "dispatcher_async_dispatches",
+			Help:      "number of events waiting to be dispatched asynchronously as the event channel is full",
+		})
+
+	// apps and tasks
+	s.applications = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: ShimSubsystem,
+			Name:      "applications",
+			Help:      "number of applications, by the state",
+		}, []string{"state"})
+	s.tasks = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: ShimSubsystem,
+			Name:      "tasks",
+			Help:      "number of tasks, by the state",
+		}, []string{"state"})
+
+	// informers
+	s.informerEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: ShimSubsystem,
+			Name:      "informer_events_total",
+			Help:      "Number of events received from the informers, by the resource and the event type.",
+		}, []string{"resource", "event"})
+
+	// scheduler cache
+	s.expiredAssumedPods = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: ShimSubsystem,
+			Name:      "assumed_pods_expired_total",
+			Help:      "Number of assumed pods expired as they were not confirmed in time after binding.",
+		})
+	s.cacheInconsistencies = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: ShimSubsystem,
+			Name:      "cache_inconsistencies",
+			Help:      "number of inconsistencies found by the latest cache check, by the type",
+		}, []string{"type"})
+
+	var metricsList = []prometheus.Collector{
+		s.podAddToSubmitLatency,
+		s.podSubmitToAllocateLatency,
+		s.podAllocateToBindLatency,
+		s.bindFailures,
+		s.predicateEvaluations,
+		s.dispatcherQueueDepth,
+		s.asyncDispatches,
+		s.applications,
+		s.tasks,
+		s.informerEvents,
+		s.expiredAssumedPods,
+		s.cacheInconsistencies,
+	}
+
+	// Register the metrics.
+	for _, metric := range metricsList {
+		if err := prometheus.Register(metric); err != nil {
+			log.Logger.Warn("failed to register metrics collector", zap.Error(err))
+		}
+	}
+
+	return s
+}
+
+// SinceInSeconds gets the time since the specified start in seconds.
+func SinceInSeconds(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+func (m *ShimMetrics) ObservePodAddToSubmitLatency(start time.Time) {
+	m.podAddToSubmitLatency.Observe(SinceInSeconds(start))
+}
+
+func (m *ShimMetrics) ObservePodSubmitToAllocateLatency(start time.Time) {
+	m.podSubmitToAllocateLatency.Observe(SinceInSeconds(start))
+}
+
+func (m *ShimMetrics) ObservePodAllocateToBindLatency(start time.Time) {
+	m.podAllocateToBindLatency.Observe(SinceInSeconds(start))
+}
+
+// Metrics Ops related to bindFailures
+func (m *ShimMetrics) IncPodBindFailure() {
+	m.bindFailures.With(prometheus.Labels{"type": BindFailurePod}).Inc()
+}
+
+func (m *ShimMetrics) IncVolumeBindFailure() {
+	m.bindFailures.With(prometheus.Labels{"type": BindFailureVolume}).Inc()
+}
+
+// Metrics Ops related to predicateEvaluations, result is one of fit, unfit or error
+func (m *ShimMetrics) IncPredicateEvaluation(predicate string, result string) {
+	m.predicateEvaluations.With(prometheus.Labels{"predicate": predicate, "result": result}).Inc()
+}
+
+// Metrics Ops related to the dispatcher
+func (m *ShimMetrics) SetDispatcherQueueDepth(value int) {
+	m.dispatcherQueueDepth.Set(float64(value))
+}
+
+func (m *ShimMetrics) SetAsyncDispatches(value int) {
+	m.asyncDispatches.Set(float64(value))
+}
+
+// Metrics Ops related to applications, an application is counted in its initial state
+// once it is created, moved between the states on every state transition, and
+// removed from its current state when it is removed.
+func (m *ShimMetrics) IncApplicationsInState(state string) {
+	m.applications.With(prometheus.Labels{"state": state}).Inc()
+}
+
+func (m *ShimMetrics) DecApplicationsInState(state string) {
+	m.applications.With(prometheus.Labels{"state": state}).Dec()
+}
+
+func (m *ShimMetrics) MoveApplicationState(from, to string) {
+	m.applications.With(prometheus.Labels{"state": from}).Dec()
+	m.applications.With(prometheus.Labels{"state": to}).Inc()
+}
+
+// Metrics Ops related to tasks, same as the applications
+func (m *ShimMetrics) IncTasksInState(state string) {
+	m.tasks.With(prometheus.Labels{"state": state}).Inc()
+}
+
+func (m *ShimMetrics) DecTasksInState(state string) {
+	m.tasks.With(prometheus.Labels{"state": state}).Dec()
+}
+
+func (m *ShimMetrics) MoveTaskState(from, to string) {
+	m.tasks.With(prometheus.Labels{"state": from}).Dec()
+	m.tasks.With(prometheus.Labels{"state": to}).Inc()
+}
+
+// Metrics Ops related to informerEvents
+func (m *ShimMetrics) IncInformerEvent(resource string, event string) {
+	m.informerEvents.With(prometheus.Labels{"resource": resource, "event": event}).Inc()
+}
+
+// Metrics Ops related to expiredAssumedPods
+func (m *ShimMetrics) IncExpiredAssumedPods() {
+	m.expiredAssumedPods.Inc()
+}
+
+// Metrics Ops related to cacheInconsistencies, the gauge is set by every cache check
+func (m *ShimMetrics) SetCacheInconsistencies(inconsistency string, value int) {
+	m.cacheInconsistencies.With(prometheus.Labels{"type": inconsistency}).Set(float64(value))
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/assert"
+)
+
+func TestBindFailures(t *testing.T) {
+	m := GetShimMetrics()
+	podFailures := testutil.ToFloat64(m.bindFailures.With(prometheus.Labels{"type": BindFailurePod}))
+	volumeFailures := testutil.ToFloat64(m.bindFailures.With(prometheus.Labels{"type": BindFailureVolume}))
+
+	m.IncPodBindFailure()
+	m.IncVolumeBindFailure()
+	m.IncVolumeBindFailure()
+	assert.Equal(t, testutil.ToFloat64(m.bindFailures.With(prometheus.Labels{"type": BindFailurePod})), podFailures+1)
+	assert.Equal(t, testutil.ToFloat64(m.bindFailures.With(prometheus.Labels{"type": BindFailureVolume})), volumeFailures+2)
+}
+
+func TestTaskStates(t *testing.T) {
+	m := GetShimMetrics()
+	m.IncTasksInState("TestNew")
+	m.IncTasksInState("TestNew")
+	m.MoveTaskState("TestNew", "TestPending")
+	assert.Equal(t, testutil.ToFloat64(m.tasks.With(prometheus.Labels{"state": "TestNew"})), float64(1))
+	assert.Equal(t, testutil.ToFloat64(m.tasks.With(prometheus.Labels{"state": "TestPending"})), float64(1))
+	m.DecTasksInState("TestPending")
+	assert.Equal(t, testutil.ToFloat64(m.tasks.With(prometheus.Labels{"state": "TestPending"})), float64(0))
+}
+
+func TestApplicationStates(t *testing.T) {
+	m := GetShimMetrics()
+	m.IncApplicationsInState("TestNew")
+	m.MoveApplicationState("TestNew", "TestAccepted")
+	assert.Equal(t, testutil.ToFloat64(m.applications.With(prometheus.Labels{"state": "TestNew"})), float64(0))
+	assert.Equal(t, testutil.ToFloat64(m.applications.With(prometheus.Labels{"state": "TestAccepted"})), float64(1))
+	m.DecApplicationsInState("TestAccepted")
+	assert.Equal(t, testutil.ToFloat64(m.applications.With(prometheus.Labels{"state": "TestAccepted"})), float64(0))
+}
+
+func TestPredicateEvaluations(t *testing.T) {
+	m := GetShimMetrics()
+	m.IncPredicateEvaluation("TestPredicate", PredicateFit)
+	m.IncPredicateEvaluation("TestPredicate", PredicateUnfit)
+	m.IncPredicateEvaluation("TestPredicate", PredicateUnfit)
+	assert.Equal(t, testutil.ToFloat64(m.predicateEvaluations.With(
+		prometheus.Labels{"predicate": "TestPredicate", "result": PredicateFit})), float64(1))
+	assert.Equal(t, testutil.ToFloat64(m.predicateEvaluations.With(
+		prometheus.Labels{"predicate": "TestPredicate", "result": PredicateUnfit})), float64(2))
+	assert.Equal(t, testutil.ToFloat64(m.predicateEvaluations.With(
+		prometheus.Labels{"predicate": "TestPredicate", "result": PredicateError})), float64(0))
+}
+
+func TestMetricsRegistered(t *testing.T) {
+	m := GetShimMetrics()
+	m.ObservePodAddToSubmitLatency(time.Now().Add(-time.Second))
+	m.SetDispatcherQueueDepth(10)
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NilError(t, err)
+	found := make(map[string]bool)
+	for _, family := range families {
+		found[family.GetName()] = true
+	}
+	assert.Assert(t, found["yunikorn_k8shim_pod_add_to_submit_latency_seconds"])
+	assert.Assert(t, found["yunikorn_k8shim_dispatcher_queue_depth"])
+}
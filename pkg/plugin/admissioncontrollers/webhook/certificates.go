@@ -0,0 +1,345 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+)
+
+// the keys of the certificates in the secret, in PEM format
+const (
+	caCertKey   = "ca-cert.pem"
+	caKeyKey    = "ca-key.pem"
+	caBundleKey = "ca-bundle.pem"
+	certKey     = "cert.pem"
+	keyKey      = "key.pem"
+)
+
+const (
+	// how often the certificates are checked for renewal, and reloaded from the secret
+	certCheckInterval = time.Hour
+	rsaKeySize        = 2048
+	// the secret may be updated by another replica at the same time
+	maxCertUpdateAttempts = 3
+)
+
+// the CA and the serving certificate of the admission controller, the CA bundle has the
+// current CA and the previous one, so the certificates signed by both are trusted.
+type certificates struct {
+	caCert    *x509.Certificate
+	caKey     *rsa.PrivateKey
+	caCertPEM []byte
+	caKeyPEM  []byte
+	caBundle  []byte
+	cert      *x509.Certificate
+	certPEM   []byte
+	keyPEM    []byte
+}
+
+// generates the CA and the TLS certificate of the admission controller, stores them in a secret,
+// and renews them before they expire. The web-hook configurations are registered with the CA bundle.
+// The certificates are shared by the replicas of the admission controller through the secret.
+type certManager struct {
+	clientSet    kubernetes.Interface
+	namespace    string
+	serviceName  string
+	secretName   string
+	caValidity   time.Duration
+	certValidity time.Duration
+	renewBefore  time.Duration
+	// the certificate served by the admission controller
+	current *tls.Certificate
+	lock    sync.RWMutex
+	// returns the current time, replaced in tests
+	now func() time.Time
+}
+
+func newCertManager(clientSet kubernetes.Interface, schedulerConf *conf.SchedulerConf) *certManager {
+	return &certManager{
+		clientSet:    clientSet,
+		namespace:    schedulerConf.AdmissionServiceNamespace,
+		serviceName:  schedulerConf.AdmissionServiceName,
+		secretName:   schedulerConf.AdmissionSecretName,
+		caValidity:   schedulerConf.AdmissionCAValidity,
+		certValidity: schedulerConf.AdmissionCertValidity,
+		renewBefore:  schedulerConf.AdmissionCertRenewBefore,
+		now:          time.Now,
+	}
+}
+
+// returns the current serving certificate, it is called by the TLS server for each connection
+// so the renewed certificates are served without a restart.
+func (m *certManager) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if m.current == nil {
+		return nil, fmt.Errorf("the certificate of the admission controller is not loaded")
+	}
+	return m.current, nil
+}
+
+// checks the certificates periodically, until the stop channel is closed
+func (m *certManager) run(stopCh <-chan struct{}) {
+	wait.Until(func() {
+		if err := m.refresh(); err != nil {
+			log.Log(log.Webhook).Error("failed to refresh the certificates of the admission controller",
+				zap.Error(err))
+		}
+	}, certCheckInterval, stopCh)
+}
+
+// loads the certificates from the secret, generates the missing or expiring ones, registers
+// the web-hook configurations with the CA bundle, and then serves the certificate.
+func (m *certManager) refresh() error {
+	var certs *certificates
+	var err error
+	for attempt := 1; attempt <= maxCertUpdateAttempts; attempt++ {
+		certs, err = m.loadOrRenew()
+		// the secret was changed concurrently, the certificates are reloaded
+		if err == nil || !(apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	pair, err := tls.X509KeyPair(certs.certPEM, certs.keyPEM)
+	if err != nil {
+		return err
+	}
+	// the API server must trust the new certificate before it is served, it is only
+	// swapped once the CA bundle which signed it is published in the web-hook configurations
+	if err = registerWebhooks(m.clientSet, m.namespace, m.serviceName, certs.caBundle); err != nil {
+		return err
+	}
+	m.lock.Lock()
+	m.current = &pair
+	m.lock.Unlock()
+	return nil
+}
+
+func (m *certManager) loadOrRenew() (*certificates, error) {
+	secret, err := m.clientSet.CoreV1().Secrets(m.namespace).Get(m.secretName, metav1.GetOptions{})
+	exists := err == nil
+	if apierrors.IsNotFound(err) {
+		secret = &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      m.secretName,
+				Namespace: m.namespace,
+			},
+			Type: v1.SecretTypeOpaque,
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	certs, err := parseCertificates(secret.Data)
+	changed := false
+	if err != nil || certs.caCert.NotAfter.Before(now.Add(m.renewBefore)) {
+		log.Log(log.Webhook).Info("generating the CA of the admission controller",
+			zap.String("secret", m.secretName),
+			zap.NamedError("invalidCertificates", err))
+		var previous *certificates
+		if err == nil && certs.caCert.NotAfter.After(now) {
+			previous = certs
+		}
+		if certs, err = generateCA(now, m.caValidity, previous); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+	dnsName := fmt.Sprintf("%s.%s.svc", m.serviceName, m.namespace)
+	if certs.cert == nil || certs.cert.NotAfter.Before(now.Add(m.renewBefore)) ||
+		certs.cert.CheckSignatureFrom(certs.caCert) != nil || certs.cert.VerifyHostname(dnsName) != nil {
+		log.Log(log.Webhook).Info("generating the certificate of the admission controller",
+			zap.String("secret", m.secretName),
+			zap.String("dnsName", dnsName))
+		if err = certs.generateCert(now, m.certValidity, []string{
+			m.serviceName,
+			fmt.Sprintf("%s.%s", m.serviceName, m.namespace),
+			dnsName,
+		}); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+	if !changed {
+		return certs, nil
+	}
+
+	secret.Data = map[string][]byte{
+		caCertKey:   certs.caCertPEM,
+		caKeyKey:    certs.caKeyPEM,
+		caBundleKey: certs.caBundle,
+		certKey:     certs.certPEM,
+		keyKey:      certs.keyPEM,
+	}
+	if exists {
+		_, err = m.clientSet.CoreV1().Secrets(m.namespace).Update(secret)
+	} else {
+		_, err = m.clientSet.CoreV1().Secrets(m.namespace).Create(secret)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Log(log.Webhook).Info("stored the certificates of the admission controller",
+		zap.String("secret", m.secretName),
+		zap.Time("caExpiry", certs.caCert.NotAfter),
+		zap.Time("certExpiry", certs.cert.NotAfter))
+	return certs, nil
+}
+
+// parses the certificates stored in the secret, the serving certificate is nil if it is missing or invalid
+func parseCertificates(data map[string][]byte) (*certificates, error) {
+	certs := &certificates{
+		caCertPEM: data[caCertKey],
+		caKeyPEM:  data[caKeyKey],
+		caBundle:  data[caBundleKey],
+	}
+	var err error
+	if certs.caCert, err = parseCertPEM(certs.caCertPEM); err != nil {
+		return nil, fmt.Errorf("invalid CA certificate: %v", err)
+	}
+	if certs.caKey, err = parseKeyPEM(certs.caKeyPEM); err != nil {
+		return nil, fmt.Errorf("invalid CA key: %v", err)
+	}
+	if len(certs.caBundle) == 0 {
+		certs.caBundle = certs.caCertPEM
+	}
+	if _, err = tls.X509KeyPair(data[certKey], data[keyKey]); err == nil {
+		certs.certPEM = data[certKey]
+		certs.keyPEM = data[keyKey]
+		// the pair is valid, the certificate can be parsed
+		certs.cert, _ = parseCertPEM(certs.certPEM)
+	}
+	return certs, nil
+}
+
+// generates a self-signed CA, the bundle keeps the previous CA, if any, so the certificates it signed
+// are still trusted until they are replaced. The serving certificate must be generated after.
+func generateCA(now time.Time, validity time.Duration, previous *certificates) (*certificates, error) {
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+	if err != nil {
+		return nil, err
+	}
+	template, err := newCertTemplate(now, validity)
+	if err != nil {
+		return nil, err
+	}
+	template.Subject = pkix.Name{CommonName: fmt.Sprintf("yunikorn-admission-controller-ca@%d", now.Unix())}
+	template.KeyUsage = x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign
+	template.BasicConstraintsValid = true
+	template.IsCA = true
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	certs := &certificates{
+		caCert:    caCert,
+		caKey:     key,
+		caCertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		caKeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	}
+	certs.caBundle = certs.caCertPEM
+	if previous != nil {
+		certs.caBundle = bytes.Join([][]byte{certs.caCertPEM, previous.caCertPEM}, nil)
+	}
+	return certs, nil
+}
+
+// generates the serving certificate signed by the CA, it doesn't outlive the CA
+func (certs *certificates) generateCert(now time.Time, validity time.Duration, dnsNames []string) error {
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+	if err != nil {
+		return err
+	}
+	template, err := newCertTemplate(now, validity)
+	if err != nil {
+		return err
+	}
+	if template.NotAfter.After(certs.caCert.NotAfter) {
+		template.NotAfter = certs.caCert.NotAfter
+	}
+	template.Subject = pkix.Name{CommonName: dnsNames[len(dnsNames)-1]}
+	template.DNSNames = dnsNames
+	template.KeyUsage = x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	der, err := x509.CreateCertificate(rand.Reader, template, certs.caCert, &key.PublicKey, certs.caKey)
+	if err != nil {
+		return err
+	}
+	if certs.cert, err = x509.ParseCertificate(der); err != nil {
+		return err
+	}
+	certs.certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	certs.keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return nil
+}
+
+func newCertTemplate(now time.Time, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	return &x509.Certificate{
+		SerialNumber: serial,
+		// tolerate the clock skew of the API server
+		NotBefore: now.Add(-time.Hour).UTC(),
+		NotAfter:  now.Add(validity).UTC(),
+	}, nil
+}
+
+func parseCertPEM(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate in PEM data")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func parseKeyPEM(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		return nil, fmt.Errorf("no RSA private key in PEM data")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
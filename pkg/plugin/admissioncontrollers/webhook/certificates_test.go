@@ -0,0 +1,205 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+)
+
+func newTestCertManager(clientSet *fake.Clientset, now *time.Time) *certManager {
+	schedulerConf := conf.GetSchedulerConf().Clone()
+	schedulerConf.AdmissionServiceName = "admission-service"
+	schedulerConf.AdmissionServiceNamespace = "yunikorn"
+	schedulerConf.AdmissionSecretName = "admission-certs"
+	schedulerConf.AdmissionCAValidity = 100 * time.Hour
+	schedulerConf.AdmissionCertValidity = 10 * time.Hour
+	schedulerConf.AdmissionCertRenewBefore = time.Hour
+	m := newCertManager(clientSet, schedulerConf)
+	m.now = func() time.Time { return *now }
+	return m
+}
+
+// verifies the served certificate with the CA bundle registered in the web-hook configurations
+func assertServedCertificate(t *testing.T, clientSet *fake.Clientset, m *certManager, now time.Time) *x509.Certificate {
+	served, err := m.getCertificate(nil)
+	assert.NilError(t, err)
+	cert, err := x509.ParseCertificate(served.Certificate[0])
+	assert.NilError(t, err)
+
+	mutating, err := clientSet.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().Get(
+		mutatingWebhookConfigName, metav1.GetOptions{})
+	assert.NilError(t, err)
+	validating, err := clientSet.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Get(
+		validatingWebhookConfigName, metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(mutating.Webhooks), 1)
+	assert.Equal(t, len(validating.Webhooks), 1)
+	assert.Equal(t, *mutating.Webhooks[0].ClientConfig.Service.Path, "/mutate")
+	assert.Equal(t, *validating.Webhooks[0].ClientConfig.Service.Path, "/validate")
+	assert.DeepEqual(t, mutating.Webhooks[0].AdmissionReviewVersions, admissionReviewVersions)
+	assert.DeepEqual(t, validating.Webhooks[0].AdmissionReviewVersions, admissionReviewVersions)
+	assert.Assert(t, bytes.Equal(mutating.Webhooks[0].ClientConfig.CABundle, validating.Webhooks[0].ClientConfig.CABundle))
+
+	roots := x509.NewCertPool()
+	assert.Assert(t, roots.AppendCertsFromPEM(mutating.Webhooks[0].ClientConfig.CABundle))
+	_, err = cert.Verify(x509.VerifyOptions{
+		DNSName:     "admission-service.yunikorn.svc",
+		Roots:       roots,
+		CurrentTime: now,
+	})
+	assert.NilError(t, err)
+	return cert
+}
+
+func TestCertManagerRotation(t *testing.T) {
+	now := time.Now()
+	clientSet := fake.NewSimpleClientset()
+	m := newTestCertManager(clientSet, &now)
+
+	_, err := m.getCertificate(nil)
+	assert.Assert(t, err != nil, "no certificate before the first refresh")
+
+	// the certificates are generated and stored in the secret
+	assert.NilError(t, m.refresh())
+	cert := assertServedCertificate(t, clientSet, m, now)
+	secret, err := clientSet.CoreV1().Secrets("yunikorn").Get("admission-certs", metav1.GetOptions{})
+	assert.NilError(t, err)
+	caCertPEM := secret.Data[caCertKey]
+	for _, key := range []string{caCertKey, caKeyKey, caBundleKey, certKey, keyKey} {
+		assert.Assert(t, len(secret.Data[key]) > 0, key)
+	}
+
+	// the certificates are kept while they are valid
+	now = now.Add(8 * time.Hour)
+	assert.NilError(t, m.refresh())
+	assert.Assert(t, assertServedCertificate(t, clientSet, m, now).Equal(cert))
+
+	// the certificate is renewed before it expires, signed by the same CA
+	now = now.Add(90 * time.Minute)
+	assert.NilError(t, m.refresh())
+	renewed := assertServedCertificate(t, clientSet, m, now)
+	assert.Assert(t, !renewed.Equal(cert))
+	secret, err = clientSet.CoreV1().Secrets("yunikorn").Get("admission-certs", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Assert(t, bytes.Equal(secret.Data[caCertKey], caCertPEM))
+
+	// the CA is renewed before it expires, the bundle trusts the previous CA until it expires
+	now = now.Add(90 * time.Hour)
+	assert.NilError(t, m.refresh())
+	assertServedCertificate(t, clientSet, m, now)
+	secret, err = clientSet.CoreV1().Secrets("yunikorn").Get("admission-certs", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Assert(t, !bytes.Equal(secret.Data[caCertKey], caCertPEM))
+	assert.Assert(t, bytes.Contains(secret.Data[caBundleKey], caCertPEM))
+	assert.Assert(t, bytes.Contains(secret.Data[caBundleKey], secret.Data[caCertKey]))
+}
+
+func TestCertManagerRegistrationFailure(t *testing.T) {
+	now := time.Now()
+	clientSet := fake.NewSimpleClientset()
+	m := newTestCertManager(clientSet, &now)
+	assert.NilError(t, m.refresh())
+	cert := assertServedCertificate(t, clientSet, m, now)
+
+	// the certificate signed by the renewed CA is not served while the CA bundle cannot be published
+	failUpdates := true
+	clientSet.PrependReactor("update", "validatingwebhookconfigurations",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if failUpdates {
+				return true, nil, apierrors.NewServiceUnavailable("update failed")
+			}
+			return false, nil, nil
+		})
+	now = now.Add(99*time.Hour + 30*time.Minute)
+	assert.Assert(t, m.refresh() != nil)
+	served, err := m.getCertificate(nil)
+	assert.NilError(t, err)
+	current, err := x509.ParseCertificate(served.Certificate[0])
+	assert.NilError(t, err)
+	assert.Assert(t, current.Equal(cert))
+
+	// the next refresh publishes the bundle and serves the renewed certificate
+	failUpdates = false
+	assert.NilError(t, m.refresh())
+	assert.Assert(t, !assertServedCertificate(t, clientSet, m, now).Equal(cert))
+}
+
+func TestCertManagerSharedSecret(t *testing.T) {
+	now := time.Now()
+	clientSet := fake.NewSimpleClientset()
+	first := newTestCertManager(clientSet, &now)
+	second := newTestCertManager(clientSet, &now)
+
+	// the replicas serve the certificates stored in the secret
+	assert.NilError(t, first.refresh())
+	assert.NilError(t, second.refresh())
+	assert.Assert(t, assertServedCertificate(t, clientSet, first, now).Equal(
+		assertServedCertificate(t, clientSet, second, now)))
+
+	// an invalid secret is replaced
+	secret, err := clientSet.CoreV1().Secrets("yunikorn").Get("admission-certs", metav1.GetOptions{})
+	assert.NilError(t, err)
+	secret.Data[caCertKey] = []byte("invalid")
+	_, err = clientSet.CoreV1().Secrets("yunikorn").Update(secret)
+	assert.NilError(t, err)
+	assert.NilError(t, first.refresh())
+	assertServedCertificate(t, clientSet, first, now)
+}
+
+func TestRegisterWebhooksKeepsSettings(t *testing.T) {
+	clientSet := fake.NewSimpleClientset()
+	namespaceSelector := &metav1.LabelSelector{MatchLabels: map[string]string{"yunikorn": "enabled"}}
+	path := "/mutate"
+	_, err := clientSet.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().Create(
+		&admissionregistrationv1beta1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: mutatingWebhookConfigName},
+			Webhooks: []admissionregistrationv1beta1.MutatingWebhook{{
+				Name: mutatingWebhookName,
+				ClientConfig: admissionregistrationv1beta1.WebhookClientConfig{
+					Service: &admissionregistrationv1beta1.ServiceReference{
+						Namespace: "yunikorn",
+						Name:      "admission-service",
+						Path:      &path,
+					},
+					CABundle: []byte("old"),
+				},
+				NamespaceSelector: namespaceSelector,
+			}},
+		})
+	assert.NilError(t, err)
+
+	assert.NilError(t, registerWebhooks(clientSet, "yunikorn", "admission-service", []byte("new")))
+	mutating, err := clientSet.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().Get(
+		mutatingWebhookConfigName, metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(mutating.Webhooks), 1)
+	assert.Equal(t, string(mutating.Webhooks[0].ClientConfig.CABundle), "new")
+	assert.DeepEqual(t, mutating.Webhooks[0].NamespaceSelector, namespaceSelector)
+}
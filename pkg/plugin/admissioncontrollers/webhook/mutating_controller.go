@@ -19,6 +19,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -26,23 +27,102 @@ import (
 
 	"go.uber.org/zap"
 	"k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	corelisters "k8s.io/client-go/listers/core/v1"
 
 	"github.com/cloudera/yunikorn-k8shim/pkg/common"
 	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
 	"github.com/cloudera/yunikorn-k8shim/pkg/log"
 )
 
-var (
-	runtimeScheme = runtime.NewScheme()
-	codecs        = serializer.NewCodecFactory(runtimeScheme)
-	deserializer  = codecs.UniversalDeserializer()
-)
-
 type admissionController struct {
+	// the queue configuration the pods are validated against
+	queues *queueRules
+	// the queue of the pods without one, by namespace, and the queue of other namespaces
+	namespaceQueues map[string]string
+	defaultQueue    string
+	// the pods which are not changed
+	excludedNamespaces  map[string]bool
+	excludedPodPrefixes []string
+	podSelector         labels.Selector
+	namespaceSelector   labels.Selector
+	// lists the namespaces matched by the namespace selector, nil if the selector is not set
+	namespaceLister corelisters.NamespaceLister
+}
+
+// creates the admission controller with the options in the scheduler configuration, the namespace
+// lister is only required when the namespace selector is set.
+func newAdmissionController(schedulerConf *conf.SchedulerConf, queues *queueRules,
+	namespaceLister corelisters.NamespaceLister) (*admissionController, error) {
+	namespaceQueues, err := conf.ParseNamespaceQueues(schedulerConf.AdmissionNamespaceQueues)
+	if err != nil {
+		return nil, err
+	}
+	podSelector, err := labels.Parse(schedulerConf.AdmissionPodSelector)
+	if err != nil {
+		return nil, err
+	}
+	namespaceSelector, err := labels.Parse(schedulerConf.AdmissionNamespaceSelector)
+	if err != nil {
+		return nil, err
+	}
+	if !namespaceSelector.Empty() && namespaceLister == nil {
+		return nil, fmt.Errorf("namespace selector %s is set without a namespace lister", namespaceSelector)
+	}
+	excludedNamespaces := make(map[string]bool)
+	for _, namespace := range conf.ParseList(schedulerConf.AdmissionExcludedNamespaces) {
+		excludedNamespaces[namespace] = true
+	}
+	return &admissionController{
+		queues:              queues,
+		namespaceQueues:     namespaceQueues,
+		defaultQueue:        schedulerConf.AdmissionDefaultQueue,
+		excludedNamespaces:  excludedNamespaces,
+		excludedPodPrefixes: conf.ParseList(schedulerConf.AdmissionExcludedPodPrefixes),
+		podSelector:         podSelector,
+		namespaceSelector:   namespaceSelector,
+		namespaceLister:     namespaceLister,
+	}, nil
+}
+
+// returns the reason the pod is not changed by the admission controller, empty if it is changed
+func (c *admissionController) excludedReason(pod *v1.Pod) string {
+	if c.excludedNamespaces[pod.Namespace] {
+		return "namespace is excluded"
+	}
+	for _, prefix := range c.excludedPodPrefixes {
+		if strings.HasPrefix(pod.Name, prefix) || strings.HasPrefix(pod.GenerateName, prefix) {
+			return "pod name prefix is excluded"
+		}
+	}
+	if !c.podSelector.Matches(labels.Set(pod.Labels)) {
+		return "pod labels are not selected"
+	}
+	if !c.namespaceSelector.Empty() {
+		namespace, err := c.namespaceLister.Get(pod.Namespace)
+		if err != nil {
+			log.Log(log.Webhook).Warn("failed to get the namespace of the pod, the pod is not changed",
+				zap.String("namespace", pod.Namespace),
+				zap.Error(err))
+			return "namespace is unknown"
+		}
+		if !c.namespaceSelector.Matches(labels.Set(namespace.Labels)) {
+			return "namespace labels are not selected"
+		}
+	}
+	return ""
+}
+
+// returns the queue of a pod without one
+func (c *admissionController) queueOf(namespace string) string {
+	if queue, ok := c.namespaceQueues[namespace]; ok {
+		return queue
+	}
+	return c.defaultQueue
 }
 
 type patchOperation struct {
@@ -53,7 +133,7 @@ type patchOperation struct {
 
 func (c *admissionController) mutate(ar *v1beta1.AdmissionReview) *v1beta1.AdmissionResponse {
 	req := ar.Request
-	log.Logger.Info("AdmissionReview",
+	log.Log(log.Webhook).Info("AdmissionReview",
 		zap.Any("Kind", req.Kind),
 		zap.String("Namespace", req.Namespace),
 		zap.String("UID", string(req.UID)),
@@ -72,15 +152,23 @@ func (c *admissionController) mutate(ar *v1beta1.AdmissionReview) *v1beta1.Admis
 			}
 		}
 
-		if strings.HasPrefix(pod.Name, "yunikorn-scheduler") {
-			log.Logger.Info("ignore yunikorn scheduler pod")
+		// the pod namespace is not set in the object when it is taken from the request
+		if pod.Namespace == "" {
+			pod.Namespace = req.Namespace
+		}
+
+		if reason := c.excludedReason(&pod); reason != "" {
+			log.Log(log.Webhook).Info("ignore excluded pod",
+				zap.String("namespace", pod.Namespace),
+				zap.String("podName", pod.Name),
+				zap.String("reason", reason))
 			return &v1beta1.AdmissionResponse{
 				Allowed: true,
 			}
 		}
 
 		patch = updateSchedulerName(patch)
-		patch = updateLabels(&pod, patch)
+		patch = c.updateLabels(&pod, patch)
 	}
 
 	patchBytes, err := json.Marshal(patch)
@@ -103,7 +191,7 @@ func (c *admissionController) mutate(ar *v1beta1.AdmissionReview) *v1beta1.Admis
 }
 
 func updateSchedulerName(patch []patchOperation) []patchOperation {
-	log.Logger.Info("updating scheduler name")
+	log.Log(log.Webhook).Info("updating scheduler name")
 	return append(patch, patchOperation{
 		Op:    "add",
 		Path:  "/spec/schedulerName",
@@ -111,8 +199,8 @@ func updateSchedulerName(patch []patchOperation) []patchOperation {
 	})
 }
 
-func updateLabels(pod *v1.Pod, patch []patchOperation) []patchOperation {
-	log.Logger.Info("updating pod labels")
+func (c *admissionController) updateLabels(pod *v1.Pod, patch []patchOperation) []patchOperation {
+	log.Log(log.Webhook).Info("updating pod labels")
 	existingLabels := pod.Labels
 	result := make(map[string]string)
 	for k, v := range existingLabels {
@@ -122,24 +210,18 @@ func updateLabels(pod *v1.Pod, patch []patchOperation) []patchOperation {
 	if _, ok := existingLabels[common.SparkLabelAppID]; !ok {
 		if _, ok := existingLabels[common.LabelApplicationID]; !ok {
 			// if app id not exist, generate one
-			// the generated ID is using [PodNamespace]_[PodName]_[Timestamp] naming convention.
-			// some admission controllers have strict checks of the length/format of each labels,
-			// this convention keeps the name tidy and short.
-			podNamespace := "default"
-			if pod.Namespace != "" {
-				podNamespace = pod.Namespace
-			}
- 			generatedID := fmt.Sprintf("%s_%s_%d", podNamespace, pod.Name, time.Now().Unix())
-			log.Logger.Debug("adding application ID",
+			generatedID := generateAppID(pod)
+			log.Log(log.Webhook).Debug("adding application ID",
 				zap.String("generatedID", generatedID))
 			result[common.LabelApplicationID] = generatedID
 		}
 	}
 
 	if _, ok := existingLabels[common.LabelQueueName]; !ok {
-		log.Logger.Debug("adding queue name",
-			zap.String("defaultQueue", "root.default"))
-		result[common.LabelQueueName] = "root.default"
+		queue := c.queueOf(pod.Namespace)
+		log.Log(log.Webhook).Debug("adding queue name",
+			zap.String("defaultQueue", queue))
+		result[common.LabelQueueName] = queue
 	}
 
 	patch = append(patch, patchOperation{
@@ -151,8 +233,82 @@ func updateLabels(pod *v1.Pod, patch []patchOperation) []patchOperation {
 	return patch
 }
 
+// generates the application ID of a pod without one. The pods sharing a controller owner,
+// e.g the pods of a Job or a StatefulSet, share the application ID, which is using
+// [PodNamespace]_[OwnerKind]_[OwnerName]_[OwnerUIDHash] naming convention. The owner UID hash
+// keeps an owner re-created with the same name, e.g a Job submitted again, apart from the
+// previous one. The pods of the ReplicaSet of a Deployment use the Deployment as owner, the pod
+// does not carry the Deployment UID, the hash is taken from the namespace and the Deployment name,
+// so all the rollouts of a Deployment share the application.
+// The ID of a bare pod is using [PodNamespace]_[PodName]_[Timestamp] naming convention.
+// some admission controllers have strict checks of the length/format of each labels,
+// this convention keeps the name tidy and short.
+func generateAppID(pod *v1.Pod) string {
+	podNamespace := "default"
+	if pod.Namespace != "" {
+		podNamespace = pod.Namespace
+	}
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return fmt.Sprintf("%s_%s_%d", podNamespace, pod.Name, time.Now().Unix())
+	}
+
+	kind := strings.ToLower(owner.Kind)
+	name := owner.Name
+	uid := string(owner.UID)
+	// a ReplicaSet of a Deployment is named after the Deployment and the pod template hash
+	if owner.Kind == "ReplicaSet" {
+		if hash, ok := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; ok && hash != "" &&
+			strings.HasSuffix(name, "-"+hash) {
+			kind = "deployment"
+			name = strings.TrimSuffix(name, "-"+hash)
+			uid = podNamespace + "/" + name
+		}
+	}
+	appID := fmt.Sprintf("%s_%s_%s", podNamespace, kind, name)
+	suffix := ""
+	if uid != "" {
+		suffix = "_" + shortHash(uid)
+	}
+	// the ID is a label value, a long ID is shortened keeping it unique per owner
+	if len(appID)+len(suffix) > validation.LabelValueMaxLength {
+		if suffix == "" {
+			suffix = "-" + shortHash(appID)
+		}
+		appID = strings.TrimRight(appID[:validation.LabelValueMaxLength-len(suffix)], "-_.")
+	}
+	return appID + suffix
+}
+
+// returns the 8 hex digits FNV-1a hash of the value
+func shortHash(value string) string {
+	hash := fnv.New32a()
+	// hash.Write never returns an error
+	_, _ = hash.Write([]byte(value))
+	return fmt.Sprintf("%08x", hash.Sum32())
+}
+
+// the AdmissionReview versions served by the admission controller, the v1 AdmissionReview has the same
+// fields as v1beta1, the requests of both versions are decoded in the v1beta1 types.
+const (
+	admissionReviewKind    = "AdmissionReview"
+	admissionReviewV1beta1 = "admission.k8s.io/v1beta1"
+	admissionReviewV1      = "admission.k8s.io/v1"
+)
+
 func (c *admissionController) serve(w http.ResponseWriter, r *http.Request) {
-	log.Logger.Debug("request", zap.Any("httpRequest", r))
+	log.Log(log.Webhook).Debug("request", zap.Any("httpRequest", r))
+	var handle func(ar *v1beta1.AdmissionReview) *v1beta1.AdmissionResponse
+	switch r.URL.Path {
+	case "/mutate":
+		handle = c.mutate
+	case "/validate":
+		handle = c.validate
+	default:
+		http.Error(w, fmt.Sprintf("unknown path %s, expect `/mutate` or `/validate`", r.URL.Path), http.StatusNotFound)
+		return
+	}
+
 	var body []byte
 	if r.Body != nil {
 		if data, err := ioutil.ReadAll(r.Body); err == nil {
@@ -173,31 +329,50 @@ func (c *admissionController) serve(w http.ResponseWriter, r *http.Request) {
 
 	var admissionResponse *v1beta1.AdmissionResponse
 	ar := v1beta1.AdmissionReview{}
-	if _, _, err := deserializer.Decode(body, nil, &ar); err != nil {
-		log.Logger.Error("Can't decode the body", zap.Error(err))
+	if err := json.Unmarshal(body, &ar); err != nil {
+		log.Log(log.Webhook).Error("Can't decode the body", zap.Error(err))
 		admissionResponse = &v1beta1.AdmissionResponse{
 			Result: &metav1.Status{
 				Message: err.Error(),
 			},
 		}
-	} else if r.URL.Path == "/mutate" {
-		admissionResponse = c.mutate(&ar)
+	} else if (ar.APIVersion != admissionReviewV1beta1 && ar.APIVersion != admissionReviewV1) || ar.Kind != admissionReviewKind {
+		http.Error(w, fmt.Sprintf("unsupported %s %s, expect %s in %s or %s", ar.Kind, ar.APIVersion,
+			admissionReviewKind, admissionReviewV1, admissionReviewV1beta1), http.StatusBadRequest)
+		return
+	} else if ar.Request == nil {
+		admissionResponse = &v1beta1.AdmissionResponse{
+			Result: &metav1.Status{
+				Message: "the AdmissionReview has no request",
+			},
+		}
+	} else {
+		admissionResponse = handle(&ar)
 	}
 
-	admissionReview := v1beta1.AdmissionReview{}
-	if admissionResponse != nil {
-		admissionReview.Response = admissionResponse
-		if ar.Request != nil {
-			admissionReview.Response.UID = ar.Request.UID
-		}
+	// the response is in the version of the request, v1beta1 if the request can't be decoded
+	admissionReview := v1beta1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: admissionReviewV1beta1,
+			Kind:       admissionReviewKind,
+		},
+		Response: admissionResponse,
+	}
+	if ar.APIVersion == admissionReviewV1 {
+		admissionReview.APIVersion = admissionReviewV1
+	}
+	if ar.Request != nil {
+		admissionReview.Response.UID = ar.Request.UID
 	}
 
 	resp, err := json.Marshal(admissionReview)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("could not encode response: %v", err), http.StatusInternalServerError)
+		return
 	}
 
-	log.Logger.Info("writing response...")
+	log.Log(log.Webhook).Info("writing response...")
+	w.Header().Set("Content-Type", "application/json")
 	if _, err = w.Write(resp); err != nil {
 		http.Error(w, fmt.Sprintf("could not write response: %v", err), http.StatusInternalServerError)
 	}
@@ -0,0 +1,199 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+	"k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/common"
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+)
+
+func TestGenerateAppID(t *testing.T) {
+	isController := true
+	newPod := func(name string, podLabels map[string]string, owners ...metav1.OwnerReference) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "ns",
+				Labels:          podLabels,
+				OwnerReferences: owners,
+			},
+		}
+	}
+	newOwner := func(kind, name string) metav1.OwnerReference {
+		return metav1.OwnerReference{
+			APIVersion: "apps/v1",
+			Kind:       kind,
+			Name:       name,
+			UID:        types.UID("uid-" + name),
+			Controller: &isController,
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		pod      *v1.Pod
+		expected string
+	}{
+		{"job", newPod("job-1-abcde", nil, newOwner("Job", "job-1")),
+			"ns_job_job-1_" + shortHash("uid-job-1")},
+		{"statefulset", newPod("db-0", nil, newOwner("StatefulSet", "db")),
+			"ns_statefulset_db_" + shortHash("uid-db")},
+		{"deployment", newPod("web-6d4cf56db6-x2k4v", map[string]string{"pod-template-hash": "6d4cf56db6"},
+			newOwner("ReplicaSet", "web-6d4cf56db6")), "ns_deployment_web_" + shortHash("ns/web")},
+		{"replicaset", newPod("rs-x2k4v", nil, newOwner("ReplicaSet", "rs")),
+			"ns_replicaset_rs_" + shortHash("uid-rs")},
+		{"no controller", newPod("pod-1", nil, metav1.OwnerReference{Kind: "Job", Name: "job-1"}), "ns_pod-1_"},
+		{"no owner UID", newPod("job-1-abcde", nil, metav1.OwnerReference{Kind: "Job", Name: "job-1",
+			Controller: &isController}), "ns_job_job-1"},
+		{"bare pod", newPod("pod-1", nil), "ns_pod-1_"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			appID := generateAppID(tc.pod)
+			if strings.HasSuffix(tc.expected, "_") {
+				assert.Assert(t, strings.HasPrefix(appID, tc.expected), appID)
+			} else {
+				assert.Equal(t, appID, tc.expected)
+			}
+		})
+	}
+
+	// pods of the same owner share the application ID
+	assert.Equal(t, generateAppID(newPod("job-1-abcde", nil, newOwner("Job", "job-1"))),
+		generateAppID(newPod("job-1-fghij", nil, newOwner("Job", "job-1"))))
+
+	// the rollouts of a Deployment share the application ID
+	assert.Equal(t, generateAppID(newPod("web-6d4cf56db6-x2k4v", map[string]string{"pod-template-hash": "6d4cf56db6"},
+		newOwner("ReplicaSet", "web-6d4cf56db6"))),
+		generateAppID(newPod("web-7f9b8c6d5-q8w2e", map[string]string{"pod-template-hash": "7f9b8c6d5"},
+			newOwner("ReplicaSet", "web-7f9b8c6d5"))))
+
+	// an owner re-created with the same name gets a new application ID
+	recreated := newOwner("Job", "job-1")
+	recreated.UID = "uid-job-1-recreated"
+	assert.Assert(t, generateAppID(newPod("job-1-abcde", nil, newOwner("Job", "job-1"))) !=
+		generateAppID(newPod("job-1-abcde", nil, recreated)))
+
+	// a long ID is shortened to a valid label value, keeping the owners apart
+	longName := strings.Repeat("a", 100)
+	for _, owner := range []metav1.OwnerReference{
+		newOwner("Job", longName),
+		{Kind: "Job", Name: longName, Controller: &isController},
+	} {
+		appID1 := generateAppID(newPod("pod-1", nil, owner))
+		owner.Name = longName + "2"
+		owner.UID += "2"
+		appID2 := generateAppID(newPod("pod-1", nil, owner))
+		assert.Equal(t, len(validation.IsValidLabelValue(appID1)), 0, appID1)
+		assert.Equal(t, len(validation.IsValidLabelValue(appID2)), 0, appID2)
+		assert.Assert(t, appID1 != appID2)
+	}
+	// the owner UID hash is kept
+	appID := generateAppID(newPod("pod-1", nil, newOwner("Job", longName)))
+	assert.Assert(t, strings.HasSuffix(appID, "_"+shortHash("uid-"+longName)), appID)
+}
+
+func TestMutate(t *testing.T) {
+	previous := conf.GetSchedulerConf()
+	defer conf.Set(previous)
+	schedulerConf := previous.Clone()
+	schedulerConf.SchedulerName = conf.DefaultSchedulerName
+	schedulerConf.AdmissionDefaultQueue = conf.DefaultAdmissionQueue
+	schedulerConf.AdmissionExcludedNamespaces = "kube-system"
+	schedulerConf.AdmissionNamespaceQueues = "dev=root.dev"
+	schedulerConf.AdmissionExcludedPodPrefixes = "yunikorn-scheduler,system-"
+	schedulerConf.AdmissionPodSelector = "!yunikorn-disabled"
+	schedulerConf.AdmissionNamespaceSelector = "yunikorn=enabled"
+	conf.Set(schedulerConf)
+
+	namespaces := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for name, enabled := range map[string]string{"default": "enabled", "dev": "enabled", "other": "disabled",
+		"kube-system": "enabled"} {
+		assert.NilError(t, namespaces.Add(&v1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{"yunikorn": enabled},
+			},
+		}))
+	}
+	// the namespace selector requires a namespace lister
+	_, err := newAdmissionController(schedulerConf, &queueRules{}, nil)
+	assert.ErrorContains(t, err, "without a namespace lister")
+	controller, err := newAdmissionController(schedulerConf, &queueRules{}, corelisters.NewNamespaceLister(namespaces))
+	assert.NilError(t, err)
+
+	// returns the labels patched by the mutation, nil if the pod is not changed
+	mutate := func(namespace string, name string, podLabels map[string]string) map[string]string {
+		raw, err := json.Marshal(&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: podLabels,
+			},
+		})
+		assert.NilError(t, err)
+		resp := controller.mutate(&v1beta1.AdmissionReview{
+			Request: &v1beta1.AdmissionRequest{
+				UID:       "uid-1",
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+				Namespace: namespace,
+				Operation: v1beta1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		})
+		assert.Assert(t, resp.Allowed)
+		if resp.Patch == nil {
+			return nil
+		}
+		var patch []patchOperation
+		assert.NilError(t, json.Unmarshal(resp.Patch, &patch))
+		assert.Equal(t, len(patch), 2)
+		assert.Equal(t, patch[0].Value, schedulerConf.SchedulerName)
+		podLabels = make(map[string]string)
+		for k, v := range patch[1].Value.(map[string]interface{}) {
+			podLabels[k] = v.(string)
+		}
+		return podLabels
+	}
+
+	// the pods without a queue are placed in the queue of the namespace
+	assert.Equal(t, mutate("default", "pod-1", nil)[common.LabelQueueName], conf.DefaultAdmissionQueue)
+	assert.Equal(t, mutate("dev", "pod-1", nil)[common.LabelQueueName], "root.dev")
+	assert.Equal(t, mutate("dev", "pod-1", map[string]string{common.LabelQueueName: "root.a"})[common.LabelQueueName],
+		"root.a")
+
+	// excluded pods
+	assert.Assert(t, mutate("kube-system", "pod-1", nil) == nil)
+	assert.Assert(t, mutate("default", "yunikorn-scheduler-0", nil) == nil)
+	assert.Assert(t, mutate("default", "system-pod", nil) == nil)
+	assert.Assert(t, mutate("default", "pod-1", map[string]string{"yunikorn-disabled": "true"}) == nil)
+	assert.Assert(t, mutate("other", "pod-1", nil) == nil)
+	assert.Assert(t, mutate("unknown", "pod-1", nil) == nil)
+}
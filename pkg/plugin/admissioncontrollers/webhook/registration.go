@@ -0,0 +1,256 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+
+	"go.uber.org/zap"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	admissionregistrationclient "k8s.io/client-go/kubernetes/typed/admissionregistration/v1beta1"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+)
+
+// the web-hook configurations registered by the admission controller, the same as in the deployment files
+const (
+	mutatingWebhookConfigName   = "yunikorn-admission-controller-cfg"
+	mutatingWebhookName         = "admission-webhook.yunikorn.svc"
+	validatingWebhookConfigName = "yunikorn-admission-controller-validations"
+	validatingWebhookName       = "admission-webhook.yunikorn.validate-pods"
+)
+
+// the AdmissionReview versions the admission controller accepts, in order of preference
+var admissionReviewVersions = []string{"v1", "v1beta1"}
+
+// creates the web-hook configurations of the admission controller, or updates the service and the CA bundle
+// of the existing ones. The other settings of an existing web-hook are kept, they may be customized.
+func registerWebhooks(clientSet kubernetes.Interface, namespace string, serviceName string, caBundle []byte) error {
+	client := clientSet.AdmissionregistrationV1beta1()
+	if err := registerWebhook(&mutatingWebhookClient{client.MutatingWebhookConfigurations()},
+		newWebhookClientConfig(namespace, serviceName, "/mutate", caBundle)); err != nil {
+		return err
+	}
+	return registerWebhook(&validatingWebhookClient{client.ValidatingWebhookConfigurations()},
+		newWebhookClientConfig(namespace, serviceName, "/validate", caBundle))
+}
+
+// the mutating and the validating web-hook configurations have the same fields but different types,
+// the clients hide the types so both are registered the same way.
+type webhookClient interface {
+	// the kind of the configuration, for logging
+	kind() string
+	configName() string
+	// creates the configuration with the web-hook of the admission controller
+	create(clientConfig admissionregistrationv1beta1.WebhookClientConfig) error
+	// returns the existing configuration
+	get() (webhookConfig, error)
+	update(config webhookConfig) error
+}
+
+type webhookConfig interface {
+	// returns the client config of the web-hook of the admission controller, nil if it is not in the configuration
+	clientConfig() *admissionregistrationv1beta1.WebhookClientConfig
+	// adds the web-hook of the admission controller to the configuration
+	addWebhook(clientConfig admissionregistrationv1beta1.WebhookClientConfig)
+}
+
+func registerWebhook(client webhookClient, clientConfig admissionregistrationv1beta1.WebhookClientConfig) error {
+	existing, err := client.get()
+	if apierrors.IsNotFound(err) {
+		log.Log(log.Webhook).Info("creating the "+client.kind()+" web-hook configuration",
+			zap.String("name", client.configName()))
+		return client.create(clientConfig)
+	} else if err != nil {
+		return err
+	}
+
+	if current := existing.clientConfig(); current != nil {
+		if isClientConfigUpToDate(current, &clientConfig) {
+			return nil
+		}
+		*current = clientConfig
+		log.Log(log.Webhook).Info("updating the "+client.kind()+" web-hook configuration",
+			zap.String("name", client.configName()))
+	} else {
+		existing.addWebhook(clientConfig)
+		log.Log(log.Webhook).Info("adding the web-hook to the "+client.kind()+" web-hook configuration",
+			zap.String("name", client.configName()))
+	}
+	return client.update(existing)
+}
+
+func newWebhookConfigMeta(name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:   name,
+		Labels: map[string]string{"app": "yunikorn"},
+	}
+}
+
+type mutatingWebhookClient struct {
+	client admissionregistrationclient.MutatingWebhookConfigurationInterface
+}
+
+type mutatingWebhookConfig struct {
+	*admissionregistrationv1beta1.MutatingWebhookConfiguration
+}
+
+func (c *mutatingWebhookClient) kind() string {
+	return "mutating"
+}
+
+func (c *mutatingWebhookClient) configName() string {
+	return mutatingWebhookConfigName
+}
+
+func (c *mutatingWebhookClient) create(clientConfig admissionregistrationv1beta1.WebhookClientConfig) error {
+	config := mutatingWebhookConfig{&admissionregistrationv1beta1.MutatingWebhookConfiguration{
+		ObjectMeta: newWebhookConfigMeta(mutatingWebhookConfigName),
+	}}
+	config.addWebhook(clientConfig)
+	_, err := c.client.Create(config.MutatingWebhookConfiguration)
+	return err
+}
+
+func (c *mutatingWebhookClient) get() (webhookConfig, error) {
+	config, err := c.client.Get(mutatingWebhookConfigName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return mutatingWebhookConfig{config}, nil
+}
+
+func (c *mutatingWebhookClient) update(config webhookConfig) error {
+	_, err := c.client.Update(config.(mutatingWebhookConfig).MutatingWebhookConfiguration)
+	return err
+}
+
+func (c mutatingWebhookConfig) clientConfig() *admissionregistrationv1beta1.WebhookClientConfig {
+	for i := range c.Webhooks {
+		if c.Webhooks[i].Name == mutatingWebhookName {
+			return &c.Webhooks[i].ClientConfig
+		}
+	}
+	return nil
+}
+
+func (c mutatingWebhookConfig) addWebhook(clientConfig admissionregistrationv1beta1.WebhookClientConfig) {
+	failurePolicy := admissionregistrationv1beta1.Ignore
+	c.Webhooks = append(c.Webhooks, admissionregistrationv1beta1.MutatingWebhook{
+		Name:                    mutatingWebhookName,
+		ClientConfig:            clientConfig,
+		Rules:                   newPodCreateRules(),
+		FailurePolicy:           &failurePolicy,
+		AdmissionReviewVersions: admissionReviewVersions,
+	})
+}
+
+type validatingWebhookClient struct {
+	client admissionregistrationclient.ValidatingWebhookConfigurationInterface
+}
+
+type validatingWebhookConfig struct {
+	*admissionregistrationv1beta1.ValidatingWebhookConfiguration
+}
+
+func (c *validatingWebhookClient) kind() string {
+	return "validating"
+}
+
+func (c *validatingWebhookClient) configName() string {
+	return validatingWebhookConfigName
+}
+
+func (c *validatingWebhookClient) create(clientConfig admissionregistrationv1beta1.WebhookClientConfig) error {
+	config := validatingWebhookConfig{&admissionregistrationv1beta1.ValidatingWebhookConfiguration{
+		ObjectMeta: newWebhookConfigMeta(validatingWebhookConfigName),
+	}}
+	config.addWebhook(clientConfig)
+	_, err := c.client.Create(config.ValidatingWebhookConfiguration)
+	return err
+}
+
+func (c *validatingWebhookClient) get() (webhookConfig, error) {
+	config, err := c.client.Get(validatingWebhookConfigName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return validatingWebhookConfig{config}, nil
+}
+
+func (c *validatingWebhookClient) update(config webhookConfig) error {
+	_, err := c.client.Update(config.(validatingWebhookConfig).ValidatingWebhookConfiguration)
+	return err
+}
+
+func (c validatingWebhookConfig) clientConfig() *admissionregistrationv1beta1.WebhookClientConfig {
+	for i := range c.Webhooks {
+		if c.Webhooks[i].Name == validatingWebhookName {
+			return &c.Webhooks[i].ClientConfig
+		}
+	}
+	return nil
+}
+
+func (c validatingWebhookConfig) addWebhook(clientConfig admissionregistrationv1beta1.WebhookClientConfig) {
+	failurePolicy := admissionregistrationv1beta1.Ignore
+	c.Webhooks = append(c.Webhooks, admissionregistrationv1beta1.ValidatingWebhook{
+		Name:                    validatingWebhookName,
+		ClientConfig:            clientConfig,
+		Rules:                   newPodCreateRules(),
+		FailurePolicy:           &failurePolicy,
+		AdmissionReviewVersions: admissionReviewVersions,
+	})
+}
+
+func newWebhookClientConfig(namespace string, serviceName string, path string,
+	caBundle []byte) admissionregistrationv1beta1.WebhookClientConfig {
+	return admissionregistrationv1beta1.WebhookClientConfig{
+		Service: &admissionregistrationv1beta1.ServiceReference{
+			Namespace: namespace,
+			Name:      serviceName,
+			Path:      &path,
+		},
+		CABundle: caBundle,
+	}
+}
+
+// the pods are mutated and validated when they are created
+func newPodCreateRules() []admissionregistrationv1beta1.RuleWithOperations {
+	return []admissionregistrationv1beta1.RuleWithOperations{{
+		Operations: []admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.Create},
+		Rule: admissionregistrationv1beta1.Rule{
+			APIGroups:   []string{""},
+			APIVersions: []string{"v1"},
+			Resources:   []string{"pods"},
+		},
+	}}
+}
+
+func isClientConfigUpToDate(existing *admissionregistrationv1beta1.WebhookClientConfig,
+	expected *admissionregistrationv1beta1.WebhookClientConfig) bool {
+	if existing.Service == nil || existing.Service.Path == nil ||
+		existing.Service.Namespace != expected.Service.Namespace ||
+		existing.Service.Name != expected.Service.Name ||
+		*existing.Service.Path != *expected.Service.Path {
+		return false
+	}
+	return bytes.Equal(existing.CABundle, expected.CABundle)
+}
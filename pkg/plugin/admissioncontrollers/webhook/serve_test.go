@@ -0,0 +1,186 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+	"k8s.io/api/admission/v1beta1"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/common"
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+)
+
+// an AdmissionReview sent by the API server when a pod is created, the version and the labels are replaced
+const podCreateReview = `{
+  "kind": "AdmissionReview",
+  "apiVersion": "admission.k8s.io/VERSION",
+  "request": {
+    "uid": "705ab4f5-6393-11e8-b7cc-42010a800002",
+    "kind": {"group": "", "version": "v1", "kind": "Pod"},
+    "resource": {"group": "", "version": "v1", "resource": "pods"},
+    "requestKind": {"group": "", "version": "v1", "kind": "Pod"},
+    "requestResource": {"group": "", "version": "v1", "resource": "pods"},
+    "namespace": "default",
+    "operation": "CREATE",
+    "userInfo": {
+      "username": "system:serviceaccount:kube-system:replicaset-controller",
+      "uid": "a4a3bd8e-6393-11e8-b7cc-42010a800002",
+      "groups": ["system:serviceaccounts", "system:serviceaccounts:kube-system", "system:authenticated"]
+    },
+    "object": {
+      "kind": "Pod",
+      "apiVersion": "v1",
+      "metadata": {
+        "generateName": "sleep-7d4f8b8c5-",
+        "creationTimestamp": null,
+        "labels": {"app": "sleep", "pod-template-hash": "7d4f8b8c5"LABELS},
+        "ownerReferences": [{
+          "apiVersion": "apps/v1",
+          "kind": "ReplicaSet",
+          "name": "sleep-7d4f8b8c5",
+          "uid": "a5b7c4e3-6393-11e8-b7cc-42010a800002",
+          "controller": true,
+          "blockOwnerDeletion": true
+        }]
+      },
+      "spec": {
+        "containers": [{
+          "name": "sleep",
+          "image": "alpine:latest",
+          "command": ["sleep", "30"],
+          "resources": {"requests": {"cpu": "100m", "memory": "500M"}}
+        }],
+        "restartPolicy": "Always",
+        "schedulerName": "yunikorn"
+      },
+      "status": {}
+    },
+    "oldObject": null,
+    "dryRun": false,
+    "options": {"kind": "CreateOptions", "apiVersion": "meta.k8s.io/v1"}
+  }
+}`
+
+func newPodCreateReview(version string, podLabels map[string]string) string {
+	var extra []string
+	for k, v := range podLabels {
+		extra = append(extra, fmt.Sprintf(", %q: %q", k, v))
+	}
+	return strings.NewReplacer("VERSION", version, "LABELS", strings.Join(extra, "")).Replace(podCreateReview)
+}
+
+// the labels of a pod mutated by the admission controller
+func validLabels(queue string) map[string]string {
+	return map[string]string{
+		common.LabelApplicationID: "default_deployment_sleep",
+		common.LabelQueueName:     queue,
+	}
+}
+
+func TestServe(t *testing.T) {
+	previous := conf.GetSchedulerConf()
+	defer conf.Set(previous)
+	schedulerConf := previous.Clone()
+	schedulerConf.SchedulerName = conf.DefaultSchedulerName
+	schedulerConf.AdmissionDefaultQueue = conf.DefaultAdmissionQueue
+	conf.Set(schedulerConf)
+
+	rules := &queueRules{}
+	assert.NilError(t, rules.update([]byte(queuesConfig)))
+	controller, err := newAdmissionController(schedulerConf, rules, nil)
+	assert.NilError(t, err)
+
+	testCases := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		status      int
+		apiVersion  string
+		allowed     bool
+		patched     bool
+		message     string
+	}{
+		{"mutate v1beta1", "/mutate", "application/json", newPodCreateReview("v1beta1", nil),
+			http.StatusOK, admissionReviewV1beta1, true, true, ""},
+		{"mutate v1", "/mutate", "application/json", newPodCreateReview("v1", nil),
+			http.StatusOK, admissionReviewV1, true, true, ""},
+		{"validate v1beta1", "/validate", "application/json", newPodCreateReview("v1beta1", validLabels("root.default")),
+			http.StatusOK, admissionReviewV1beta1, true, false, ""},
+		{"validate v1", "/validate", "application/json", newPodCreateReview("v1", validLabels("root.default")),
+			http.StatusOK, admissionReviewV1, true, false, ""},
+		{"reject v1beta1", "/validate", "application/json", newPodCreateReview("v1beta1", validLabels("root.unknown")),
+			http.StatusOK, admissionReviewV1beta1, false, false, "queue root.unknown does not exist"},
+		{"reject v1", "/validate", "application/json", newPodCreateReview("v1", validLabels("root.unknown")),
+			http.StatusOK, admissionReviewV1, false, false, "queue root.unknown does not exist"},
+		{"malformed body", "/mutate", "application/json", "{", http.StatusOK, admissionReviewV1beta1, false, false,
+			"unexpected end of JSON input"},
+		{"no request", "/mutate", "application/json",
+			`{"kind": "AdmissionReview", "apiVersion": "admission.k8s.io/v1"}`,
+			http.StatusOK, admissionReviewV1, false, false, "no request"},
+		{"unsupported version", "/mutate", "application/json", newPodCreateReview("v2", nil),
+			http.StatusBadRequest, "", false, false, ""},
+		{"unknown path", "/unknown", "application/json", newPodCreateReview("v1", nil),
+			http.StatusNotFound, "", false, false, ""},
+		{"empty body", "/mutate", "application/json", "", http.StatusBadRequest, "", false, false, ""},
+		{"content type", "/mutate", "text/plain", newPodCreateReview("v1", nil),
+			http.StatusUnsupportedMediaType, "", false, false, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			recorder := httptest.NewRecorder()
+			controller.serve(recorder, req)
+			assert.Equal(t, recorder.Code, tc.status, recorder.Body.String())
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			var review v1beta1.AdmissionReview
+			assert.NilError(t, json.Unmarshal(recorder.Body.Bytes(), &review))
+			assert.Equal(t, review.APIVersion, tc.apiVersion)
+			assert.Equal(t, review.Kind, admissionReviewKind)
+			assert.Assert(t, review.Response != nil)
+			assert.Equal(t, review.Response.Allowed, tc.allowed)
+			if tc.allowed {
+				assert.Equal(t, string(review.Response.UID), "705ab4f5-6393-11e8-b7cc-42010a800002")
+			} else {
+				assert.Assert(t, strings.Contains(review.Response.Result.Message, tc.message), review.Response.Result.Message)
+			}
+			if !tc.patched {
+				assert.Assert(t, review.Response.Patch == nil)
+				return
+			}
+			assert.Equal(t, *review.Response.PatchType, v1beta1.PatchTypeJSONPatch)
+			var patch []patchOperation
+			assert.NilError(t, json.Unmarshal(review.Response.Patch, &patch))
+			assert.Equal(t, len(patch), 2)
+			podLabels := patch[1].Value.(map[string]interface{})
+			assert.Equal(t, podLabels[common.LabelApplicationID],
+				"default_deployment_sleep_"+shortHash("default/sleep"))
+			assert.Equal(t, podLabels[common.LabelQueueName], "root.default")
+		})
+	}
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cloudera/yunikorn-core/pkg/common/configs"
+	"go.uber.org/zap"
+	"k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/common"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/utils"
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+)
+
+// queue property restricting the namespaces of the pods submitted to the queue and to its children,
+// a comma separated list of namespaces, the property of the nearest queue having it is applied.
+const namespacesQueueProperty = "admission.namespaces"
+
+// the rules the active queue configuration sets for the submitted pods, the configuration is read
+// from the scheduler configMap. Pods are not checked against the queues while it is unknown.
+type queueRules struct {
+	// the default partition of the configuration, nil if the configuration is unknown
+	partition *configs.PartitionConfig
+	lock      sync.RWMutex
+}
+
+// replaces the queue configuration, an invalid configuration is rejected and the previous one is kept
+func (r *queueRules) update(data []byte) error {
+	schedulerConfig, err := configs.LoadSchedulerConfigFromByteArray(data)
+	if err != nil {
+		return err
+	}
+	var partition *configs.PartitionConfig
+	for i := range schedulerConfig.Partitions {
+		if schedulerConfig.Partitions[i].Name == configs.DefaultPartition {
+			partition = &schedulerConfig.Partitions[i]
+		}
+	}
+	if partition == nil {
+		return fmt.Errorf("partition %s is not configured", configs.DefaultPartition)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.partition = partition
+	return nil
+}
+
+func (r *queueRules) clear() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.partition = nil
+}
+
+// checks that the queue is a leaf queue of the configuration and that it accepts pods
+// from the namespace. The queue name is fully qualified and case insensitive, like the
+// scheduler core resolves it.
+func (r *queueRules) check(queueName string, namespace string) error {
+	r.lock.RLock()
+	partition := r.partition
+	r.lock.RUnlock()
+	if partition == nil || len(partition.Queues) == 0 {
+		return nil
+	}
+	// the placement rules decide the queue and can create it, the queue is not known here
+	if len(partition.PlacementRules) > 0 {
+		return nil
+	}
+
+	parts := strings.Split(strings.ToLower(queueName), ".")
+	if parts[0] != configs.RootQueue {
+		return fmt.Errorf("queue %s is not fully qualified, queue names start with %s", queueName, configs.RootQueue)
+	}
+	queue := &partition.Queues[0]
+	namespaces := queue.Properties[namespacesQueueProperty]
+	for _, part := range parts[1:] {
+		var child *configs.QueueConfig
+		for i := range queue.Queues {
+			if strings.ToLower(queue.Queues[i].Name) == part {
+				child = &queue.Queues[i]
+				break
+			}
+		}
+		if child == nil {
+			return fmt.Errorf("queue %s does not exist in partition %s", queueName, partition.Name)
+		}
+		queue = child
+		if property, ok := queue.Properties[namespacesQueueProperty]; ok {
+			namespaces = property
+		}
+	}
+	if queue.Parent || len(queue.Queues) > 0 {
+		return fmt.Errorf("queue %s is not a leaf queue, pods can only be submitted to leaf queues", queueName)
+	}
+	if namespaces != "" {
+		for _, allowed := range strings.Split(namespaces, ",") {
+			if strings.TrimSpace(allowed) == namespace {
+				return nil
+			}
+		}
+		return fmt.Errorf("namespace %s is not allowed to submit pods to queue %s, allowed namespaces are: %s",
+			namespace, queueName, namespaces)
+	}
+	return nil
+}
+
+// keeps the queue rules up to date with the queue configuration in the scheduler configMap
+func (r *queueRules) watch(clientSet kubernetes.Interface, namespace string, stopCh <-chan struct{}) {
+	key := fmt.Sprintf("%s.yaml", conf.GetSchedulerConf().PolicyGroup)
+	updateFromConfigMap := func(obj interface{}) {
+		configMap, ok := obj.(*v1.ConfigMap)
+		if !ok {
+			return
+		}
+		data, ok := configMap.Data[key]
+		if !ok {
+			log.Log(log.Webhook).Info("no queue configuration in the configMap, queues are not validated",
+				zap.String("key", key))
+			r.clear()
+			return
+		}
+		if err := r.update([]byte(data)); err != nil {
+			log.Log(log.Webhook).Error("invalid queue configuration, the current configuration is kept",
+				zap.String("key", key),
+				zap.Error(err))
+			return
+		}
+		log.Log(log.Webhook).Info("queue configuration updated", zap.String("key", key))
+	}
+
+	informerFactory := informers.NewSharedInformerFactoryWithOptions(clientSet, 0, informers.WithNamespace(namespace))
+	informerFactory.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if configMap, ok := obj.(*v1.ConfigMap); ok {
+				return configMap.Name == common.DefaultConfigMapName
+			}
+			// the deleted configMap might only be known by its key
+			return true
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: updateFromConfigMap,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				updateFromConfigMap(newObj)
+			},
+			DeleteFunc: func(obj interface{}) {
+				log.Log(log.Webhook).Info("scheduler configMap deleted, queues are not validated")
+				r.clear()
+			},
+		},
+	})
+	informerFactory.Start(stopCh)
+}
+
+func (c *admissionController) validate(ar *v1beta1.AdmissionReview) *v1beta1.AdmissionResponse {
+	req := ar.Request
+	log.Log(log.Webhook).Info("AdmissionReview",
+		zap.Any("Kind", req.Kind),
+		zap.String("Namespace", req.Namespace),
+		zap.String("UID", string(req.UID)),
+		zap.String("Operation", string(req.Operation)),
+		zap.Any("UserInfo", req.UserInfo))
+
+	if req.Kind.Kind != "Pod" {
+		return &v1beta1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+	var pod v1.Pod
+	if err := json.Unmarshal(req.Object.Raw, &pod); err != nil {
+		return &v1beta1.AdmissionResponse{
+			Result: &metav1.Status{
+				Message: err.Error(),
+			},
+		}
+	}
+	// the pods of other schedulers are not checked
+	if pod.Spec.SchedulerName != conf.GetSchedulerConf().SchedulerName {
+		return &v1beta1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+	// the pod namespace is not set in the object when it is taken from the request
+	if pod.Namespace == "" {
+		pod.Namespace = req.Namespace
+	}
+
+	if err := c.validatePod(&pod); err != nil {
+		log.Log(log.Webhook).Info("pod rejected",
+			zap.String("namespace", pod.Namespace),
+			zap.String("podName", pod.Name),
+			zap.Error(err))
+		return &v1beta1.AdmissionResponse{
+			Allowed: false,
+			Result: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Reason:  metav1.StatusReasonInvalid,
+				Message: fmt.Sprintf("pod rejected by the yunikorn admission controller: %v", err),
+			},
+		}
+	}
+	return &v1beta1.AdmissionResponse{
+		Allowed: true,
+	}
+}
+
+// checks the application ID and the queue of a pod
+func (c *admissionController) validatePod(pod *v1.Pod) error {
+	appID, err := utils.GetApplicationIDFromPod(pod)
+	if err != nil {
+		return fmt.Errorf("application ID is not set, it is set in the %s label", common.LabelApplicationID)
+	}
+	if appID == "" {
+		return fmt.Errorf("application ID is empty")
+	}
+	if errs := validation.IsValidLabelValue(appID); len(errs) > 0 {
+		return fmt.Errorf("application ID %s is malformed: %s", appID, strings.Join(errs, ", "))
+	}
+	return c.queues.check(utils.GetQueueNameFromPod(pod), pod.Namespace)
+}
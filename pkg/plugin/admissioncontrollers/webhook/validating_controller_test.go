@@ -0,0 +1,176 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+	"k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/common"
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+)
+
+const queuesConfig = `
+partitions:
+  - name: default
+    queues:
+      - name: root
+        submitacl: "*"
+        queues:
+          - name: default
+          - name: prod
+            properties:
+              admission.namespaces: "prod, prod-batch"
+            queues:
+              - name: batch
+              - name: services
+          - name: dev
+            parent: true
+`
+
+func TestQueueRulesCheck(t *testing.T) {
+	rules := &queueRules{}
+	// any queue is accepted while the configuration is unknown
+	assert.NilError(t, rules.check("root.unknown", "default"))
+
+	assert.NilError(t, rules.update([]byte(queuesConfig)))
+	assert.NilError(t, rules.check("root.default", "default"))
+	assert.NilError(t, rules.check("ROOT.Default", "default"))
+	assert.NilError(t, rules.check("root.prod.batch", "prod"))
+	assert.NilError(t, rules.check("root.prod.services", "prod-batch"))
+
+	assert.ErrorContains(t, rules.check("root.unknown", "default"), "does not exist")
+	assert.ErrorContains(t, rules.check("root.prod.unknown", "prod"), "does not exist")
+	assert.ErrorContains(t, rules.check("default", "default"), "not fully qualified")
+	assert.ErrorContains(t, rules.check("root", "default"), "not a leaf queue")
+	assert.ErrorContains(t, rules.check("root.prod", "prod"), "not a leaf queue")
+	assert.ErrorContains(t, rules.check("root.dev", "default"), "not a leaf queue")
+	assert.ErrorContains(t, rules.check("root.prod.batch", "default"), "namespace default is not allowed")
+
+	// an invalid configuration keeps the current one
+	assert.Assert(t, rules.update([]byte("partitions: [")) != nil)
+	assert.ErrorContains(t, rules.check("root.unknown", "default"), "does not exist")
+
+	rules.clear()
+	assert.NilError(t, rules.check("root.unknown", "default"))
+}
+
+func TestQueueRulesPlacementRules(t *testing.T) {
+	rules := &queueRules{}
+	assert.NilError(t, rules.update([]byte(`
+partitions:
+  - name: default
+    placementrules:
+      - name: tag
+        value: namespace
+        create: true
+    queues:
+      - name: root
+        submitacl: "*"
+`)))
+	// the queue is decided by the placement rules
+	assert.NilError(t, rules.check("root.unknown", "default"))
+}
+
+func TestValidate(t *testing.T) {
+	conf.Set(&conf.SchedulerConf{SchedulerName: conf.DefaultSchedulerName})
+	rules := &queueRules{}
+	assert.NilError(t, rules.update([]byte(queuesConfig)))
+	controller := &admissionController{queues: rules}
+
+	newReview := func(pod *v1.Pod) *v1beta1.AdmissionReview {
+		raw, err := json.Marshal(pod)
+		assert.NilError(t, err)
+		return &v1beta1.AdmissionReview{
+			Request: &v1beta1.AdmissionRequest{
+				UID:       "uid-1",
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+				Namespace: pod.Namespace,
+				Operation: v1beta1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		}
+	}
+	newPod := func(namespace string, podLabels map[string]string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "pod-1",
+				Namespace: namespace,
+				Labels:    podLabels,
+			},
+			Spec: v1.PodSpec{
+				SchedulerName: conf.DefaultSchedulerName,
+			},
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		pod     *v1.Pod
+		allowed bool
+		message string
+	}{
+		{"valid pod", newPod("prod", map[string]string{
+			common.LabelApplicationID: "app-1",
+			common.LabelQueueName:     "root.prod.batch",
+		}), true, ""},
+		{"no queue", newPod("default", map[string]string{
+			common.LabelApplicationID: "app-1",
+		}), false, "queue root is not a leaf queue"},
+		{"no application ID", newPod("default", map[string]string{
+			common.LabelQueueName: "root.default",
+		}), false, "application ID is not set"},
+		{"malformed application ID", newPod("default", map[string]string{
+			common.LabelApplicationID: "app 1/x",
+			common.LabelQueueName:     "root.default",
+		}), false, "application ID app 1/x is malformed"},
+		{"unknown queue", newPod("default", map[string]string{
+			common.LabelApplicationID: "app-1",
+			common.LabelQueueName:     "root.unknown",
+		}), false, "queue root.unknown does not exist"},
+		{"parent queue", newPod("prod", map[string]string{
+			common.LabelApplicationID: "app-1",
+			common.LabelQueueName:     "root.prod",
+		}), false, "not a leaf queue"},
+		{"disallowed namespace", newPod("default", map[string]string{
+			common.LabelApplicationID: "app-1",
+			common.LabelQueueName:     "root.prod.services",
+		}), false, "namespace default is not allowed"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := controller.validate(newReview(tc.pod))
+			assert.Equal(t, resp.Allowed, tc.allowed)
+			if !tc.allowed {
+				assert.Assert(t, resp.Result != nil)
+				assert.Assert(t, strings.Contains(resp.Result.Message, tc.message), resp.Result.Message)
+			}
+		})
+	}
+
+	// pods of other schedulers are not validated
+	pod := newPod("default", map[string]string{common.LabelQueueName: "root.unknown"})
+	pod.Spec.SchedulerName = "default-scheduler"
+	assert.Assert(t, controller.validate(newReview(pod)).Allowed)
+}
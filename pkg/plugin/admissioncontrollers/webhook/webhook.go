@@ -23,56 +23,91 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"syscall"
 
 	"go.uber.org/zap"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 
+	"github.com/cloudera/yunikorn-k8shim/pkg/client"
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
 	"github.com/cloudera/yunikorn-k8shim/pkg/log"
 )
 
-const (
-	HTTPPort    = 8443
-	tlsDir      = `/run/secrets/tls`
-	tlsCertFile = `cert.pem`
-	tlsKeyFile  = `key.pem`
-)
-
 func main() {
-	certPath := filepath.Join(tlsDir, tlsCertFile)
-	keyPath := filepath.Join(tlsDir, tlsKeyFile)
-	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
-	if err != nil {
-		log.Logger.Fatal("Failed to load key pair", zap.Error(err))
+	if err := conf.InitFromCommandLine(); err != nil {
+		log.Log(log.Webhook).Fatal("failed to load the configuration", zap.Error(err))
+	}
+	schedulerConf := conf.GetSchedulerConf()
+	stopCh := make(chan struct{})
+	kubeClient := client.NewKubeClient(schedulerConf.KubeConfig)
+
+	tlsConfig := &tls.Config{}
+	if schedulerConf.AdmissionGenerateCerts {
+		// the certificates are generated, or loaded from the secret, before the server starts
+		certs := newCertManager(kubeClient.GetClientSet(), schedulerConf)
+		if err := certs.refresh(); err != nil {
+			log.Log(log.Webhook).Fatal("failed to set up the certificates", zap.Error(err))
+		}
+		go certs.run(stopCh)
+		tlsConfig.GetCertificate = certs.getCertificate
+	} else {
+		pair, err := tls.LoadX509KeyPair(schedulerConf.AdmissionCertFile, schedulerConf.AdmissionKeyFile)
+		if err != nil {
+			log.Log(log.Webhook).Fatal("Failed to load key pair", zap.Error(err))
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
 	}
 
-	webHook := admissionController{}
+	// the queue configuration is read from the scheduler configMap, in the namespace of the scheduler
+	queues := &queueRules{}
+	queues.watch(kubeClient.GetClientSet(), schedulerConf.Namespace, stopCh)
+
+	// the namespaces are only watched when they are selected by labels
+	var namespaceLister corelisters.NamespaceLister
+	if schedulerConf.AdmissionNamespaceSelector != "" {
+		informerFactory := informers.NewSharedInformerFactory(kubeClient.GetClientSet(), 0)
+		namespaceInformer := informerFactory.Core().V1().Namespaces()
+		namespaceLister = namespaceInformer.Lister()
+		informerFactory.Start(stopCh)
+		if !cache.WaitForCacheSync(stopCh, namespaceInformer.Informer().HasSynced) {
+			log.Log(log.Webhook).Fatal("failed to sync the namespaces")
+		}
+	}
+
+	webHook, err := newAdmissionController(schedulerConf, queues, namespaceLister)
+	if err != nil {
+		log.Log(log.Webhook).Fatal("failed to create the admission controller", zap.Error(err))
+	}
 	mux := http.NewServeMux()
 	mux.HandleFunc("/mutate", webHook.serve)
+	mux.HandleFunc("/validate", webHook.serve)
 	server := &http.Server{
-		Addr:      fmt.Sprintf(":%v", HTTPPort),
-		TLSConfig: &tls.Config{Certificates: []tls.Certificate{pair}},
+		Addr:      fmt.Sprintf(":%v", schedulerConf.AdmissionPort),
+		TLSConfig: tlsConfig,
 		Handler:   mux,
 	}
 
 	go func() {
 		if err = server.ListenAndServeTLS("", ""); err != nil {
-			log.Logger.Fatal("failed to start admission controller", zap.Error(err))
+			log.Log(log.Webhook).Fatal("failed to start admission controller", zap.Error(err))
 		}
 	}()
 
-	log.Logger.Info("the admission controller started",
-		zap.Int("port", HTTPPort),
-		zap.String("listeningOn", "/mutate"))
+	log.Log(log.Webhook).Info("the admission controller started",
+		zap.Int("port", schedulerConf.AdmissionPort),
+		zap.Strings("listeningOn", []string{"/mutate", "/validate"}))
 
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 	<-signalChan
 
-	log.Logger.Info("shutting down the admission controller...")
+	log.Log(log.Webhook).Info("shutting down the admission controller...")
+	close(stopCh)
 	err = server.Shutdown(context.Background())
 	if err != nil {
-		log.Logger.Warn("failed to stop the admission controller",
+		log.Log(log.Webhook).Warn("failed to stop the admission controller",
 			zap.Error(err))
 	}
 }
@@ -0,0 +1,209 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extenders
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
+	"k8s.io/kubernetes/pkg/scheduler/api/validation"
+	"k8s.io/kubernetes/pkg/scheduler/core"
+	deschedulernode "k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+)
+
+// Extenders calls out to the scheduler extenders of the default scheduler,
+// the extenders are configured in the "extenders" section of a scheduler policy file
+// and they are called with the standard extender wire format over HTTP.
+// A nil or empty Extenders has no extenders, all its calls are no-op.
+type Extenders struct {
+	extenders []algorithm.SchedulerExtender
+}
+
+func NewExtenders(testMode bool) *Extenders {
+	if testMode {
+		// in test mode, no extenders are called
+		return &Extenders{}
+	}
+	configFile := conf.GetSchedulerConf().ExtenderConfigFile
+	if configFile == "" {
+		return &Extenders{}
+	}
+	extenders, err := LoadExtenders(configFile)
+	if err != nil {
+		log.Log(log.Extenders).Fatal(err.Error())
+	}
+	return extenders
+}
+
+// the extenders section of a scheduler policy file, the extender configs are decoded
+// case-insensitively like the policy decoder of the default scheduler does.
+type policyFile struct {
+	Kind       string                        `json:"kind"`
+	APIVersion string                        `json:"apiVersion"`
+	Extenders  []schedulerapi.ExtenderConfig `json:"extenders"`
+}
+
+// loads the extenders from a scheduler policy file in JSON,
+// only the extenders section of the policy is used.
+func LoadExtenders(configFile string) (*Extenders, error) {
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the extender config file %s: %v", configFile, err)
+	}
+	policy := &policyFile{}
+	if err = json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("invalid extender config file %s: %v", configFile, err)
+	}
+	if policy.Kind != "Policy" || policy.APIVersion != "v1" {
+		return nil, fmt.Errorf("invalid extender config file %s: expected kind Policy of apiVersion v1, got %s of %s",
+			configFile, policy.Kind, policy.APIVersion)
+	}
+	if err = validation.ValidatePolicy(schedulerapi.Policy{ExtenderConfigs: policy.Extenders}); err != nil {
+		return nil, fmt.Errorf("invalid extender config file %s: %v", configFile, err)
+	}
+	return newExtendersInternal(policy.Extenders)
+}
+
+func newExtendersInternal(configs []schedulerapi.ExtenderConfig) (*Extenders, error) {
+	e := &Extenders{
+		extenders: make([]algorithm.SchedulerExtender, 0, len(configs)),
+	}
+	for i := range configs {
+		extender, err := core.NewHTTPExtender(&configs[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the extender %s: %v", configs[i].URLPrefix, err)
+		}
+		log.Log(log.Extenders).Info("use scheduler extender",
+			zap.String("urlPrefix", configs[i].URLPrefix),
+			zap.String("filterVerb", configs[i].FilterVerb),
+			zap.String("prioritizeVerb", configs[i].PrioritizeVerb),
+			zap.String("bindVerb", configs[i].BindVerb),
+			zap.Bool("ignorable", configs[i].Ignorable))
+		e.extenders = append(e.extenders, extender)
+	}
+	return e, nil
+}
+
+func (e *Extenders) Enabled() bool {
+	return e != nil && len(e.extenders) > 0
+}
+
+// filters the nodes by the extenders interested in the pod, in the order they are configured.
+// The nodes which pass all the extenders are returned, with the failure reasons of the others.
+// An ignorable extender is skipped when it fails, a failure of any other extender fails the filtering.
+func (e *Extenders) Filter(pod *v1.Pod, nodes []*v1.Node,
+	nodeNameToInfo map[string]*deschedulernode.NodeInfo) ([]*v1.Node, map[string][]string, error) {
+	failedNodes := make(map[string][]string)
+	if !e.Enabled() {
+		return nodes, failedNodes, nil
+	}
+	filtered := nodes
+	for _, extender := range e.extenders {
+		if len(filtered) == 0 {
+			break
+		}
+		if !extender.IsInterested(pod) {
+			continue
+		}
+		result, failedMap, err := extender.Filter(pod, filtered, nodeNameToInfo)
+		if err != nil {
+			if extender.IsIgnorable() {
+				log.Log(log.Extenders).Warn("skipping ignorable extender which failed to filter nodes",
+					zap.String("extender", extender.Name()),
+					zap.String("podName", pod.Name),
+					zap.Error(err))
+				continue
+			}
+			return nil, nil, fmt.Errorf("extender %s failed to filter nodes: %v", extender.Name(), err)
+		}
+		passed := make(map[string]bool, len(result))
+		for _, node := range result {
+			passed[node.Name] = true
+		}
+		// the nodes not returned by the extender fail, with or without a reason
+		for _, node := range filtered {
+			if passed[node.Name] {
+				continue
+			}
+			if reason, ok := failedMap[node.Name]; ok {
+				failedNodes[node.Name] = append(failedNodes[node.Name], reason)
+			} else {
+				failedNodes[node.Name] = append(failedNodes[node.Name],
+					fmt.Sprintf("node(s) were filtered out by extender %s", extender.Name()))
+			}
+		}
+		filtered = result
+	}
+	return filtered, failedNodes, nil
+}
+
+// returns the weighted scores given by the extenders interested in the pod to the nodes,
+// the extenders failed to prioritize are ignored like they are in the default scheduler.
+func (e *Extenders) Prioritize(pod *v1.Pod, nodes []*v1.Node) map[string]int {
+	scores := make(map[string]int)
+	if !e.Enabled() {
+		return scores
+	}
+	for _, extender := range e.extenders {
+		if !extender.IsInterested(pod) {
+			continue
+		}
+		priorities, weight, err := extender.Prioritize(pod, nodes)
+		if err != nil {
+			log.Log(log.Extenders).Warn("skipping extender which failed to prioritize nodes",
+				zap.String("extender", extender.Name()),
+				zap.String("podName", pod.Name),
+				zap.Error(err))
+			continue
+		}
+		for _, priority := range *priorities {
+			scores[priority.Host] += priority.Score * weight
+		}
+	}
+	return scores
+}
+
+// binds the pod to the node with the binder extender if it is interested in the pod,
+// returns false if no extender binds the pod, the pod must be bound by the caller then.
+func (e *Extenders) Bind(pod *v1.Pod, nodeName string) (bool, error) {
+	if !e.Enabled() {
+		return false, nil
+	}
+	for _, extender := range e.extenders {
+		if !extender.IsBinder() || !extender.IsInterested(pod) {
+			continue
+		}
+		binding := &v1.Binding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID},
+			Target:     v1.ObjectReference{Kind: "Node", Name: nodeName},
+		}
+		if err := extender.Bind(binding); err != nil {
+			return true, fmt.Errorf("extender %s failed to bind pod: %v", extender.Name(), err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
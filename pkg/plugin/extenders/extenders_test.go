@@ -0,0 +1,430 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extenders
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
+	deschedulernode "k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+)
+
+// an extender stand-in, it fails the nodes listed in failedNodes, scores the nodes
+// listed in scores and records the bindings
+type fakeExtender struct {
+	failedNodes map[string]string
+	scores      map[string]int
+	bindings    []schedulerapi.ExtenderBindingArgs
+	calls       map[string]int
+	statusCode  int
+	delay       time.Duration
+	// the requests are served concurrently
+	lock sync.Mutex
+}
+
+func newFakeExtender() *fakeExtender {
+	return &fakeExtender{
+		failedNodes: make(map[string]string),
+		scores:      make(map[string]int),
+		calls:       make(map[string]int),
+		statusCode:  http.StatusOK,
+	}
+}
+
+func (f *fakeExtender) callCount(verb string) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.calls[verb]
+}
+
+func (f *fakeExtender) serve() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verb := filepath.Base(r.URL.Path)
+		f.lock.Lock()
+		f.calls[verb]++
+		f.lock.Unlock()
+		time.Sleep(f.delay)
+		if f.statusCode != http.StatusOK {
+			w.WriteHeader(f.statusCode)
+			return
+		}
+		var result interface{}
+		switch verb {
+		case "filter":
+			var args schedulerapi.ExtenderArgs
+			if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			filterResult := schedulerapi.ExtenderFilterResult{
+				Nodes:       &v1.NodeList{},
+				FailedNodes: schedulerapi.FailedNodesMap{},
+			}
+			for _, node := range args.Nodes.Items {
+				if reason, ok := f.failedNodes[node.Name]; ok {
+					filterResult.FailedNodes[node.Name] = reason
+				} else {
+					filterResult.Nodes.Items = append(filterResult.Nodes.Items, node)
+				}
+			}
+			result = filterResult
+		case "prioritize":
+			var args schedulerapi.ExtenderArgs
+			if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			priorities := schedulerapi.HostPriorityList{}
+			for _, node := range args.Nodes.Items {
+				priorities = append(priorities, schedulerapi.HostPriority{Host: node.Name, Score: f.scores[node.Name]})
+			}
+			result = priorities
+		case "bind":
+			var args schedulerapi.ExtenderBindingArgs
+			if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.lock.Lock()
+			f.bindings = append(f.bindings, args)
+			f.lock.Unlock()
+			result = schedulerapi.ExtenderBindingResult{}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+}
+
+func newExtenderConfig(server *httptest.Server) schedulerapi.ExtenderConfig {
+	return schedulerapi.ExtenderConfig{
+		URLPrefix:      server.URL,
+		FilterVerb:     "filter",
+		PrioritizeVerb: "prioritize",
+		Weight:         1,
+	}
+}
+
+func newTestNodes(names ...string) ([]*v1.Node, map[string]*deschedulernode.NodeInfo) {
+	nodes := make([]*v1.Node, len(names))
+	nodeNameToInfo := make(map[string]*deschedulernode.NodeInfo)
+	for i, name := range names {
+		nodes[i] = &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		nodeInfo := deschedulernode.NewNodeInfo()
+		if err := nodeInfo.SetNode(nodes[i]); err != nil {
+			panic(err)
+		}
+		nodeNameToInfo[name] = nodeInfo
+	}
+	return nodes, nodeNameToInfo
+}
+
+func newTestPod(resources v1.ResourceList) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default", UID: "uid-1"},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:      "container-1",
+				Resources: v1.ResourceRequirements{Requests: resources},
+			}},
+		},
+	}
+}
+
+func nodeNames(nodes []*v1.Node) []string {
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		names[i] = node.Name
+	}
+	return names
+}
+
+func TestLoadExtenders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extenders")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "policy.json")
+
+	// not existing file
+	_, err = LoadExtenders(configFile)
+	assert.ErrorContains(t, err, "failed to read the extender config file")
+
+	// valid policy
+	policy := `{
+  "kind": "Policy",
+  "apiVersion": "v1",
+  "extenders": [
+    {
+      "urlPrefix": "http://127.0.0.1:8888/scheduler",
+      "filterVerb": "filter",
+      "prioritizeVerb": "prioritize",
+      "weight": 2,
+      "bindVerb": "bind",
+      "enableHttps": false,
+      "nodeCacheCapable": false,
+      "managedResources": [{"name": "example.com/gpu", "ignoredByScheduler": false}],
+      "ignorable": true
+    },
+    {
+      "urlPrefix": "http://127.0.0.1:9999/scheduler",
+      "filterVerb": "filter"
+    }
+  ]
+}`
+	assert.NilError(t, ioutil.WriteFile(configFile, []byte(policy), 0644))
+	extenders, err := LoadExtenders(configFile)
+	assert.NilError(t, err)
+	assert.Assert(t, extenders.Enabled())
+	assert.Equal(t, len(extenders.extenders), 2)
+	assert.Equal(t, extenders.extenders[0].Name(), "http://127.0.0.1:8888/scheduler")
+	assert.Assert(t, extenders.extenders[0].IsBinder())
+	assert.Assert(t, extenders.extenders[0].IsIgnorable())
+	assert.Assert(t, !extenders.extenders[0].IsInterested(newTestPod(nil)))
+	assert.Assert(t, extenders.extenders[0].IsInterested(newTestPod(v1.ResourceList{
+		"example.com/gpu": resource.MustParse("1"),
+	})))
+	assert.Assert(t, !extenders.extenders[1].IsBinder())
+	assert.Assert(t, !extenders.extenders[1].IsIgnorable())
+
+	// malformed policy
+	assert.NilError(t, ioutil.WriteFile(configFile, []byte("extenders: []"), 0644))
+	_, err = LoadExtenders(configFile)
+	assert.ErrorContains(t, err, "invalid extender config file")
+
+	// not a policy
+	assert.NilError(t, ioutil.WriteFile(configFile, []byte(`{"kind": "ConfigMap", "apiVersion": "v1"}`), 0644))
+	_, err = LoadExtenders(configFile)
+	assert.ErrorContains(t, err, "expected kind Policy of apiVersion v1")
+
+	// invalid policy, only one extender can bind
+	policy = `{
+  "kind": "Policy",
+  "apiVersion": "v1",
+  "extenders": [
+    {"urlPrefix": "http://127.0.0.1:8888/scheduler", "bindVerb": "bind"},
+    {"urlPrefix": "http://127.0.0.1:9999/scheduler", "bindVerb": "bind"}
+  ]
+}`
+	assert.NilError(t, ioutil.WriteFile(configFile, []byte(policy), 0644))
+	_, err = LoadExtenders(configFile)
+	assert.ErrorContains(t, err, "Only one extender can implement bind")
+}
+
+func TestNoExtenders(t *testing.T) {
+	var extenders *Extenders
+	assert.Assert(t, !extenders.Enabled())
+	nodes, nodeNameToInfo := newTestNodes("node-1")
+	filtered, failedNodes, err := extenders.Filter(newTestPod(nil), nodes, nodeNameToInfo)
+	assert.NilError(t, err)
+	assert.Equal(t, len(filtered), 1)
+	assert.Equal(t, len(failedNodes), 0)
+	assert.Equal(t, len(extenders.Prioritize(newTestPod(nil), nodes)), 0)
+	bound, err := extenders.Bind(newTestPod(nil), "node-1")
+	assert.NilError(t, err)
+	assert.Assert(t, !bound)
+	assert.Assert(t, !NewExtenders(true).Enabled())
+}
+
+func TestFilter(t *testing.T) {
+	first := newFakeExtender()
+	first.failedNodes["node-2"] = "license not available"
+	firstServer := first.serve()
+	defer firstServer.Close()
+	second := newFakeExtender()
+	second.failedNodes["node-3"] = "GPU topology not satisfied"
+	second.failedNodes["node-2"] = "never checked"
+	secondServer := second.serve()
+	defer secondServer.Close()
+
+	extenders, err := newExtendersInternal([]schedulerapi.ExtenderConfig{
+		newExtenderConfig(firstServer),
+		newExtenderConfig(secondServer),
+	})
+	assert.NilError(t, err)
+	nodes, nodeNameToInfo := newTestNodes("node-1", "node-2", "node-3")
+	filtered, failedNodes, err := extenders.Filter(newTestPod(nil), nodes, nodeNameToInfo)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, nodeNames(filtered), []string{"node-1"})
+	// the second extender only gets the nodes passed the first one
+	assert.DeepEqual(t, failedNodes, map[string][]string{
+		"node-2": {"license not available"},
+		"node-3": {"GPU topology not satisfied"},
+	})
+	assert.Equal(t, first.callCount("filter"), 1)
+	assert.Equal(t, second.callCount("filter"), 1)
+
+	// no more extenders are called when all the nodes are filtered out
+	first.failedNodes["node-1"] = "license not available"
+	first.failedNodes["node-3"] = "license not available"
+	filtered, failedNodes, err = extenders.Filter(newTestPod(nil), nodes, nodeNameToInfo)
+	assert.NilError(t, err)
+	assert.Equal(t, len(filtered), 0)
+	assert.Equal(t, len(failedNodes), 3)
+	assert.Equal(t, second.callCount("filter"), 1)
+}
+
+func TestFilterManagedResources(t *testing.T) {
+	gpu := newFakeExtender()
+	gpu.failedNodes["node-1"] = "no GPU"
+	server := gpu.serve()
+	defer server.Close()
+
+	config := newExtenderConfig(server)
+	config.ManagedResources = []schedulerapi.ExtenderManagedResource{{Name: "example.com/gpu"}}
+	extenders, err := newExtendersInternal([]schedulerapi.ExtenderConfig{config})
+	assert.NilError(t, err)
+	nodes, nodeNameToInfo := newTestNodes("node-1", "node-2")
+
+	// the extender is not interested in pods without the managed resources
+	filtered, _, err := extenders.Filter(newTestPod(nil), nodes, nodeNameToInfo)
+	assert.NilError(t, err)
+	assert.Equal(t, len(filtered), 2)
+	assert.Equal(t, gpu.callCount("filter"), 0)
+
+	filtered, failedNodes, err := extenders.Filter(newTestPod(v1.ResourceList{
+		"example.com/gpu": resource.MustParse("1"),
+	}), nodes, nodeNameToInfo)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, nodeNames(filtered), []string{"node-2"})
+	assert.DeepEqual(t, failedNodes, map[string][]string{"node-1": {"no GPU"}})
+	assert.Equal(t, gpu.callCount("filter"), 1)
+}
+
+func TestFilterFailures(t *testing.T) {
+	broken := newFakeExtender()
+	broken.statusCode = http.StatusInternalServerError
+	brokenServer := broken.serve()
+	defer brokenServer.Close()
+	slow := newFakeExtender()
+	slow.delay = 200 * time.Millisecond
+	slowServer := slow.serve()
+	defer slowServer.Close()
+	nodes, nodeNameToInfo := newTestNodes("node-1", "node-2")
+
+	testCases := []struct {
+		name      string
+		config    schedulerapi.ExtenderConfig
+		ignorable bool
+		expectErr string
+	}{
+		{"failed", newExtenderConfig(brokenServer), false, "code 500"},
+		{"failed ignorable", newExtenderConfig(brokenServer), true, ""},
+		{"timeout", newExtenderConfig(slowServer), false, "Timeout"},
+		{"timeout ignorable", newExtenderConfig(slowServer), true, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.Ignorable = tc.ignorable
+			tc.config.HTTPTimeout = 50 * time.Millisecond
+			extenders, err := newExtendersInternal([]schedulerapi.ExtenderConfig{tc.config})
+			assert.NilError(t, err)
+			filtered, _, err := extenders.Filter(newTestPod(nil), nodes, nodeNameToInfo)
+			if tc.expectErr != "" {
+				assert.ErrorContains(t, err, tc.expectErr)
+				assert.ErrorContains(t, err, fmt.Sprintf("extender %s failed to filter nodes", tc.config.URLPrefix))
+			} else {
+				// the ignorable extender is skipped
+				assert.NilError(t, err)
+				assert.Equal(t, len(filtered), 2)
+			}
+		})
+	}
+}
+
+func TestPrioritize(t *testing.T) {
+	first := newFakeExtender()
+	first.scores["node-1"] = 1
+	first.scores["node-2"] = 5
+	firstServer := first.serve()
+	defer firstServer.Close()
+	second := newFakeExtender()
+	second.scores["node-1"] = 3
+	secondServer := second.serve()
+	defer secondServer.Close()
+	broken := newFakeExtender()
+	broken.statusCode = http.StatusInternalServerError
+	brokenServer := broken.serve()
+	defer brokenServer.Close()
+
+	secondConfig := newExtenderConfig(secondServer)
+	secondConfig.Weight = 2
+	extenders, err := newExtendersInternal([]schedulerapi.ExtenderConfig{
+		newExtenderConfig(firstServer),
+		secondConfig,
+		// failed prioritizing is always ignored
+		newExtenderConfig(brokenServer),
+	})
+	assert.NilError(t, err)
+	nodes, _ := newTestNodes("node-1", "node-2")
+	scores := extenders.Prioritize(newTestPod(nil), nodes)
+	assert.DeepEqual(t, scores, map[string]int{"node-1": 7, "node-2": 5})
+	assert.Equal(t, broken.callCount("prioritize"), 1)
+}
+
+func TestBind(t *testing.T) {
+	binder := newFakeExtender()
+	server := binder.serve()
+	defer server.Close()
+
+	config := newExtenderConfig(server)
+	config.BindVerb = "bind"
+	config.ManagedResources = []schedulerapi.ExtenderManagedResource{{Name: "example.com/gpu"}}
+	extenders, err := newExtendersInternal([]schedulerapi.ExtenderConfig{config})
+	assert.NilError(t, err)
+
+	// not interested, the pod is bound by the caller
+	bound, err := extenders.Bind(newTestPod(nil), "node-1")
+	assert.NilError(t, err)
+	assert.Assert(t, !bound)
+	assert.Equal(t, len(binder.bindings), 0)
+
+	bound, err = extenders.Bind(newTestPod(v1.ResourceList{
+		"example.com/gpu": resource.MustParse("1"),
+	}), "node-1")
+	assert.NilError(t, err)
+	assert.Assert(t, bound)
+	assert.DeepEqual(t, binder.bindings, []schedulerapi.ExtenderBindingArgs{{
+		PodName:      "pod-1",
+		PodNamespace: "default",
+		PodUID:       "uid-1",
+		Node:         "node-1",
+	}})
+
+	// bind failures are never ignored
+	binder.statusCode = http.StatusInternalServerError
+	bound, err = extenders.Bind(newTestPod(v1.ResourceList{
+		"example.com/gpu": resource.MustParse("1"),
+	}), "node-1")
+	assert.Assert(t, bound)
+	assert.ErrorContains(t, err, "failed to bind pod")
+}
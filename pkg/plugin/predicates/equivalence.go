@@ -0,0 +1,202 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package predicates
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	deschedulernode "k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+)
+
+// equivalenceCache keeps the predicate metadata of the pods and the predicate results of the
+// equivalence classes, a class groups the pods that have identical specs, e.g the pods of a job.
+// The metadata is derived from the whole scheduler cache, it is cleared when the cache is used
+// with a newer generation. The result on a node is kept until the NodeInfo of the node changes,
+// except the results of the classes which depend on more than the node, see dependsOnOtherNodes.
+type equivalenceCache struct {
+	generation uint64
+	// pod key to the cached metadata of the pod
+	pods map[string]*podEntry
+	// equivalence class to the predicate results of the nodes
+	results map[uint64]map[string]*nodeResult
+	// the classes used since the generation changed, the results of the other classes are dropped
+	// on the next change so the results of the classes without pods don't pile up
+	usedClasses map[uint64]bool
+	lock        sync.Mutex
+}
+
+type podEntry struct {
+	meta  predicates.PredicateMetadata
+	class uint64
+	// the results are only valid for the generation of the scheduler cache they are computed with
+	dependsOnOtherNodes bool
+}
+
+type nodeResult struct {
+	err error
+	// the generation of the NodeInfo the result is computed with
+	nodeGeneration int64
+	// the generation of the scheduler cache, only checked for the classes depending on the other nodes
+	generation uint64
+}
+
+func newEquivalenceCache() *equivalenceCache {
+	return &equivalenceCache{
+		pods:        make(map[string]*podEntry),
+		results:     make(map[uint64]map[string]*nodeResult),
+		usedClasses: make(map[uint64]bool),
+	}
+}
+
+// clears the metadata if the generation is changed, the results of the nodes are checked
+// when they are read. Assumes that lock is already acquired.
+func (c *equivalenceCache) checkGeneration(generation uint64) {
+	if c.generation != generation {
+		c.generation = generation
+		c.pods = make(map[string]*podEntry)
+		for class := range c.results {
+			if !c.usedClasses[class] {
+				delete(c.results, class)
+			}
+		}
+		c.usedClasses = make(map[uint64]bool)
+	}
+}
+
+func (c *equivalenceCache) getPod(key string, generation uint64) (*podEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.checkGeneration(generation)
+	entry, ok := c.pods[key]
+	return entry, ok
+}
+
+func (c *equivalenceCache) putPod(key string, entry *podEntry, generation uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.generation == generation {
+		c.pods[key] = entry
+	}
+}
+
+func (c *equivalenceCache) getResult(entry *podEntry, node *deschedulernode.NodeInfo, generation uint64) (error, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.checkGeneration(generation)
+	c.usedClasses[entry.class] = true
+	result, ok := c.results[entry.class][node.Node().Name]
+	if !ok || result.nodeGeneration != node.GetGeneration() ||
+		(entry.dependsOnOtherNodes && result.generation != generation) {
+		return nil, false
+	}
+	return result.err, true
+}
+
+func (c *equivalenceCache) putResult(entry *podEntry, node *deschedulernode.NodeInfo, err error, generation uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.generation != generation {
+		return
+	}
+	nodeResults, ok := c.results[entry.class]
+	if !ok {
+		nodeResults = make(map[string]*nodeResult)
+		c.results[entry.class] = nodeResults
+	}
+	nodeResults[node.Node().Name] = &nodeResult{
+		err:            err,
+		nodeGeneration: node.GetGeneration(),
+		generation:     generation,
+	}
+}
+
+// returns true if the predicate results of the pod on a node depend on more than the NodeInfo of the node:
+// on the pods of the other nodes through the inter-pod affinity, or on the state of the volumes.
+func (p *Predictor) dependsOnOtherNodes(pod *v1.Pod, nodeNameToInfo map[string]*deschedulernode.NodeInfo) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			return true
+		}
+	}
+	if _, ok := p.fitPredicateFunctions[predicates.MatchInterPodAffinityPred]; !ok {
+		return false
+	}
+	if affinity := pod.Spec.Affinity; affinity != nil && (affinity.PodAffinity != nil || affinity.PodAntiAffinity != nil) {
+		return true
+	}
+	// the anti-affinity of the existing pods
+	for _, nodeInfo := range nodeNameToInfo {
+		if len(nodeInfo.PodsWithAffinity()) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// the equivalence class of a pod, pods in the same namespace with the same labels
+// and the same spec apart from the assigned node share the predicate results.
+func equivalenceClass(pod *v1.Pod) (uint64, error) {
+	spec := pod.Spec
+	spec.NodeName = ""
+	// maps are marshalled with sorted keys, equal pods always get the same hash
+	data, err := json.Marshal(struct {
+		Namespace string
+		Labels    map[string]string
+		Spec      v1.PodSpec
+	}{pod.Namespace, pod.Labels, spec})
+	if err != nil {
+		return 0, err
+	}
+	hash := fnv.New64a()
+	//nolint:errcheck
+	_, _ = hash.Write(data)
+	return hash.Sum64(), nil
+}
+
+// runs the predicates with the metadata and the results cached for the given generation of the
+// scheduler cache, the metadata is computed once per pod and the predicates run once per node
+// for each equivalence class, until the node changes. Pods without UID or class are not cached.
+func (p *Predictor) PredicatesWithCache(pod *v1.Pod, node *deschedulernode.NodeInfo,
+	nodeNameToInfo map[string]*deschedulernode.NodeInfo, generation uint64) error {
+	key := string(pod.UID)
+	if key == "" {
+		return p.Predicates(pod, p.GetPredicateMeta(pod, nodeNameToInfo), node)
+	}
+	entry, ok := p.equivalenceCache.getPod(key, generation)
+	if !ok {
+		class, err := equivalenceClass(pod)
+		if err != nil {
+			return p.Predicates(pod, p.GetPredicateMeta(pod, nodeNameToInfo), node)
+		}
+		entry = &podEntry{
+			meta:                p.GetPredicateMeta(pod, nodeNameToInfo),
+			class:               class,
+			dependsOnOtherNodes: p.dependsOnOtherNodes(pod, nodeNameToInfo),
+		}
+		p.equivalenceCache.putPod(key, entry, generation)
+	}
+	if result, ok := p.equivalenceCache.getResult(entry, node, generation); ok {
+		return result
+	}
+	result := p.Predicates(pod, entry.meta, node)
+	p.equivalenceCache.putResult(entry, node, result, generation)
+	return result
+}
@@ -26,11 +26,13 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	v1helper "k8s.io/kubernetes/pkg/apis/core/v1/helper"
 	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
 	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
 	"k8s.io/kubernetes/pkg/scheduler/factory"
 	deschedulernode "k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+	schedulertesting "k8s.io/kubernetes/pkg/scheduler/testing"
 
 	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
 )
@@ -2037,3 +2039,247 @@ func TestInvalidConfiguredPredicates(t *testing.T) {
 	assert.Error(t, err, fmt.Sprintf("configured predicate 'xxx' is invalid, valid predicates are: %v",
 		predicates.Ordering()))
 }
+
+func newTestPod(uid string, labels map[string]string, milliCPU int64) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      uid,
+			Namespace: "default",
+			UID:       types.UID(uid),
+			Labels:    labels,
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{
+						v1.ResourceCPU: *resource.NewMilliQuantity(milliCPU, resource.DecimalSI),
+					},
+				},
+			}},
+		},
+	}
+}
+
+func newNodeInfoForCacheTest(name string, milliCPU int64, pods ...*v1.Pod) *deschedulernode.NodeInfo {
+	nodeInfo := deschedulernode.NewNodeInfo(pods...)
+	// API call always returns nil, never an error
+	//nolint:errcheck
+	_ = nodeInfo.SetNode(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{v1.LabelHostname: name},
+		},
+		Status: v1.NodeStatus{
+			Allocatable: v1.ResourceList{
+				v1.ResourceCPU:  *resource.NewMilliQuantity(milliCPU, resource.DecimalSI),
+				v1.ResourcePods: *resource.NewQuantity(110, resource.DecimalSI),
+			},
+		},
+	})
+	return nodeInfo
+}
+
+func TestPredicatesWithCache(t *testing.T) {
+	conf.Set(&conf.SchedulerConf{TestMode: true})
+	predictor := newPredictorInternal(&factory.PluginFactoryArgs{}, schedulerapi.Policy{
+		Predicates: []schedulerapi.PredicatePolicy{
+			{Name: predicates.PodFitsResourcesPred},
+		}})
+	// count the evaluations of the predicate
+	evaluations := 0
+	fitsResources := predictor.fitPredicateFunctions[predicates.PodFitsResourcesPred]
+	predictor.fitPredicateFunctions[predicates.PodFitsResourcesPred] = func(pod *v1.Pod,
+		meta predicates.PredicateMetadata, nodeInfo *deschedulernode.NodeInfo) (bool, []predicates.PredicateFailureReason, error) {
+		evaluations++
+		return fitsResources(pod, meta, nodeInfo)
+	}
+	small := newNodeInfoForCacheTest("small", 500)
+	large := newNodeInfoForCacheTest("large", 4000)
+	nodeNameToInfo := map[string]*deschedulernode.NodeInfo{"small": small, "large": large}
+	labels := map[string]string{"app": "job-1"}
+
+	// pods with the same spec share the results of each node, unfit results included
+	assert.NilError(t, predictor.PredicatesWithCache(newTestPod("pod-1", labels, 1000), large, nodeNameToInfo, 1))
+	assert.NilError(t, predictor.PredicatesWithCache(newTestPod("pod-2", labels, 1000), large, nodeNameToInfo, 1))
+	assert.Equal(t, evaluations, 1)
+	assert.Assert(t, predictor.PredicatesWithCache(newTestPod("pod-1", labels, 1000), small, nodeNameToInfo, 1) != nil)
+	assert.Assert(t, predictor.PredicatesWithCache(newTestPod("pod-3", labels, 1000), small, nodeNameToInfo, 1) != nil)
+	assert.Equal(t, evaluations, 2)
+
+	// pods with a different spec or labels are in other classes
+	assert.NilError(t, predictor.PredicatesWithCache(newTestPod("pod-4", labels, 200), small, nodeNameToInfo, 1))
+	assert.Equal(t, evaluations, 3)
+	assert.NilError(t, predictor.PredicatesWithCache(newTestPod("pod-5", map[string]string{"app": "job-2"}, 1000),
+		large, nodeNameToInfo, 1))
+	assert.Equal(t, evaluations, 4)
+
+	// the metadata is recomputed when the scheduler cache is changed, the results of the unchanged nodes are kept
+	assert.NilError(t, predictor.PredicatesWithCache(newTestPod("pod-1", labels, 1000), large, nodeNameToInfo, 2))
+	assert.Equal(t, evaluations, 4)
+	assert.Equal(t, len(predictor.equivalenceCache.pods), 1)
+
+	// the results of a changed node are computed again
+	large.AddPod(newTestPod("running", nil, 3500))
+	assert.Assert(t, predictor.PredicatesWithCache(newTestPod("pod-1", labels, 1000), large, nodeNameToInfo, 3) != nil)
+	assert.Equal(t, evaluations, 5)
+	assert.Assert(t, predictor.PredicatesWithCache(newTestPod("pod-1", labels, 1000), small, nodeNameToInfo, 3) != nil)
+	assert.Equal(t, evaluations, 5)
+	// only the results of the classes used since the previous change are kept
+	assert.Equal(t, len(predictor.equivalenceCache.results), 1)
+
+	// pods without UID are never cached
+	assert.NilError(t, predictor.PredicatesWithCache(newTestPod("", labels, 200), large, nodeNameToInfo, 3))
+	assert.NilError(t, predictor.PredicatesWithCache(newTestPod("", labels, 200), large, nodeNameToInfo, 3))
+	assert.Equal(t, evaluations, 7)
+}
+
+func TestPredicatesWithCacheInterPodAffinity(t *testing.T) {
+	conf.Set(&conf.SchedulerConf{TestMode: true})
+	predictor := newPredictorInternal(&factory.PluginFactoryArgs{}, schedulerapi.Policy{
+		Predicates: []schedulerapi.PredicatePolicy{
+			{Name: predicates.PodFitsResourcesPred},
+			{Name: predicates.MatchInterPodAffinityPred},
+		}})
+	evaluations := 0
+	fitsResources := predictor.fitPredicateFunctions[predicates.PodFitsResourcesPred]
+	predictor.fitPredicateFunctions[predicates.PodFitsResourcesPred] = func(pod *v1.Pod,
+		meta predicates.PredicateMetadata, nodeInfo *deschedulernode.NodeInfo) (bool, []predicates.PredicateFailureReason, error) {
+		evaluations++
+		return fitsResources(pod, meta, nodeInfo)
+	}
+	node1 := newNodeInfoForCacheTest("node-1", 4000)
+	node2 := newNodeInfoForCacheTest("node-2", 4000)
+	nodeNameToInfo := map[string]*deschedulernode.NodeInfo{"node-1": node1, "node-2": node2}
+
+	// without pod affinity the results only depend on the node
+	pod := newTestPod("pod-1", map[string]string{"app": "job"}, 1000)
+	assert.NilError(t, predictor.PredicatesWithCache(pod, node1, nodeNameToInfo, 1))
+	assert.NilError(t, predictor.PredicatesWithCache(pod, node1, nodeNameToInfo, 2))
+	assert.Equal(t, evaluations, 1)
+
+	// the anti-affinity of a pod on the other node changes the result of the unchanged node
+	antiAffinityPod := newTestPod("batch", map[string]string{"app": "batch"}, 100)
+	antiAffinityPod.Spec.Affinity = &v1.Affinity{
+		PodAntiAffinity: &v1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "job"}},
+				TopologyKey:   "zone",
+			}},
+		},
+	}
+	node1.Node().Labels["zone"] = "a"
+	node2.Node().Labels["zone"] = "a"
+	node2.AddPod(antiAffinityPod)
+	assert.Assert(t, predictor.PredicatesWithCache(pod, node1, nodeNameToInfo, 3) != nil)
+	assert.Equal(t, evaluations, 2)
+	assert.Assert(t, predictor.PredicatesWithCache(pod, node1, nodeNameToInfo, 3) != nil)
+	assert.Equal(t, evaluations, 2)
+	// the results are only kept for one generation of the scheduler cache
+	assert.Assert(t, predictor.PredicatesWithCache(pod, node1, nodeNameToInfo, 4) != nil)
+	assert.Equal(t, evaluations, 3)
+}
+
+func TestEquivalenceClass(t *testing.T) {
+	pod := newTestPod("pod-1", map[string]string{"app": "job-1", "role": "worker"}, 1000)
+	class, err := equivalenceClass(pod)
+	assert.NilError(t, err)
+
+	// the name, the UID and the assigned node don't change the class
+	other := pod.DeepCopy()
+	other.Name = "pod-2"
+	other.UID = "pod-2"
+	other.Spec.NodeName = "node-1"
+	otherClass, err := equivalenceClass(other)
+	assert.NilError(t, err)
+	assert.Equal(t, class, otherClass)
+
+	other.Namespace = "other"
+	otherClass, err = equivalenceClass(other)
+	assert.NilError(t, err)
+	assert.Assert(t, class != otherClass)
+}
+
+// a cluster of nodes running some pods with labels, the pods to schedule have
+// an anti-affinity to them, this makes the metadata computation expensive.
+func newBenchmarkCluster(numNodes int) (*Predictor, []*deschedulernode.NodeInfo, map[string]*deschedulernode.NodeInfo) {
+	conf.Set(&conf.SchedulerConf{TestMode: true})
+	nodes := make([]*deschedulernode.NodeInfo, numNodes)
+	nodeNameToInfo := make(map[string]*deschedulernode.NodeInfo, numNodes)
+	var allPods []*v1.Pod
+	var allNodes []v1.Node
+	for i := 0; i < numNodes; i++ {
+		name := fmt.Sprintf("node-%d", i)
+		var pods []*v1.Pod
+		for j := 0; j < 5; j++ {
+			pod := newTestPod(fmt.Sprintf("running-%d-%d", i, j), map[string]string{"app": "service"}, 100)
+			pod.Spec.NodeName = name
+			pods = append(pods, pod)
+		}
+		allPods = append(allPods, pods...)
+		nodes[i] = newNodeInfoForCacheTest(name, 16000, pods...)
+		nodeNameToInfo[name] = nodes[i]
+		allNodes = append(allNodes, *nodes[i].Node())
+	}
+	predictor := newPredictorInternal(&factory.PluginFactoryArgs{
+		PodLister: schedulertesting.FakePodLister(allPods),
+		NodeInfo:  predicates.FakeNodeListInfo(allNodes),
+	}, schedulerapi.Policy{
+		Predicates: []schedulerapi.PredicatePolicy{
+			{Name: predicates.GeneralPred},
+			{Name: predicates.PodToleratesNodeTaintsPred},
+			{Name: predicates.MatchInterPodAffinityPred},
+		}})
+	return predictor, nodes, nodeNameToInfo
+}
+
+func newBenchmarkPods(numPods int) []*v1.Pod {
+	pods := make([]*v1.Pod, numPods)
+	for i := range pods {
+		pods[i] = newTestPod(fmt.Sprintf("job-%d", i), map[string]string{"app": "job"}, 500)
+		pods[i].Spec.Affinity = &v1.Affinity{
+			PodAntiAffinity: &v1.PodAntiAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "batch"},
+					},
+					TopologyKey: v1.LabelHostname,
+				}},
+			},
+		}
+	}
+	return pods
+}
+
+// the core asks for every pod and node pair of a job of identical pods
+func BenchmarkPredicates(b *testing.B) {
+	predictor, nodes, nodeNameToInfo := newBenchmarkCluster(100)
+	pods := newBenchmarkPods(50)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, pod := range pods {
+			for _, node := range nodes {
+				meta := predictor.GetPredicateMeta(pod, nodeNameToInfo)
+				if err := predictor.Predicates(pod, meta, node); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkPredicatesWithCache(b *testing.B) {
+	predictor, nodes, nodeNameToInfo := newBenchmarkCluster(100)
+	pods := newBenchmarkPods(50)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		// start every iteration with a new generation to include the misses
+		generation := uint64(n + 1)
+		for _, pod := range pods {
+			for _, node := range nodes {
+				if err := predictor.PredicatesWithCache(pod, node, nodeNameToInfo, generation); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+}
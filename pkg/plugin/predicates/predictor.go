@@ -29,9 +29,10 @@ import (
 	"k8s.io/kubernetes/pkg/scheduler/factory"
 	deschedulernode "k8s.io/kubernetes/pkg/scheduler/nodeinfo"
 
-	"github.com/cloudera/yunikorn-k8shim/pkg/common/events"
 	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
 	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+	"github.com/cloudera/yunikorn-k8shim/pkg/metrics"
+	"github.com/cloudera/yunikorn-k8shim/pkg/plugin/extenders"
 )
 
 // this policy defines a configurable set of supported predicates.
@@ -53,6 +54,31 @@ var DefaultSchedulerPolicy = schedulerapi.Policy{
 	},
 }
 
+// the predicate name of the failures reported by the scheduler extenders
+const ExtenderPredicate = "SchedulerExtender"
+
+// the error returned when a pod doesn't fit a node, the failures are not reported
+// as events per node, the reasons are aggregated per pod by the caller instead.
+type PredicateError struct {
+	Predicate string
+	Reasons   []string
+}
+
+func newPredicateError(predicate string, reasons []predicates.PredicateFailureReason) *PredicateError {
+	err := &PredicateError{
+		Predicate: predicate,
+		Reasons:   make([]string, len(reasons)),
+	}
+	for i, reason := range reasons {
+		err.Reasons[i] = reason.GetReason()
+	}
+	return err
+}
+
+func (e *PredicateError) Error() string {
+	return fmt.Sprintf("predicate %s cannot be satisified, reason %v", e.Predicate, e.Reasons)
+}
+
 type Predictor struct {
 	fitPredicateMap              map[string]factory.FitPredicateFactory
 	fitPredicateFunctions        map[string]predicates.FitPredicate
@@ -60,6 +86,8 @@ type Predictor struct {
 	predicateMetaProducer        predicates.PredicateMetadataProducer
 	mandatoryFitPredicates       sets.String
 	schedulerPolicy              schedulerapi.Policy
+	equivalenceCache             *equivalenceCache
+	extenders                    *extenders.Extenders
 	lock                         sync.RWMutex
 }
 
@@ -72,7 +100,7 @@ func NewPredictor(args *factory.PluginFactoryArgs, testMode bool) *Predictor {
 	}
 	schedulerPolicy, err := parseConfiguredSchedulerPolicy()
 	if err != nil {
-		log.Logger.Fatal(err.Error())
+		log.Log(log.Predicates).Fatal(err.Error())
 	}
 	if schedulerPolicy == nil {
 		schedulerPolicy = &DefaultSchedulerPolicy
@@ -86,6 +114,7 @@ func newPredictorInternal(args *factory.PluginFactoryArgs, schedulerPolicy sched
 		fitPredicateFunctions:  make(map[string]predicates.FitPredicate),
 		mandatoryFitPredicates: sets.NewString(),
 		schedulerPolicy:        schedulerPolicy,
+		equivalenceCache:       newEquivalenceCache(),
 	}
 	// init all predicates
 	p.init()
@@ -255,11 +284,46 @@ func (p *Predictor) GetPredicateMeta(pod *v1.Pod,
 }
 
 func (p *Predictor) Enabled() bool {
-	return len(p.schedulerPolicy.Predicates) > 0
+	return len(p.schedulerPolicy.Predicates) > 0 || p.extenders.Enabled()
+}
+
+// sets the scheduler extenders which filter the nodes after the predicates,
+// this must be called before the predictor is used.
+func (p *Predictor) SetExtenders(e *extenders.Extenders) {
+	p.extenders = e
+}
+
+// filters the nodes which passed the predicates by the scheduler extenders, the failures of
+// the nodes filtered out are returned by the node name. The extender results are not cached,
+// the extenders keep their own state which is not tracked by the scheduler cache.
+func (p *Predictor) FilterByExtenders(pod *v1.Pod, nodes []*deschedulernode.NodeInfo,
+	nodeNameToInfo map[string]*deschedulernode.NodeInfo) (map[string]error, error) {
+	failures := make(map[string]error)
+	if !p.extenders.Enabled() || len(nodes) == 0 {
+		return failures, nil
+	}
+	candidates := make([]*v1.Node, len(nodes))
+	for i, node := range nodes {
+		candidates[i] = node.Node()
+	}
+	_, failedNodes, err := p.extenders.Filter(pod, candidates, nodeNameToInfo)
+	if err != nil {
+		metrics.GetShimMetrics().IncPredicateEvaluation(ExtenderPredicate, metrics.PredicateError)
+		return nil, err
+	}
+	for _, node := range candidates {
+		if reasons, ok := failedNodes[node.Name]; ok {
+			metrics.GetShimMetrics().IncPredicateEvaluation(ExtenderPredicate, metrics.PredicateUnfit)
+			failures[node.Name] = &PredicateError{Predicate: ExtenderPredicate, Reasons: reasons}
+		} else {
+			metrics.GetShimMetrics().IncPredicateEvaluation(ExtenderPredicate, metrics.PredicateFit)
+		}
+	}
+	return failures, nil
 }
 
 func (p *Predictor) Predicates(pod *v1.Pod, meta predicates.PredicateMetadata, node *deschedulernode.NodeInfo) error {
-	log.Logger.Debug("calling predicates")
+	log.Log(log.Predicates).Debug("calling predicates")
 	// honor the ordering...
 	for _, predicateKey := range predicates.Ordering() {
 		var (
@@ -269,26 +333,25 @@ func (p *Predictor) Predicates(pod *v1.Pod, meta predicates.PredicateMetadata, n
 		)
 		if predicate, exist := p.fitPredicateFunctions[predicateKey]; exist {
 			fit, reasons, err = predicate(pod, meta, node)
-			log.Logger.Debug("predicate", zap.String("key", predicateKey), zap.Bool("fit", fit))
+			log.Log(log.Predicates).Debug("predicate", zap.String("key", predicateKey), zap.Bool("fit", fit))
 			if err != nil {
-				log.Logger.Error("predicate failed",
+				metrics.GetShimMetrics().IncPredicateEvaluation(predicateKey, metrics.PredicateError)
+				log.Log(log.Predicates).Error("predicate failed",
 					zap.String("key", predicateKey),
 					zap.Bool("fit", fit),
 					zap.Any("reasons", reasons))
-				events.GetRecorder().Eventf(pod, v1.EventTypeWarning,
-					"FailedScheduling", err.Error())
 				return err
 			}
 
 			if !fit {
-				log.Logger.Warn("predicate failed",
+				metrics.GetShimMetrics().IncPredicateEvaluation(predicateKey, metrics.PredicateUnfit)
+				predicateErr := newPredicateError(predicateKey, reasons)
+				log.Log(log.Predicates).Debug("predicate failed",
 					zap.String("key", predicateKey),
-					zap.Bool("fit", fit),
-					zap.Any("reasons", reasons))
-				events.GetRecorder().Eventf(pod, v1.EventTypeWarning,
-					"FailedScheduling", "%v", reasons)
-				return fmt.Errorf("predicate %s cannot be satisified, reason %v", predicateKey, reasons)
+					zap.Strings("reasons", predicateErr.Reasons))
+				return predicateErr
 			}
+			metrics.GetShimMetrics().IncPredicateEvaluation(predicateKey, metrics.PredicateFit)
 		}
 	}
 	return nil
@@ -314,7 +377,7 @@ func parseConfiguredSchedulerPolicy() (*schedulerapi.Policy, error) {
 					parsedPredicate, predicates.Ordering())
 			}
 		}
-		log.Logger.Info("use configured predicates",
+		log.Log(log.Predicates).Info("use configured predicates",
 			zap.Any("predicates", predicatePolicies))
 		return &schedulerapi.Policy{Predicates: predicatePolicies}, nil
 	}
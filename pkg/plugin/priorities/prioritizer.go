@@ -0,0 +1,305 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package priorities
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/priorities"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
+	"k8s.io/kubernetes/pkg/scheduler/factory"
+	deschedulernode "k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+	"github.com/cloudera/yunikorn-k8shim/pkg/plugin/extenders"
+)
+
+// the priorities used when no priorities are configured, these are the default
+// priorities of the default scheduler except the spreading and inter-pod affinity ones.
+var DefaultPriorities = []schedulerapi.PriorityPolicy{
+	{Name: priorities.LeastRequestedPriority, Weight: 1},
+	{Name: priorities.BalancedResourceAllocation, Weight: 1},
+	{Name: priorities.NodePreferAvoidPodsPriority, Weight: 10000},
+	{Name: priorities.NodeAffinityPriority, Weight: 1},
+	{Name: priorities.TaintTolerationPriority, Weight: 1},
+	{Name: priorities.ImageLocalityPriority, Weight: 1},
+}
+
+type priorityFunction struct {
+	mapFn    priorities.PriorityMapFunction
+	reduceFn priorities.PriorityReduceFunction
+	weight   int
+}
+
+// the functions and default weights of the priorities in conf.SupportedPriorities
+var priorityFunctions = map[string]priorityFunction{
+	// Prioritize nodes by least requested utilization.
+	priorities.LeastRequestedPriority: {priorities.LeastRequestedPriorityMap, nil, 1},
+	// Optional, cluster-autoscaler friendly priority function - give used nodes higher priority.
+	priorities.MostRequestedPriority: {priorities.MostRequestedPriorityMap, nil, 1},
+	// Prioritizes nodes to help achieve balanced resource usage
+	priorities.BalancedResourceAllocation: {priorities.BalancedResourceAllocationMap, nil, 1},
+	// Set this weight large enough to override all other priority functions.
+	priorities.NodePreferAvoidPodsPriority: {priorities.CalculateNodePreferAvoidPodsPriorityMap, nil, 10000},
+	// Prioritizes nodes that have labels matching NodeAffinity
+	priorities.NodeAffinityPriority: {
+		priorities.CalculateNodeAffinityPriorityMap, priorities.CalculateNodeAffinityPriorityReduce, 1},
+	// Prioritizes nodes that marked with taint which pod can tolerate.
+	priorities.TaintTolerationPriority: {
+		priorities.ComputeTaintTolerationPriorityMap, priorities.ComputeTaintTolerationPriorityReduce, 1},
+	// ImageLocalityPriority prioritizes nodes that have images requested by the pod present.
+	priorities.ImageLocalityPriority: {priorities.ImageLocalityPriorityMap, nil, 1},
+}
+
+// the score of a node, a higher score means the node is preferred
+type NodeScore struct {
+	NodeID string
+	Score  int
+}
+
+type priorityConfig struct {
+	name   string
+	mapFn  priorities.PriorityMapFunction
+	reduce priorities.PriorityReduceFunction
+	weight int
+}
+
+type Prioritizer struct {
+	priorityConfigMap           map[string]factory.PriorityConfigFactory
+	priorityConfigs             []priorityConfig
+	priorityMetaProducerFactory factory.PriorityMetadataProducerFactory
+	priorityMetaProducer        priorities.PriorityMetadataProducer
+	priorityPolicies            []schedulerapi.PriorityPolicy
+	extenders                   *extenders.Extenders
+	lock                        sync.RWMutex
+}
+
+func NewPrioritizer(args *factory.PluginFactoryArgs, testMode bool) *Prioritizer {
+	if testMode {
+		// in test mode, disable all the priorities
+		return newPrioritizerInternal(args, []schedulerapi.PriorityPolicy{})
+	}
+	priorityPolicies, err := parseConfiguredPriorities()
+	if err != nil {
+		log.Log(log.Priorities).Fatal(err.Error())
+	}
+	if priorityPolicies == nil {
+		priorityPolicies = DefaultPriorities
+	}
+	return newPrioritizerInternal(args, priorityPolicies)
+}
+
+func newPrioritizerInternal(args *factory.PluginFactoryArgs, priorityPolicies []schedulerapi.PriorityPolicy) *Prioritizer {
+	p := &Prioritizer{
+		priorityConfigMap: make(map[string]factory.PriorityConfigFactory),
+		priorityPolicies:  priorityPolicies,
+	}
+	// init all priorities
+	p.init()
+	// generate priority functions
+	p.populatePriorityFunc(*args)
+	// generate priority meta producer
+	p.populatePriorityMetaProducer(*args)
+	return p
+}
+
+// a complete list of all supported priorities,
+// see more at "kubernetes/pkg/scheduler/algorithmprovider/defaults/register_priorities.go"
+func (p *Prioritizer) init() {
+	// Register functions that extract metadata used by priorities computations,
+	// the listers not set in the args are replaced by empty ones.
+	p.RegisterPriorityMetadataProducerFactory(
+		func(args factory.PluginFactoryArgs) priorities.PriorityMetadataProducer {
+			serviceLister := args.ServiceLister
+			if serviceLister == nil {
+				serviceLister = emptyServiceLister{}
+			}
+			controllerLister := args.ControllerLister
+			if controllerLister == nil {
+				controllerLister = algorithm.EmptyControllerLister{}
+			}
+			replicaSetLister := args.ReplicaSetLister
+			if replicaSetLister == nil {
+				replicaSetLister = algorithm.EmptyReplicaSetLister{}
+			}
+			statefulSetLister := args.StatefulSetLister
+			if statefulSetLister == nil {
+				statefulSetLister = algorithm.EmptyStatefulSetLister{}
+			}
+			return priorities.NewPriorityMetadataFactory(serviceLister, controllerLister, replicaSetLister, statefulSetLister)
+		})
+
+	// the names that can be configured are listed in the conf, each of them must have its functions here
+	for _, name := range conf.SupportedPriorities {
+		fn, ok := priorityFunctions[name]
+		if !ok {
+			log.Log(log.Priorities).Fatal("supported priority has no priority function registered",
+				zap.String("priority", name))
+		}
+		p.RegisterPriorityFunction(name, fn.mapFn, fn.reduceFn, fn.weight)
+	}
+}
+
+// From: k8s.io/kubernetes/pkg/scheduler/factory/plugins.go
+// RegisterPriorityFunction registers a priority function with the algorithm registry.
+// Returns the name with which the function was registered.
+func (p *Prioritizer) RegisterPriorityFunction(name string, mapFunction priorities.PriorityMapFunction,
+	reduceFunction priorities.PriorityReduceFunction, weight int) string {
+	return p.RegisterPriorityConfigFactory(name, factory.PriorityConfigFactory{
+		MapReduceFunction: func(factory.PluginFactoryArgs) (priorities.PriorityMapFunction, priorities.PriorityReduceFunction) {
+			return mapFunction, reduceFunction
+		},
+		Weight: weight,
+	})
+}
+
+// From: k8s.io/kubernetes/pkg/scheduler/factory/plugins.go
+// RegisterPriorityConfigFactory registers a priority config factory with its name.
+func (p *Prioritizer) RegisterPriorityConfigFactory(name string, pcf factory.PriorityConfigFactory) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.priorityConfigMap[name] = pcf
+	return name
+}
+
+// RegisterPriorityMetadataProducerFactory registers a PriorityMetadataProducerFactory.
+func (p *Prioritizer) RegisterPriorityMetadataProducerFactory(factory factory.PriorityMetadataProducerFactory) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.priorityMetaProducerFactory = factory
+}
+
+func (p *Prioritizer) populatePriorityFunc(args factory.PluginFactoryArgs) {
+	for _, policy := range p.priorityPolicies {
+		if pcf, ok := p.priorityConfigMap[policy.Name]; ok && pcf.MapReduceFunction != nil {
+			mapFn, reduceFn := pcf.MapReduceFunction(args)
+			weight := pcf.Weight
+			if policy.Weight > 0 {
+				weight = policy.Weight
+			}
+			p.priorityConfigs = append(p.priorityConfigs, priorityConfig{
+				name:   policy.Name,
+				mapFn:  mapFn,
+				reduce: reduceFn,
+				weight: weight,
+			})
+		}
+	}
+}
+
+func (p *Prioritizer) populatePriorityMetaProducer(args factory.PluginFactoryArgs) {
+	if p.priorityMetaProducerFactory != nil {
+		p.priorityMetaProducer = p.priorityMetaProducerFactory(args)
+	}
+}
+
+func (p *Prioritizer) Enabled() bool {
+	return len(p.priorityConfigs) > 0 || p.extenders.Enabled()
+}
+
+// sets the scheduler extenders whose scores are added to the scores of the priorities,
+// this must be called before the prioritizer is used.
+func (p *Prioritizer) SetExtenders(e *extenders.Extenders) {
+	p.extenders = e
+}
+
+// scores the given nodes for the pod, the result is sorted by the scores in descending order.
+// This follows PrioritizeNodes of the default scheduler: each priority maps every node to
+// a score, the optional reduce step normalizes the scores, the weighted scores are summed up.
+func (p *Prioritizer) ScoreNodes(pod *v1.Pod, nodes []*deschedulernode.NodeInfo,
+	nodeNameToInfo map[string]*deschedulernode.NodeInfo) ([]NodeScore, error) {
+	var meta interface{}
+	if p.priorityMetaProducer != nil {
+		meta = p.priorityMetaProducer(pod, nodeNameToInfo)
+	}
+	scores := make([]NodeScore, len(nodes))
+	for i, node := range nodes {
+		if node.Node() == nil {
+			return nil, fmt.Errorf("node info of the node at index %d has no node", i)
+		}
+		scores[i].NodeID = node.Node().Name
+	}
+	for _, config := range p.priorityConfigs {
+		result := make(schedulerapi.HostPriorityList, len(nodes))
+		for i, node := range nodes {
+			hostPriority, err := config.mapFn(pod, meta, node)
+			if err != nil {
+				return nil, fmt.Errorf("priority %s failed on node %s: %v", config.name, scores[i].NodeID, err)
+			}
+			result[i] = hostPriority
+		}
+		if config.reduce != nil {
+			if err := config.reduce(pod, meta, nodeNameToInfo, result); err != nil {
+				return nil, fmt.Errorf("priority %s failed: %v", config.name, err)
+			}
+		}
+		for i := range result {
+			scores[i].Score += result[i].Score * config.weight
+		}
+		log.Log(log.Priorities).Debug("priority",
+			zap.String("key", config.name),
+			zap.Any("result", result))
+	}
+	if p.extenders.Enabled() {
+		candidates := make([]*v1.Node, len(nodes))
+		for i, node := range nodes {
+			candidates[i] = node.Node()
+		}
+		extenderScores := p.extenders.Prioritize(pod, candidates)
+		for i := range scores {
+			scores[i].Score += extenderScores[scores[i].NodeID]
+		}
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Score > scores[j].Score
+	})
+	return scores, nil
+}
+
+// parse the configured priorities from scheduler conf
+func parseConfiguredPriorities() ([]schedulerapi.PriorityPolicy, error) {
+	configured := conf.GetSchedulerConf().Priorities
+	parsed, err := conf.ParsePriorities(configured)
+	if err != nil || len(parsed) == 0 {
+		return nil, err
+	}
+	policies := make([]schedulerapi.PriorityPolicy, len(parsed))
+	for i, priority := range parsed {
+		policies[i] = schedulerapi.PriorityPolicy{Name: priority.Name, Weight: priority.Weight}
+	}
+	log.Log(log.Priorities).Info("use configured priorities",
+		zap.Any("priorities", policies))
+	return policies, nil
+}
+
+// a service lister without services, the scheduler cache doesn't list services
+type emptyServiceLister struct{}
+
+func (emptyServiceLister) List(labels.Selector) ([]*v1.Service, error) {
+	return nil, nil
+}
+
+func (emptyServiceLister) GetPodServices(*v1.Pod) ([]*v1.Service, error) {
+	return nil, nil
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package priorities
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/priorities"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
+	"k8s.io/kubernetes/pkg/scheduler/factory"
+	deschedulernode "k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/cache/external"
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+)
+
+func newTestPod(name string, milliCPU, memory int64) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{
+						v1.ResourceCPU:    *resource.NewMilliQuantity(milliCPU, resource.DecimalSI),
+						v1.ResourceMemory: *resource.NewQuantity(memory, resource.BinarySI),
+					},
+				},
+			}},
+		},
+	}
+}
+
+func newNodeInfoForTest(name string, labels map[string]string, pods ...*v1.Pod) *deschedulernode.NodeInfo {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Status: v1.NodeStatus{
+			Allocatable: v1.ResourceList{
+				v1.ResourceCPU:    *resource.NewMilliQuantity(4000, resource.DecimalSI),
+				v1.ResourceMemory: *resource.NewQuantity(8*1024*1024*1024, resource.BinarySI),
+				v1.ResourcePods:   *resource.NewQuantity(100, resource.DecimalSI),
+			},
+		},
+	}
+	nodeInfo := deschedulernode.NewNodeInfo(pods...)
+	// API call always returns nil, never an error
+	//nolint:errcheck
+	_ = nodeInfo.SetNode(node)
+	return nodeInfo
+}
+
+func scoreNodesForTest(t *testing.T, p *Prioritizer, pod *v1.Pod, nodes ...*deschedulernode.NodeInfo) []NodeScore {
+	nodeNameToInfo := make(map[string]*deschedulernode.NodeInfo)
+	for _, node := range nodes {
+		nodeNameToInfo[node.Node().Name] = node
+	}
+	scores, err := p.ScoreNodes(pod, nodes, nodeNameToInfo)
+	assert.NilError(t, err)
+	return scores
+}
+
+func TestLeastAndMostRequested(t *testing.T) {
+	pod := newTestPod("pod", 1000, 1024*1024*1024)
+	busy := newNodeInfoForTest("busy", nil, newTestPod("existing", 2000, 4*1024*1024*1024))
+	idle := newNodeInfoForTest("idle", nil)
+
+	least := newPrioritizerInternal(&factory.PluginFactoryArgs{}, []schedulerapi.PriorityPolicy{
+		{Name: priorities.LeastRequestedPriority},
+	})
+	assert.Assert(t, least.Enabled())
+	scores := scoreNodesForTest(t, least, pod, busy, idle)
+	assert.Equal(t, scores[0].NodeID, "idle")
+	assert.Equal(t, scores[1].NodeID, "busy")
+	assert.Assert(t, scores[0].Score > scores[1].Score)
+
+	most := newPrioritizerInternal(&factory.PluginFactoryArgs{}, []schedulerapi.PriorityPolicy{
+		{Name: priorities.MostRequestedPriority},
+	})
+	scores = scoreNodesForTest(t, most, pod, idle, busy)
+	assert.Equal(t, scores[0].NodeID, "busy")
+	assert.Equal(t, scores[1].NodeID, "idle")
+}
+
+func TestNodeAffinityAndWeights(t *testing.T) {
+	pod := newTestPod("pod", 1000, 1024*1024*1024)
+	pod.Spec.Affinity = &v1.Affinity{
+		NodeAffinity: &v1.NodeAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []v1.PreferredSchedulingTerm{{
+				Weight: 5,
+				Preference: v1.NodeSelectorTerm{
+					MatchExpressions: []v1.NodeSelectorRequirement{{
+						Key:      "zone",
+						Operator: v1.NodeSelectorOpIn,
+						Values:   []string{"a"},
+					}},
+				},
+			}},
+		},
+	}
+	// the preferred node is busier, it only wins when the affinity has enough weight
+	preferred := newNodeInfoForTest("preferred", map[string]string{"zone": "a"},
+		newTestPod("existing", 3000, 6*1024*1024*1024))
+	other := newNodeInfoForTest("other", map[string]string{"zone": "b"})
+
+	p := newPrioritizerInternal(&factory.PluginFactoryArgs{}, []schedulerapi.PriorityPolicy{
+		{Name: priorities.LeastRequestedPriority, Weight: 2},
+		{Name: priorities.NodeAffinityPriority},
+	})
+	scores := scoreNodesForTest(t, p, pod, preferred, other)
+	assert.Equal(t, scores[0].NodeID, "other")
+
+	p = newPrioritizerInternal(&factory.PluginFactoryArgs{}, []schedulerapi.PriorityPolicy{
+		{Name: priorities.LeastRequestedPriority, Weight: 2},
+		{Name: priorities.NodeAffinityPriority, Weight: 10},
+	})
+	scores = scoreNodesForTest(t, p, pod, preferred, other)
+	assert.Equal(t, scores[0].NodeID, "preferred")
+	// the normalized affinity score is 10 for the preferred node, 0 for the other
+	assert.Assert(t, scores[0].Score >= 100)
+}
+
+func TestImageLocality(t *testing.T) {
+	// the image states of the nodes are filled in by the scheduler cache
+	cache := external.NewSchedulerCache(nil, nil, nil, nil, 0)
+	for _, name := range []string{"with-image", "without-image"} {
+		node := newNodeInfoForTest(name, nil).Node()
+		if name == "with-image" {
+			node.Status.Images = []v1.ContainerImage{{
+				Names:     []string{"app:1"},
+				SizeBytes: 500 * 1024 * 1024,
+			}}
+		}
+		cache.AddNode(node)
+	}
+	snapshot := cache.Snapshot()
+
+	pod := newTestPod("pod", 1000, 1024*1024*1024)
+	pod.Spec.Containers[0].Image = "app:1"
+	p := newPrioritizerInternal(&factory.PluginFactoryArgs{}, DefaultPriorities)
+	scores := scoreNodesForTest(t, p, pod, snapshot.NodeInfos["without-image"], snapshot.NodeInfos["with-image"])
+	assert.Equal(t, scores[0].NodeID, "with-image")
+	assert.Assert(t, scores[0].Score > scores[1].Score)
+}
+
+func TestDefaultPriorities(t *testing.T) {
+	// every default and supported priority is registered, and only those
+	p := newPrioritizerInternal(&factory.PluginFactoryArgs{}, DefaultPriorities)
+	assert.Equal(t, len(p.priorityConfigs), len(DefaultPriorities))
+	assert.Equal(t, len(priorityFunctions), len(conf.SupportedPriorities))
+	assert.Equal(t, len(p.priorityConfigMap), len(conf.SupportedPriorities))
+	for _, name := range conf.SupportedPriorities {
+		_, ok := p.priorityConfigMap[name]
+		assert.Assert(t, ok, name)
+	}
+
+	// the default priorities run with the args of the scheduler cache
+	pod := newTestPod("pod", 1000, 1024*1024*1024)
+	scores := scoreNodesForTest(t, p, pod, newNodeInfoForTest("node-1", nil), newNodeInfoForTest("node-2", nil))
+	assert.Equal(t, len(scores), 2)
+	assert.Equal(t, scores[0].Score, scores[1].Score)
+	// ties keep the given order
+	assert.Equal(t, scores[0].NodeID, "node-1")
+}
+
+func TestConfiguredPriorities(t *testing.T) {
+	defer conf.Set(conf.GetSchedulerConf())
+	conf.Set(&conf.SchedulerConf{Priorities: "ImageLocalityPriority:3,LeastRequestedPriority"})
+	p := NewPrioritizer(&factory.PluginFactoryArgs{}, false)
+	assert.Equal(t, len(p.priorityConfigs), 2)
+	assert.Equal(t, p.priorityConfigs[0].name, priorities.ImageLocalityPriority)
+	assert.Equal(t, p.priorityConfigs[0].weight, 3)
+	assert.Equal(t, p.priorityConfigs[1].name, priorities.LeastRequestedPriority)
+	assert.Equal(t, p.priorityConfigs[1].weight, 1)
+
+	conf.Set(&conf.SchedulerConf{})
+	p = NewPrioritizer(&factory.PluginFactoryArgs{}, false)
+	assert.Equal(t, len(p.priorityConfigs), len(DefaultPriorities))
+
+	p = NewPrioritizer(&factory.PluginFactoryArgs{}, true)
+	assert.Assert(t, !p.Enabled())
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/cloudera/yunikorn-core/pkg/api"
+	"github.com/cloudera/yunikorn-scheduler-interface/lib/go/si"
+)
+
+// the message of the error returned by the scheduler-core when it rejects an update request
+// from a RM it doesn't know, this happens when the core was restarted after the RM registered.
+const coreRMNotRegisteredFormat = "received UpdateRequest, but RmID=\"%s\" not registered"
+
+// rmNotRegisteredError is returned when the core rejects an update request
+// because the RM of the request is not registered.
+type rmNotRegisteredError struct {
+	rmID  string
+	cause error
+}
+
+func (e *rmNotRegisteredError) Error() string {
+	return e.cause.Error()
+}
+
+// the core does not return typed errors, the rejection is recognized by the complete
+// message for the RM of the request, other errors are returned unchanged.
+func toRMNotRegisteredError(request *si.UpdateRequest, err error) error {
+	if err.Error() == fmt.Sprintf(coreRMNotRegisteredFormat, request.RmID) {
+		return &rmNotRegisteredError{rmID: request.RmID, cause: err}
+	}
+	return err
+}
+
+// coreProxy wraps the scheduler API of the scheduler-core, it notifies the shim
+// when an update request is rejected because the core has lost the RM registration.
+type coreProxy struct {
+	api.SchedulerAPI
+	onRMLost func()
+}
+
+func newCoreProxy(schedulerAPI api.SchedulerAPI) *coreProxy {
+	return &coreProxy{
+		SchedulerAPI: schedulerAPI,
+	}
+}
+
+// sets the handler called when the core has lost the RM registration,
+// this must be set before the scheduler starts.
+func (p *coreProxy) setRMLostHandler(handler func()) {
+	p.onRMLost = handler
+}
+
+func (p *coreProxy) Update(request *si.UpdateRequest) error {
+	err := p.SchedulerAPI.Update(request)
+	if err == nil {
+		return nil
+	}
+	err = toRMNotRegisteredError(request, err)
+	if _, ok := err.(*rmNotRegisteredError); ok && p.onRMLost != nil {
+		p.onRMLost()
+	}
+	return err
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -26,7 +27,9 @@ import (
 	"github.com/cloudera/yunikorn-core/pkg/api"
 	"github.com/cloudera/yunikorn-core/pkg/entrypoint"
 	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+	"github.com/cloudera/yunikorn-k8shim/pkg/election"
 	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+	"github.com/cloudera/yunikorn-k8shim/pkg/webservice"
 )
 
 var (
@@ -35,6 +38,12 @@ var (
 )
 
 func main() {
+	if err := conf.InitFromCommandLine(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid scheduler configuration: %v\n", err)
+		os.Exit(2)
+	}
+	log.InitLogger(conf.GetSchedulerConf())
+
 	log.Logger.Info("Build info", zap.String("version", version), zap.String("date", date))
 	log.Logger.Info("starting scheduler",
 		zap.String("name", conf.GetSchedulerConf().SchedulerName))
@@ -43,14 +52,54 @@ func main() {
 
 	if sa, ok := serviceContext.RMProxy.(api.SchedulerAPI); ok {
 		ss := newShimScheduler(sa, conf.GetSchedulerConf())
-		ss.run()
+		conf.AddReloadHandler(ss.context.OnConfigReload)
+		lostLeadership := make(chan struct{})
+		var elector *election.Elector
+		if conf.GetSchedulerConf().LeaderElection {
+			// only the leader registers to the core, the others stay in standby
+			var err error
+			elector, err = election.NewElector(ss.context.GetKubeClient().GetClientSet(),
+				conf.GetSchedulerConf(), election.Callbacks{
+					OnStartedLeading: ss.activate,
+					OnStoppedLeading: func() {
+						ss.deactivate()
+						close(lostLeadership)
+					},
+				})
+			if err != nil {
+				log.Logger.Fatal("failed to create the leader elector", zap.Error(err))
+			}
+			ss.runStandby()
+			elector.Run()
+		} else {
+			ss.run()
+		}
+
+		webApp := webservice.NewWebApp(ss.context, conf.GetSchedulerConf().WebServicePort)
+		webApp.AddReadinessCheck("scheduler", ss.checkReadiness)
+		webApp.AddLivenessCheck("dispatcher", ss.checkDispatcher)
+		webApp.AddLivenessCheck("scheduling-loop", ss.checkSchedulingLoop)
+		webApp.AddLivenessCheck("informers", ss.checkInformers)
+		webApp.StartWebApp()
 
 		signalChan := make(chan os.Signal, 1)
 		signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
-		for range signalChan {
+		select {
+		case <-signalChan:
 			log.Logger.Info("Shutdown signal received, exiting...")
+			if err := webApp.StopWebApp(); err != nil {
+				log.Logger.Error("failed to stop the shim web-app", zap.Error(err))
+			}
+			if elector != nil {
+				// release the lease so that a standby can take over immediately
+				elector.Stop()
+			}
 			ss.stop()
 			os.Exit(0)
+		case <-lostLeadership:
+			// restart to rejoin the election as a standby
+			log.Logger.Error("lost the leadership, exiting...")
+			os.Exit(1)
 		}
 	}
 }
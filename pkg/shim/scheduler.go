@@ -17,12 +17,13 @@ limitations under the License.
 package main
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/looplab/fsm"
 	"go.uber.org/zap"
-	"k8s.io/apimachinery/pkg/util/wait"
 
 	"github.com/cloudera/yunikorn-core/pkg/api"
 	"github.com/cloudera/yunikorn-k8shim/pkg/cache"
@@ -34,31 +35,54 @@ import (
 	"github.com/cloudera/yunikorn-scheduler-interface/lib/go/si"
 )
 
+// the scheduling loop is considered as stalled if it has not completed
+// an iteration within this number of scheduling intervals
+const scheduleStallIntervals = 10
+
 // shim scheduler watches api server and interacts with unity scheduler to allocate pods
 type KubernetesShim struct {
+	// unix nano time of the latest completed scheduling iteration,
+	// accessed atomically, keep it first in the struct for 64-bit alignment
+	lastScheduleTime int64
+	// set to 1 when the core has lost the RM registration, accessed atomically
+	rmLost       int32
 	rmProxy      api.SchedulerAPI
 	context      *cache.Context
 	callback     api.ResourceManagerCallback
 	stateMachine *fsm.FSM
-	stopChan     chan struct{}
-	lock         *sync.RWMutex
+	history      *events.StateHistory
+	// stops the scheduling loop
+	scheduleStopChan chan struct{}
+	// stops the informers
+	stopChan chan struct{}
+	stopOnce sync.Once
+	// number of consecutive failed registrations
+	registerAttempts int
+	// the scheduling loop and event handlers are started at the first time the scheduler runs
+	schedulingStarted bool
+	lock              *sync.RWMutex
 }
 
 func newShimScheduler(api api.SchedulerAPI, configs *conf.SchedulerConf) *KubernetesShim {
-	context := cache.NewContext(api, configs)
+	proxy := newCoreProxy(api)
+	context := cache.NewContext(proxy, configs)
 	rmCallback := callback.NewAsyncRMCallback(context)
-	return newShimSchedulerInternal(api, context, rmCallback)
+	ss := newShimSchedulerInternal(proxy, context, rmCallback)
+	proxy.setRMLostHandler(ss.handleRMLost)
+	return ss
 }
 
 // this is visible for testing
 func newShimSchedulerInternal(api api.SchedulerAPI, ctx *cache.Context, cb api.ResourceManagerCallback) *KubernetesShim {
 	var states = events.States().Scheduler
 	ss := &KubernetesShim{
-		rmProxy:  api,
-		context:  ctx,
-		callback: cb,
-		stopChan: make(chan struct{}),
-		lock:     &sync.RWMutex{},
+		rmProxy:          api,
+		context:          ctx,
+		callback:         cb,
+		history:          events.NewStateHistory(events.ObjectScheduler, conf.GetSchedulerConf().SchedulerName),
+		scheduleStopChan: make(chan struct{}),
+		stopChan:         make(chan struct{}),
+		lock:             &sync.RWMutex{},
 	}
 
 	// init state machine
@@ -66,7 +90,7 @@ func newShimSchedulerInternal(api api.SchedulerAPI, ctx *cache.Context, cb api.R
 		states.New,
 		fsm.Events{
 			{Name: string(events.RegisterScheduler),
-				Src: []string{states.New},
+				Src: []string{states.New, states.Stopped, states.Running},
 				Dst: states.Registering},
 			{Name: string(events.RegisterSchedulerSucceed),
 				Src: []string{states.Registering},
@@ -83,13 +107,20 @@ func newShimSchedulerInternal(api api.SchedulerAPI, ctx *cache.Context, cb api.R
 			{Name: string(events.RecoverSchedulerFailed),
 				Src: []string{states.Recovering},
 				Dst: states.Stopped},
+			{Name: string(events.DrainScheduler),
+				Src: []string{states.New, states.Registering, states.Registered, states.Recovering, states.Running},
+				Dst: states.Draining},
+			{Name: string(events.StopScheduler),
+				Src: []string{states.Draining},
+				Dst: states.Stopped},
 		},
 		fsm.Callbacks{
 			string(events.RegisterScheduler):       ss.register(),                      // trigger registration
-			string(events.RegisterSchedulerFailed): ss.handleSchedulerFailure(),        // registration failed, stop the scheduler
+			string(events.RegisterSchedulerFailed): ss.handleSchedulerFailure(),        // registration failed, retry or stop the scheduler
 			string(states.Registered):              ss.triggerSchedulerStateRecovery(), // if reaches registered, trigger recovering
 			string(states.Recovering):              ss.recoverSchedulerState(),         // do recovering
 			string(states.Running):                 ss.doScheduling(),                  // do scheduling
+			events.EnterState:                      ss.history.OnEnterState,            // record state transitions
 		},
 	)
 
@@ -118,11 +149,19 @@ func (ss *KubernetesShim) SchedulerEventHandler() func(obj interface{}) {
 
 func (ss *KubernetesShim) register() func(e *fsm.Event) {
 	return func(e *fsm.Event) {
+		atomic.StoreInt32(&ss.rmLost, 0)
+		if e.Src != events.States().Scheduler.New && ss.context != nil {
+			// registering again, the core doesn't know the previous state,
+			// it is rebuilt from scratch by the recovery after the registration
+			ss.context.ResetForRecovery()
+		}
 		if err := ss.registerShimLayer(); err != nil {
+			log.Logger.Warn("failed to register RM to the scheduler", zap.Error(err))
 			dispatcher.Dispatch(ShimSchedulerEvent{
 				event: events.RegisterSchedulerFailed,
 			})
 		} else {
+			ss.registerAttempts = 0
 			dispatcher.Dispatch(ShimSchedulerEvent{
 				event: events.RegisterSchedulerSucceed,
 			})
@@ -132,7 +171,56 @@ func (ss *KubernetesShim) register() func(e *fsm.Event) {
 
 func (ss *KubernetesShim) handleSchedulerFailure() func(e *fsm.Event) {
 	return func(e *fsm.Event) {
-		ss.stop()
+		maxRetries := conf.GetSchedulerConf().RegisterMaxRetries
+		if maxRetries > 0 && ss.registerAttempts >= maxRetries {
+			log.Logger.Error("registration failed, max number of retries reached",
+				zap.Int("maxRetries", maxRetries))
+			// stop asynchronously, the shutdown waits for the dispatcher
+			// which is blocked by this state transition
+			go ss.stop()
+			return
+		}
+		backoff := registerBackoff(ss.registerAttempts)
+		ss.registerAttempts++
+		log.Logger.Info("retry registration after backoff",
+			zap.Int("attempt", ss.registerAttempts),
+			zap.Stringer("backoff", backoff))
+		go func() {
+			select {
+			case <-time.After(backoff):
+				dispatcher.Dispatch(newRegisterSchedulerEvent())
+			case <-ss.scheduleStopChan:
+				// the scheduler is shutting down
+			}
+		}()
+	}
+}
+
+// returns the interval before the next registration retry, the initial
+// interval is doubled after each failed attempt, up to the max interval.
+func registerBackoff(attempts int) time.Duration {
+	configs := conf.GetSchedulerConf()
+	backoff := configs.RegisterRetryInitial
+	for i := 0; i < attempts && backoff < configs.RegisterRetryMax; i++ {
+		backoff *= 2
+	}
+	if backoff > configs.RegisterRetryMax {
+		backoff = configs.RegisterRetryMax
+	}
+	return backoff
+}
+
+// called when the core rejects a request because it has lost the RM registration,
+// e.g the core was restarted. The scheduler registers again and does a full recovery.
+func (ss *KubernetesShim) handleRMLost() {
+	if ss.GetSchedulerState() != events.States().Scheduler.Running {
+		// registering or recovering, the registration is not lost
+		return
+	}
+	// many requests may be rejected, only register once
+	if atomic.CompareAndSwapInt32(&ss.rmLost, 0, 1) {
+		log.Logger.Warn("scheduler core has lost the RM registration, registering again")
+		dispatcher.Dispatch(newRegisterSchedulerEvent())
 	}
 }
 
@@ -170,11 +258,21 @@ func (ss *KubernetesShim) recoverSchedulerState() func(e *fsm.Event) {
 
 func (ss *KubernetesShim) doScheduling() func(e *fsm.Event) {
 	return func(e *fsm.Event) {
+		if ss.schedulingStarted {
+			// registered again, informers don't notify about the pending pods again,
+			// they are submitted again from the informer cache
+			if err := ss.context.ResubmitPendingPods(); err != nil {
+				log.Logger.Error("failed to resubmit pending pods", zap.Error(err))
+			}
+			return
+		}
+		ss.schedulingStarted = true
+
 		// add event handlers to the context
 		ss.context.AddSchedulingEventHandlers()
 
 		// run main scheduling loop
-		go wait.Until(ss.schedule, conf.GetSchedulerConf().GetSchedulingInterval(), ss.stopChan)
+		go ss.scheduleLoop()
 	}
 }
 
@@ -201,6 +299,11 @@ func (ss *KubernetesShim) GetSchedulerState() string {
 	return ss.stateMachine.Current()
 }
 
+// returns the recorded state transitions of the scheduler, from the oldest to the latest
+func (ss *KubernetesShim) GetStateHistory() []events.StateTransition {
+	return ss.history.GetTransitions()
+}
+
 // event handling
 func (ss *KubernetesShim) handle(se events.SchedulerEvent) error {
 	ss.lock.Lock()
@@ -223,32 +326,149 @@ func (ss *KubernetesShim) canHandle(se events.SchedulerEvent) bool {
 	return ss.stateMachine.Can(string(se.GetEvent()))
 }
 
+// runs the schedule iterations until the scheduler stops, the interval is read from the
+// configuration before each iteration, so that it can be changed at runtime.
+func (ss *KubernetesShim) scheduleLoop() {
+	for {
+		ss.schedule()
+		select {
+		case <-ss.scheduleStopChan:
+			return
+		case <-time.After(conf.GetSchedulerConf().GetSchedulingInterval()):
+		}
+	}
+}
+
 // each schedule iteration, we scan all apps and triggers app state transition
 func (ss *KubernetesShim) schedule() {
+	if ss.GetSchedulerState() != events.States().Scheduler.Running {
+		// registering again, apps are scheduled once the recovery is done
+		return
+	}
 	apps := ss.context.SelectApplications(nil)
 	for _, app := range apps {
 		app.Schedule()
 	}
+	atomic.StoreInt64(&ss.lastScheduleTime, time.Now().UnixNano())
+}
+
+// the scheduler is ready to serve once it reaches the running state
+func (ss *KubernetesShim) checkReadiness() error {
+	if state := ss.GetSchedulerState(); state != events.States().Scheduler.Running {
+		return fmt.Errorf("scheduler is not running, current state: %s", state)
+	}
+	return nil
+}
+
+// the dispatcher is started when the scheduler runs and must not stop afterwards
+func (ss *KubernetesShim) checkDispatcher() error {
+	if !dispatcher.IsRunning() {
+		return fmt.Errorf("dispatcher is not running")
+	}
+	return nil
+}
+
+// the scheduling loop is started once the scheduler reaches the running state,
+// it must keep completing iterations within the stall threshold.
+func (ss *KubernetesShim) checkSchedulingLoop() error {
+	if ss.GetSchedulerState() != events.States().Scheduler.Running {
+		return nil
+	}
+	lastScheduleTime := atomic.LoadInt64(&ss.lastScheduleTime)
+	if lastScheduleTime == 0 {
+		// the first iteration may not be completed yet
+		return nil
+	}
+	threshold := scheduleStallIntervals * conf.GetSchedulerConf().GetSchedulingInterval()
+	if elapsed := time.Since(time.Unix(0, lastScheduleTime)); elapsed > threshold {
+		return fmt.Errorf("scheduling loop stalled, last iteration completed %s ago", elapsed)
+	}
+	return nil
+}
+
+// informers are synced during the recovery, the scheduler only gets
+// to the running state after that, they must stay synced since then.
+func (ss *KubernetesShim) checkInformers() error {
+	if ss.GetSchedulerState() != events.States().Scheduler.Running {
+		return nil
+	}
+	if !ss.context.InformersSynced() {
+		return fmt.Errorf("informers are not synced")
+	}
+	return nil
 }
 
 func (ss *KubernetesShim) run() {
+	ss.runStandby()
+	ss.activate()
+}
+
+// runs the dispatcher and the informers without registering to the scheduler core,
+// a standby scheduler keeps the informers warm so that it can take over quickly.
+func (ss *KubernetesShim) runStandby() {
 	// run dispatcher
 	dispatcher.Start()
 
-	// register scheduler with scheduler core
-	dispatcher.Dispatch(newRegisterSchedulerEvent())
-
 	// run context
 	ss.context.Run(ss.stopChan)
 }
 
+// registers scheduler with scheduler core, this triggers the register, recover and run
+// state transitions, it is called when the scheduler starts or takes over the leadership.
+func (ss *KubernetesShim) activate() {
+	log.Logger.Info("activating scheduler")
+	dispatcher.Dispatch(newRegisterSchedulerEvent())
+}
+
+// called when the scheduler loses the leadership, binding is disabled immediately
+// to avoid pods being bound by two schedulers, then the scheduler stops.
+func (ss *KubernetesShim) deactivate() {
+	log.Logger.Warn("deactivating scheduler, binding is disabled")
+	ss.context.DisableBinding()
+	ss.stop()
+}
+
+// stops the scheduler in order, this only takes effect on the first call.
+// First the scheduling loop and the dispatcher are stopped, so no new events are accepted.
+// Then it waits for the in-flight pod binds, volume binds and pod status updates, at most
+// the configured shutdown timeout. Last the informers are stopped and the scheduler moves
+// to the stopped state, the core has no API to deregister a RM, the registration is replaced
+// when a scheduler registers again.
 func (ss *KubernetesShim) stop() {
-	log.Logger.Info("stopping scheduler")
-	select {
-	case ss.stopChan <- struct{}{}:
-		// stop the dispatcher
+	ss.stopOnce.Do(func() {
+		log.Logger.Info("stopping scheduler")
+		ss.transition(events.DrainScheduler)
+
+		close(ss.scheduleStopChan)
+
+		// the in-flight operations dispatch events when they finish,
+		// the dispatcher keeps running until they are drained
+		if ss.context != nil {
+			timeout := conf.GetSchedulerConf().ShutdownTimeout
+			if err := ss.context.DrainAsyncOperations(timeout); err != nil {
+				log.Logger.Warn("in-flight operations are not finished before the shutdown timeout",
+					zap.Stringer("timeout", timeout),
+					zap.Error(err))
+			}
+		}
 		dispatcher.Stop()
-	default:
-		log.Logger.Info("scheduler is already stopped")
+
+		close(ss.stopChan)
+		ss.transition(events.StopScheduler)
+		events.CloseStateHistoryFile()
+		log.Logger.Info("scheduler stopped")
+	})
+}
+
+// moves the scheduler state synchronously, this is used when the dispatcher is stopped,
+// the transition is skipped if it is not allowed in the current state.
+func (ss *KubernetesShim) transition(event events.SchedulerEventType) {
+	se := ShimSchedulerEvent{event: event}
+	if ss.canHandle(se) {
+		if err := ss.handle(se); err != nil {
+			log.Logger.Warn("failed to handle scheduler event",
+				zap.String("event", string(event)),
+				zap.Error(err))
+		}
 	}
 }
@@ -43,6 +43,9 @@ const fakeClusterID = "test-cluster"
 const fakeClusterVersion = "0.1.0"
 const fakeClusterSchedulerName = "yunikorn-test"
 const fakeClusterSchedulingInterval = time.Second
+const fakeClusterShutdownTimeout = 10 * time.Second
+const fakeClusterRegisterRetryInitial = 100 * time.Millisecond
+const fakeClusterRegisterRetryMax = time.Second
 
 // fake cluster is used for testing
 // it uses fake kube client to simulate API calls with k8s, all other code paths are real
@@ -60,12 +63,15 @@ type MockScheduler struct {
 
 func (fc *MockScheduler) init(queues string) {
 	configs := conf.SchedulerConf{
-		ClusterID:      fakeClusterID,
-		ClusterVersion: fakeClusterVersion,
-		SchedulerName:  fakeClusterSchedulerName,
-		Interval:       fakeClusterSchedulingInterval,
-		KubeConfig:     "",
-		TestMode:       true,
+		ClusterID:            fakeClusterID,
+		ClusterVersion:       fakeClusterVersion,
+		SchedulerName:        fakeClusterSchedulerName,
+		Interval:             fakeClusterSchedulingInterval,
+		KubeConfig:           "",
+		TestMode:             true,
+		ShutdownTimeout:      fakeClusterShutdownTimeout,
+		RegisterRetryInitial: fakeClusterRegisterRetryInitial,
+		RegisterRetryMax:     fakeClusterRegisterRetryMax,
 	}
 
 	conf.Set(&configs)
@@ -126,9 +132,9 @@ func (fc *MockScheduler) addNode(nodeName string, memory, cpu int64) error {
 	return fc.proxy.Update(&request)
 }
 
-func (fc *MockScheduler) addTask(tid string, ask *si.Resource, app *cache.Application) cache.Task {
+func (fc *MockScheduler) addTask(tid string, ask *si.Resource, app *cache.Application) *cache.Task {
 	task := cache.CreateTaskForTest(tid, app, ask, fc.context)
-	app.AddTask(&task)
+	app.AddTask(task)
 	return task
 }
 
@@ -18,17 +18,22 @@ package main
 
 import (
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"go.uber.org/zap"
+	"gotest.tools/assert"
 	v1 "k8s.io/api/core/v1"
 
 	"github.com/cloudera/yunikorn-core/pkg/api"
 	"github.com/cloudera/yunikorn-k8shim/pkg/cache"
+	"github.com/cloudera/yunikorn-k8shim/pkg/callback"
 	"github.com/cloudera/yunikorn-k8shim/pkg/common"
 	"github.com/cloudera/yunikorn-k8shim/pkg/common/events"
 	"github.com/cloudera/yunikorn-k8shim/pkg/common/test"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/utils"
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
 	"github.com/cloudera/yunikorn-k8shim/pkg/log"
 	"github.com/cloudera/yunikorn-scheduler-interface/lib/go/si"
 )
@@ -146,6 +151,7 @@ partitions:
 func TestSchedulerRegistrationFailed(t *testing.T) {
 	var ctx *cache.Context
 	var callback api.ResourceManagerCallback
+	conf.Set(newRegisterRetryConf(2))
 
 	schedulerAPI := test.NewSchedulerAPIMock().RegisterFunction(
 		func(request *si.RegisterResourceManagerRequest,
@@ -160,6 +166,144 @@ func TestSchedulerRegistrationFailed(t *testing.T) {
 	if err := waitShimSchedulerState(shim, events.States().Scheduler.Stopped, 5*time.Second); err != nil {
 		t.Fatalf("%v", err)
 	}
+	// the scheduler stops after the first attempt and 2 retries
+	err := utils.WaitForCondition(func() bool {
+		return shim.GetSchedulerState() == events.States().Scheduler.Stopped &&
+			schedulerAPI.GetRegisterCount() == 3
+	}, 10*time.Millisecond, 5*time.Second)
+	assert.NilError(t, err)
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, schedulerAPI.GetRegisterCount(), int32(3))
+}
+
+func TestSchedulerRegistrationRetry(t *testing.T) {
+	configs := newRegisterRetryConf(0)
+	conf.Set(configs)
+
+	// the core is not available for the first 2 attempts
+	schedulerAPI := test.NewSchedulerAPIMock()
+	schedulerAPI.RegisterFunction(
+		func(request *si.RegisterResourceManagerRequest,
+			callback api.ResourceManagerCallback) (response *si.RegisterResourceManagerResponse, e error) {
+			if schedulerAPI.GetRegisterCount() <= 2 {
+				return nil, fmt.Errorf("scheduler core is not available")
+			}
+			return nil, nil
+		})
+	ctx := cache.NewContextInternal(schedulerAPI, configs, test.NewKubeClientMock(), true)
+	shim := newShimSchedulerInternal(schedulerAPI, ctx, callback.NewAsyncRMCallback(ctx))
+	shim.run()
+	defer shim.stop()
+
+	if err := waitShimSchedulerState(shim, events.States().Scheduler.Running, 5*time.Second); err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, schedulerAPI.GetRegisterCount(), int32(3))
+}
+
+func TestCoreProxyRMLost(t *testing.T) {
+	var updateErr error
+	schedulerAPI := test.NewSchedulerAPIMock().UpdateFunction(func(request *si.UpdateRequest) error {
+		return updateErr
+	})
+	var lost int
+	proxy := newCoreProxy(schedulerAPI)
+	proxy.setRMLostHandler(func() {
+		lost++
+	})
+	request := &si.UpdateRequest{RmID: "rm-1"}
+
+	// other errors are returned unchanged
+	for _, err := range []error{
+		fmt.Errorf("node not registered"),
+		fmt.Errorf("received UpdateRequest, but RmID=\"rm-2\" not registered"),
+	} {
+		updateErr = err
+		assert.Equal(t, proxy.Update(request), err)
+	}
+	assert.Equal(t, lost, 0)
+
+	updateErr = fmt.Errorf("received UpdateRequest, but RmID=\"rm-1\" not registered")
+	err := proxy.Update(request)
+	notRegistered, ok := err.(*rmNotRegisteredError)
+	assert.Assert(t, ok)
+	assert.Equal(t, notRegistered.rmID, "rm-1")
+	assert.Equal(t, err.Error(), updateErr.Error())
+	assert.Equal(t, lost, 1)
+
+	updateErr = nil
+	assert.NilError(t, proxy.Update(request))
+	assert.Equal(t, lost, 1)
+}
+
+func TestReRegisterWhenRMLost(t *testing.T) {
+	configs := newRegisterRetryConf(0)
+	conf.Set(configs)
+
+	// the core rejects updates until the RM is registered
+	var registered int32
+	schedulerAPI := test.NewSchedulerAPIMock()
+	schedulerAPI.RegisterFunction(
+		func(request *si.RegisterResourceManagerRequest,
+			callback api.ResourceManagerCallback) (response *si.RegisterResourceManagerResponse, e error) {
+			atomic.StoreInt32(&registered, 1)
+			return nil, nil
+		})
+	schedulerAPI.UpdateFunction(func(request *si.UpdateRequest) error {
+		if atomic.LoadInt32(&registered) == 0 {
+			return fmt.Errorf("received UpdateRequest, but RmID=\"%s\" not registered", request.RmID)
+		}
+		return nil
+	})
+
+	proxy := newCoreProxy(schedulerAPI)
+	ctx := cache.NewContextInternal(proxy, configs, test.NewKubeClientMock(), true)
+	shim := newShimSchedulerInternal(proxy, ctx, callback.NewAsyncRMCallback(ctx))
+	proxy.setRMLostHandler(shim.handleRMLost)
+	shim.run()
+	defer shim.stop()
+
+	if err := waitShimSchedulerState(shim, events.States().Scheduler.Running, 5*time.Second); err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, schedulerAPI.GetRegisterCount(), int32(1))
+
+	// the core restarts and loses the RM, the app submission is rejected
+	atomic.StoreInt32(&registered, 0)
+	app := cache.NewApplication("app0001", "root.a", "testuser", map[string]string{}, proxy)
+	ctx.AddApplication(app)
+
+	// the scheduler registers again and recovers from scratch
+	err := utils.WaitForCondition(func() bool {
+		return schedulerAPI.GetRegisterCount() == 2 &&
+			shim.GetSchedulerState() == events.States().Scheduler.Running
+	}, 10*time.Millisecond, 5*time.Second)
+	assert.NilError(t, err)
+	_, err = ctx.GetApplication("app0001")
+	assert.Assert(t, err != nil, "the context is not reset")
+
+	reRegistered := false
+	for _, transition := range shim.GetStateHistory() {
+		if transition.From == events.States().Scheduler.Running &&
+			transition.To == events.States().Scheduler.Registering {
+			reRegistered = true
+		}
+	}
+	assert.Assert(t, reRegistered, "no transition from running to registering")
+}
+
+func newRegisterRetryConf(maxRetries int) *conf.SchedulerConf {
+	return &conf.SchedulerConf{
+		ClusterID:            fakeClusterID,
+		ClusterVersion:       fakeClusterVersion,
+		SchedulerName:        fakeClusterSchedulerName,
+		Interval:             100 * time.Millisecond,
+		TestMode:             true,
+		ShutdownTimeout:      fakeClusterShutdownTimeout,
+		RegisterRetryInitial: 10 * time.Millisecond,
+		RegisterRetryMax:     100 * time.Millisecond,
+		RegisterMaxRetries:   maxRetries,
+	}
 }
 
 func TestTaskFailures(t *testing.T) {
@@ -247,3 +391,169 @@ func waitShimSchedulerState(shim *KubernetesShim, expectedState string, timeout
 		}
 	}
 }
+
+func TestSchedulerHealthChecks(t *testing.T) {
+	configData := `
+partitions:
+  - name: default
+    queues:
+      - name: root
+        submitacl: "*"
+        queues:
+          - name: a
+`
+	cluster := MockScheduler{}
+	cluster.init(configData)
+	ss := cluster.scheduler
+
+	// not started yet
+	assert.Assert(t, ss.checkReadiness() != nil)
+	assert.Assert(t, ss.checkDispatcher() != nil)
+	assert.NilError(t, ss.checkSchedulingLoop())
+	assert.NilError(t, ss.checkInformers())
+
+	// pretend the scheduler is running without the scheduling loop
+	ss.stateMachine.SetState(events.States().Scheduler.Running)
+	atomic.StoreInt64(&ss.lastScheduleTime, time.Now().UnixNano())
+	assert.NilError(t, ss.checkSchedulingLoop())
+	atomic.StoreInt64(&ss.lastScheduleTime,
+		time.Now().Add(-2*scheduleStallIntervals*fakeClusterSchedulingInterval).UnixNano())
+	assert.Assert(t, ss.checkSchedulingLoop() != nil)
+	ss.stateMachine.SetState(events.States().Scheduler.New)
+	atomic.StoreInt64(&ss.lastScheduleTime, 0)
+
+	cluster.start()
+	defer cluster.stop()
+	cluster.waitForSchedulerState(t, events.States().Scheduler.Running)
+	assert.NilError(t, ss.checkReadiness())
+	assert.NilError(t, ss.checkDispatcher())
+	assert.NilError(t, ss.checkInformers())
+
+	// the scheduling loop completes iterations
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&ss.lastScheduleTime) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for a scheduling iteration")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.NilError(t, ss.checkSchedulingLoop())
+}
+
+func TestStandbyAndTakeover(t *testing.T) {
+	configData := `
+partitions:
+  - name: default
+    queues:
+      - name: root
+        submitacl: "*"
+        queues:
+          - name: a
+            resources:
+              guaranteed:
+                memory: 100
+                vcore: 10
+              max:
+                memory: 150
+                vcore: 20
+`
+	var bindCount int32
+	cluster := MockScheduler{}
+	cluster.bindFn = func(pod *v1.Pod, hostID string) error {
+		atomic.AddInt32(&bindCount, 1)
+		return nil
+	}
+	cluster.init(configData)
+	defer cluster.stop()
+
+	// a standby scheduler does not register to the core
+	cluster.scheduler.runStandby()
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, cluster.scheduler.GetSchedulerState(), events.States().Scheduler.New)
+
+	// take over the leadership
+	cluster.scheduler.activate()
+	cluster.waitForSchedulerState(t, events.States().Scheduler.Running)
+
+	// once the leadership is lost, allocated pods are no longer bound
+	cluster.context.DisableBinding()
+	if err := cluster.addNode("test.host.01", 100, 10); err != nil {
+		t.Fatalf("add node failed %v", err)
+	}
+	app0001 := cluster.newApplication("app0001", "root.a")
+	taskResource := common.NewResourceBuilder().
+		AddResource(common.Memory, 10).
+		AddResource(common.CPU, 1).
+		Build()
+	cluster.addTask("task0001", taskResource, app0001)
+	cluster.addApplication(app0001)
+	cluster.waitAndAssertTaskState(t, "app0001", "task0001", events.States().Task.Allocated)
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, atomic.LoadInt32(&bindCount), int32(0))
+	// the reservation of the pod is reverted
+	assert.Equal(t, len(cluster.context.GetSchedulerCache().GetAssumedPods()), 0)
+	cluster.waitAndAssertTaskState(t, "app0001", "task0001", events.States().Task.Allocated)
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	configData := `
+partitions:
+  - name: default
+    queues:
+      - name: root
+        submitacl: "*"
+        queues:
+          - name: a
+            resources:
+              guaranteed:
+                memory: 100
+                vcore: 10
+              max:
+                memory: 150
+                vcore: 20
+`
+	var bindStarted, bindCompleted int32
+	cluster := MockScheduler{}
+	cluster.bindFn = func(pod *v1.Pod, hostID string) error {
+		// a slow bind, the shutdown must wait for it
+		atomic.AddInt32(&bindStarted, 1)
+		time.Sleep(2 * time.Second)
+		atomic.AddInt32(&bindCompleted, 1)
+		return nil
+	}
+	cluster.init(configData)
+	cluster.start()
+	cluster.waitForSchedulerState(t, events.States().Scheduler.Running)
+
+	if err := cluster.addNode("test.host.01", 100, 10); err != nil {
+		t.Fatalf("add node failed %v", err)
+	}
+	app0001 := cluster.newApplication("app0001", "root.a")
+	taskResource := common.NewResourceBuilder().
+		AddResource(common.Memory, 10).
+		AddResource(common.CPU, 1).
+		Build()
+	cluster.addTask("task0001", taskResource, app0001)
+	cluster.addApplication(app0001)
+	cluster.waitAndAssertTaskState(t, "app0001", "task0001", events.States().Task.Allocated)
+
+	// wait until the bind is in-flight
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&bindStarted) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the bind to start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, atomic.LoadInt32(&bindCompleted), int32(0))
+
+	// the shutdown returns after the in-flight bind is completed
+	cluster.stop()
+	assert.Equal(t, atomic.LoadInt32(&bindCompleted), int32(1))
+	assert.Equal(t, cluster.scheduler.GetSchedulerState(), events.States().Scheduler.Stopped)
+	assert.Assert(t, cluster.scheduler.checkDispatcher() != nil)
+
+	// stop again is a no-op
+	cluster.scheduler.stop()
+	assert.Equal(t, cluster.scheduler.GetSchedulerState(), events.States().Scheduler.Stopped)
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dao
+
+import (
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/events"
+)
+
+type ApplicationsDAOInfo struct {
+	Applications []ApplicationDAOInfo `json:"applications"`
+}
+
+type ApplicationDAOInfo struct {
+	ApplicationID string                   `json:"applicationID"`
+	QueueName     string                   `json:"queueName"`
+	Partition     string                   `json:"partition"`
+	User          string                   `json:"user"`
+	State         string                   `json:"applicationState"`
+	Tasks         []TaskDAOInfo            `json:"tasks"`
+	StateHistory  []events.StateTransition `json:"stateHistory,omitempty"`
+}
+
+type TaskDAOInfo struct {
+	TaskID         string                   `json:"taskID"`
+	ApplicationID  string                   `json:"applicationID"`
+	State          string                   `json:"taskState"`
+	PodName        string                   `json:"podName,omitempty"`
+	PodNamespace   string                   `json:"podNamespace,omitempty"`
+	PodUID         string                   `json:"podUID,omitempty"`
+	NodeName       string                   `json:"nodeName,omitempty"`
+	AllocationUUID string                   `json:"allocationUUID,omitempty"`
+	StateHistory   []events.StateTransition `json:"stateHistory,omitempty"`
+}
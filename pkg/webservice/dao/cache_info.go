@@ -0,0 +1,41 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dao
+
+type AssumedPodsDAOInfo struct {
+	AssumedPods []AssumedPodDAOInfo `json:"assumedPods"`
+}
+
+type AssumedPodDAOInfo struct {
+	PodKey          string `json:"podKey"`
+	PodName         string `json:"podName,omitempty"`
+	PodNamespace    string `json:"podNamespace,omitempty"`
+	NodeName        string `json:"nodeName,omitempty"`
+	AllVolumesBound bool   `json:"allVolumesBound"`
+}
+
+type CacheConsistencyDAOInfo struct {
+	Consistent       bool     `json:"consistent"`
+	Healed           bool     `json:"healed"`
+	MissingPods      []string `json:"missingPods"`
+	StaleAssumedPods []string `json:"staleAssumedPods"`
+	RedundantPods    []string `json:"redundantPods"`
+	OrphanTasks      []string `json:"orphanTasks"`
+	MissingNodes     []string `json:"missingNodes"`
+	StaleNodes       []string `json:"staleNodes"`
+	RedundantNodes   []string `json:"redundantNodes"`
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dao
+
+import "time"
+
+type TaskDiagnosticsDAOInfo struct {
+	TaskID         string                   `json:"taskID"`
+	ApplicationID  string                   `json:"applicationID"`
+	State          string                   `json:"taskState"`
+	PodName        string                   `json:"podName,omitempty"`
+	PodNamespace   string                   `json:"podNamespace,omitempty"`
+	Message        string                   `json:"message"`
+	TotalNodes     int                      `json:"totalNodes"`
+	AvailableNodes int                      `json:"availableNodes"`
+	Reasons        []ReasonCountDAOInfo     `json:"reasons"`
+	Nodes          []NodeDiagnosticsDAOInfo `json:"nodes"`
+	LastUpdated    *time.Time               `json:"lastUpdated,omitempty"`
+}
+
+type ReasonCountDAOInfo struct {
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+type NodeDiagnosticsDAOInfo struct {
+	NodeName string   `json:"nodeName"`
+	Fit      bool     `json:"fit"`
+	Reasons  []string `json:"reasons,omitempty"`
+}
@@ -0,0 +1,33 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dao
+
+type LogLevelDAOInfo struct {
+	Level      string                     `json:"level"`
+	Components []ComponentLogLevelDAOInfo `json:"components"`
+}
+
+type ComponentLogLevelDAOInfo struct {
+	Name       string `json:"name"`
+	Level      string `json:"level"`
+	Overridden bool   `json:"overridden"`
+}
+
+// payload to change a log level, e.g {"level": "debug"}
+type LogLevelUpdateDAOInfo struct {
+	Level string `json:"level"`
+}
@@ -0,0 +1,35 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dao
+
+import (
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/events"
+)
+
+type NodesDAOInfo struct {
+	Nodes []NodeDAOInfo `json:"nodes"`
+}
+
+type NodeDAOInfo struct {
+	NodeName            string                   `json:"nodeName"`
+	NodeUID             string                   `json:"nodeUID"`
+	State               string                   `json:"nodeState"`
+	Schedulable         bool                     `json:"schedulable"`
+	Capacity            map[string]int64         `json:"capacity"`
+	ExistingAllocations int                      `json:"existingAllocations"`
+	StateHistory        []events.StateTransition `json:"stateHistory,omitempty"`
+}
@@ -0,0 +1,433 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/cache"
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+	"github.com/cloudera/yunikorn-k8shim/pkg/webservice/dao"
+)
+
+func GetApplicationsInfo(w http.ResponseWriter, r *http.Request) {
+	apps := gContext.SelectApplications(nil)
+	sort.Slice(apps, func(i, j int) bool {
+		return apps[i].GetApplicationID() < apps[j].GetApplicationID()
+	})
+
+	appsDao := dao.ApplicationsDAOInfo{
+		Applications: make([]dao.ApplicationDAOInfo, 0, len(apps)),
+	}
+	for _, app := range apps {
+		appsDao.Applications = append(appsDao.Applications, *getApplicationJSON(app, false))
+	}
+
+	writeHeaders(w)
+	writeJSON(w, appsDao)
+}
+
+func GetApplicationInfo(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	app, err := gContext.GetApplication(vars["appID"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeHeaders(w)
+	writeJSON(w, getApplicationJSON(app, true))
+}
+
+func GetTaskInfo(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	task, err := gContext.GetTask(vars["appID"], vars["taskID"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeHeaders(w)
+	writeJSON(w, getTaskJSON(task, true))
+}
+
+func GetTaskDiagnostics(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	task, err := gContext.GetTask(vars["appID"], vars["taskID"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeHeaders(w)
+	writeJSON(w, getTaskDiagnosticsJSON(task))
+}
+
+func GetNodesInfo(w http.ResponseWriter, r *http.Request) {
+	nodes := gContext.SelectNodes(nil)
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].GetNodeName() < nodes[j].GetNodeName()
+	})
+
+	nodesDao := dao.NodesDAOInfo{
+		Nodes: make([]dao.NodeDAOInfo, 0, len(nodes)),
+	}
+	for _, node := range nodes {
+		nodesDao.Nodes = append(nodesDao.Nodes, *getNodeJSON(node))
+	}
+
+	writeHeaders(w)
+	writeJSON(w, nodesDao)
+}
+
+func GetAssumedPodsInfo(w http.ResponseWriter, r *http.Request) {
+	schedulerCache := gContext.GetSchedulerCache()
+	assumedPods := schedulerCache.GetAssumedPods()
+	keys := make([]string, 0, len(assumedPods))
+	for key := range assumedPods {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	podsDao := dao.AssumedPodsDAOInfo{
+		AssumedPods: make([]dao.AssumedPodDAOInfo, 0, len(keys)),
+	}
+	for _, key := range keys {
+		podDao := dao.AssumedPodDAOInfo{
+			PodKey:          key,
+			AllVolumesBound: assumedPods[key],
+		}
+		// the pod could be removed from the cache in the meantime
+		if pod, ok := schedulerCache.GetPod(key); ok {
+			podDao.PodName = pod.Name
+			podDao.PodNamespace = pod.Namespace
+			podDao.NodeName = pod.Spec.NodeName
+		}
+		podsDao.AssumedPods = append(podsDao.AssumedPods, podDao)
+	}
+
+	writeHeaders(w)
+	writeJSON(w, podsDao)
+}
+
+func GetCacheConsistency(w http.ResponseWriter, r *http.Request) {
+	writeCacheConsistency(w, false)
+}
+
+func HealCacheConsistency(w http.ResponseWriter, r *http.Request) {
+	writeCacheConsistency(w, true)
+}
+
+func writeCacheConsistency(w http.ResponseWriter, heal bool) {
+	inconsistencies, err := gContext.CompareCache()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	consistencyDao := getCacheConsistencyJSON(inconsistencies)
+	if heal && !inconsistencies.IsConsistent() {
+		gContext.HealCache(inconsistencies)
+		consistencyDao.Healed = true
+	}
+
+	writeHeaders(w)
+	writeJSON(w, consistencyDao)
+}
+
+func GetConfigInfo(w http.ResponseWriter, r *http.Request) {
+	configDao := dao.ConfigDAOInfo{
+		Config:     conf.GetSchedulerConf(),
+		LastReload: conf.GetLastReloadResult(),
+	}
+
+	writeHeaders(w)
+	writeJSON(w, configDao)
+}
+
+func GetLogLevels(w http.ResponseWriter, r *http.Request) {
+	writeHeaders(w)
+	writeJSON(w, getLogLevelsJSON())
+}
+
+// sets the level of the root logger, the components which are not overridden follow it
+func SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	level, err := readLogLevel(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.SetLevel(level)
+	log.Logger.Info("logging level is changed",
+		zap.Stringer("level", level))
+
+	writeHeaders(w)
+	writeJSON(w, getLogLevelsJSON())
+}
+
+func SetComponentLogLevel(w http.ResponseWriter, r *http.Request) {
+	level, err := readLogLevel(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	component := mux.Vars(r)["component"]
+	if err = log.SetComponentLevel(component, level); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.Logger.Info("logging level of the component is changed",
+		zap.String("component", component),
+		zap.Stringer("level", level))
+
+	writeHeaders(w)
+	writeJSON(w, getLogLevelsJSON())
+}
+
+// the component follows the level of the root logger again
+func ResetComponentLogLevel(w http.ResponseWriter, r *http.Request) {
+	component := mux.Vars(r)["component"]
+	if err := log.ResetComponentLevel(component); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeHeaders(w)
+	writeJSON(w, getLogLevelsJSON())
+}
+
+func readLogLevel(r *http.Request) (zapcore.Level, error) {
+	var update dao.LogLevelUpdateDAOInfo
+	var level zapcore.Level
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		return level, fmt.Errorf("invalid request body: %v", err)
+	}
+	if err := level.UnmarshalText([]byte(update.Level)); err != nil {
+		return level, err
+	}
+	return level, nil
+}
+
+func getLogLevelsJSON() *dao.LogLevelDAOInfo {
+	components := log.GetComponentLevels()
+	levelsDao := &dao.LogLevelDAOInfo{
+		Level:      log.GetLevel().String(),
+		Components: make([]dao.ComponentLogLevelDAOInfo, 0, len(components)),
+	}
+	for _, component := range components {
+		levelsDao.Components = append(levelsDao.Components, dao.ComponentLogLevelDAOInfo{
+			Name:       component.Name,
+			Level:      component.Level.String(),
+			Overridden: component.Overridden,
+		})
+	}
+	return levelsDao
+}
+
+func GetLiveness(w http.ResponseWriter, r *http.Request) {
+	writeHealthInfo(w, gLivenessChecks)
+}
+
+func GetReadiness(w http.ResponseWriter, r *http.Request) {
+	writeHealthInfo(w, gReadinessChecks)
+}
+
+// runs all the checks, responds 503 if any of them fails
+func writeHealthInfo(w http.ResponseWriter, checks []HealthCheck) {
+	healthDao := dao.HealthDAOInfo{
+		Healthy: true,
+		Checks:  make([]dao.HealthCheckDAOInfo, 0, len(checks)),
+	}
+	for _, check := range checks {
+		checkDao := dao.HealthCheckDAOInfo{
+			Name:    check.Name,
+			Healthy: true,
+		}
+		if err := check.Check(); err != nil {
+			checkDao.Healthy = false
+			checkDao.Message = err.Error()
+			healthDao.Healthy = false
+		}
+		healthDao.Checks = append(healthDao.Checks, checkDao)
+	}
+
+	if !healthDao.Healthy {
+		log.Logger.Warn("health check failed", zap.Any("checks", healthDao.Checks))
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		writeHeaders(w)
+	}
+	writeJSON(w, healthDao)
+}
+
+func getApplicationJSON(app *cache.Application, withHistory bool) *dao.ApplicationDAOInfo {
+	tasks := app.GetAllTasks()
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].GetTaskID() < tasks[j].GetTaskID()
+	})
+
+	appDao := &dao.ApplicationDAOInfo{
+		ApplicationID: app.GetApplicationID(),
+		QueueName:     app.GetQueue(),
+		Partition:     app.GetPartition(),
+		User:          app.GetUser(),
+		State:         app.GetApplicationState(),
+		Tasks:         make([]dao.TaskDAOInfo, 0, len(tasks)),
+	}
+	for _, task := range tasks {
+		appDao.Tasks = append(appDao.Tasks, *getTaskJSON(task, false))
+	}
+	if withHistory {
+		appDao.StateHistory = app.GetStateHistory()
+	}
+	return appDao
+}
+
+func getTaskJSON(task *cache.Task, withHistory bool) *dao.TaskDAOInfo {
+	taskDao := &dao.TaskDAOInfo{
+		TaskID:         task.GetTaskID(),
+		ApplicationID:  task.GetApplicationID(),
+		State:          task.GetTaskState(),
+		NodeName:       task.GetNodeName(),
+		AllocationUUID: task.GetAllocationUUID(),
+	}
+	if pod := task.GetTaskPod(); pod != nil {
+		taskDao.PodName = pod.Name
+		taskDao.PodNamespace = pod.Namespace
+		taskDao.PodUID = string(pod.UID)
+	}
+	if withHistory {
+		taskDao.StateHistory = task.GetStateHistory()
+	}
+	return taskDao
+}
+
+func getTaskDiagnosticsJSON(task *cache.Task) *dao.TaskDiagnosticsDAOInfo {
+	diagnosticsDao := &dao.TaskDiagnosticsDAOInfo{
+		TaskID:        task.GetTaskID(),
+		ApplicationID: task.GetApplicationID(),
+		State:         task.GetTaskState(),
+		Message:       gContext.GetPendingMessage(task),
+		Reasons:       make([]dao.ReasonCountDAOInfo, 0),
+		Nodes:         make([]dao.NodeDiagnosticsDAOInfo, 0),
+	}
+	if pod := task.GetTaskPod(); pod != nil {
+		diagnosticsDao.PodName = pod.Name
+		diagnosticsDao.PodNamespace = pod.Namespace
+	}
+	diagnosis, ok := gContext.GetPodDiagnosis(task.GetTaskID())
+	if !ok {
+		return diagnosticsDao
+	}
+	diagnosticsDao.TotalNodes = diagnosis.TotalNodes
+	diagnosticsDao.AvailableNodes = diagnosis.AvailableNodes
+	diagnosticsDao.LastUpdated = &diagnosis.Updated
+	for _, reason := range diagnosis.Reasons {
+		diagnosticsDao.Reasons = append(diagnosticsDao.Reasons, dao.ReasonCountDAOInfo{
+			Reason: reason.Reason,
+			Count:  reason.Count,
+		})
+	}
+	nodes := make([]string, 0, len(diagnosis.Nodes))
+	for node := range diagnosis.Nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		diagnosticsDao.Nodes = append(diagnosticsDao.Nodes, dao.NodeDiagnosticsDAOInfo{
+			NodeName: node,
+			Fit:      len(diagnosis.Nodes[node]) == 0,
+			Reasons:  diagnosis.Nodes[node],
+		})
+	}
+	return diagnosticsDao
+}
+
+func getNodeJSON(node *cache.SchedulerNode) *dao.NodeDAOInfo {
+	capacity := make(map[string]int64)
+	if resource := node.GetCapacity(); resource != nil {
+		for name, quantity := range resource.Resources {
+			capacity[name] = quantity.GetValue()
+		}
+	}
+	return &dao.NodeDAOInfo{
+		NodeName:            node.GetNodeName(),
+		NodeUID:             node.GetNodeUID(),
+		State:               node.GetNodeState(),
+		Schedulable:         node.IsSchedulable(),
+		Capacity:            capacity,
+		ExistingAllocations: len(node.GetExistingAllocations()),
+		StateHistory:        node.GetStateHistory(),
+	}
+}
+
+func getCacheConsistencyJSON(inconsistencies *cache.CacheInconsistencies) *dao.CacheConsistencyDAOInfo {
+	podNames := func(pods []*v1.Pod) []string {
+		names := make([]string, 0, len(pods))
+		for _, pod := range pods {
+			names = append(names, fmt.Sprintf("%s/%s", pod.Namespace, pod.Name))
+		}
+		sort.Strings(names)
+		return names
+	}
+	nodeNames := func(nodes []*v1.Node) []string {
+		names := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			names = append(names, node.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	taskNames := make([]string, 0, len(inconsistencies.OrphanTasks))
+	for _, task := range inconsistencies.OrphanTasks {
+		taskNames = append(taskNames, fmt.Sprintf("%s/%s", task.GetApplicationID(), task.GetTaskID()))
+	}
+	sort.Strings(taskNames)
+	return &dao.CacheConsistencyDAOInfo{
+		Consistent:       inconsistencies.IsConsistent(),
+		MissingPods:      podNames(inconsistencies.MissingPods),
+		StaleAssumedPods: podNames(inconsistencies.StaleAssumedPods),
+		RedundantPods:    podNames(inconsistencies.RedundantPods),
+		OrphanTasks:      taskNames,
+		MissingNodes:     nodeNames(inconsistencies.MissingNodes),
+		StaleNodes:       nodeNames(inconsistencies.StaleNodes),
+		RedundantNodes:   nodeNames(inconsistencies.RedundantNodes),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, obj interface{}) {
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		log.Logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+func writeHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Allow-Headers", "X-Requested-With,Content-Type,Accept,Origin")
+	w.WriteHeader(http.StatusOK)
+}
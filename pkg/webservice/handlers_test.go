@@ -0,0 +1,389 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+	"gotest.tools/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	apis "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/cache"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/events"
+	"github.com/cloudera/yunikorn-k8shim/pkg/common/test"
+	"github.com/cloudera/yunikorn-k8shim/pkg/conf"
+	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+	"github.com/cloudera/yunikorn-k8shim/pkg/webservice/dao"
+)
+
+func initTestContext() *cache.Context {
+	configs := &conf.SchedulerConf{
+		ClusterID: "test-cluster",
+		TestMode:  true,
+	}
+	conf.Set(configs)
+	ctx := cache.NewContextInternal(test.NewSchedulerAPIMock(), configs, test.NewKubeClientMock(), true)
+	NewWebApp(ctx, conf.DefaultWebServicePort)
+	return ctx
+}
+
+func serve(t *testing.T, url string) *httptest.ResponseRecorder {
+	return serveRequest(t, "GET", url, "")
+}
+
+func serveRequest(t *testing.T, method string, url string, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.NilError(t, err)
+	req.RemoteAddr = "127.0.0.1:40000"
+	rr := httptest.NewRecorder()
+	NewRouter().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestGetApplicationsInfo(t *testing.T) {
+	ctx := initTestContext()
+	app01 := cache.NewApplication("app01", "root.a", "user01", map[string]string{}, test.NewSchedulerAPIMock())
+	app02 := cache.NewApplication("app02", "root.b", "user02", map[string]string{}, test.NewSchedulerAPIMock())
+	task01 := cache.CreateTaskForTest("task01", app01, common.NewResourceBuilder().Build(), ctx)
+	task02 := cache.CreateTaskForTest("task02", app01, common.NewResourceBuilder().Build(), ctx)
+	app01.AddTask(task01)
+	app01.AddTask(task02)
+	ctx.AddApplication(app02)
+	ctx.AddApplication(app01)
+
+	rr := serve(t, "/ws/v1/apps")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, rr.Header().Get("Content-Type"), "application/json; charset=UTF-8")
+
+	var appsDao dao.ApplicationsDAOInfo
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &appsDao))
+	assert.Equal(t, len(appsDao.Applications), 2)
+	assert.Equal(t, appsDao.Applications[0].ApplicationID, "app01")
+	assert.Equal(t, appsDao.Applications[0].QueueName, "root.a")
+	assert.Equal(t, appsDao.Applications[0].User, "user01")
+	assert.Equal(t, appsDao.Applications[0].Partition, common.DefaultPartition)
+	assert.Equal(t, appsDao.Applications[0].State, events.States().Application.New)
+	assert.Equal(t, len(appsDao.Applications[0].Tasks), 2)
+	assert.Equal(t, appsDao.Applications[0].Tasks[0].TaskID, "task01")
+	assert.Equal(t, appsDao.Applications[0].Tasks[0].State, events.States().Task.New)
+	assert.Equal(t, appsDao.Applications[0].Tasks[1].TaskID, "task02")
+	assert.Equal(t, appsDao.Applications[1].ApplicationID, "app02")
+	assert.Equal(t, len(appsDao.Applications[1].Tasks), 0)
+}
+
+func TestGetApplicationInfo(t *testing.T) {
+	ctx := initTestContext()
+	app01 := cache.NewApplication("app01", "root.a", "user01", map[string]string{}, test.NewSchedulerAPIMock())
+	task01 := cache.CreateTaskForTest("task01", app01, common.NewResourceBuilder().Build(), ctx)
+	app01.AddTask(task01)
+	ctx.AddApplication(app01)
+
+	rr := serve(t, "/ws/v1/apps/app01")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	var appDao dao.ApplicationDAOInfo
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &appDao))
+	assert.Equal(t, appDao.ApplicationID, "app01")
+	assert.Equal(t, len(appDao.Tasks), 1)
+	assert.Equal(t, appDao.Tasks[0].PodName, "task01")
+
+	// unknown application
+	rr = serve(t, "/ws/v1/apps/app02")
+	assert.Equal(t, rr.Code, http.StatusNotFound)
+}
+
+func TestGetTaskInfo(t *testing.T) {
+	ctx := initTestContext()
+	app01 := cache.NewApplication("app01", "root.a", "user01", map[string]string{}, test.NewSchedulerAPIMock())
+	task01 := cache.CreateTaskForTest("task01", app01, common.NewResourceBuilder().Build(), ctx)
+	app01.AddTask(task01)
+	ctx.AddApplication(app01)
+
+	rr := serve(t, "/ws/v1/apps/app01/tasks/task01")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	var taskDao dao.TaskDAOInfo
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &taskDao))
+	assert.Equal(t, taskDao.TaskID, "task01")
+	assert.Equal(t, taskDao.ApplicationID, "app01")
+	assert.Equal(t, taskDao.State, events.States().Task.New)
+	assert.Equal(t, taskDao.PodName, "task01")
+	// not allocated yet
+	assert.Equal(t, taskDao.NodeName, "")
+	assert.Equal(t, taskDao.AllocationUUID, "")
+
+	// unknown task
+	rr = serve(t, "/ws/v1/apps/app01/tasks/task02")
+	assert.Equal(t, rr.Code, http.StatusNotFound)
+	// unknown application
+	rr = serve(t, "/ws/v1/apps/app02/tasks/task01")
+	assert.Equal(t, rr.Code, http.StatusNotFound)
+}
+
+func TestGetTaskDiagnostics(t *testing.T) {
+	ctx := initTestContext()
+	app01 := cache.NewApplication("app01", "root.a", "user01", map[string]string{}, test.NewSchedulerAPIMock())
+	task01 := cache.CreateTaskForTest("task01", app01, common.NewResourceBuilder().Build(), ctx)
+	app01.AddTask(task01)
+	ctx.AddApplication(app01)
+
+	rr := serve(t, "/ws/v1/apps/app01/tasks/task01/diagnostics")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	var diagnosticsDao dao.TaskDiagnosticsDAOInfo
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &diagnosticsDao))
+	assert.Equal(t, diagnosticsDao.TaskID, "task01")
+	assert.Equal(t, diagnosticsDao.ApplicationID, "app01")
+	assert.Equal(t, diagnosticsDao.PodName, "task01")
+	assert.Equal(t, diagnosticsDao.Message,
+		"application \"app01\" in queue \"root.a\" is New: waiting for resources from the queue")
+	// no nodes checked yet
+	assert.Equal(t, diagnosticsDao.TotalNodes, 0)
+	assert.Equal(t, len(diagnosticsDao.Reasons), 0)
+	assert.Equal(t, len(diagnosticsDao.Nodes), 0)
+	assert.Assert(t, diagnosticsDao.LastUpdated == nil)
+
+	// unknown task
+	rr = serve(t, "/ws/v1/apps/app01/tasks/task02/diagnostics")
+	assert.Equal(t, rr.Code, http.StatusNotFound)
+}
+
+func TestGetNodesInfo(t *testing.T) {
+	ctx := initTestContext()
+	resourceList := make(map[v1.ResourceName]resource.Quantity)
+	resourceList[v1.ResourceName("memory")] = *resource.NewQuantity(1024*1000*1000, resource.DecimalSI)
+	resourceList[v1.ResourceName("cpu")] = *resource.NewQuantity(10, resource.DecimalSI)
+	ctx.AddNode(&v1.Node{
+		ObjectMeta: apis.ObjectMeta{
+			Name:      "host0001",
+			Namespace: "default",
+			UID:       "uid_0001",
+		},
+		Status: v1.NodeStatus{
+			Capacity: resourceList,
+		},
+	})
+
+	rr := serve(t, "/ws/v1/nodes")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	var nodesDao dao.NodesDAOInfo
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &nodesDao))
+	assert.Equal(t, len(nodesDao.Nodes), 1)
+	assert.Equal(t, nodesDao.Nodes[0].NodeName, "host0001")
+	assert.Equal(t, nodesDao.Nodes[0].NodeUID, "uid_0001")
+	assert.Equal(t, nodesDao.Nodes[0].State, events.States().Node.New)
+	assert.Equal(t, nodesDao.Nodes[0].Schedulable, true)
+	assert.Equal(t, nodesDao.Nodes[0].Capacity[common.Memory], int64(1024))
+	assert.Equal(t, nodesDao.Nodes[0].Capacity[common.CPU], int64(10000))
+}
+
+func TestGetAssumedPodsInfo(t *testing.T) {
+	ctx := initTestContext()
+	pod := &v1.Pod{
+		ObjectMeta: apis.ObjectMeta{
+			Name:      "pod01",
+			Namespace: "default",
+			UID:       "UID-00001",
+		},
+		Spec: v1.PodSpec{
+			NodeName: "host0001",
+		},
+	}
+	assert.NilError(t, ctx.GetSchedulerCache().AssumePod(pod, true))
+
+	rr := serve(t, "/ws/v1/cache/assumedpods")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	var podsDao dao.AssumedPodsDAOInfo
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &podsDao))
+	assert.Equal(t, len(podsDao.AssumedPods), 1)
+	assert.Equal(t, podsDao.AssumedPods[0].PodKey, "UID-00001")
+	assert.Equal(t, podsDao.AssumedPods[0].PodName, "pod01")
+	assert.Equal(t, podsDao.AssumedPods[0].PodNamespace, "default")
+	assert.Equal(t, podsDao.AssumedPods[0].NodeName, "host0001")
+	assert.Equal(t, podsDao.AssumedPods[0].AllVolumesBound, true)
+}
+
+func TestCacheConsistency(t *testing.T) {
+	ctx := initTestContext()
+	rr := serve(t, "/ws/v1/cache/consistency")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	var consistencyDao dao.CacheConsistencyDAOInfo
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &consistencyDao))
+	assert.Assert(t, consistencyDao.Consistent)
+
+	// the pod of the assumed pod is not known by the informer
+	pod := &v1.Pod{
+		ObjectMeta: apis.ObjectMeta{
+			Name:      "pod01",
+			Namespace: "default",
+			UID:       "UID-00001",
+		},
+		Spec: v1.PodSpec{
+			NodeName: "host0001",
+		},
+	}
+	assert.NilError(t, ctx.GetSchedulerCache().AssumePod(pod, true))
+	rr = serve(t, "/ws/v1/cache/consistency")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &consistencyDao))
+	assert.Assert(t, !consistencyDao.Consistent)
+	assert.Assert(t, !consistencyDao.Healed)
+	assert.DeepEqual(t, consistencyDao.StaleAssumedPods, []string{"default/pod01"})
+	assert.Equal(t, len(ctx.GetSchedulerCache().GetAssumedPods()), 1)
+
+	// the stale assumed pod is forgotten
+	rr = serveRequest(t, "PUT", "/ws/v1/cache/consistency", "")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &consistencyDao))
+	assert.Assert(t, consistencyDao.Healed)
+	assert.DeepEqual(t, consistencyDao.StaleAssumedPods, []string{"default/pod01"})
+	assert.Equal(t, len(ctx.GetSchedulerCache().GetAssumedPods()), 0)
+
+	rr = serve(t, "/ws/v1/cache/consistency")
+	consistencyDao = dao.CacheConsistencyDAOInfo{}
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &consistencyDao))
+	assert.Assert(t, consistencyDao.Consistent)
+}
+
+func TestHealthChecks(t *testing.T) {
+	initTestContext()
+	webApp := NewWebApp(nil, conf.DefaultWebServicePort)
+
+	// no checks registered
+	rr := serve(t, "/ws/v1/health/liveness")
+	assert.Equal(t, rr.Code, http.StatusOK)
+
+	running := false
+	webApp.AddReadinessCheck("scheduler", func() error {
+		if !running {
+			return fmt.Errorf("scheduler is not running")
+		}
+		return nil
+	})
+	webApp.AddLivenessCheck("dispatcher", func() error {
+		return nil
+	})
+
+	rr = serve(t, "/ws/v1/health/readiness")
+	assert.Equal(t, rr.Code, http.StatusServiceUnavailable)
+	var healthDao dao.HealthDAOInfo
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &healthDao))
+	assert.Equal(t, healthDao.Healthy, false)
+	assert.Equal(t, len(healthDao.Checks), 1)
+	assert.Equal(t, healthDao.Checks[0].Name, "scheduler")
+	assert.Equal(t, healthDao.Checks[0].Message, "scheduler is not running")
+
+	// readiness checks do not impact the liveness
+	rr = serve(t, "/ws/v1/health/liveness")
+	assert.Equal(t, rr.Code, http.StatusOK)
+
+	running = true
+	rr = serve(t, "/ws/v1/health/readiness")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &healthDao))
+	assert.Equal(t, healthDao.Healthy, true)
+	assert.Equal(t, healthDao.Checks[0].Healthy, true)
+}
+
+func TestLogLevels(t *testing.T) {
+	initTestContext()
+	defer log.SetLevel(log.GetLevel())
+	log.SetLevel(zapcore.InfoLevel)
+
+	rr := serve(t, "/ws/v1/loglevel")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	var levelsDao dao.LogLevelDAOInfo
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &levelsDao))
+	assert.Equal(t, levelsDao.Level, "info")
+	assert.Equal(t, len(levelsDao.Components), len(log.GetComponentLevels()))
+
+	// override a component, then change the root level
+	rr = serveRequest(t, "PUT", "/ws/v1/loglevel/dispatcher", `{"level": "debug"}`)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	rr = serveRequest(t, "PUT", "/ws/v1/loglevel", `{"level": "warn"}`)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &levelsDao))
+	assert.Equal(t, levelsDao.Level, "warn")
+	for _, component := range levelsDao.Components {
+		if component.Name == log.Dispatcher {
+			assert.Equal(t, component.Level, "debug")
+			assert.Equal(t, component.Overridden, true)
+		} else {
+			assert.Equal(t, component.Level, "warn")
+			assert.Equal(t, component.Overridden, false)
+		}
+	}
+
+	// reset the component, it follows the root level again
+	rr = serveRequest(t, "DELETE", "/ws/v1/loglevel/dispatcher", "")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &levelsDao))
+	for _, component := range levelsDao.Components {
+		assert.Equal(t, component.Level, "warn")
+		assert.Equal(t, component.Overridden, false)
+	}
+
+	// invalid requests
+	rr = serveRequest(t, "PUT", "/ws/v1/loglevel", `{"level": "verbose"}`)
+	assert.Equal(t, rr.Code, http.StatusBadRequest)
+	rr = serveRequest(t, "PUT", "/ws/v1/loglevel", `level=debug`)
+	assert.Equal(t, rr.Code, http.StatusBadRequest)
+	rr = serveRequest(t, "PUT", "/ws/v1/loglevel/unknown", `{"level": "debug"}`)
+	assert.Equal(t, rr.Code, http.StatusNotFound)
+	rr = serveRequest(t, "DELETE", "/ws/v1/loglevel/unknown", "")
+	assert.Equal(t, rr.Code, http.StatusNotFound)
+	assert.Equal(t, log.GetLevel(), zapcore.WarnLevel)
+}
+
+func TestRouteAccess(t *testing.T) {
+	initTestContext()
+	defer log.SetLevel(log.GetLevel())
+
+	// the methods of the path are advertised
+	rr := serve(t, "/ws/v1/apps")
+	assert.Equal(t, rr.Header().Get("Access-Control-Allow-Methods"), "GET")
+	rr = serve(t, "/ws/v1/loglevel")
+	assert.Equal(t, rr.Header().Get("Access-Control-Allow-Methods"), "GET,PUT")
+	rr = serveRequest(t, "DELETE", "/ws/v1/loglevel/dispatcher", "")
+	assert.Equal(t, rr.Header().Get("Access-Control-Allow-Methods"), "PUT,DELETE")
+
+	// the state is only changed by local clients, remote clients can read it
+	testCases := []struct {
+		method     string
+		remoteAddr string
+		code       int
+	}{
+		{"PUT", "127.0.0.1:40000", http.StatusOK},
+		{"PUT", "[::1]:40000", http.StatusOK},
+		{"PUT", "10.0.0.1:40000", http.StatusForbidden},
+		{"GET", "10.0.0.1:40000", http.StatusOK},
+	}
+	for _, tc := range testCases {
+		req, err := http.NewRequest(tc.method, "/ws/v1/loglevel", strings.NewReader(`{"level": "debug"}`))
+		assert.NilError(t, err)
+		req.RemoteAddr = tc.remoteAddr
+		rr = httptest.NewRecorder()
+		NewRouter().ServeHTTP(rr, req)
+		assert.Equal(t, rr.Code, tc.code, tc.method+" from "+tc.remoteAddr)
+	}
+}
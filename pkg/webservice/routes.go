@@ -0,0 +1,149 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webservice
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type Route struct {
+	Name        string
+	Method      string
+	Pattern     string
+	HandlerFunc http.HandlerFunc
+}
+
+type Routes []Route
+
+// the routes with a method other than GET change the state of the shim,
+// they are only served to the clients on the same host.
+var routes = Routes{
+	// endpoints to retrieve applications and tasks known by the shim
+	Route{
+		"Shim",
+		"GET",
+		"/ws/v1/apps",
+		GetApplicationsInfo,
+	},
+	Route{
+		"Shim",
+		"GET",
+		"/ws/v1/apps/{appID}",
+		GetApplicationInfo,
+	},
+	Route{
+		"Shim",
+		"GET",
+		"/ws/v1/apps/{appID}/tasks/{taskID}",
+		GetTaskInfo,
+	},
+
+	// endpoint to explain why a task is pending, the node failures of the pod are aggregated by reason
+	Route{
+		"Shim",
+		"GET",
+		"/ws/v1/apps/{appID}/tasks/{taskID}/diagnostics",
+		GetTaskDiagnostics,
+	},
+	// endpoint to retrieve nodes known by the shim
+	Route{
+		"Shim",
+		"GET",
+		"/ws/v1/nodes",
+		GetNodesInfo,
+	},
+
+	// endpoint to dump the assumed pods in the scheduler cache
+	Route{
+		"Cache",
+		"GET",
+		"/ws/v1/cache/assumedpods",
+		GetAssumedPodsInfo,
+	},
+	// endpoints to compare the scheduler cache and the tasks with the informers, PUT also repairs them
+	Route{
+		"Cache",
+		"GET",
+		"/ws/v1/cache/consistency",
+		GetCacheConsistency,
+	},
+	Route{
+		"Cache",
+		"PUT",
+		"/ws/v1/cache/consistency",
+		HealCacheConsistency,
+	},
+
+	// endpoint to retrieve the shim configuration and the result of the latest reload
+	Route{
+		"Shim",
+		"GET",
+		"/ws/v1/config",
+		GetConfigInfo,
+	},
+
+	// endpoints to change the log levels at runtime, of the root logger or a component logger
+	Route{
+		"Log",
+		"GET",
+		"/ws/v1/loglevel",
+		GetLogLevels,
+	},
+	Route{
+		"Log",
+		"PUT",
+		"/ws/v1/loglevel",
+		SetLogLevel,
+	},
+	Route{
+		"Log",
+		"PUT",
+		"/ws/v1/loglevel/{component}",
+		SetComponentLogLevel,
+	},
+	Route{
+		"Log",
+		"DELETE",
+		"/ws/v1/loglevel/{component}",
+		ResetComponentLogLevel,
+	},
+
+	// endpoints for the kubernetes liveness and readiness probes
+	Route{
+		"Health",
+		"GET",
+		"/ws/v1/health/liveness",
+		GetLiveness,
+	},
+	Route{
+		"Health",
+		"GET",
+		"/ws/v1/health/readiness",
+		GetReadiness,
+	},
+
+	// endpoint to retrieve the shim metrics,
+	// this serves the default registry which has the core metrics registered too
+	Route{
+		"Shim",
+		"GET",
+		"/metrics",
+		promhttp.Handler().ServeHTTP,
+	},
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2020 Cloudera, Inc.  All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/cloudera/yunikorn-k8shim/pkg/cache"
+	"github.com/cloudera/yunikorn-k8shim/pkg/log"
+)
+
+// the web service exposes the shim internal state in REST endpoints, and allows changing
+// the log levels at runtime, it runs next to the scheduler core web service on its own port.
+// The web service has no authentication, the endpoints which change the state of the shim
+// are only served to the clients on the same host, e.g. through kubectl exec or port-forward.
+var gContext *cache.Context
+
+// health checks run by the liveness and readiness endpoints,
+// a check returns an error when the checked component is unhealthy.
+var gLivenessChecks []HealthCheck
+var gReadinessChecks []HealthCheck
+
+type HealthCheck struct {
+	Name  string
+	Check func() error
+}
+
+type WebService struct {
+	httpServer *http.Server
+	port       int
+}
+
+func NewRouter() *mux.Router {
+	router := mux.NewRouter().StrictSlash(true)
+	// the methods of each path, the CORS headers of a path advertise all of them
+	methods := make(map[string][]string)
+	for _, route := range routes {
+		methods[route.Pattern] = append(methods[route.Pattern], route.Method)
+	}
+	for _, route := range routes {
+		var handler http.Handler
+
+		handler = route.HandlerFunc
+		if route.Method != http.MethodGet {
+			handler = LocalOnly(handler)
+		}
+		handler = AllowMethods(handler, methods[route.Pattern])
+		handler = Logger(handler, route.Name)
+
+		router.
+			Methods(route.Method).
+			Path(route.Pattern).
+			Name(route.Name).
+			Handler(handler)
+	}
+	return router
+}
+
+func Logger(inner http.Handler, name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		inner.ServeHTTP(w, r)
+
+		log.Logger.Debug(fmt.Sprintf("%s\t%s\t%s\t%s",
+			r.Method, r.RequestURI, name, time.Since(start)))
+	})
+}
+
+// sets the methods allowed on the path of the route, before the handler writes the other headers
+func AllowMethods(inner http.Handler, methods []string) http.Handler {
+	allowed := strings.Join(methods, ",")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Methods", allowed)
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// rejects the requests which are not sent from the loopback interface,
+// the endpoints changing the state of the shim are not served to remote clients.
+func LocalOnly(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			log.Logger.Warn("rejected request from a remote client",
+				zap.String("method", r.Method),
+				zap.String("uri", r.RequestURI),
+				zap.String("remoteAddr", r.RemoteAddr))
+			http.Error(w, "this endpoint is only served to local clients", http.StatusForbidden)
+			return
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
+
+func NewWebApp(ctx *cache.Context, port int) *WebService {
+	gContext = ctx
+	gLivenessChecks = nil
+	gReadinessChecks = nil
+	return &WebService{
+		port: port,
+	}
+}
+
+// adds a check to the liveness endpoint, checks must be added before the web app starts
+func (m *WebService) AddLivenessCheck(name string, check func() error) {
+	gLivenessChecks = append(gLivenessChecks, HealthCheck{Name: name, Check: check})
+}
+
+// adds a check to the readiness endpoint, checks must be added before the web app starts
+func (m *WebService) AddReadinessCheck(name string, check func() error) {
+	gReadinessChecks = append(gReadinessChecks, HealthCheck{Name: name, Check: check})
+}
+
+func (m *WebService) StartWebApp() {
+	router := NewRouter()
+	m.httpServer = &http.Server{Addr: fmt.Sprintf(":%d", m.port), Handler: router}
+
+	log.Logger.Info("shim web-app started", zap.Int("port", m.port))
+	go func() {
+		httpError := m.httpServer.ListenAndServe()
+		if httpError != nil && httpError != http.ErrServerClosed {
+			log.Logger.Error("HTTP serving error",
+				zap.Error(httpError))
+		}
+	}()
+}
+
+func (m *WebService) StopWebApp() error {
+	if m.httpServer != nil {
+		// graceful shutdown in 5 seconds
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return m.httpServer.Shutdown(ctx)
+	}
+
+	return nil
+}